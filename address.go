@@ -0,0 +1,234 @@
+package wgquick
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// AddressOptions are additional netlink attributes of a single interface address
+type AddressOptions struct {
+	// Peer is the remote end of the point-to-point address, e.g. `Address = 10.0.0.1/32 peer 10.0.0.2/32`
+	Peer *net.IPNet
+	// NoPrefixRoute stops the kernel from adding the prefix route for the address, e.g. `Address = 10.0.0.1/24 noprefixroute`
+	NoPrefixRoute bool
+	// Metric is the metric of the prefix route the kernel adds for the address, e.g. `Address = 10.0.0.1/24 metric 100`
+	Metric int
+	// Label overrides Config.AddressLabel for the address, e.g. `Address = 10.0.0.1/24 label wg0:lan`. Labels apply to IPv4 only
+	Label string
+	// ValidLifetime and PreferredLifetime are the address lifetimes, 0 means forever. e.g. `Address = fd00::1/64 valid_lft 3600 preferred_lft 1800`
+	// Addresses with lifetimes are refreshed on every sync.
+	ValidLifetime     time.Duration
+	PreferredLifetime time.Duration
+}
+
+// parseAddress parses the address with its options, e.g. `10.0.0.1/32 peer 10.0.0.2/32`
+func parseAddress(s string) (net.IPNet, AddressOptions, error) {
+	var opts AddressOptions
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return net.IPNet{}, opts, fmt.Errorf("empty address")
+	}
+	addr, err := parseIPNet(fields[0])
+	if err != nil {
+		return net.IPNet{}, opts, err
+	}
+	for i := 1; i < len(fields); i++ {
+		option := fields[i]
+		if option == "noprefixroute" {
+			opts.NoPrefixRoute = true
+			continue
+		}
+		if i+1 >= len(fields) {
+			return net.IPNet{}, opts, fmt.Errorf("missing %s value", option)
+		}
+		i++
+		value := fields[i]
+		switch option {
+		case "peer":
+			peer, err := parseIPNet(value)
+			if err != nil {
+				return net.IPNet{}, opts, fmt.Errorf("cannot parse peer: %w", err)
+			}
+			opts.Peer = &peer
+		case "label":
+			opts.Label = value
+		case "metric":
+			metric, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return net.IPNet{}, opts, fmt.Errorf("cannot parse metric: %w", err)
+			}
+			opts.Metric = int(metric)
+		case "valid_lft", "preferred_lft":
+			lft, err := parseLifetime(value)
+			if err != nil {
+				return net.IPNet{}, opts, fmt.Errorf("cannot parse %s: %w", option, err)
+			}
+			if option == "valid_lft" {
+				opts.ValidLifetime = lft
+			} else {
+				opts.PreferredLifetime = lft
+			}
+		default:
+			return net.IPNet{}, opts, fmt.Errorf("unknown address option %s", option)
+		}
+	}
+	return addr, opts, nil
+}
+
+func parseLifetime(s string) (time.Duration, error) {
+	if s == "forever" {
+		return 0, nil
+	}
+	secs, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(secs) * time.Second, nil
+}
+
+// String formats the options as they're written after the address
+func (o AddressOptions) String() string {
+	var parts []string
+	if o.Peer != nil {
+		parts = append(parts, "peer", o.Peer.String())
+	}
+	if o.NoPrefixRoute {
+		parts = append(parts, "noprefixroute")
+	}
+	if o.Label != "" {
+		parts = append(parts, "label", o.Label)
+	}
+	if o.Metric != 0 {
+		parts = append(parts, "metric", strconv.Itoa(o.Metric))
+	}
+	if o.ValidLifetime != 0 {
+		parts = append(parts, "valid_lft", strconv.Itoa(toSeconds(o.ValidLifetime)))
+	}
+	if o.PreferredLifetime != 0 {
+		parts = append(parts, "preferred_lft", strconv.Itoa(toSeconds(o.PreferredLifetime)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// refresh reports whether the address has to be replaced on every sync, since its state can't be compared or it expires
+func (o AddressOptions) refresh() bool {
+	return o.Metric != 0 || o.ValidLifetime != 0 || o.PreferredLifetime != 0
+}
+
+// formatAddress formats the address together with its options
+func (cfg *Config) formatAddress(addr net.IPNet) string {
+	if opts := cfg.AddressOptions[addr.String()].String(); opts != "" {
+		return addr.String() + " " + opts
+	}
+	return addr.String()
+}
+
+// netlinkAddr returns the netlink address which should be assigned to the link for the config address
+func (cfg *Config) netlinkAddr(addr net.IPNet) *netlink.Addr {
+	opts := cfg.AddressOptions[addr.String()]
+	nlAddr := &netlink.Addr{
+		IPNet:       &addr,
+		Label:       cfg.addressLabel(addr),
+		Peer:        opts.Peer,
+		ValidLft:    toSeconds(opts.ValidLifetime),
+		PreferedLft: toSeconds(opts.PreferredLifetime),
+	}
+	if opts.NoPrefixRoute {
+		nlAddr.Flags |= unix.IFA_F_NOPREFIXROUTE
+	}
+	return nlAddr
+}
+
+// hasAddress reports whether the config has the address
+func (cfg *Config) hasAddress(addr net.IPNet) bool {
+	for _, a := range cfg.Address {
+		if a.String() == addr.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// addressLabel returns the label of the address. IPv6 addresses have no labels
+func (cfg *Config) addressLabel(addr net.IPNet) string {
+	if addr.IP.To4() == nil {
+		return ""
+	}
+	if label := cfg.AddressOptions[addr.String()].Label; label != "" {
+		return label
+	}
+	return cfg.AddressLabel
+}
+
+// addrMatches reports whether the present link address has the wanted attributes
+func addrMatches(present, wanted *netlink.Addr) bool {
+	if wanted.Peer != nil && (present.Peer == nil || present.Peer.String() != wanted.Peer.String()) {
+		return false
+	}
+	if wanted.Label != "" && present.Label != wanted.Label {
+		return false
+	}
+	if present.Flags&unix.IFA_F_NOPREFIXROUTE != wanted.Flags&unix.IFA_F_NOPREFIXROUTE {
+		return false
+	}
+	return true
+}
+
+// addrReplace adds or replaces the address over the sockets, including the prefix route metric which the netlink library
+// doesn't support. Equivalent to: `ip addr replace $addr dev $link metric $metric`
+func addrReplace(sockets map[int]*nl.SocketHandle, link netlink.Link, addr *netlink.Addr, metric int) error {
+	req := nl.NewNetlinkRequest(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_REPLACE|unix.NLM_F_ACK)
+	req.Sockets = sockets
+	family := nl.GetIPFamily(addr.IP)
+	msg := nl.NewIfAddrmsg(family)
+	msg.Index = uint32(link.Attrs().Index)
+	msg.Scope = uint8(addr.Scope)
+	prefixlen, _ := addr.Mask.Size()
+	msg.Prefixlen = uint8(prefixlen)
+	req.AddData(msg)
+
+	ipData := func(ip net.IP) []byte {
+		if family == nl.FAMILY_V4 {
+			return ip.To4()
+		}
+		return ip.To16()
+	}
+	local := ipData(addr.IP)
+	req.AddData(nl.NewRtAttr(unix.IFA_LOCAL, local))
+	if addr.Peer != nil {
+		req.AddData(nl.NewRtAttr(unix.IFA_ADDRESS, ipData(addr.Peer.IP)))
+	} else {
+		req.AddData(nl.NewRtAttr(unix.IFA_ADDRESS, local))
+	}
+	if addr.Flags != 0 {
+		req.AddData(nl.NewRtAttr(unix.IFA_FLAGS, nl.Uint32Attr(uint32(addr.Flags))))
+	}
+	if family == nl.FAMILY_V4 && addr.Label != "" {
+		req.AddData(nl.NewRtAttr(unix.IFA_LABEL, nl.ZeroTerminated(addr.Label)))
+	}
+	if addr.ValidLft > 0 || addr.PreferedLft > 0 {
+		cacheinfo := nl.IfaCacheInfo{
+			IfaValid:    uint32(addr.ValidLft),
+			IfaPrefered: uint32(addr.PreferedLft),
+		}
+		if cacheinfo.IfaValid == 0 {
+			cacheinfo.IfaValid = ^uint32(0) // forever
+		}
+		if cacheinfo.IfaPrefered == 0 {
+			cacheinfo.IfaPrefered = cacheinfo.IfaValid
+		}
+		req.AddData(nl.NewRtAttr(unix.IFA_CACHEINFO, cacheinfo.Serialize()))
+	}
+	if metric != 0 {
+		req.AddData(nl.NewRtAttr(unix.IFA_RT_PRIORITY, nl.Uint32Attr(uint32(metric))))
+	}
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
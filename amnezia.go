@@ -0,0 +1,136 @@
+package wgquick
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// AmneziaWG holds the AmneziaWG obfuscation parameters, making the handshake unrecognizable by DPI in the censored
+// networks. The zero values are unset. Both ends need the same S1, S2 and H1-H4, they only work with the amneziawg
+// implementations, see AmneziaWGConfigurer.
+type AmneziaWG struct {
+	// Jc is the number of the junk packets of random size between Jmin and Jmax sent before the handshake
+	Jc   int
+	Jmin int
+	Jmax int
+	// S1 and S2 are the junk bytes prepended to the handshake initiation and response
+	S1 int
+	S2 int
+	// H1-H4 replace the message type headers of the initiation, response, cookie and transport messages
+	H1 uint32
+	H2 uint32
+	H3 uint32
+	H4 uint32
+}
+
+// AmneziaWGConfigurer is implemented by the Wireguard implementations supporting the AmneziaWG parameters, e.g. UAPISocket
+// of amneziawg-go. The kernel wgctrl client doesn't, Sync fails for the configs with them.
+type AmneziaWGConfigurer interface {
+	// ConfigureDeviceAmneziaWG applies the device config together with the parameters in one request, so the device
+	// never handshakes with the peers without them
+	ConfigureDeviceAmneziaWG(name string, cfg wgtypes.Config, params AmneziaWG) error
+}
+
+// IsZero reports whether no parameter is set
+func (a AmneziaWG) IsZero() bool {
+	return a == AmneziaWG{}
+}
+
+// uapi returns the UAPI `set=1` lines of the set parameters
+func (a AmneziaWG) uapi() string {
+	b := &bytes.Buffer{}
+	for _, p := range a.params() {
+		if p.value != 0 {
+			fmt.Fprintf(b, "%s=%d\n", p.uapi, p.value)
+		}
+	}
+	return b.String()
+}
+
+type amneziaParam struct {
+	uapi  string
+	value uint64
+}
+
+func (a AmneziaWG) params() []amneziaParam {
+	return []amneziaParam{
+		{"jc", uint64(a.Jc)},
+		{"jmin", uint64(a.Jmin)},
+		{"jmax", uint64(a.Jmax)},
+		{"s1", uint64(a.S1)},
+		{"s2", uint64(a.S2)},
+		{"h1", uint64(a.H1)},
+		{"h2", uint64(a.H2)},
+		{"h3", uint64(a.H3)},
+		{"h4", uint64(a.H4)},
+	}
+}
+
+// parseLine parses the AmneziaWG [Interface] key
+func (a *AmneziaWG) parseLine(key, value string) error {
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return err
+	}
+	switch key {
+	case "Jc":
+		a.Jc = int(n)
+	case "Jmin":
+		a.Jmin = int(n)
+	case "Jmax":
+		a.Jmax = int(n)
+	case "S1":
+		a.S1 = int(n)
+	case "S2":
+		a.S2 = int(n)
+	case "H1":
+		a.H1 = uint32(n)
+	case "H2":
+		a.H2 = uint32(n)
+	case "H3":
+		a.H3 = uint32(n)
+	case "H4":
+		a.H4 = uint32(n)
+	}
+	return nil
+}
+
+// ConfigureDeviceAmneziaWG applies the config and the AmneziaWG parameters of amneziawg-go with one `set=1` request
+func (s *UAPISocket) ConfigureDeviceAmneziaWG(name string, cfg wgtypes.Config, params AmneziaWG) error {
+	_, err := s.request(uapiSet(cfg, params))
+	return err
+}
+
+// validate returns the problems of the parameters, following the amneziawg limits
+func (a AmneziaWG) validate() []string {
+	var problems []string
+	if a.Jc < 0 || a.Jc > 128 {
+		problems = append(problems, fmt.Sprintf("Jc %d out of range [0, 128]", a.Jc))
+	}
+	if a.Jmin < 0 || a.Jmax > 1280 || a.Jmin > a.Jmax {
+		problems = append(problems, fmt.Sprintf("junk size range [%d, %d] must be within [0, 1280]", a.Jmin, a.Jmax))
+	}
+	if a.S1 < 0 || a.S1 > 1132 {
+		problems = append(problems, fmt.Sprintf("S1 %d out of range [0, 1132]", a.S1))
+	}
+	if a.S2 < 0 || a.S2 > 1188 {
+		problems = append(problems, fmt.Sprintf("S2 %d out of range [0, 1188]", a.S2))
+	}
+	if (a.S1 != 0 || a.S2 != 0) && a.S1+56 == a.S2 {
+		problems = append(problems, "S1 + 56 must differ from S2, the padded handshake messages would have the same size")
+	}
+	seen := make(map[uint32]bool)
+	for _, h := range []uint32{a.H1, a.H2, a.H3, a.H4} {
+		if h == 0 {
+			continue
+		}
+		if seen[h] {
+			problems = append(problems, fmt.Sprintf("H1-H4 must be unique, %d repeats", h))
+		}
+		seen[h] = true
+	}
+	return problems
+}
@@ -0,0 +1,54 @@
+package wgquick
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const amneziaConfig = `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Jc = 4
+Jmin = 40
+Jmax = 70
+S1 = 15
+S2 = 92
+H1 = 1234567891
+H2 = 1234567892
+H3 = 1234567893
+H4 = 1234567894
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.0.0.2/32
+`
+
+func TestAmneziaWG(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(amneziaConfig)))
+	assert.Equal(t, AmneziaWG{Jc: 4, Jmin: 40, Jmax: 70, S1: 15, S2: 92, H1: 1234567891, H2: 1234567892, H3: 1234567893, H4: 1234567894}, c.AmneziaWG)
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, "jc=4\njmin=40\njmax=70\ns1=15\ns2=92\nh1=1234567891\nh2=1234567892\nh3=1234567893\nh4=1234567894\n", c.AmneziaWG.uapi())
+
+	port := 51820
+	assert.Equal(t, "set=1\nlisten_port=51820\njc=4\njmin=40\njmax=70\ns1=15\ns2=92\nh1=1234567891\nh2=1234567892\nh3=1234567893\nh4=1234567894\npublic_key="+hex.EncodeToString(c.Peers[0].PublicKey[:])+"\nallowed_ip=10.0.0.2/32\n\n",
+		uapiSet(wgtypes.Config{ListenPort: &port, Peers: c.Peers}, c.AmneziaWG), "the parameters are set with the device, before the peers")
+
+	text, err := c.MarshalText()
+	require.NoError(t, err)
+	parsed := &Config{}
+	require.NoError(t, parsed.UnmarshalText(text))
+	assert.Equal(t, c.AmneziaWG, parsed.AmneziaWG)
+
+	c.AmneziaWG.Jmin = 100
+	c.AmneziaWG.S2 = c.AmneziaWG.S1 + 56
+	c.AmneziaWG.H4 = c.AmneziaWG.H1
+	err = c.Validate()
+	require.Error(t, err)
+	assert.Len(t, err.(*ValidationError).Diagnostics, 3)
+
+	assert.Error(t, c.UnmarshalText([]byte("[Interface]\nJc = -1\n")))
+}
@@ -0,0 +1,209 @@
+package wgquick
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"syscall"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultAppMark is the firewall mark of the selected application traffic when AppRouting.Mark isn't set. It must
+	// differ from the tunnel FwMark, which marks the encrypted packets to keep them out of the tunnel.
+	DefaultAppMark = 0x77670001
+	// DefaultAppRulePriority is the priority of the `fwmark <mark> lookup <Table>` rule, before the source rules
+	DefaultAppRulePriority = 9000
+)
+
+// uidRangeRegexp matches the iptables owner match uid or uid range
+var uidRangeRegexp = regexp.MustCompile(`^[0-9]+(-[0-9]+)?$`)
+
+// AppRouting routes only the traffic of the selected applications via the tunnel: the packets of the processes in the
+// cgroups or of the users are marked by the iptables mangle rules and the policy rule looks up the marked ones in the
+// tunnel Table. The traffic leaving via the tunnel is masqueraded to the tunnel address, as its source was picked by
+// the main table. The replies pass the reverse path filter only with rp_filter 0 or 2 (loose) on the tunnel link.
+type AppRouting struct {
+	// Cgroups are the cgroup v2 paths relative to the cgroup root, e.g. `user.slice/user-1000.slice/app-firefox.scope`
+	Cgroups []string
+	// UIDs are the user ids or ranges, e.g. 1000 or 1000-1010
+	UIDs []string
+	// Mark is the firewall mark of the selected traffic, DefaultAppMark if 0
+	Mark int
+	// RulePriority is the priority of the policy rule, DefaultAppRulePriority if 0
+	RulePriority int
+}
+
+// validate checks the selected cgroups and uids are the plain paths and numbers the iptables matches expect
+func (a AppRouting) validate() error {
+	if len(a.Cgroups) == 0 && len(a.UIDs) == 0 {
+		return fmt.Errorf("app routing: no cgroups or uids selected")
+	}
+	for _, cgroup := range a.Cgroups {
+		if cgroup == "" || cgroup[0] == '-' || strings.IndexFunc(cgroup, unicode.IsSpace) >= 0 || strings.ContainsRune(cgroup, 0) {
+			return fmt.Errorf("app routing: invalid cgroup path %q", cgroup)
+		}
+		for _, elem := range strings.Split(cgroup, "/") {
+			if elem == ".." {
+				return fmt.Errorf("app routing: invalid cgroup path %q", cgroup)
+			}
+		}
+	}
+	for _, uid := range a.UIDs {
+		if !uidRangeRegexp.MatchString(uid) {
+			return fmt.Errorf("app routing: invalid uid %q, expected the number or range", uid)
+		}
+	}
+	return nil
+}
+
+func (a AppRouting) mark() int {
+	if a.Mark == 0 {
+		return DefaultAppMark
+	}
+	return a.Mark
+}
+
+// families returns the address families of the config addresses, the marked traffic of the others has no source
+// address to be masqueraded to
+func (cfg *Config) families() []int {
+	var v4, v6 bool
+	for _, addr := range cfg.Address {
+		if addr.IP.To4() != nil {
+			v4 = true
+		} else {
+			v6 = true
+		}
+	}
+	var families []int
+	if v4 {
+		families = append(families, unix.AF_INET)
+	}
+	if v6 {
+		families = append(families, unix.AF_INET6)
+	}
+	return families
+}
+
+// appRules returns the policy rules looking up the marked traffic in the config table
+func (a AppRouting) appRules(cfg *Config) []netlink.Rule {
+	priority := a.RulePriority
+	if priority == 0 {
+		priority = DefaultAppRulePriority
+	}
+	var rules []netlink.Rule
+	for _, family := range cfg.families() {
+		rule := netlink.NewRule()
+		rule.Family = family
+		rule.Priority = priority
+		rule.Mark = a.mark()
+		rule.Mask = 0xffffffff
+		rule.Table = int(cfg.Table)
+		rules = append(rules, *rule)
+	}
+	return rules
+}
+
+// appIptablesRules returns the iptables rules (without the action) marking the selected traffic and
+// masquerading it on the tunnel link, in the order they're added
+func (a AppRouting) appIptablesRules(cfg *Config, iface string) [][]string {
+	mark := fmt.Sprintf("0x%x", a.mark())
+	var rules [][]string
+	for _, family := range cfg.families() {
+		cmd := "iptables"
+		if family == unix.AF_INET6 {
+			cmd = "ip6tables"
+		}
+		for _, cgroup := range a.Cgroups {
+			rules = append(rules, []string{cmd, "-w", "-t", "mangle", "OUTPUT", "-m", "cgroup", "--path", cgroup, "-j", "MARK", "--set-mark", mark})
+		}
+		for _, uid := range a.UIDs {
+			rules = append(rules, []string{cmd, "-w", "-t", "mangle", "OUTPUT", "-m", "owner", "--uid-owner", uid, "-j", "MARK", "--set-mark", mark})
+		}
+		rules = append(rules, []string{cmd, "-w", "-t", "nat", "POSTROUTING", "-o", iface, "-m", "mark", "--mark", mark, "-j", "MASQUERADE"})
+	}
+	return rules
+}
+
+// EnableAppRouting starts routing the traffic of the selected applications via the tunnel, see AppRouting. The tunnel
+// must be up with a dedicated Table, typically with the default routes in AllowedIPs. Enabling it again is a no-op.
+// The rules are recorded in the state, so Down deletes them. On failure everything done so far is reverted.
+func (c *Client) EnableAppRouting(cfg *Config, iface string, apps AppRouting, logger logrus.FieldLogger) error {
+	log := logger.WithField("iface", iface)
+	cfg = cfg.clone()
+	cfg.FillDefaults()
+	if !cfg.dedicatedTable() {
+		return fmt.Errorf("app routing needs a dedicated routing table, got %v", cfg.Table)
+	}
+	if err := apps.validate(); err != nil {
+		return err
+	}
+	if cfg.FirewallMark != nil && *cfg.FirewallMark == apps.mark() {
+		return fmt.Errorf("app routing mark 0x%x is the tunnel FwMark", apps.mark())
+	}
+	rules, policyRules := apps.appIptablesRules(cfg, iface), apps.appRules(cfg)
+	if err := c.addIptablesRules(rules, "-A", log); err != nil {
+		return err
+	}
+	revert := func() {
+		c.deletePolicyRules(policyRules, log)
+		c.deleteIptablesRules(rules, log)
+	}
+	for _, rule := range policyRules {
+		rule := rule // make copy
+		if err := c.nl.RuleAdd(&rule); err != nil && err != syscall.EEXIST {
+			log.WithError(err).WithField("rule", rule.String()).Error("cannot add rule")
+			revert()
+			return err
+		}
+	}
+	err := c.recordFirewallRules(iface, rules, nil, log)
+	if err == nil {
+		err = c.recordPolicyRules(iface, policyRules, nil, log)
+	}
+	if err != nil {
+		revert()
+		return err
+	}
+	log.WithFields(map[string]interface{}{"cgroups": apps.Cgroups, "uids": apps.UIDs}).Info("app routing enabled")
+	return nil
+}
+
+// DisableAppRouting deletes the rules added by EnableAppRouting, skipping the ones which are already gone. Down
+// deletes them too, as long as the state files are enabled.
+func (c *Client) DisableAppRouting(cfg *Config, iface string, apps AppRouting, logger logrus.FieldLogger) error {
+	log := logger.WithField("iface", iface)
+	cfg = cfg.clone()
+	cfg.FillDefaults()
+	rules, policyRules := apps.appIptablesRules(cfg, iface), apps.appRules(cfg)
+	c.deleteIptablesRules(rules, log)
+	if err := c.deletePolicyRules(policyRules, log); err != nil {
+		return err
+	}
+	if err := c.recordFirewallRules(iface, nil, rules, log); err != nil {
+		return err
+	}
+	if err := c.recordPolicyRules(iface, nil, policyRules, log); err != nil {
+		return err
+	}
+	log.Info("app routing disabled")
+	return nil
+}
+
+// deletePolicyRules deletes the policy rules, ignoring already deleted ones
+func (c *Client) deletePolicyRules(rules []netlink.Rule, log logrus.FieldLogger) error {
+	for _, rule := range rules {
+		rule := rule // make copy
+		log := log.WithField("rule", rule.String())
+		if err := c.nl.RuleDel(&rule); err != nil && err != syscall.ENOENT {
+			log.WithError(err).Error("cannot delete rule")
+			return err
+		}
+		log.Info("rule deleted")
+	}
+	return nil
+}
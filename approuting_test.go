@@ -0,0 +1,68 @@
+package wgquick
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestAppRoutingRules(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	c.Table = 1234
+	c.Address = c.Address[:0]
+	addr, err := parseIPNet("10.200.100.8/24")
+	require.NoError(t, err)
+	c.Address = append(c.Address, addr)
+
+	apps := AppRouting{Cgroups: []string{"user.slice/app-firefox.scope"}, UIDs: []string{"1000-1010"}}
+	var cmds []string
+	for _, rule := range apps.appIptablesRules(c, "wg0") {
+		cmds = append(cmds, strings.Join(iptablesArgs(rule, "-A"), " "))
+	}
+	assert.Equal(t, []string{
+		"iptables -w -t mangle -A OUTPUT -m cgroup --path user.slice/app-firefox.scope -j MARK --set-mark 0x77670001",
+		"iptables -w -t mangle -A OUTPUT -m owner --uid-owner 1000-1010 -j MARK --set-mark 0x77670001",
+		"iptables -w -t nat -A POSTROUTING -o wg0 -m mark --mark 0x77670001 -j MASQUERADE",
+	}, cmds, "no IPv6 address, no ip6tables rules")
+
+	rules := apps.appRules(c)
+	require.Len(t, rules, 1)
+	assert.Equal(t, unix.AF_INET, rules[0].Family)
+	assert.Equal(t, DefaultAppRulePriority, rules[0].Priority)
+	assert.Equal(t, DefaultAppMark, rules[0].Mark)
+	assert.Equal(t, 1234, rules[0].Table)
+
+	apps.Mark, apps.RulePriority = 7, 100
+	rules = apps.appRules(c)
+	assert.Equal(t, 7, rules[0].Mark)
+	assert.Equal(t, 100, rules[0].Priority)
+}
+
+func TestAppRoutingValidate(t *testing.T) {
+	assert.NoError(t, AppRouting{Cgroups: []string{"user.slice/app-firefox.scope"}, UIDs: []string{"1000", "1000-1010"}}.validate())
+	assert.Error(t, AppRouting{}.validate())
+	for _, apps := range []AppRouting{
+		{Cgroups: []string{"app.scope; reboot"}},
+		{Cgroups: []string{"--help"}},
+		{Cgroups: []string{"user.slice/../system.slice"}},
+		{UIDs: []string{"1000 -j ACCEPT"}},
+		{UIDs: []string{"root"}},
+	} {
+		assert.Error(t, apps.validate(), "%v", apps)
+	}
+}
+
+func TestStateRule(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	c.Table = 1234
+	rules := (AppRouting{UIDs: []string{"1000"}}).appRules(c)
+	require.NotEmpty(t, rules)
+	for _, rule := range rules {
+		assert.Equal(t, rule.String(), newStateRule(rule).netlinkRule().String())
+	}
+}
@@ -0,0 +1,272 @@
+package wgquick
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// AuditEvent is a single mutation done by the client: a link, address, route, rule or neighbor change, the device
+// or peer configuration, a sysctl or resolv.conf write, or a hook or DNS command run
+type AuditEvent struct {
+	Time time.Time
+	// Op is the operation, e.g. "replace route" or "run hook"
+	Op string
+	// Subject is the changed object, e.g. "10.0.0.0/24 dev 7 table 254" or the hook command. Secrets are never included
+	Subject string
+	// Err is the outcome of the operation, nil if it succeeded
+	Err error
+}
+
+func (e AuditEvent) String() string {
+	s := fmt.Sprintf("%s %s %s", e.Time.Format(time.RFC3339Nano), e.Op, e.Subject)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// AuditSink receives the audit events, e.g. to ship them to the security team log collector. It's called synchronously
+// by the operations, concurrently with ParallelSync or the bulk operations.
+type AuditSink interface {
+	Audit(e AuditEvent)
+}
+
+// AuditFunc is the function implementing AuditSink
+type AuditFunc func(e AuditEvent)
+
+// Audit calls f
+func (f AuditFunc) Audit(e AuditEvent) {
+	f(e)
+}
+
+// WithAuditSink records every mutation done by the client into the sink, successful or not, so it's possible to
+// reconstruct exactly what was done on the host
+func WithAuditSink(sink AuditSink) ClientOption {
+	return func(c *Client) {
+		c.audit = sink
+	}
+}
+
+// record sends the event to the audit sink, if any
+func (c *Client) record(op, subject string, err error) {
+	if c.audit != nil {
+		c.audit.Audit(AuditEvent{Time: time.Now(), Op: op, Subject: subject, Err: err})
+	}
+}
+
+// kernelNetlink reports whether the client uses the kernel netlink, not e.g. the fake one
+func (c *Client) kernelNetlink() bool {
+	nl := c.nl
+	if a, ok := nl.(auditNetlink); ok {
+		nl = a.Netlink
+	}
+	_, ok := nl.(netlinkHandle)
+	return ok
+}
+
+// runHook runs the hook with execHook, recording it
+func (c *Client) runHook(cfg *Config, hook string, iface string, log logrus.FieldLogger) error {
+	err := execHook(cfg, hook, iface, log)
+	c.record("run hook", hook, err)
+	return err
+}
+
+// runSh runs the command with execSh, recording it
+func (c *Client) runSh(command string, iface string, log logrus.FieldLogger, stdin ...string) error {
+	err := execSh(command, iface, log, stdin...)
+	c.record("run command", command, err)
+	return err
+}
+
+// runCommand runs the command without a shell, so the arguments need no quoting
+func (c *Client) runCommand(args []string, log logrus.FieldLogger) error {
+	err := execCommand(exec.Command(args[0], args[1:]...), log)
+	c.record("run command", strings.Join(args, " "), err)
+	return err
+}
+
+// recordDevice records the device configuration and every configured or removed peer in it
+func (c *Client) recordDevice(name string, update wgtypes.Config, err error) {
+	if c.audit == nil {
+		return
+	}
+	subject := name
+	if update.PrivateKey != nil {
+		subject += " " + publicKeyOf(update.PrivateKey)
+	}
+	if update.ListenPort != nil {
+		subject += fmt.Sprintf(" listen-port %d", *update.ListenPort)
+	}
+	if update.FirewallMark != nil {
+		subject += fmt.Sprintf(" fwmark %d", *update.FirewallMark)
+	}
+	c.record("configure device", subject, err)
+	for _, p := range update.Peers {
+		subject := name + " peer " + serializeKey(&p.PublicKey)
+		if p.Remove {
+			c.record("remove peer", subject, err)
+			continue
+		}
+		if len(p.AllowedIPs) > 0 {
+			subject += fmt.Sprintf(" allowed-ips %v", p.AllowedIPs)
+		}
+		if p.Endpoint != nil {
+			subject += " endpoint " + p.Endpoint.String()
+		}
+		c.record("configure peer", subject, err)
+	}
+}
+
+// auditNetlink records the mutations done with the netlink
+type auditNetlink struct {
+	Netlink
+	c *Client
+}
+
+func linkSubject(link netlink.Link) string {
+	return link.Attrs().Name
+}
+
+func addrSubject(link netlink.Link, addr *netlink.Addr) string {
+	return fmt.Sprintf("%s dev %s", addr.IPNet, link.Attrs().Name)
+}
+
+func routeSubject(rt *netlink.Route) string {
+	s := fmt.Sprintf("%s", rt.Dst)
+	if rt.Gw != nil {
+		s += " via " + rt.Gw.String()
+	}
+	s += fmt.Sprintf(" dev %d table %d", rt.LinkIndex, rt.Table)
+	if rt.Type != 0 {
+		s += fmt.Sprintf(" type %d", rt.Type)
+	}
+	if rt.Priority != 0 {
+		s += fmt.Sprintf(" metric %d", rt.Priority)
+	}
+	if rt.MTU != 0 {
+		s += fmt.Sprintf(" mtu %d", rt.MTU)
+	}
+	return s
+}
+
+func neighSubject(n *netlink.Neigh) string {
+	return fmt.Sprintf("%s dev %d", n.IP, n.LinkIndex)
+}
+
+func (a auditNetlink) LinkAdd(link netlink.Link) error {
+	err := a.Netlink.LinkAdd(link)
+	a.c.record("add link", linkSubject(link), err)
+	return err
+}
+
+func (a auditNetlink) LinkDel(link netlink.Link) error {
+	err := a.Netlink.LinkDel(link)
+	a.c.record("delete link", linkSubject(link), err)
+	return err
+}
+
+func (a auditNetlink) LinkSetUp(link netlink.Link) error {
+	err := a.Netlink.LinkSetUp(link)
+	a.c.record("set link up", linkSubject(link), err)
+	return err
+}
+
+func (a auditNetlink) LinkSetAlias(link netlink.Link, name string) error {
+	err := a.Netlink.LinkSetAlias(link, name)
+	a.c.record("set link alias", fmt.Sprintf("%s alias %q", linkSubject(link), name), err)
+	return err
+}
+
+func (a auditNetlink) LinkSetTxQLen(link netlink.Link, qlen int) error {
+	err := a.Netlink.LinkSetTxQLen(link, qlen)
+	a.c.record("set link txqueuelen", fmt.Sprintf("%s txqueuelen %d", linkSubject(link), qlen), err)
+	return err
+}
+
+func (a auditNetlink) LinkSetGroup(link netlink.Link, group uint32) error {
+	err := a.Netlink.LinkSetGroup(link, group)
+	a.c.record("set link group", fmt.Sprintf("%s group %d", linkSubject(link), group), err)
+	return err
+}
+
+func (a auditNetlink) AddrAdd(link netlink.Link, addr *netlink.Addr) error {
+	err := a.Netlink.AddrAdd(link, addr)
+	a.c.record("add address", addrSubject(link, addr), err)
+	return err
+}
+
+func (a auditNetlink) AddrDel(link netlink.Link, addr *netlink.Addr) error {
+	err := a.Netlink.AddrDel(link, addr)
+	a.c.record("delete address", addrSubject(link, addr), err)
+	return err
+}
+
+func (a auditNetlink) AddrReplaceMetric(link netlink.Link, addr *netlink.Addr, metric int) error {
+	err := a.Netlink.AddrReplaceMetric(link, addr, metric)
+	a.c.record("replace address", fmt.Sprintf("%s metric %d", addrSubject(link, addr), metric), err)
+	return err
+}
+
+func (a auditNetlink) RouteReplace(route *netlink.Route) error {
+	err := a.Netlink.RouteReplace(route)
+	a.c.record("replace route", routeSubject(route), err)
+	return err
+}
+
+func (a auditNetlink) RouteReplaceMTULock(route *netlink.Route) error {
+	err := a.Netlink.RouteReplaceMTULock(route)
+	a.c.record("replace route", routeSubject(route)+" lock", err)
+	return err
+}
+
+// RouteReplaceBatch batches the routes if the wrapped Netlink supports it and replaces them one by one otherwise
+func (a auditNetlink) RouteReplaceBatch(routes []netlink.Route) []error {
+	var errs []error
+	if b, ok := a.Netlink.(RouteBatcher); ok {
+		errs = b.RouteReplaceBatch(routes)
+	} else {
+		for i := range routes {
+			errs = append(errs, a.Netlink.RouteReplace(&routes[i]))
+		}
+	}
+	for i := range routes {
+		a.c.record("replace route", routeSubject(&routes[i]), errs[i])
+	}
+	return errs
+}
+
+func (a auditNetlink) RouteDel(route *netlink.Route) error {
+	err := a.Netlink.RouteDel(route)
+	a.c.record("delete route", routeSubject(route), err)
+	return err
+}
+
+func (a auditNetlink) RuleAdd(rule *netlink.Rule) error {
+	err := a.Netlink.RuleAdd(rule)
+	a.c.record("add rule", rule.String(), err)
+	return err
+}
+
+func (a auditNetlink) RuleDel(rule *netlink.Rule) error {
+	err := a.Netlink.RuleDel(rule)
+	a.c.record("delete rule", rule.String(), err)
+	return err
+}
+
+func (a auditNetlink) NeighSet(neigh *netlink.Neigh) error {
+	err := a.Netlink.NeighSet(neigh)
+	a.c.record("set neighbor", neighSubject(neigh), err)
+	return err
+}
+
+func (a auditNetlink) NeighDel(neigh *netlink.Neigh) error {
+	err := a.Netlink.NeighDel(neigh)
+	a.c.record("delete neighbor", neighSubject(neigh), err)
+	return err
+}
@@ -0,0 +1,43 @@
+package wgquick_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditSink(t *testing.T) {
+	var mu sync.Mutex
+	var events []wgquick.AuditEvent
+	sink := wgquick.AuditFunc(func(e wgquick.AuditEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})
+	c, _, _ := newFakeClient(t, wgquick.WithAuditSink(sink))
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.PostUp = "true"
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	require.NoError(t, c.Down(cfg, "wg0", testLog))
+
+	ops := make(map[string]int)
+	for _, e := range events {
+		assert.False(t, e.Time.IsZero())
+		assert.NoError(t, e.Err)
+		assert.NotContains(t, e.Subject, "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=")
+		ops[e.Op]++
+	}
+	assert.Equal(t, 1, ops["add link"])
+	assert.Equal(t, 2, ops["add address"])
+	assert.Equal(t, 1, ops["configure device"])
+	assert.Equal(t, 2, ops["configure peer"])
+	assert.Equal(t, 4, ops["replace route"])
+	assert.Equal(t, 1, ops["run hook"])
+	assert.Equal(t, 1, ops["delete link"])
+}
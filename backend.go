@@ -0,0 +1,128 @@
+package wgquick
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Netlink is the subset of the link, address, route and rule operations the Client uses. NewNetlink implements it with the
+// netlink handle, the fake package in memory for the tests without privileges.
+type Netlink interface {
+	LinkList() ([]netlink.Link, error)
+	LinkByName(name string) (netlink.Link, error)
+	LinkAdd(link netlink.Link) error
+	LinkDel(link netlink.Link) error
+	LinkSetUp(link netlink.Link) error
+	LinkSetAlias(link netlink.Link, name string) error
+	LinkSetTxQLen(link netlink.Link, qlen int) error
+	// LinkSetGroup is equivalent to: `ip link set $link group $group`
+	LinkSetGroup(link netlink.Link, group uint32) error
+
+	AddrList(link netlink.Link, family int) ([]netlink.Addr, error)
+	AddrAdd(link netlink.Link, addr *netlink.Addr) error
+	AddrDel(link netlink.Link, addr *netlink.Addr) error
+	// AddrReplaceMetric is equivalent to: `ip addr replace $addr dev $link metric $metric`
+	AddrReplaceMetric(link netlink.Link, addr *netlink.Addr, metric int) error
+
+	RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error)
+	RouteReplace(route *netlink.Route) error
+	// RouteReplaceMTULock is equivalent to: `ip route replace $route mtu lock $mtu`
+	RouteReplaceMTULock(route *netlink.Route) error
+	RouteDel(route *netlink.Route) error
+
+	RuleList(family int) ([]netlink.Rule, error)
+	RuleAdd(rule *netlink.Rule) error
+	RuleDel(rule *netlink.Rule) error
+
+	NeighSet(neigh *netlink.Neigh) error
+	NeighDel(neigh *netlink.Neigh) error
+}
+
+// RouteBatcher is implemented by the Netlink implementations able to add or replace many routes at once, e.g. NewNetlink.
+// Sync uses it for the routes of the configs with thousands of peers, where a request per route takes seconds.
+type RouteBatcher interface {
+	// RouteReplaceBatch is RouteReplace of all the routes, returning the error of every route. A failed route doesn't
+	// stop the others.
+	RouteReplaceBatch(routes []netlink.Route) []error
+}
+
+// Wireguard is the subset of the wgctrl client operations the Client uses, implemented by *wgctrl.Client
+type Wireguard interface {
+	Device(name string) (*wgtypes.Device, error)
+	ConfigureDevice(name string, cfg wgtypes.Config) error
+	Close() error
+}
+
+// isLinkNotFound reports whether LinkByName failed because the link doesn't exist. Netlink implementations other than
+// the netlink handle report it as syscall.ENODEV, as netlink.LinkNotFoundError can't be created outside the netlink package.
+func isLinkNotFound(err error) bool {
+	_, ok := err.(netlink.LinkNotFoundError)
+	return ok || err == syscall.ENODEV
+}
+
+// netlinkHandle implements Netlink with the netlink handle, adding the operations the netlink library doesn't support
+type netlinkHandle struct {
+	*netlink.Handle
+	// ns is the network namespace of the handle, the raw requests and the subscriptions are done in it
+	ns netns.NsHandle
+}
+
+// NewNetlink returns the Netlink using the handle created in the network namespace ns, e.g. with netlink.NewHandleAt(ns).
+// netns.None() is the calling thread's namespace, the one of netlink.NewHandle. Both stay owned by the caller.
+func NewNetlink(h *netlink.Handle, ns netns.NsHandle) Netlink {
+	return netlinkHandle{Handle: h, ns: ns}
+}
+
+func (h netlinkHandle) LinkSetGroup(link netlink.Link, group uint32) error {
+	return h.withSocket(func(s *nl.NetlinkSocket) error {
+		return linkSetGroup(socketHandles(s), link, group)
+	})
+}
+
+func (h netlinkHandle) RouteReplaceMTULock(route *netlink.Route) error {
+	return h.withSocket(func(s *nl.NetlinkSocket) error {
+		return routeReplaceMTULock(socketHandles(s), route)
+	})
+}
+
+func (h netlinkHandle) RouteReplaceBatch(routes []netlink.Route) []error {
+	var errs []error
+	if err := h.withSocket(func(s *nl.NetlinkSocket) error {
+		errs = routeReplaceBatch(s, routes)
+		return nil
+	}); err != nil {
+		errs = make([]error, len(routes))
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+func (h netlinkHandle) AddrReplaceMetric(link netlink.Link, addr *netlink.Addr, metric int) error {
+	return h.withSocket(func(s *nl.NetlinkSocket) error {
+		return addrReplace(socketHandles(s), link, addr, metric)
+	})
+}
+
+// withSocket calls f with the new route socket in the handle namespace, for the raw requests the netlink library
+// doesn't support
+func (h netlinkHandle) withSocket(f func(s *nl.NetlinkSocket) error) error {
+	s, err := nl.GetNetlinkSocketAt(h.ns, netns.None(), unix.NETLINK_ROUTE)
+	if err != nil {
+		return fmt.Errorf("cannot open netlink socket: %w", err)
+	}
+	defer s.Close()
+	return f(s)
+}
+
+// socketHandles returns the sockets of the raw request, see nl.NetlinkRequest.Sockets
+func socketHandles(s *nl.NetlinkSocket) map[int]*nl.SocketHandle {
+	return map[int]*nl.SocketHandle{unix.NETLINK_ROUTE: {Socket: s}}
+}
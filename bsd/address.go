@@ -0,0 +1,94 @@
+//go:build freebsd || openbsd
+// +build freebsd openbsd
+
+package bsd
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Ifconfig is the ifconfig binary
+var Ifconfig = "ifconfig"
+
+func family(ip net.IP) string {
+	if ip.To4() != nil {
+		return "inet"
+	}
+	return "inet6"
+}
+
+func ifconfig(args ...string) error {
+	out, err := exec.Command(Ifconfig, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", Ifconfig, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ifconfigCmd is the ifconfig run changing the address
+type ifconfigCmd struct {
+	addr string
+	args []string
+}
+
+// addrCommands returns the ifconfig runs adding the wanted addresses missing in present, in the wanted order, and
+// deleting the present ones not wanted, except the IPv6 link-local ones
+func addrCommands(iface string, present []net.Addr, want []net.IPNet) (add, del []ifconfigCmd) {
+	isPresent := make(map[string]bool, len(present))
+	var owned []*net.IPNet
+	for _, a := range present {
+		if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLinkLocalUnicast() {
+			isPresent[ipnet.String()] = true
+			owned = append(owned, ipnet)
+		}
+	}
+	wanted := make(map[string]bool, len(want))
+	for _, addr := range want {
+		wanted[addr.String()] = true
+		if !isPresent[addr.String()] {
+			add = append(add, ifconfigCmd{addr: addr.String(), args: []string{iface, family(addr.IP), addr.String(), "alias"}})
+		}
+	}
+	for _, ipnet := range owned {
+		if !wanted[ipnet.String()] {
+			del = append(del, ifconfigCmd{addr: ipnet.String(), args: []string{iface, family(ipnet.IP), ipnet.IP.String(), "-alias"}})
+		}
+	}
+	return add, del
+}
+
+// SyncAddress adds the wanted addresses to the interface and deletes the other ones, except the IPv6 link-local ones
+func SyncAddress(iface string, want []net.IPNet, log logrus.FieldLogger) error {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		log.WithError(err).Error("cannot read link address")
+		return err
+	}
+	add, del := addrCommands(iface, addrs, want)
+	for _, cmd := range add {
+		log := log.WithField("addr", cmd.addr)
+		if err := ifconfig(cmd.args...); err != nil {
+			log.WithError(err).Error("cannot add addr")
+			return err
+		}
+		log.Info("address added")
+	}
+	for _, cmd := range del {
+		log := log.WithField("addr", cmd.addr)
+		if err := ifconfig(cmd.args...); err != nil {
+			log.WithError(err).Error("cannot delete addr")
+			return err
+		}
+		log.Info("addr deleted")
+	}
+	return nil
+}
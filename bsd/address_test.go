@@ -0,0 +1,42 @@
+//go:build freebsd || openbsd
+// +build freebsd openbsd
+
+package bsd
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ipNet(t *testing.T, s string) *net.IPNet {
+	ip, ipnet, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	ipnet.IP = ip
+	return ipnet
+}
+
+func TestAddrCommands(t *testing.T) {
+	present := []net.Addr{
+		ipNet(t, "10.0.0.1/24"),
+		ipNet(t, "10.0.1.1/24"),
+		ipNet(t, "fe80::1/64"),
+		ipNet(t, "fd00::1/64"),
+	}
+	want := []net.IPNet{*ipNet(t, "fd00::2/64"), *ipNet(t, "10.0.0.1/24"), *ipNet(t, "10.0.2.1/32")}
+	add, del := addrCommands("wg0", present, want)
+	assert.Equal(t, []ifconfigCmd{
+		{addr: "fd00::2/64", args: []string{"wg0", "inet6", "fd00::2/64", "alias"}},
+		{addr: "10.0.2.1/32", args: []string{"wg0", "inet", "10.0.2.1/32", "alias"}},
+	}, add, "the missing ones in the wanted order")
+	assert.Equal(t, []ifconfigCmd{
+		{addr: "10.0.1.1/24", args: []string{"wg0", "inet", "10.0.1.1", "-alias"}},
+		{addr: "fd00::1/64", args: []string{"wg0", "inet6", "fd00::1", "-alias"}},
+	}, del, "the link-local address is kept")
+
+	add, del = addrCommands("wg0", present[:1], want[1:2])
+	assert.Empty(t, add)
+	assert.Empty(t, del)
+}
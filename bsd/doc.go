@@ -0,0 +1,7 @@
+// Package bsd reconciles the wireguard interface addresses and routes on FreeBSD and OpenBSD, mirroring the
+// SyncAddress and SyncRoutes semantics of the linux netlink implementation: the wanted ones are added, the other ones
+// owned by the interface deleted.
+//
+// The routes are listed and changed with the route socket. The addresses are changed with ifconfig(8), as wg-quick does,
+// since the SIOCAIFADDR ioctl structures differ between the BSDs and their releases.
+package bsd
@@ -0,0 +1,190 @@
+//go:build freebsd || openbsd
+// +build freebsd openbsd
+
+package bsd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/route"
+	"golang.org/x/sys/unix"
+)
+
+// seq numbers the route socket messages
+var seq int32
+
+// ifaceRoute is the static route over the interface, without a gateway
+type ifaceRoute struct {
+	dst net.IPNet
+}
+
+// ipAddr returns the route socket address of the IP
+func ipAddr(ip net.IP) route.Addr {
+	if ip4 := ip.To4(); ip4 != nil {
+		a := &route.Inet4Addr{}
+		copy(a.IP[:], ip4)
+		return a
+	}
+	a := &route.Inet6Addr{}
+	copy(a.IP[:], ip.To16())
+	return a
+}
+
+// addrIP returns the IP of the route socket address, nil for the other address types
+func addrIP(a route.Addr) net.IP {
+	switch a := a.(type) {
+	case *route.Inet4Addr:
+		return net.IP(a.IP[:]).To16()
+	case *route.Inet6Addr:
+		return net.IP(a.IP[:])
+	}
+	return nil
+}
+
+// listRoutes returns the static routes over the interface without a gateway, i.e. the ones SyncRoutes owns
+func listRoutes(ifi *net.Interface) ([]ifaceRoute, error) {
+	b, err := route.FetchRIB(unix.AF_UNSPEC, route.RIBTypeRoute, 0)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := route.ParseRIB(route.RIBTypeRoute, b)
+	if err != nil {
+		return nil, err
+	}
+	return ownedRoutes(msgs, ifi.Index), nil
+}
+
+// ownedRoutes returns the static routes without a gateway over the interface with the index of the route messages
+func ownedRoutes(msgs []route.Message, index int) []ifaceRoute {
+	var routes []ifaceRoute
+	for _, m := range msgs {
+		rm, ok := m.(*route.RouteMessage)
+		if !ok || rm.Index != index || rm.Flags&unix.RTF_STATIC == 0 || rm.Flags&unix.RTF_GATEWAY != 0 {
+			continue
+		}
+		if len(rm.Addrs) <= unix.RTAX_DST {
+			continue
+		}
+		ip := addrIP(rm.Addrs[unix.RTAX_DST])
+		if ip == nil {
+			continue
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		mask := net.CIDRMask(bits, bits)
+		if len(rm.Addrs) > unix.RTAX_NETMASK && rm.Flags&unix.RTF_HOST == 0 {
+			if m := addrIP(rm.Addrs[unix.RTAX_NETMASK]); m != nil {
+				if bits == 8*net.IPv4len {
+					m = m.To4()
+				}
+				mask = net.IPMask(m)
+			}
+		}
+		routes = append(routes, ifaceRoute{dst: net.IPNet{IP: ip, Mask: mask}})
+	}
+	return routes
+}
+
+// routeMessage returns the route message of the type (RTM_ADD or RTM_DELETE) for the route over the interface
+func routeMessage(typ int, ifi *net.Interface, dst net.IPNet, id uintptr, seq int) *route.RouteMessage {
+	flags := unix.RTF_UP | unix.RTF_STATIC
+	addrs := make([]route.Addr, unix.RTAX_NETMASK+1)
+	addrs[unix.RTAX_DST] = ipAddr(dst.IP)
+	addrs[unix.RTAX_GATEWAY] = &route.LinkAddr{Index: ifi.Index, Name: ifi.Name}
+	if ones, bits := dst.Mask.Size(); ones == bits {
+		flags |= unix.RTF_HOST
+		addrs = addrs[:unix.RTAX_GATEWAY+1]
+	} else {
+		addrs[unix.RTAX_NETMASK] = ipAddr(net.IP(dst.Mask))
+	}
+	return &route.RouteMessage{
+		Version: unix.RTM_VERSION,
+		Type:    typ,
+		Flags:   flags,
+		Index:   ifi.Index,
+		ID:      id,
+		Seq:     seq,
+		Addrs:   addrs,
+	}
+}
+
+// writeRoute sends the route message of the type (RTM_ADD or RTM_DELETE) for the route over the interface
+func writeRoute(typ int, ifi *net.Interface, dst net.IPNet) error {
+	b, err := routeMessage(typ, ifi, dst, uintptr(os.Getpid()), int(atomic.AddInt32(&seq, 1))).Marshal()
+	if err != nil {
+		return err
+	}
+	fd, err := unix.Socket(unix.AF_ROUTE, unix.SOCK_RAW, unix.AF_UNSPEC)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	defer unix.Close(fd)
+	if _, err := unix.Write(fd, b); err != nil {
+		return os.NewSyscallError("write", err)
+	}
+	return nil
+}
+
+// routeChanges returns the wanted routes missing in present, as the network addresses the route socket wants and in
+// the wanted order, and the present ones not wanted
+func routeChanges(present []ifaceRoute, want []net.IPNet) (add, del []net.IPNet) {
+	isPresent := make(map[string]bool, len(present))
+	for _, rt := range present {
+		isPresent[rt.dst.String()] = true
+	}
+	wanted := make(map[string]bool, len(want))
+	for _, dst := range want {
+		dst = net.IPNet{IP: dst.IP.Mask(dst.Mask), Mask: dst.Mask}
+		if wanted[dst.String()] {
+			continue
+		}
+		wanted[dst.String()] = true
+		if !isPresent[dst.String()] {
+			add = append(add, dst)
+		}
+	}
+	for _, rt := range present {
+		if !wanted[rt.dst.String()] {
+			del = append(del, rt.dst)
+		}
+	}
+	return add, del
+}
+
+// SyncRoutes adds the wanted routes over the interface and deletes the other static ones without a gateway
+func SyncRoutes(iface string, want []net.IPNet, log logrus.FieldLogger) error {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return err
+	}
+	present, err := listRoutes(ifi)
+	if err != nil {
+		log.WithError(err).Error("cannot read existing routes")
+		return err
+	}
+	add, del := routeChanges(present, want)
+	for _, dst := range add {
+		log := log.WithField("route", dst.String())
+		if err := writeRoute(unix.RTM_ADD, ifi, dst); err != nil && !errors.Is(err, unix.EEXIST) {
+			log.WithError(err).Error("cannot add route")
+			return fmt.Errorf("cannot add route %s: %w", dst.String(), err)
+		}
+		log.Info("route added")
+	}
+	for _, dst := range del {
+		log := log.WithField("route", dst.String())
+		if err := writeRoute(unix.RTM_DELETE, ifi, dst); err != nil {
+			log.WithError(err).Error("cannot delete route")
+			return fmt.Errorf("cannot delete route %s: %w", dst.String(), err)
+		}
+		log.Info("route deleted")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+//go:build freebsd || openbsd
+// +build freebsd openbsd
+
+package bsd
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/route"
+	"golang.org/x/sys/unix"
+)
+
+func cidr(t *testing.T, s string) net.IPNet {
+	_, ipnet, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	return *ipnet
+}
+
+func TestRouteMessage(t *testing.T) {
+	ifi := &net.Interface{Index: 7, Name: "wg0"}
+	tests := []struct {
+		typ   int
+		dst   string
+		flags int
+		addrs []route.Addr
+	}{
+		{
+			typ:   unix.RTM_ADD,
+			dst:   "10.0.0.0/24",
+			flags: unix.RTF_UP | unix.RTF_STATIC,
+			addrs: []route.Addr{
+				unix.RTAX_DST:     &route.Inet4Addr{IP: [4]byte{10, 0, 0, 0}},
+				unix.RTAX_GATEWAY: &route.LinkAddr{Index: 7, Name: "wg0"},
+				unix.RTAX_NETMASK: &route.Inet4Addr{IP: [4]byte{255, 255, 255, 0}},
+			},
+		},
+		{
+			typ:   unix.RTM_DELETE,
+			dst:   "10.0.0.1/32",
+			flags: unix.RTF_UP | unix.RTF_STATIC | unix.RTF_HOST,
+			addrs: []route.Addr{
+				unix.RTAX_DST:     &route.Inet4Addr{IP: [4]byte{10, 0, 0, 1}},
+				unix.RTAX_GATEWAY: &route.LinkAddr{Index: 7, Name: "wg0"},
+			},
+		},
+		{
+			typ:   unix.RTM_ADD,
+			dst:   "fd00::/64",
+			flags: unix.RTF_UP | unix.RTF_STATIC,
+			addrs: []route.Addr{
+				unix.RTAX_DST:     &route.Inet6Addr{IP: [16]byte{0xfd}},
+				unix.RTAX_GATEWAY: &route.LinkAddr{Index: 7, Name: "wg0"},
+				unix.RTAX_NETMASK: &route.Inet6Addr{IP: [16]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dst, func(t *testing.T) {
+			m := routeMessage(tt.typ, ifi, cidr(t, tt.dst), 42, 3)
+			assert.Equal(t, &route.RouteMessage{
+				Version: unix.RTM_VERSION,
+				Type:    tt.typ,
+				Flags:   tt.flags,
+				Index:   7,
+				ID:      42,
+				Seq:     3,
+				Addrs:   tt.addrs,
+			}, m)
+			_, err := m.Marshal()
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestOwnedRoutes(t *testing.T) {
+	link := &route.LinkAddr{Index: 7, Name: "wg0"}
+	msgs := []route.Message{
+		&route.RouteMessage{Index: 7, Flags: unix.RTF_UP | unix.RTF_STATIC, Addrs: []route.Addr{
+			unix.RTAX_DST:     &route.Inet4Addr{IP: [4]byte{10, 0, 0, 0}},
+			unix.RTAX_GATEWAY: link,
+			unix.RTAX_NETMASK: &route.Inet4Addr{IP: [4]byte{255, 255, 255, 0}},
+		}},
+		&route.RouteMessage{Index: 7, Flags: unix.RTF_UP | unix.RTF_STATIC | unix.RTF_HOST, Addrs: []route.Addr{
+			unix.RTAX_DST:     &route.Inet6Addr{IP: [16]byte{0xfd, 15: 1}},
+			unix.RTAX_GATEWAY: link,
+		}},
+		// another interface, a gateway route and the route the kernel added for the address
+		&route.RouteMessage{Index: 8, Flags: unix.RTF_UP | unix.RTF_STATIC, Addrs: []route.Addr{
+			unix.RTAX_DST: &route.Inet4Addr{IP: [4]byte{10, 1, 0, 0}},
+		}},
+		&route.RouteMessage{Index: 7, Flags: unix.RTF_UP | unix.RTF_STATIC | unix.RTF_GATEWAY, Addrs: []route.Addr{
+			unix.RTAX_DST: &route.Inet4Addr{IP: [4]byte{10, 2, 0, 0}},
+		}},
+		&route.RouteMessage{Index: 7, Flags: unix.RTF_UP, Addrs: []route.Addr{
+			unix.RTAX_DST: &route.Inet4Addr{IP: [4]byte{10, 3, 0, 0}},
+		}},
+	}
+	assert.Equal(t, []ifaceRoute{
+		{dst: cidr(t, "10.0.0.0/24")},
+		{dst: cidr(t, "fd00::1/128")},
+	}, ownedRoutes(msgs, 7))
+}
+
+func TestRouteChanges(t *testing.T) {
+	present := []ifaceRoute{{dst: cidr(t, "10.0.0.0/24")}, {dst: cidr(t, "10.1.0.0/16")}, {dst: cidr(t, "fd00::/64")}}
+	host := net.IPNet{IP: net.ParseIP("10.2.0.5").To4(), Mask: net.CIDRMask(24, 32)}
+	add, del := routeChanges(present, []net.IPNet{cidr(t, "fd00::/64"), host, cidr(t, "10.0.0.0/24"), host})
+	assert.Equal(t, []net.IPNet{cidr(t, "10.2.0.0/24")}, add, "the network address, once")
+	assert.Equal(t, []net.IPNet{cidr(t, "10.1.0.0/16")}, del)
+
+	add, del = routeChanges(nil, nil)
+	assert.Empty(t, add)
+	assert.Empty(t, del)
+}
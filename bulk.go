@@ -0,0 +1,186 @@
+package wgquick
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultBulkWorkers is the number of the interfaces UpAll and DownAll configure at once when none is specified
+	DefaultBulkWorkers = 8
+	// DefaultConfigDir is the directory wg-quick looks up the configs in
+	DefaultConfigDir = "/etc/wireguard"
+)
+
+// BulkError aggregates the errors of the failed interfaces of UpAll, DownAll, SyncAll and LoadConfigDir
+type BulkError struct {
+	// Ifaces maps the interface name to its error
+	Ifaces map[string]error
+}
+
+func (e *BulkError) Error() string {
+	var names []string
+	for name := range e.Ifaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, name+": "+e.Ifaces[name].Error())
+	}
+	return "bulk operation failed: " + strings.Join(parts, "; ")
+}
+
+// Unwrap returns the interface errors, so errors.Is and errors.As check all of them (Go 1.20+, see Is and As)
+func (e *BulkError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Ifaces {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Is reports whether any interface error matches the target, see SyncError.Is
+func (e *BulkError) Is(target error) bool {
+	return anyIs(e.Unwrap(), target)
+}
+
+// As finds the first interface error matching the target, see SyncError.As
+func (e *BulkError) As(target interface{}) bool {
+	return anyAs(e.Unwrap(), target)
+}
+
+// UpAll brings up the interfaces, keyed by their names, with at most workers of them at once (DefaultBulkWorkers if 0).
+// All the interfaces are attempted, the failures are returned as BulkError.
+func (c *Client) UpAll(cfgs map[string]*Config, workers int, log logrus.FieldLogger) error {
+	return c.bulk(cfgs, workers, func(iface string, cfg *Config) error { return c.Up(cfg, iface, log) })
+}
+
+// DownAll tears down the interfaces, keyed by their names, like UpAll
+func (c *Client) DownAll(cfgs map[string]*Config, workers int, log logrus.FieldLogger) error {
+	return c.bulk(cfgs, workers, func(iface string, cfg *Config) error { return c.Down(cfg, iface, log) })
+}
+
+// SyncAll syncs the interfaces, keyed by their names, like UpAll
+func (c *Client) SyncAll(cfgs map[string]*Config, workers int, log logrus.FieldLogger) error {
+	return c.bulk(cfgs, workers, func(iface string, cfg *Config) error { return c.Sync(cfg, iface, log) })
+}
+
+// SkipValidation makes LoadConfigDir return the configs failing Validate too, e.g. to tear down the interfaces brought
+// up before the config got broken
+func SkipValidation() ParseOption {
+	return func(o *parseOptions) {
+		o.skipValidation = true
+	}
+}
+
+// LoadConfigDir loads and validates the *.conf and *.toml configs in the directory (DefaultConfigDir if empty), keyed
+// by the interface name, which is the file name without the extension, e.g. wg0 of wg0.conf. The files failing to
+// load or validate, or named beyond the interface name limit, are left out and returned as BulkError along with the
+// loaded configs, so the caller may bring up the rest. The includes are enabled relative to the directory, the files
+// included by the other configs aren't interfaces of their own.
+func LoadConfigDir(dir string, dec Decrypter, opts ...ParseOption) (map[string]*Config, error) {
+	if dir == "" {
+		dir = DefaultConfigDir
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, pattern := range []string{"*.conf", "*.toml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	options := &parseOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	included := make(map[string]bool)
+	opts = append([]ParseOption{WithIncludes(dir), func(o *parseOptions) { o.included = included }}, opts...)
+	type result struct {
+		cfg *Config
+		err error
+	}
+	results := make(map[string]result, len(files))
+	for _, file := range files {
+		cfg, err := LoadConfig(file, dec, opts...)
+		results[file] = result{cfg, err}
+	}
+
+	cfgs := make(map[string]*Config)
+	errs := make(map[string]error)
+	for _, file := range files {
+		if included[filepath.Clean(file)] {
+			continue
+		}
+		iface := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if _, ok := cfgs[iface]; ok || errs[iface] != nil {
+			delete(cfgs, iface)
+			if errs[iface] == nil {
+				errs[iface] = fmt.Errorf("both %s.conf and %s.toml exist", iface, iface)
+			}
+			continue
+		}
+		if len(iface) > maxIfaceNameLen {
+			errs[iface] = fmt.Errorf("%s: interface name longer than %d characters", file, maxIfaceNameLen)
+			continue
+		}
+		cfg, err := results[file].cfg, results[file].err
+		if err == nil && !options.skipValidation {
+			err = cfg.Validate()
+		}
+		if err != nil {
+			errs[iface] = fmt.Errorf("%s: %w", file, err)
+			continue
+		}
+		cfgs[iface] = cfg
+	}
+	if len(errs) > 0 {
+		return cfgs, &BulkError{Ifaces: errs}
+	}
+	return cfgs, nil
+}
+
+// bulk runs op for every interface with the bounded worker pool
+func (c *Client) bulk(cfgs map[string]*Config, workers int, op func(iface string, cfg *Config) error) error {
+	if workers <= 0 {
+		workers = DefaultBulkWorkers
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = make(map[string]error)
+	)
+	ifaces := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for iface := range ifaces {
+				if err := op(iface, cfgs[iface]); err != nil {
+					mu.Lock()
+					errs[iface] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for iface := range cfgs {
+		ifaces <- iface
+	}
+	close(ifaces)
+	wg.Wait()
+	if len(errs) > 0 {
+		return &BulkError{Ifaces: errs}
+	}
+	return nil
+}
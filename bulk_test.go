@@ -0,0 +1,99 @@
+package wgquick_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpAll(t *testing.T) {
+	c, _, _ := newFakeClient(t)
+	defer c.Close()
+
+	cfgs := make(map[string]*wgquick.Config)
+	for _, iface := range []string{"wg0", "wg1", "wg2", "wg3", "wg4"} {
+		cfg := &wgquick.Config{}
+		require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+		cfgs[iface] = cfg
+	}
+	cfgs["wg3"].ProxyDevice = "missing0"
+
+	err := c.UpAll(cfgs, 2, testLog)
+	require.Error(t, err)
+	bulkErr, ok := err.(*wgquick.BulkError)
+	require.True(t, ok)
+	assert.Len(t, bulkErr.Ifaces, 1)
+	assert.Error(t, bulkErr.Ifaces["wg3"])
+	for _, iface := range []string{"wg0", "wg1", "wg2", "wg4"} {
+		ok, err := c.IsUp(iface)
+		require.NoError(t, err)
+		assert.True(t, ok, iface)
+	}
+
+	delete(cfgs, "wg3")
+	require.NoError(t, c.DownAll(cfgs, 0, testLog))
+	infos, err := c.ListInterfaces(false)
+	require.NoError(t, err)
+	for _, info := range infos {
+		assert.Equal(t, "wg3", info.Name)
+	}
+}
+
+func TestLoadConfigDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-configs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for name, text := range map[string]string{
+		"wg0.conf":                  testConfig,
+		"wg1.conf":                  testConfig,
+		"invalid.conf":              "[Interface]\nAddress = 10.0.0.1/24\n",
+		"waytoolongforaniface.conf": testConfig,
+		"notes.txt":                 "not a config",
+		"wg2.conf":                  strings.Replace(testConfig, "[Peer]", "Include = wg2-peers.conf\n\n[Peer]", 1),
+		"wg2-peers.conf":            "[Peer]\nPublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=\nAllowedIPs = 10.192.125.0/24\n",
+		"broken.conf":               "[Interface]\nMTU = many\n",
+		"broken.toml":               "",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0600))
+	}
+
+	cfgs, err := wgquick.LoadConfigDir(dir, nil)
+	require.Error(t, err)
+	bulkErr, ok := err.(*wgquick.BulkError)
+	require.True(t, ok)
+	assert.Len(t, bulkErr.Ifaces, 3)
+	assert.Contains(t, bulkErr.Ifaces["invalid"].Error(), "private key is not set")
+	assert.Error(t, bulkErr.Ifaces["waytoolongforaniface"])
+	assert.Contains(t, bulkErr.Ifaces["broken"].Error(), "broken.conf", "the parse error is kept")
+	var verr *wgquick.ValidationError
+	assert.True(t, errors.As(err, &verr))
+	require.Len(t, cfgs, 3, "the included file isn't an interface")
+	assert.Contains(t, cfgs, "wg0")
+	assert.Contains(t, cfgs, "wg1")
+	assert.Len(t, cfgs["wg2"].Peers, 3)
+
+	cfgs, err = wgquick.LoadConfigDir(dir, nil, wgquick.SkipValidation())
+	require.Error(t, err)
+	assert.NotContains(t, err.(*wgquick.BulkError).Ifaces, "invalid")
+	assert.Contains(t, cfgs, "invalid")
+	delete(cfgs, "invalid")
+
+	c, _, _ := newFakeClient(t)
+	defer c.Close()
+	require.NoError(t, c.UpAll(cfgs, 0, testLog))
+	require.NoError(t, c.SyncAll(cfgs, 0, testLog))
+	infos, err := c.ListInterfaces(false)
+	require.NoError(t, err)
+	assert.Len(t, infos, 3)
+	require.NoError(t, c.DownAll(cfgs, 0, testLog))
+
+	_, err = wgquick.LoadConfigDir(filepath.Join(dir, "missing"), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,123 @@
+package wgquick
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultConnectivityCheckURL answers 204 No Content unless a captive portal intercepts the request
+	DefaultConnectivityCheckURL = "http://connectivitycheck.gstatic.com/generate_204"
+	// DefaultConnectivityCheckInterval is how often UpCaptive checks the connectivity when no interval is specified
+	DefaultConnectivityCheckInterval = 5 * time.Second
+)
+
+// ConnectivityCheck returns nil once the underlying network reaches the internet, e.g. after the captive portal login
+type ConnectivityCheck func(ctx context.Context) error
+
+// HTTPConnectivityCheck requests the url, DefaultConnectivityCheckURL if empty, expecting 204 No Content. The captive
+// portals answer with a redirect or their login page instead. The request ends with the context, UpCaptive times out
+// every check after its interval.
+func HTTPConnectivityCheck(url string) ConnectivityCheck {
+	if url == "" {
+		url = DefaultConnectivityCheckURL
+	}
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			return fmt.Errorf("connectivity check %s: %s, captive portal?", url, resp.Status)
+		}
+		return nil
+	}
+}
+
+// UpCaptive brings the interface up in two steps for the networks behind a captive portal, which the full tunnel
+// would cut off before the login. First it applies the link, device and addresses only, leaving the routes, source
+// rules and DNS alone, so the portal stays reachable. Once the check passes, checked every interval
+// (DefaultConnectivityCheckInterval if 0) with the interval as its timeout, it syncs the routes and rules, sets the DNS and runs PostUp, completing Up.
+//
+// If the context is done first, the interface stays up with the device config only and the context error is returned.
+// Down cleans it up either way.
+func (c *Client) UpCaptive(ctx context.Context, cfg *Config, iface string, check ConnectivityCheck, interval time.Duration, logger logrus.FieldLogger) error {
+	if c.zeroize {
+		defer cfg.Zeroize()
+	}
+	log := logger.WithField("iface", iface)
+	if interval == 0 {
+		interval = DefaultConnectivityCheckInterval
+	}
+	cfg, err := c.withDNSBackend(cfg, log)
+	if err != nil {
+		return err
+	}
+	if err := c.preflight(cfg, iface, len(cfg.DNS) > 0 || cfg.resolved()); err != nil {
+		return err
+	}
+	cfg = cfg.clone()
+	initial := cfg.clone()
+	initial.Table = TableOff
+	initial.SourceRules = false
+	initial.DNS = nil
+	initial.DNSDefaultRoute, initial.DNSSEC, initial.DNSOverTLS, initial.LLMNR = false, "", "", ""
+	initial.PostUp = ""
+	if err := c.Up(initial, iface, logger); err != nil {
+		return err
+	}
+	log.Info("device up, waiting for connectivity")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// a hanging check, e.g. the portal dropping the packets, mustn't block the next one
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		err := check(checkCtx)
+		cancel()
+		if err == nil {
+			break
+		}
+		log.WithError(err).Info("no connectivity yet")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	log.Info("connectivity check passed, completing up")
+
+	if err := c.Sync(cfg, iface, logger); err != nil {
+		return err
+	}
+	unlock, err := c.lockIface(iface)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := c.phase(c.dnsPhase(cfg, iface, log), iface, log).run(); err != nil {
+		return err
+	}
+	if err := c.finishDNS(cfg, iface, log); err != nil {
+		return err
+	}
+	if cfg.PostUp != "" {
+		if err := c.runHook(cfg, cfg.PostUp, iface, log); err != nil {
+			return err
+		}
+		log.Infoln("applied post-up command")
+	}
+	return nil
+}
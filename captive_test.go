@@ -0,0 +1,72 @@
+package wgquick_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+func TestUpCaptive(t *testing.T) {
+	c, nl, _ := newFakeClient(t)
+	defer c.Close()
+
+	portal := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if portal {
+			http.Redirect(w, r, "http://portal.example.com/login", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	httpCheck := wgquick.HTTPConnectivityCheck(srv.URL)
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	checks := 0
+	check := func(ctx context.Context) error {
+		checks++
+		assert.Empty(t, nl.Routes(), "routes deferred until the check passes")
+		link, err := nl.LinkByName("wg0")
+		require.NoError(t, err)
+		addrs, err := nl.AddrList(link, netlink.FAMILY_ALL)
+		require.NoError(t, err)
+		assert.Len(t, addrs, 2)
+		if checks == 3 {
+			portal = false
+		}
+		return httpCheck(ctx)
+	}
+	require.NoError(t, c.UpCaptive(context.Background(), cfg, "wg0", check, time.Millisecond, testLog))
+	assert.Equal(t, 3, checks)
+	assert.NotEmpty(t, nl.Routes())
+	require.NoError(t, c.Down(cfg, "wg0", testLog))
+
+	hanging := 0
+	hangingCheck := func(ctx context.Context) error {
+		if hanging++; hanging == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}
+	require.NoError(t, c.UpCaptive(context.Background(), cfg, "wg0", hangingCheck, 10*time.Millisecond, testLog))
+	assert.Equal(t, 2, hanging, "the hanging check times out after the interval")
+	require.NoError(t, c.Down(cfg, "wg0", testLog))
+
+	portal = true
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := c.UpCaptive(ctx, cfg, "wg0", httpCheck, time.Millisecond, testLog)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Empty(t, nl.Routes())
+	_, err = nl.LinkByName("wg0")
+	assert.NoError(t, err, "interface stays up with the device config")
+}
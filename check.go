@@ -0,0 +1,123 @@
+package wgquick
+
+import (
+	"fmt"
+	"net"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// CheckResult is the outcome of Check
+type CheckResult struct {
+	// InSync is true if the live interface matches the config
+	InSync bool
+	// Diff holds the differences of the live interface (old) and the config (new), nil if there's no wireguard interface
+	Diff *ConfigDiff
+	// Problems are the differences Diff doesn't express, e.g. the missing link or routes
+	Problems []string
+}
+
+// Check reports whether the live interface matches the config without changing anything, e.g. for the monitoring probes
+// or the check mode of the configuration management tools. It compares what can be read back from the interface:
+// the link, MTU and alias, the addresses, the device with its peers and the routes. The settings unset in the config,
+// e.g. the listen port or the peer endpoints learned from the handshakes, aren't compared.
+func (c *Client) Check(cfg *Config, iface string) (*CheckResult, error) {
+	res := &CheckResult{}
+	s, err := c.Status(nil, iface)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !s.Exists:
+		res.Problems = append(res.Problems, "interface doesn't exist")
+		return res, nil
+	case !s.Wireguard:
+		res.Problems = append(res.Problems, "interface isn't wireguard")
+		return res, nil
+	case !s.Up:
+		res.Problems = append(res.Problems, "interface is down")
+	}
+
+	want := cfg.clone()
+	want.FillDefaults()
+	live, err := c.GetRuntimeConfig(iface)
+	if err != nil {
+		return nil, err
+	}
+	res.Diff = Diff(live.checked(want), want.checked(want))
+
+	if want.Table != TableOff {
+		link, err := c.nl.LinkByName(iface)
+		if err != nil {
+			return nil, err
+		}
+		routes, err := c.listOwnedRoutes(want, link)
+		if err != nil {
+			return nil, err
+		}
+		present := make(map[string]bool, len(routes))
+		for _, rt := range routes {
+			present[rt.Dst.String()] = true
+		}
+		for _, dst := range want.managedRoutes() {
+			if !present[dst.String()] {
+				res.Problems = append(res.Problems, fmt.Sprintf("route %s is missing", dst.String()))
+			}
+		}
+	}
+	res.InSync = res.Diff.Empty() && len(res.Problems) == 0
+	return res, nil
+}
+
+// checked returns the config with the settings Check compares, skipping the ones unset in the wanted config. The live
+// peers and allowed IPs missing in the wanted config are only compared if it replaces them, see Config.SetReplace.
+func (cfg *Config) checked(want *Config) *Config {
+	out := &Config{
+		Address: append([]net.IPNet(nil), cfg.Address...),
+		MTU:     cfg.MTU,
+		Routes:  cloneRoutes(cfg.Routes),
+	}
+	if want.PrivateKey != nil {
+		out.PrivateKey = cfg.PrivateKey
+	}
+	if want.ListenPort != nil && *want.ListenPort != 0 {
+		out.ListenPort = cfg.ListenPort
+	}
+	if want.FirewallMark != nil {
+		out.FirewallMark = cfg.FirewallMark
+	}
+	if want.LinkAlias != "" {
+		out.LinkAlias = cfg.LinkAlias
+	}
+	wantPeers := make(map[wgtypes.Key]wgtypes.PeerConfig, len(want.Peers))
+	for _, p := range want.Peers {
+		wantPeers[p.PublicKey] = p
+	}
+	for _, p := range cfg.Peers {
+		wp, ok := wantPeers[p.PublicKey]
+		if p.Remove || (!ok && !want.ReplacePeers) {
+			continue
+		}
+		p = clonePeer(p)
+		if ok && wp.Endpoint == nil {
+			p.Endpoint = nil
+		}
+		if ok && !wp.ReplaceAllowedIPs {
+			var allowedIPs []net.IPNet
+			for _, ip := range p.AllowedIPs {
+				if containsIPNet(wp.AllowedIPs, ip) {
+					allowedIPs = append(allowedIPs, ip)
+				}
+			}
+			p.AllowedIPs = allowedIPs
+		}
+		if p.PersistentKeepaliveInterval != nil && *p.PersistentKeepaliveInterval == 0 {
+			p.PersistentKeepaliveInterval = nil
+		}
+		if p.PresharedKey != nil && *p.PresharedKey == (wgtypes.Key{}) {
+			p.PresharedKey = nil
+		}
+		out.Peers = append(out.Peers, p)
+	}
+	return out
+}
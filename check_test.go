@@ -0,0 +1,36 @@
+package wgquick_test
+
+import (
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	c, nl, _ := newFakeClient(t)
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	res, err := c.Check(cfg, "wg0")
+	require.NoError(t, err)
+	assert.False(t, res.InSync)
+	assert.Equal(t, []string{"interface doesn't exist"}, res.Problems)
+
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	res, err = c.Check(cfg, "wg0")
+	require.NoError(t, err)
+	assert.True(t, res.InSync, "%+v", res)
+
+	rt := nl.Routes()[0]
+	require.NoError(t, nl.RouteDel(&rt))
+	changed := wgquick.Merge(cfg)
+	changed.MTU = 1280
+	res, err = c.Check(changed, "wg0")
+	require.NoError(t, err)
+	assert.False(t, res.InSync)
+	assert.Equal(t, []string{"route " + rt.Dst.String() + " is missing"}, res.Problems)
+	assert.Equal(t, []wgquick.FieldChange{{Field: "MTU", Old: "1420", New: "1280"}}, res.Diff.Interface)
+}
@@ -0,0 +1,359 @@
+package wgquick
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Client holds the netlink handle and wgctrl client shared by all the operations, so a whole Sync uses a single socket.
+// The package level functions create a new Client for every call; long running processes should create one and reuse it.
+type Client struct {
+	nl Netlink
+	// handle is the netlink handle created and owned by the client
+	handle *netlink.Handle
+	wg     Wireguard
+	ownsWg bool
+	// wgMu guards the lazy creation of wg by the concurrent operations
+	wgMu sync.Mutex
+	// parallel runs the independent sync phases concurrently
+	parallel bool
+	// continueOnError continues the sync phases past the failed items
+	continueOnError bool
+	// zeroize wipes the config keys after Up and Sync
+	zeroize bool
+	// lockDir is the directory of the lock files, see WithLockDir
+	lockDir *string
+	// stateDir is the directory of the state files, see WithStateDir
+	stateDir *string
+	// sysctlDir is the directory of the sysctls, see WithSysctlDir
+	sysctlDir *string
+	// resolvConf is the resolv.conf of DNSBackendFile, see WithResolvConf
+	resolvConf *string
+	// syncs are the last sync outcomes, see HealthHandler
+	syncs syncRecords
+	// retry is the retry policy of the sync phases, see WithRetry
+	retry *RetryPolicy
+	// audit records the mutations, see WithAuditSink
+	audit AuditSink
+	// progress receives the sync progress, see WithProgress
+	progress ProgressFunc
+}
+
+// ClientOption configures the Client
+type ClientOption func(c *Client)
+
+// WithNetlinkHandle makes the client use the caller's netlink handle created in the network namespace ns, e.g. with
+// netlink.NewHandleAt(ns). The handle and the namespace stay owned by the caller, Close doesn't delete them.
+func WithNetlinkHandle(h *netlink.Handle, ns netns.NsHandle) ClientOption {
+	return WithNetlink(NewNetlink(h, ns))
+}
+
+// WithNetlink makes the client use the Netlink implementation, e.g. the in-memory fake.Netlink in tests.
+func WithNetlink(n Netlink) ClientOption {
+	return func(c *Client) {
+		c.nl = n
+	}
+}
+
+// WithWgctrlClient makes the client use the caller's wgctrl client. It stays owned by the caller, Close doesn't close it.
+func WithWgctrlClient(cl *wgctrl.Client) ClientOption {
+	return WithWireguard(cl)
+}
+
+// WithWireguard makes the client use the Wireguard implementation, e.g. the in-memory fake.Wireguard in tests.
+// It stays owned by the caller, Close doesn't close it.
+func WithWireguard(w Wireguard) ClientOption {
+	return func(c *Client) {
+		c.wg = w
+	}
+}
+
+// ParallelSync runs the independent phases after the link is configured concurrently: addresses, routes, rules and DNS on Up.
+// The errors of failed phases are aggregated into SyncError.
+func ParallelSync() ClientOption {
+	return func(c *Client) {
+		c.parallel = true
+	}
+}
+
+// ContinueOnError makes the sync phases continue past the failed items, e.g. a route the kernel refuses, and the sync past
+// the failed phases. The failed items are returned as ItemsError, aggregated into SyncError by the phase.
+func ContinueOnError() ClientOption {
+	return func(c *Client) {
+		c.continueOnError = true
+	}
+}
+
+// ZeroizeKeys makes Up and Sync wipe the config keys once they're done, see Config.Zeroize. The config can't set
+// the device keys again afterwards, reload it for the next Sync.
+func ZeroizeKeys() ClientOption {
+	return func(c *Client) {
+		c.zeroize = true
+	}
+}
+
+// NewClient creates the client. Close it after use.
+func NewClient(opts ...ClientOption) (*Client, error) {
+	c := &Client{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.nl == nil {
+		h, err := netlink.NewHandle()
+		if err != nil {
+			return nil, err
+		}
+		c.nl = NewNetlink(h, netns.None())
+		c.handle = h
+	}
+	if c.audit != nil {
+		c.nl = auditNetlink{Netlink: c.nl, c: c}
+	}
+	return c, nil
+}
+
+// wgctrl returns the wireguard client, creating the wgctrl one on first use
+func (c *Client) wgctrl() (Wireguard, error) {
+	c.wgMu.Lock()
+	defer c.wgMu.Unlock()
+	if c.wg == nil {
+		cl, err := wgctrl.New()
+		if err != nil {
+			return nil, err
+		}
+		c.wg = cl
+		c.ownsWg = true
+	}
+	return c.wg, nil
+}
+
+// Close releases the resources owned by the client
+func (c *Client) Close() error {
+	if c.handle != nil {
+		c.handle.Delete()
+		c.handle = nil
+	}
+	if c.ownsWg {
+		err := c.wg.Close()
+		c.wg, c.ownsWg = nil, false
+		return err
+	}
+	return nil
+}
+
+// withClient runs f with a new client, closing it afterwards
+func withClient(f func(c *Client) error) error {
+	c, err := NewClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return f(c)
+}
+
+// Up sets and configures the wg interface. Mostly equivalent to `wg-quick up iface`. See Client.Up
+func Up(cfg *Config, iface string, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.Up(cfg, iface, logger) })
+}
+
+// UpCaptive brings the interface up, deferring the routes and DNS until the connectivity check passes. See Client.UpCaptive
+func UpCaptive(ctx context.Context, cfg *Config, iface string, check ConnectivityCheck, interval time.Duration, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.UpCaptive(ctx, cfg, iface, check, interval, logger) })
+}
+
+// Down destroys the wg interface. Mostly equivalent to `wg-quick down iface`. See Client.Down
+func Down(cfg *Config, iface string, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.Down(cfg, iface, logger) })
+}
+
+// Sync the config to the current setup for given interface. See Client.Sync
+func Sync(cfg *Config, iface string, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.Sync(cfg, iface, logger) })
+}
+
+// Reload applies the wireguard settings and routes without bouncing the link. See Client.Reload
+func Reload(cfg *Config, iface string, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.Reload(cfg, iface, logger) })
+}
+
+// SyncLink synces link state with the config. See Client.SyncLink
+func SyncLink(cfg *Config, iface string, log logrus.FieldLogger) (link netlink.Link, err error) {
+	err = withClient(func(c *Client) error {
+		link, err = c.SyncLink(cfg, iface, log)
+		return err
+	})
+	return link, err
+}
+
+// SyncWireguardDevice synces wireguard vpn setting on the given link. See Client.SyncWireguardDevice
+func SyncWireguardDevice(cfg *Config, link netlink.Link, log logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.SyncWireguardDevice(cfg, link, log) })
+}
+
+// ListenPort returns the actual port the wireguard device is listening on. See Client.ListenPort
+func ListenPort(iface string) (port int, err error) {
+	err = withClient(func(c *Client) error {
+		port, err = c.ListenPort(iface)
+		return err
+	})
+	return port, err
+}
+
+// ListInterfaces lists the links of type wireguard. See Client.ListInterfaces
+func ListInterfaces(managedOnly bool) (infos []InterfaceInfo, err error) {
+	err = withClient(func(c *Client) error {
+		infos, err = c.ListInterfaces(managedOnly)
+		return err
+	})
+	return infos, err
+}
+
+// Status checks the interface without changing anything. See Client.Status
+func Status(cfg *Config, iface string) (s InterfaceStatus, err error) {
+	err = withClient(func(c *Client) error {
+		s, err = c.Status(cfg, iface)
+		return err
+	})
+	return s, err
+}
+
+// PeerStats returns the statistics of a single peer. See Client.PeerStats
+func PeerStats(iface string, key wgtypes.Key) (stats PeerStatistics, err error) {
+	err = withClient(func(c *Client) error {
+		stats, err = c.PeerStats(iface, key)
+		return err
+	})
+	return stats, err
+}
+
+// Check reports whether the live interface matches the config. See Client.Check
+func Check(cfg *Config, iface string) (res *CheckResult, err error) {
+	err = withClient(func(c *Client) error {
+		res, err = c.Check(cfg, iface)
+		return err
+	})
+	return res, err
+}
+
+// Exists reports whether the wireguard link exists. See Client.Exists
+func Exists(iface string) (ok bool, err error) {
+	err = withClient(func(c *Client) error {
+		ok, err = c.Exists(iface)
+		return err
+	})
+	return ok, err
+}
+
+// IsUp reports whether the wireguard link exists and is up. See Client.IsUp
+func IsUp(iface string) (ok bool, err error) {
+	err = withClient(func(c *Client) error {
+		ok, err = c.IsUp(iface)
+		return err
+	})
+	return ok, err
+}
+
+// AllocateInterface creates the wireguard link with the first free name. See Client.AllocateInterface
+func AllocateInterface(prefix string, log logrus.FieldLogger) (name string, err error) {
+	err = withClient(func(c *Client) error {
+		name, err = c.AllocateInterface(prefix, log)
+		return err
+	})
+	return name, err
+}
+
+// GetRuntimeConfig reads the config back from the live interface. See Client.GetRuntimeConfig
+func GetRuntimeConfig(iface string) (cfg *Config, err error) {
+	err = withClient(func(c *Client) error {
+		cfg, err = c.GetRuntimeConfig(iface)
+		return err
+	})
+	return cfg, err
+}
+
+// Run brings the tunnel up and keeps it running until SIGTERM or SIGINT. See Client.Run
+func Run(ctx context.Context, cfg *Config, iface string, log logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.Run(ctx, cfg, iface, log) })
+}
+
+// PruneStalePeers removes the peers with the last handshake older than maxAge. See Client.PruneStalePeers
+func PruneStalePeers(cfg *Config, iface string, maxAge time.Duration, log logrus.FieldLogger) (pruned []wgtypes.Key, err error) {
+	err = withClient(func(c *Client) error {
+		pruned, err = c.PruneStalePeers(cfg, iface, maxAge, log)
+		return err
+	})
+	return pruned, err
+}
+
+// UpAll brings up the interfaces concurrently. See Client.UpAll
+func UpAll(cfgs map[string]*Config, workers int, log logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.UpAll(cfgs, workers, log) })
+}
+
+// DownAll tears down the interfaces concurrently. See Client.DownAll
+func DownAll(cfgs map[string]*Config, workers int, log logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.DownAll(cfgs, workers, log) })
+}
+
+// SyncAll syncs the interfaces concurrently. See Client.SyncAll
+func SyncAll(cfgs map[string]*Config, workers int, log logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.SyncAll(cfgs, workers, log) })
+}
+
+// SyncAddress adds/deletes all lind assigned IPV4 addressed as specified in the config. See Client.SyncAddress
+func SyncAddress(cfg *Config, link netlink.Link, log logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.SyncAddress(cfg, link, log) })
+}
+
+// SyncRoutes adds/deletes all route assigned IPV4 addressed as specified in the config. See Client.SyncRoutes
+func SyncRoutes(cfg *Config, link netlink.Link, managedRoutes []net.IPNet, log logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.SyncRoutes(cfg, link, managedRoutes, log) })
+}
+
+// SyncRules adds/deletes policy routing rules, so the managed set of rules is exactly the wanted one. See Client.SyncRules
+func SyncRules(cfg *Config, rules []netlink.Rule, log logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.SyncRules(cfg, rules, log) })
+}
+
+// UpExitNode brings the interface up as the exit node. See Client.UpExitNode
+func UpExitNode(cfg *Config, iface string, exit ExitNode, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.UpExitNode(cfg, iface, exit, logger) })
+}
+
+// DownExitNode reverts UpExitNode. See Client.DownExitNode
+func DownExitNode(cfg *Config, iface string, exit ExitNode, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.DownExitNode(cfg, iface, exit, logger) })
+}
+
+// EnableAppRouting routes the traffic of the selected applications via the tunnel. See Client.EnableAppRouting
+func EnableAppRouting(cfg *Config, iface string, apps AppRouting, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.EnableAppRouting(cfg, iface, apps, logger) })
+}
+
+// DisableAppRouting reverts EnableAppRouting. See Client.DisableAppRouting
+func DisableAppRouting(cfg *Config, iface string, apps AppRouting, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.DisableAppRouting(cfg, iface, apps, logger) })
+}
+
+// RunEventMonitor runs the event hooks and the handler for the runtime events until the context is done. See Client.RunEventMonitor
+func RunEventMonitor(ctx context.Context, cfg *Config, iface string, interval time.Duration, handler EventHandler, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.RunEventMonitor(ctx, cfg, iface, interval, handler, logger) })
+}
+
+// EngageKillSwitch replaces the tunnel routes with cfg.KillSwitch routes. See Client.EngageKillSwitch
+func EngageKillSwitch(cfg *Config, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.EngageKillSwitch(cfg, logger) })
+}
+
+// ReleaseKillSwitch deletes the kill switch routes for the config managed routes. See Client.ReleaseKillSwitch
+func ReleaseKillSwitch(cfg *Config, logger logrus.FieldLogger) error {
+	return withClient(func(c *Client) error { return c.ReleaseKillSwitch(cfg, logger) })
+}
@@ -0,0 +1,104 @@
+package wgquick_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/nmiculinic/wg-quick-go/fake"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+const testConfig = `[Interface]
+Address = 10.192.122.1/24
+Address = 10.10.0.1/16
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.3/32, 10.192.124.1/24
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.192.122.4/32, 192.168.0.0/16
+`
+
+// testLog discards the client logs
+var testLog = func() *logrus.Logger {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	return log
+}()
+
+// newFakeClient returns a client on the fake netlink and wireguard with the extra options, the caller closes it
+func newFakeClient(t *testing.T, opts ...wgquick.ClientOption) (*wgquick.Client, *fake.Netlink, *fake.Wireguard) {
+	nl := fake.NewNetlink()
+	wg := fake.NewWireguard(nl)
+	c, err := wgquick.NewClient(append([]wgquick.ClientOption{wgquick.WithNetlink(nl), wgquick.WithWireguard(wg)}, opts...)...)
+	require.NoError(t, err)
+	return c, nl, wg
+}
+
+// waitFor polls the condition until it's true, failing the test after 5s
+func waitFor(t *testing.T, cond func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+	}
+}
+
+// failingRoutes refuses to add the routes to dst
+type failingRoutes struct {
+	*fake.Netlink
+	dst string
+}
+
+func (n failingRoutes) RouteReplace(route *netlink.Route) error {
+	if route.Dst.String() == n.dst {
+		return syscall.EINVAL
+	}
+	return n.Netlink.RouteReplace(route)
+}
+
+func TestContinueOnError(t *testing.T) {
+	nl := fake.NewNetlink()
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+
+	c, err := wgquick.NewClient(wgquick.WithNetlink(failingRoutes{nl, "10.192.122.3/32"}), wgquick.WithWireguard(fake.NewWireguard(nl)))
+	require.NoError(t, err)
+	defer c.Close()
+	err = c.Sync(cfg, "wg0", testLog)
+	require.Error(t, err)
+	var opErr *wgquick.OpError
+	require.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "wg0", opErr.Iface)
+	assert.Equal(t, "routes", opErr.Phase)
+	assert.Equal(t, "10.192.122.3/32", opErr.Subject)
+	assert.True(t, errors.Is(err, syscall.EINVAL))
+	assert.True(t, len(nl.Routes()) < 3, "sync stops on the first failed route")
+
+	c, err = wgquick.NewClient(wgquick.WithNetlink(failingRoutes{nl, "10.192.122.3/32"}), wgquick.WithWireguard(fake.NewWireguard(nl)), wgquick.ContinueOnError())
+	require.NoError(t, err)
+	defer c.Close()
+	err = c.Sync(cfg, "wg0", testLog)
+	require.Error(t, err)
+	syncErr, ok := err.(*wgquick.SyncError)
+	require.True(t, ok)
+	require.Len(t, syncErr.Phases, 1)
+	var itemsErr *wgquick.ItemsError
+	require.True(t, errors.As(syncErr.Phases["routes"], &itemsErr))
+	assert.Len(t, itemsErr.Items, 1)
+	assert.True(t, errors.Is(itemsErr.Items["replace route 10.192.122.3/32"], syscall.EINVAL))
+	assert.True(t, errors.Is(err, syscall.EINVAL))
+	assert.Equal(t, "sync failed: wg0: routes: replace route 10.192.122.3/32: invalid argument", err.Error())
+	assert.Len(t, nl.Routes(), 3, "the other routes are added")
+}
@@ -1,17 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/nmiculinic/wg-quick-go"
 	"github.com/sirupsen/logrus"
 )
 
 func printHelp() {
-	fmt.Print("wg-quick [flags] [ up | down | sync ] [ config_file | interface ]\n\n")
+	fmt.Print("wg-quick [flags] [ up | down | sync | reload | check | prune ] [ config_file | interface ]\n")
+	fmt.Print("wg-quick [flags] [ up | down | sync ] all\n")
+	fmt.Print("wg-quick fmt config_file\n\n")
 	flag.Usage()
 	os.Exit(1)
 }
@@ -19,8 +27,40 @@ func printHelp() {
 func main() {
 	flag.String("iface", "", "interface")
 	verbose := flag.Bool("v", false, "verbose")
-	protocol := flag.Int("route-protocol", 0, "route protocol to use for our routes")
+	protocol := flag.Int("route-protocol", 0, fmt.Sprintf("route protocol to tag our routes with, only the routes with it are deleted (default %d)", wgquick.DefaultRouteProtocol))
 	metric := flag.Int("route-metric", 0, "route metric to use for our routes")
+	alias := flag.String("alias", "", "alias (description) to set on the link")
+	sourceRules := flag.Bool("source-rules", false, "add `from <address> lookup <table>` rules for every address, requires Table")
+	ipForward := flag.Bool("ip-forward", false, "enable IPv4 and IPv6 forwarding on up, restoring the previous values on down")
+	lanBypass := flag.Bool("lan-bypass", false, "keep the LAN prefixes of the other links out of the full-tunnel routing table")
+	proxyDevice := flag.String("proxy-device", "", "LAN device to add proxy ARP/NDP entries for the peer addresses on")
+	hookShell := flag.String("hook-shell", "", "shell running the PreUp, PostUp, PreDown and PostDown hooks, e.g. `bash -ce`, or none to run them without a shell")
+	hookUser := flag.String("hook-user", "", "`user[:group]` running the hooks instead of root")
+	hookCaps := flag.String("hook-caps", "", "comma separated capabilities the hooks keep with -hook-user, e.g. CAP_NET_ADMIN")
+	dnsBackend := flag.String("dns-backend", wgquick.DNSBackendResolvconf, "backend setting the DNS servers: resolvconf, networkmanager, resolved, file, the comma separated fallback chain of them or auto for "+wgquick.DefaultDNSBackendChain)
+	resolvconfAdd := flag.String("resolvconf-add", wgquick.DefaultResolvconfAdd, "command setting the DNS servers, %r is the interface record name")
+	resolvconfDelete := flag.String("resolvconf-delete", wgquick.DefaultResolvconfDelete, "command removing the DNS servers")
+	resolvconfRecord := flag.String("resolvconf-record", wgquick.DefaultResolvconfRecord, "resolvconf interface record name, %i is the interface name")
+	dnsDefaultRoute := flag.Bool("dns-default-route", false, "make the tunnel the systemd-resolved default DNS route (Domains=~.)")
+	dnssec := flag.String("dnssec", "", "systemd-resolved DNSSEC mode of the tunnel: yes, no or allow-downgrade")
+	dnsOverTLS := flag.String("dns-over-tls", "", "systemd-resolved DNS-over-TLS mode of the tunnel: yes, no or opportunistic")
+	llmnr := flag.String("llmnr", "", "systemd-resolved LLMNR mode of the tunnel: yes, no or resolve")
+	replacePeers := flag.Bool("replace-peers", false, "remove the device peers missing in the config on sync")
+	replaceAllowedIPs := flag.Bool("replace-allowed-ips", false, "remove the peer allowed IPs missing in the config on sync")
+	routeOptions := flag.String("route-mtu", "", "comma separated route MTUs, e.g. `192.168.7.0/24 mtu 1280, 10.0.0.0/8 mtu lock 1400`")
+	staleAfter := flag.Duration("stale-after", 3*time.Minute, "handshake age after which prune removes the peer")
+	captive := flag.String("captive", "", "on up defer the routes and DNS until this URL answers 204 No Content, e.g. after a captive portal login; `default` for "+wgquick.DefaultConnectivityCheckURL)
+	exitNode := flag.String("exit-node", "", "egress device making the host the exit node: forwarding and masquerading the tunnel traffic")
+	hairpin := flag.Bool("hairpin", false, "with -exit-node forward the traffic between the peers too")
+	killSwitch := flag.String("kill-switch", "off", "route type (blackhole, unreachable, prohibit) replacing the tunnel routes on down, or off")
+	gnupgHome := flag.String("gnupg-home", "", "gpg home directory with the keys decrypting the gpg encrypted config files, the user's one if empty; needs the gpg command")
+	ageIdentity := flag.String("age-identity", "", "age identity file used to decrypt age encrypted config files, needs the age command")
+	profile := flag.String("profile", "", "name of the profile to use of the config file bundling several `[Profile <name>]` tunnels")
+	lenient := flag.Bool("lenient", false, "skip unknown keys and malformed lines in the config, logging a warning")
+	expandEnv := flag.Bool("expand-env", false, "expand ${VAR} references in config values from the environment")
+	strictPermissions := flag.Bool("strict-permissions", false, "refuse config files accessible by group or others instead of warning")
+	endpointFamily := flag.String("endpoint-family", "prefer-ipv4", "address family of the endpoint host names: prefer-ipv4, prefer-ipv6, require-ipv4 or require-ipv6")
+	passphraseFile := flag.String("passphrase-file", "", "file containing the passphrase for the gpg key or symmetrically encrypted config")
 	flag.Parse()
 	args := flag.Args()
 	if len(args) != 2 {
@@ -31,14 +71,23 @@ func main() {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
+	if args[0] == "fmt" {
+		formatFile(args[1])
+		return
+	}
+
 	iface := flag.Lookup("iface").Value.String()
 	log := logrus.WithField("iface", iface)
 
 	cfg := args[1]
 
+	all := false
 	_, err := os.Stat(cfg)
 	switch {
 	case err == nil:
+	case os.IsNotExist(err) && cfg == "all":
+		all = true
+		cfg = filepath.Join(wgquick.DefaultConfigDir, cfg)
 	case os.IsNotExist(err):
 		if iface == "" {
 			iface = cfg
@@ -55,24 +104,130 @@ func main() {
 		printHelp()
 	}
 
-	b, err := ioutil.ReadFile(cfg)
+	var passphrase []byte
+	if *passphraseFile != "" {
+		passphrase, err = ioutil.ReadFile(*passphraseFile)
+		if err != nil {
+			logrus.WithError(err).Fatalln("cannot read passphrase file")
+		}
+		passphrase = bytes.TrimRight(passphrase, "\r\n")
+	}
+	var dec wgquick.Decrypter = &wgquick.GPGDecrypter{Homedir: *gnupgHome, Passphrase: passphrase}
+	if *ageIdentity != "" {
+		identity, err := ioutil.ReadFile(*ageIdentity)
+		if err != nil {
+			logrus.WithError(err).Fatalln("cannot read age identity file")
+		}
+		age, gpg := &wgquick.AgeDecrypter{Identity: identity}, dec
+		dec = wgquick.DecrypterFunc(func(format wgquick.EncryptionFormat, ciphertext []byte) ([]byte, error) {
+			if format == wgquick.AgeEncrypted {
+				return age.Decrypt(format, ciphertext)
+			}
+			return gpg.Decrypt(format, ciphertext)
+		})
+	}
+
+	opts := []wgquick.ParseOption{wgquick.WithIncludes(filepath.Dir(cfg)), wgquick.WarnInsecurePermissions(log)}
+	if *strictPermissions {
+		opts = append(opts, wgquick.RequirePrivatePermissions())
+	}
+	if *expandEnv {
+		opts = append(opts, wgquick.ExpandEnv())
+	}
+	family, err := wgquick.ParseEndpointFamily(*endpointFamily)
 	if err != nil {
-		logrus.WithError(err).Fatalln("cannot read file")
+		logrus.WithError(err).Fatalln("invalid endpoint family")
+	}
+	opts = append(opts, wgquick.WithEndpointFamily(family))
+	if all {
+		runAll(args[0], dec, opts)
+		return
 	}
-	c := &wgquick.Config{}
-	if err := c.UnmarshalText(b); err != nil {
+	if *profile != "" {
+		opts = append(opts, wgquick.WithProfile(*profile))
+	}
+	var warnings []wgquick.ParseWarning
+	if *lenient {
+		opts = append(opts, wgquick.Lenient(&warnings))
+	}
+	c, err := wgquick.LoadConfig(cfg, dec, opts...)
+	if err != nil {
 		logrus.WithError(err).Fatalln("cannot parse config file")
 	}
+	for _, w := range warnings {
+		log.WithField("line", w.Line).Warnln(w.Err)
+	}
 
 	c.RouteProtocol = *protocol
 	c.RouteMetric = *metric
+	c.LinkAlias = *alias
+	c.SourceRules = *sourceRules
+	c.LANBypass = *lanBypass
+	c.IPForward = *ipForward
+	c.ProxyDevice = *proxyDevice
+	c.HookShell = *hookShell
+	c.HookUser = *hookUser
+	c.DNSBackend = *dnsBackend
+	c.ResolvconfAdd = *resolvconfAdd
+	c.ResolvconfDelete = *resolvconfDelete
+	c.ResolvconfRecord = *resolvconfRecord
+	c.DNSDefaultRoute = *dnsDefaultRoute
+	c.DNSSEC = *dnssec
+	c.DNSOverTLS = *dnsOverTLS
+	c.LLMNR = *llmnr
+	if *routeOptions != "" {
+		c.RouteOptions, err = wgquick.ParseRouteOptions(*routeOptions)
+		if err != nil {
+			logrus.WithError(err).Fatalln("invalid route mtu")
+		}
+	}
+	c.SetReplace(*replacePeers, *replaceAllowedIPs)
+	if *hookCaps != "" {
+		c.HookCapabilities = strings.Split(*hookCaps, ",")
+	}
+	c.KillSwitch, err = wgquick.ParseKillSwitch(*killSwitch)
+	if err != nil {
+		logrus.WithError(err).Fatalln("invalid kill switch")
+	}
+	if err := c.Validate(); err != nil {
+		logrus.WithError(err).Fatalln("invalid config")
+	}
+	for _, d := range c.Lint() {
+		l := log.WithField("field", d.Field).WithField("code", d.Code)
+		if d.Line > 0 {
+			l = l.WithField("line", d.Line)
+		}
+		l.Warnln(d.Message)
+	}
 
 	switch args[0] {
 	case "up":
+		if *exitNode != "" {
+			if err := wgquick.UpExitNode(c, iface, wgquick.ExitNode{Egress: *exitNode, Hairpin: *hairpin}, log); err != nil {
+				logrus.WithError(err).Errorln("cannot up exit node")
+			}
+			break
+		}
+		if *captive != "" {
+			url := *captive
+			if url == "default" {
+				url = ""
+			}
+			if err := wgquick.UpCaptive(context.Background(), c, iface, wgquick.HTTPConnectivityCheck(url), 0, log); err != nil {
+				logrus.WithError(err).Errorln("cannot up interface")
+			}
+			break
+		}
 		if err := wgquick.Up(c, iface, log); err != nil {
 			logrus.WithError(err).Errorln("cannot up interface")
 		}
 	case "down":
+		if *exitNode != "" {
+			if err := wgquick.DownExitNode(c, iface, wgquick.ExitNode{Egress: *exitNode, Hairpin: *hairpin}, log); err != nil {
+				logrus.WithError(err).Errorln("cannot down exit node")
+			}
+			break
+		}
 		if err := wgquick.Down(c, iface, log); err != nil {
 			logrus.WithError(err).Errorln("cannot down interface")
 		}
@@ -80,7 +235,99 @@ func main() {
 		if err := wgquick.Sync(c, iface, log); err != nil {
 			logrus.WithError(err).Errorln("cannot sync interface")
 		}
+	case "check":
+		res, err := wgquick.Check(c, iface)
+		if err != nil {
+			logrus.WithError(err).Fatalln("cannot check interface")
+		}
+		for _, p := range res.Problems {
+			log.Warnln(p)
+		}
+		if res.Diff != nil {
+			for _, op := range res.Diff.Plan().Operations {
+				log.WithFields(logrus.Fields{"object": op.Object, "name": op.Name, "field": op.Field, "before": op.Before, "after": op.After}).Warnln(op.Op)
+			}
+		}
+		if !res.InSync {
+			os.Exit(2)
+		}
+		log.Infoln("interface in sync")
+	case "prune":
+		pruned, err := wgquick.PruneStalePeers(c, iface, *staleAfter, log)
+		if err != nil {
+			logrus.WithError(err).Errorln("cannot prune stale peers")
+		}
+		log.WithField("peers", len(pruned)).Infoln("pruned stale peers")
+	case "reload":
+		if err := wgquick.Reload(c, iface, log); err != nil {
+			logrus.WithError(err).Errorln("cannot reload interface")
+		}
 	default:
 		printHelp()
 	}
 }
+
+// runAll runs the command for every config in /etc/wireguard, logging the result of every interface
+func runAll(cmd string, dec wgquick.Decrypter, opts []wgquick.ParseOption) {
+	if cmd == "down" {
+		// the broken config of the running interface still tears it down
+		opts = append(opts, wgquick.SkipValidation())
+	}
+	cfgs, err := wgquick.LoadConfigDir(wgquick.DefaultConfigDir, dec, opts...)
+	if cfgs == nil {
+		logrus.WithError(err).Fatalln("cannot load configs")
+	}
+	errs := make(map[string]error)
+	if bulkErr, ok := err.(*wgquick.BulkError); ok {
+		for iface, err := range bulkErr.Ifaces {
+			logrus.WithError(err).WithField("iface", iface).Errorln("cannot load config")
+			errs[iface] = err
+		}
+	}
+	log := logrus.WithField("cmd", cmd)
+	switch cmd {
+	case "up":
+		err = wgquick.UpAll(cfgs, 0, log)
+	case "down":
+		err = wgquick.DownAll(cfgs, 0, log)
+	case "sync":
+		err = wgquick.SyncAll(cfgs, 0, log)
+	default:
+		printHelp()
+	}
+	var ifaces []string
+	for iface := range cfgs {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+	failed := map[string]error{}
+	if bulkErr, ok := err.(*wgquick.BulkError); ok {
+		failed = bulkErr.Ifaces
+	} else if err != nil {
+		logrus.WithError(err).Fatalln("cannot " + cmd + " interfaces")
+	}
+	for _, iface := range ifaces {
+		if err := failed[iface]; err != nil {
+			log.WithError(err).WithField("iface", iface).Errorln("failed")
+			errs[iface] = err
+			continue
+		}
+		log.WithField("iface", iface).Infoln("done")
+	}
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+}
+
+// formatFile prints the formatted config file, see wgquick.Format
+func formatFile(path string) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		logrus.WithError(err).Fatalln("cannot read config file")
+	}
+	formatted, err := wgquick.Format(text)
+	if err != nil {
+		logrus.WithError(err).Fatalln("cannot format config file")
+	}
+	os.Stdout.Write(formatted)
+}
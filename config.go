@@ -4,31 +4,45 @@ import (
 	"bytes"
 	"encoding"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
+	"github.com/sirupsen/logrus"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 // Config represents full wg-quick like config structure
 type Config struct {
+	// Config holds the device settings. By default Sync is additive: it adds and updates the peers and allowed IPs and
+	// removes the peers marked Remove. ReplacePeers and the per peer ReplaceAllowedIPs make it authoritative, removing
+	// what's on the device but not in the config, see SetReplace and RemovePeer.
 	wgtypes.Config
 
 	// Address list of IP (v4 or v6) addresses (optionally with CIDR masks) to be assigned to the interface. May be specified multiple times.
 	Address []net.IPNet
 
+	// AddressOptions holds additional attributes of the addresses, keyed by the Address CIDR string (e.g. "10.0.0.1/32").
+	// In the config file they follow the address, e.g. `Address = 10.0.0.1/32 peer 10.0.0.2/32`
+	AddressOptions map[string]AddressOptions
+
 	// list of IP (v4 or v6) addresses to be set as the interface’s DNS servers. May be specified multiple times. Upon bringing the interface up, this runs ‘resolvconf -a tun.INTERFACE -m 0 -x‘ and upon bringing it down, this runs ‘resolvconf -d tun.INTERFACE‘. If these particular invocations of resolvconf(8) are undesirable, the PostUp and PostDown keys below may be used instead.
 	DNS []net.IP
 
 	// MTU is automatically determined from the endpoint addresses or the system default route, which is usually a sane choice. However, to manually specify an MTU to override this automatic discovery, this value may be specified explicitly.
 	MTU int
 
-	// Table — Controls the routing table to which routes are added.
-	Table int
+	// Table — Controls the routing table to which routes are added. There are two special values: ‘off’ disables the creation of routes altogether, and ‘auto’ (the default) adds routes to the default table.
+	Table RouteTable
 
 	// PreUp, PostUp, PreDown, PostDown — script snippets which will be executed by bash(1) before/after setting up/tearing down the interface, most commonly used to configure custom DNS options or firewall rules. The special string ‘%i’ is expanded to INTERFACE. Each one may be specified multiple times, in which case the commands are executed in order.
 	PreUp    string
@@ -36,24 +50,166 @@ type Config struct {
 	PreDown  string
 	PostDown string
 
-	// RouteProtocol to set on the route. See linux/rtnetlink.h  Use value > 4 or default 0
+	// EventHooks are run by RunEventMonitor on the runtime events, like the hooks above. Besides %i the placeholders
+	// %p (the peer public key), %e (the peer endpoint) and %r (the removed route) are expanded.
+	EventHooks map[EventType]string
+
+	// HookShell is the shell running the hooks above, `sh -ce` if empty, e.g. `bash -ceo pipefail`. It's split into the
+	// arguments on white space and the hook is appended as the last one. HookDirect runs the hooks without a shell instead.
+	HookShell string
+
+	// HookUser runs the hooks as the user, `user[:group]` by name or id, instead of root, e.g. for the untrusted per-tenant
+	// hooks. They lose the capabilities except HookCapabilities, e.g. CAP_NET_ADMIN for the firewall rules.
+	HookUser         string
+	HookCapabilities []string
+
+	// DNSBackend sets the DNS servers, DNSBackendResolvconf if empty. It may be the comma separated fallback chain, e.g.
+	// `resolved,resolvconf,file` or DNSBackendAuto: Up uses the first backend available on the host instead of failing if
+	// the first one isn't. With the state dir enabled the chosen backend is recorded in the state, so Down uses it too;
+	// otherwise Down selects it again.
+	DNSBackend string
+
+	// ResolvconfAdd and ResolvconfDelete are the shell commands setting and removing the DNS servers, DefaultResolvconfAdd
+	// and DefaultResolvconfDelete if empty. %r is replaced with ResolvconfRecord, the interface record name (DefaultResolvconfRecord
+	// if empty), and %i with the interface name. ResolvconfAdd gets the `nameserver <ip>` lines on stdin.
+	ResolvconfAdd    string
+	ResolvconfDelete string
+	ResolvconfRecord string
+
+	// DNSDefaultRoute makes the tunnel the systemd-resolved default DNS route (`Domains=~.`), so the full tunnel doesn't leak
+	// the queries to the other links. DNSSEC (yes, no, allow-downgrade), DNSOverTLS (yes, no, opportunistic) and LLMNR
+	// (yes, no, resolve) set the resolved link options if not empty, so the queries to the tunnel DNS servers are secured
+	// as the tunnel wants regardless of the global resolved settings. They're applied with resolvectl after the link is up.
+	DNSDefaultRoute bool
+	DNSSEC          string
+	DNSOverTLS      string
+	LLMNR           string
+
+	// RouteProtocol to set on the route, DefaultRouteProtocol if 0. Sync deletes the link routes of this protocol which
+	// it doesn't want, so use the protocol no other daemon uses. See linux/rtnetlink.h, the values <= 4 are reserved.
+	// After the protocol changed, the first Sync with the state dir enabled also deletes the routes of the recorded one.
 	RouteProtocol int
 
 	// RouteMetric sets this metric on all managed routes. Lower number means pick this one
 	RouteMetric int
 
-	// Address label to set on the link
+	// Address label to set on the link IPv4 addresses, unless overridden per address in AddressOptions
 	AddressLabel string
 
+	// AmneziaWG are the AmneziaWG obfuscation parameters, the Jc, Jmin, Jmax, S1, S2 and H1-H4 [Interface] keys
+	AmneziaWG AmneziaWG
+
+	// LinkAlias sets the link ifalias, e.g. the tunnel name or description, so it's identifiable in `ip link` output and monitoring
+	LinkAlias string
+
+	// TxQueueLen sets the link transmit queue length. 0 keeps the kernel default
+	TxQueueLen int
+
+	// LinkGroup sets the link group. 0 keeps the link in the default group
+	LinkGroup uint32
+
+	// NumTxQueues and NumRxQueues set the number of link queues. 0 keeps the kernel default. They can only be set when creating the link
+	NumTxQueues int
+	NumRxQueues int
+
+	// RouteOptions holds additional attributes of the routes, keyed by the destination CIDR string (e.g. "192.168.7.0/24"),
+	// see ParseRouteOptions
+	RouteOptions map[string]RouteOptions
+
+	// Routes are additional routes via the link, e.g. to the networks behind a peer using it as the gateway
+	Routes []Route
+
+	// SourceRules installs `from <address> lookup <Table>` rule for every address, so replies to the tunnel traffic leave via the tunnel
+	// on multi-homed hosts. It requires Table other than auto, off or main.
+	SourceRules bool
+
+	// SourceRulePriority is the priority of the source rules, DefaultSourceRulePriority if 0
+	SourceRulePriority int
+
+	// IPForward enables IPv4 and IPv6 forwarding on Up for the gateway and exit node configs. Down restores the previous
+	// values recorded in the state file, so with more such tunnels the first one down disables forwarding for the others.
+	IPForward bool
+
+	// LANBypass adds `throw` routes for the prefixes of the addresses on the other links to the dedicated Table when
+	// AllowedIPs include the default route, so the LAN traffic (printers, NAS, ...) falls through to the main table
+	// instead of the tunnel. In the main table the LAN routes are more specific than the tunnel default route already.
+	// The prefixes are detected on Up and on every Sync.
+	LANBypass bool
+
+	// ProxyDevice installs proxy ARP and NDP entries (`ip neigh add proxy`) for the peer host AllowedIPs (/32 and /128)
+	// on this LAN device, so the peers appear as the on-link LAN hosts. Up enables proxy_ndp on the device. It needs
+	// forwarding, see IPForward.
+	ProxyDevice string
+
+	// KillSwitch replaces the tunnel routes with routes of this type on Down instead of deleting them, see EngageKillSwitch
+	KillSwitch KillSwitch
+
 	// SaveConfig — if set to ‘true’, the configuration is saved from the current state of the interface upon shutdown.
 	// Currently unsupported
 	SaveConfig bool
+
+	// PeerNames are friendly peer names, parsed from `# Name = laptop` comments in the [Peer] section or the comment directly above it.
+	// They're used in logs so peers aren't only identified by base64 keys.
+	PeerNames map[wgtypes.Key]string
+
+	// EndpointHosts are the peer Endpoint values given as host names, e.g. `vpn.example.com:51820`, so the endpoints
+	// can be resolved again when the network changes, see RefreshEndpoints. The IP literal endpoints aren't recorded.
+	EndpointHosts map[wgtypes.Key]string
+
+	// doc is the original text this config was parsed from, used to preserve comments and ordering
+	doc *document
+}
+
+// RouteTable is the routing table number, or one of the special TableAuto and TableOff values
+type RouteTable int
+
+const (
+	// TableAuto adds routes to the main routing table
+	TableAuto RouteTable = 0
+	// TableOff disables route management
+	TableOff RouteTable = -1
+)
+
+func (t RouteTable) String() string {
+	switch t {
+	case TableAuto:
+		return "auto"
+	case TableOff:
+		return "off"
+	default:
+		return strconv.Itoa(int(t))
+	}
+}
+
+// ParseRouteTable parses wg-quick Table value: "auto", "off" or the table number
+func ParseRouteTable(s string) (RouteTable, error) {
+	switch s {
+	case "auto":
+		return TableAuto, nil
+	case "off":
+		return TableOff, nil
+	}
+	tbl, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if tbl < 0 {
+		return 0, fmt.Errorf("table %d must not be negative", tbl)
+	}
+	return RouteTable(tbl), nil
 }
 
 var _ encoding.TextMarshaler = (*Config)(nil)
 var _ encoding.TextUnmarshaler = (*Config)(nil)
 
+// String returns the config serialization with the private and preshared keys redacted, so it's safe to log.
+// Use StringWithSecrets or MarshalText for the full serialization.
 func (cfg *Config) String() string {
+	return redactSecrets(cfg.StringWithSecrets())
+}
+
+// StringWithSecrets returns the full config serialization, including the private and preshared keys
+func (cfg *Config) StringWithSecrets() string {
 	b, err := cfg.MarshalText()
 	if err != nil {
 		panic(err)
@@ -61,6 +217,25 @@ func (cfg *Config) String() string {
 	return string(b)
 }
 
+const redacted = "(redacted)"
+
+var secretLineRegexp = regexp.MustCompile(`(?m)^(\s*(?:PrivateKey|PresharedKey)\s*=\s*).*$`)
+
+func redactSecrets(text string) string {
+	return secretLineRegexp.ReplaceAllString(text, "${1}"+redacted)
+}
+
+// Peer wraps the peer config so it can be safely printed or logged, with the preshared key redacted
+type Peer wgtypes.PeerConfig
+
+func (p Peer) String() string {
+	psk := ""
+	if p.PresharedKey != nil {
+		psk = ", PresharedKey = " + redacted
+	}
+	return fmt.Sprintf("Peer{PublicKey = %s, AllowedIPs = %v, Endpoint = %v%s}", serializeKey(&p.PublicKey), p.AllowedIPs, p.Endpoint, psk)
+}
+
 func serializeKey(key *wgtypes.Key) string {
 	return base64.StdEncoding.EncodeToString(key[:])
 }
@@ -72,6 +247,9 @@ func toSeconds(duration time.Duration) int {
 var funcMap = template.FuncMap(map[string]interface{}{
 	"wgKey":     serializeKey,
 	"toSeconds": toSeconds,
+	"formatAddress": func(cfg *Config, addr net.IPNet) string {
+		return cfg.formatAddress(addr)
+	},
 })
 
 var cfgTemplate = template.Must(
@@ -80,7 +258,15 @@ var cfgTemplate = template.Must(
 		Funcs(funcMap).
 		Parse(wgtypeTemplateSpec))
 
+// MarshalText serializes the config. Configs obtained by parsing keep their comments and key ordering for unchanged values.
 func (cfg *Config) MarshalText() (text []byte, err error) {
+	if cfg.doc != nil {
+		return cfg.doc.render(cfg)
+	}
+	return cfg.canonicalText()
+}
+
+func (cfg *Config) canonicalText() ([]byte, error) {
 	buff := &bytes.Buffer{}
 	if err := cfgTemplate.Execute(buff, cfg); err != nil {
 		return nil, err
@@ -90,14 +276,24 @@ func (cfg *Config) MarshalText() (text []byte, err error) {
 
 const wgtypeTemplateSpec = `[Interface]
 {{- range .Address }}
-Address = {{ . }}
+Address = {{ formatAddress $ . }}
 {{- end }}
 {{- range .DNS }}
 DNS = {{ . }}
 {{- end }}
-PrivateKey = {{ .PrivateKey | wgKey }}
+{{- if .PrivateKey }}{{ "\n" }}PrivateKey = {{ .PrivateKey | wgKey }}{{ end }}
 {{- if .ListenPort }}{{ "\n" }}ListenPort = {{ .ListenPort }}{{ end }}
+{{- if .FirewallMark }}{{ "\n" }}FwMark = {{ .FirewallMark }}{{ end }}
 {{- if .MTU }}{{ "\n" }}MTU = {{ .MTU }}{{ end }}
+{{- if .AmneziaWG.Jc }}{{ "\n" }}Jc = {{ .AmneziaWG.Jc }}{{ end }}
+{{- if .AmneziaWG.Jmin }}{{ "\n" }}Jmin = {{ .AmneziaWG.Jmin }}{{ end }}
+{{- if .AmneziaWG.Jmax }}{{ "\n" }}Jmax = {{ .AmneziaWG.Jmax }}{{ end }}
+{{- if .AmneziaWG.S1 }}{{ "\n" }}S1 = {{ .AmneziaWG.S1 }}{{ end }}
+{{- if .AmneziaWG.S2 }}{{ "\n" }}S2 = {{ .AmneziaWG.S2 }}{{ end }}
+{{- if .AmneziaWG.H1 }}{{ "\n" }}H1 = {{ .AmneziaWG.H1 }}{{ end }}
+{{- if .AmneziaWG.H2 }}{{ "\n" }}H2 = {{ .AmneziaWG.H2 }}{{ end }}
+{{- if .AmneziaWG.H3 }}{{ "\n" }}H3 = {{ .AmneziaWG.H3 }}{{ end }}
+{{- if .AmneziaWG.H4 }}{{ "\n" }}H4 = {{ .AmneziaWG.H4 }}{{ end }}
 {{- if .Table }}{{ "\n" }}Table = {{ .Table }}{{ end }}
 {{- if .PreUp }}{{ "\n" }}PreUp = {{ .PreUp }}{{ end }}
 {{- if .PostUp }}{{ "\n" }}PostUp = {{ .PostUp }}{{ end }}
@@ -107,23 +303,90 @@ PrivateKey = {{ .PrivateKey | wgKey }}
 {{- range .Peers }}
 {{- "\n" }}
 [Peer]
+{{- with index $.PeerNames .PublicKey }}{{ "\n" }}# Name = {{ . }}{{ end }}
 PublicKey = {{ .PublicKey | wgKey }}
-AllowedIPs = {{ range $i, $el := .AllowedIPs }}{{if $i}}, {{ end }}{{ $el }}{{ end }}
+{{- if .AllowedIPs }}{{ "\n" }}AllowedIPs = {{ range $i, $el := .AllowedIPs }}{{if $i}}, {{ end }}{{ $el }}{{ end }}{{ end }}
 {{- if .PresharedKey }}{{ "\n" }}PresharedKey = {{ .PresharedKey }}{{ end }}
 {{- if .PersistentKeepaliveInterval }}{{ "\n" }}PersistentKeepalive = {{ .PersistentKeepaliveInterval | toSeconds }}{{ end }}
 {{- if .Endpoint }}{{ "\n" }}Endpoint = {{ .Endpoint }}{{ end }}
 {{- end }}
 `
 
-// ParseKey parses the base64 encoded wireguard private key
+// PeerLabel returns human friendly peer identifier for logs, including peer name if known
+func (cfg *Config) PeerLabel(key wgtypes.Key) string {
+	if name := cfg.PeerNames[key]; name != "" {
+		return fmt.Sprintf("%s (%s)", name, serializeKey(&key))
+	}
+	return serializeKey(&key)
+}
+
+// ParseKey parses the wireguard key: the standard base64 one like `wg genkey` prints, or the hex, base64url or unpadded
+// base64 one some provisioning systems emit. It must decode to exactly 32 bytes. The error describes the common
+// mistakes, e.g. the quoted key.
 func ParseKey(key string) (wgtypes.Key, error) {
-	var pkey wgtypes.Key
-	pkeySlice, err := base64.StdEncoding.DecodeString(key)
+	var (
+		keySlice []byte
+		err      error
+	)
+	switch {
+	case len(key) == hex.EncodedLen(wgtypes.KeyLen) && strings.Trim(key, "0123456789abcdefABCDEF") == "":
+		keySlice, err = hex.DecodeString(key)
+	case len(key) == base64.RawStdEncoding.EncodedLen(wgtypes.KeyLen) && strings.ContainsAny(key, "+/"):
+		keySlice, err = base64.RawStdEncoding.DecodeString(key)
+	case len(key) == base64.RawURLEncoding.EncodedLen(wgtypes.KeyLen):
+		keySlice, err = base64.RawURLEncoding.DecodeString(key)
+	case len(key) == base64.URLEncoding.EncodedLen(wgtypes.KeyLen) && strings.ContainsAny(key, "-_"):
+		keySlice, err = base64.URLEncoding.DecodeString(key)
+	default:
+		if hint := keyHint(key); hint != "" {
+			return wgtypes.Key{}, fmt.Errorf("key %s, expected %d base64 characters like `wg genkey` prints", hint, base64.StdEncoding.EncodedLen(wgtypes.KeyLen))
+		}
+		keySlice, err = base64.StdEncoding.DecodeString(key)
+	}
+	defer zeroBytes(keySlice)
 	if err != nil {
-		return pkey, err
+		return wgtypes.Key{}, err
 	}
-	copy(pkey[:], pkeySlice[:])
-	return pkey, nil
+	return wgtypes.NewKey(keySlice)
+}
+
+// keyHint describes what's wrong with the base64 key text, empty if it has the right length. The key itself isn't
+// part of the description, it may be the private one.
+func keyHint(key string) string {
+	n := base64.StdEncoding.EncodedLen(wgtypes.KeyLen)
+	switch {
+	case len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0]:
+		return "is quoted"
+	case len(key) != n:
+		return fmt.Sprintf("has %d characters", len(key))
+	}
+	return ""
+}
+
+// isKeyDirective reports whether the config key holds a wireguard key
+func isKeyDirective(key string) bool {
+	switch key {
+	case "PrivateKey", "PublicKey", "PresharedKey":
+		return true
+	}
+	return false
+}
+
+// canonicalKeyLine rewrites the hex, base64url or unpadded key of the config line to the standard base64, so MarshalText
+// writes it like the template does. The other lines are returned as is.
+func canonicalKeyLine(line, lhs, rhs string) string {
+	if !isKeyDirective(lhs) {
+		return line
+	}
+	key, err := ParseKey(rhs)
+	if err != nil {
+		return line
+	}
+	defer zeroKey(&key)
+	if canonical := serializeKey(&key); canonical != rhs {
+		return strings.Replace(line, rhs, canonical, 1)
+	}
+	return line
 }
 
 type parseState int
@@ -134,55 +397,430 @@ const (
 	peer               = iota
 )
 
+// ParseOption customizes config parsing
+type ParseOption func(*parseOptions)
+
+type parseOptions struct {
+	mode       parseMode
+	warnings   *[]ParseWarning
+	lookupEnv  func(string) (string, bool)
+	includeDir *string
+	peersOnly  bool
+	// permLog warns about config files accessible beyond the owner, strictPerms refuses them
+	permLog     logrus.FieldLogger
+	strictPerms bool
+	resolver    Resolver
+	// endpointFamily picks the resolved Endpoint address
+	endpointFamily EndpointFamily
+	// profile selects the profile of the bundle, see WithProfile
+	profile string
+	// included collects the files read by Include, see LoadConfigDir
+	included map[string]bool
+	// skipValidation is only used by LoadConfigDir, see SkipValidation
+	skipValidation bool
+	// lineOffset is added to the reported line numbers, the profile is parsed apart from the bundle
+	lineOffset int
+}
+
+type parseMode int
+
+const (
+	defaultMode parseMode = iota
+	strictMode
+	lenientMode
+)
+
+// ParseWarning is a problem found while parsing in lenient mode
+type ParseWarning struct {
+	// Line is 1-based line number
+	Line int
+	Err  error
+}
+
+func (w ParseWarning) String() string {
+	return w.Err.Error()
+}
+
+const (
+	// MaxConfigSize is the size limit of the parsed config text, enough for tens of thousands of peers
+	MaxConfigSize = 16 << 20
+	// MaxLineLength is the length limit of a single config line
+	MaxLineLength = 64 << 10
+)
+
+// unknownDirectiveError is returned for the unknown keys
+type unknownDirectiveError string
+
+func (e unknownDirectiveError) Error() string {
+	return "unknown directive " + string(e)
+}
+
+// repeatableKeys may be specified multiple times in the same section
+var repeatableKeys = map[string]bool{
+	"Address":    true,
+	"DNS":        true,
+	"AllowedIPs": true,
+	"Include":    true,
+}
+
+// listKeys are the keys with the comma separated values, arrays in TOML
+var listKeys = map[string]bool{
+	"Address":    true,
+	"DNS":        true,
+	"AllowedIPs": true,
+}
+
+// Strict makes parsing fail on duplicate keys and duplicate [Interface] sections, in addition to
+// unknown keys and malformed lines which always fail parsing by default.
+func Strict() ParseOption {
+	return func(o *parseOptions) {
+		o.mode = strictMode
+	}
+}
+
+// Lenient makes parsing skip unknown keys, duplicate keys, malformed lines and unparsable values,
+// appending a warning for each of them to warnings (if non-nil). Of the duplicate keys the last one wins.
+func Lenient(warnings *[]ParseWarning) ParseOption {
+	return func(o *parseOptions) {
+		o.mode = lenientMode
+		o.warnings = warnings
+	}
+}
+
+// WithEnvExpansion expands ${VAR} references in config values using lookup, e.g. `PrivateKey = ${WG_PRIVATE_KEY}`.
+// Referencing undefined variable is an error. PreUp, PostUp, PreDown and PostDown are left as is, since they're run by the shell.
+func WithEnvExpansion(lookup func(string) (string, bool)) ParseOption {
+	return func(o *parseOptions) {
+		o.lookupEnv = lookup
+	}
+}
+
+// WithIncludes enables `Include = /etc/wireguard/peers/*.conf` directive in the [Interface] section.
+// Matching files are read in lexical order and may only contain [Peer] sections, which are appended to the config peers.
+// Relative patterns are resolved against dir. MarshalText keeps the Include line and leaves the included peers out, they
+// stay in their files.
+func WithIncludes(dir string) ParseOption {
+	return func(o *parseOptions) {
+		o.includeDir = &dir
+	}
+}
+
+func (o *parseOptions) include(cfg *Config, pattern string) error {
+	if o.includeDir == nil {
+		return fmt.Errorf("Include directive is not enabled")
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(*o.includeDir, pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	sub := *o
+	sub.peersOnly = true
+	sub.lineOffset = 0
+	for _, fname := range matches {
+		if o.included != nil {
+			o.included[filepath.Clean(fname)] = true
+		}
+		b, err := o.readFile(fname)
+		if err != nil {
+			return err
+		}
+		inc := &Config{}
+		if err := inc.parse(b, &sub); err != nil {
+			return fmt.Errorf("%s: %w", fname, err)
+		}
+		cfg.Peers = append(cfg.Peers, inc.Peers...)
+		for key, name := range inc.PeerNames {
+			if cfg.PeerNames == nil {
+				cfg.PeerNames = make(map[wgtypes.Key]string)
+			}
+			cfg.PeerNames[key] = name
+		}
+		for key, host := range inc.EndpointHosts {
+			if cfg.EndpointHosts == nil {
+				cfg.EndpointHosts = make(map[wgtypes.Key]string)
+			}
+			cfg.EndpointHosts[key] = host
+		}
+	}
+	return nil
+}
+
+// WarnInsecurePermissions makes LoadConfig log a warning if the config file or an included file is group or world accessible,
+// like wg-quick does. The file contains the private key, it should be 0600.
+func WarnInsecurePermissions(log logrus.FieldLogger) ParseOption {
+	return func(o *parseOptions) {
+		o.permLog = log
+	}
+}
+
+// RequirePrivatePermissions makes LoadConfig fail if the config file or an included file is group or world accessible,
+// i.e. its permissions aren't 0600 or stricter.
+func RequirePrivatePermissions() ParseOption {
+	return func(o *parseOptions) {
+		o.strictPerms = true
+	}
+}
+
+// readFile reads the config file, checking its permissions
+func (o *parseOptions) readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		if o.strictPerms {
+			return nil, fmt.Errorf("%s is accessible by group or others (%04o), it must be 0600 or stricter", path, perm)
+		}
+		if o.permLog != nil {
+			o.permLog.WithField("file", path).Warnf("config file is accessible by group or others (%04o), it should be 0600", perm)
+		}
+	}
+	return ioutil.ReadAll(f)
+}
+
+// ExpandEnv expands ${VAR} references in config values from the process environment. See WithEnvExpansion
+func ExpandEnv() ParseOption {
+	return WithEnvExpansion(os.LookupEnv)
+}
+
+var envRefRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+func expandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var missing []string
+	out := envRefRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		val, ok := lookup(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return val
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined environment variable %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+func isHook(key string) bool {
+	switch key {
+	case "PreUp", "PostUp", "PreDown", "PostDown":
+		return true
+	}
+	return false
+}
+
+// UnmarshalText parses the wg-quick config with default options
 func (cfg *Config) UnmarshalText(text []byte) error {
+	return cfg.Parse(text)
+}
+
+// Parse parses the wg-quick config with given options
+func (cfg *Config) Parse(text []byte, opts ...ParseOption) error {
+	options := &parseOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.profile != "" {
+		return cfg.parseProfile(text, options)
+	}
+	return cfg.parse(text, options)
+}
+
+func (cfg *Config) parse(text []byte, options *parseOptions) error {
 	*cfg = Config{} // Zero out the config
+	if len(text) > MaxConfigSize {
+		return fmt.Errorf("config is %d bytes, exceeding the %d bytes limit", len(text), MaxConfigSize)
+	}
 	state := unknown
 	var peerCfg *wgtypes.PeerConfig
-	for no, line := range strings.Split(string(text), "\n") {
+	var seen map[string]bool
+	// endpointHosts are the host name endpoints by the peer index, the public key may follow the Endpoint
+	endpointHosts := make(map[int]string)
+	seenInterface := false
+	doc, lines := newDocBuilder(string(text))
+
+	// fail reports the line problem. In lenient mode it's recorded as warning and parsing continues
+	fail := func(no int, err error) error {
+		err = fmt.Errorf("[line %d]: %w", no+1+options.lineOffset, err)
+		if options.mode != lenientMode {
+			return err
+		}
+		if options.warnings != nil {
+			*options.warnings = append(*options.warnings, ParseWarning{Line: no + 1 + options.lineOffset, Err: err})
+		}
+		return nil
+	}
+
+	for no, line := range lines {
+		var lineErr error
+		switch {
+		case len(line) > MaxLineLength:
+			lineErr = fmt.Errorf("line is %d bytes, exceeding the %d bytes limit", len(line), MaxLineLength)
+		case !utf8.ValidString(line):
+			lineErr = fmt.Errorf("invalid UTF-8 at column %d", invalidUTF8Column(line))
+		}
+		if lineErr != nil {
+			if err := fail(no, lineErr); err != nil {
+				return err
+			}
+			doc.trivia(line)
+			continue
+		}
 		ln := strings.TrimSpace(line)
 		if len(ln) == 0 || ln[0] == '#' {
+			doc.trivia(line)
 			continue
 		}
 		switch ln {
 		case "[Interface]":
+			if options.peersOnly {
+				return fmt.Errorf("[line %d] only [Peer] sections are allowed in included files", no+1+options.lineOffset)
+			}
+			if seenInterface && options.mode == strictMode {
+				return fmt.Errorf("[line %d]: duplicate [Interface] section", no+1+options.lineOffset)
+			}
+			seenInterface = true
 			state = inter
+			seen = make(map[string]bool)
+			doc.header(line, -1)
 		case "[Peer]":
 			state = peer
+			seen = make(map[string]bool)
 			cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{})
 			peerCfg = &cfg.Peers[len(cfg.Peers)-1]
+			doc.header(line, len(cfg.Peers)-1)
 		default:
-			parts := strings.Split(ln, "=")
+			parts := strings.SplitN(ln, "=", 2)
 			if len(parts) < 2 {
-				return fmt.Errorf("cannot parse line %d, missing =", no)
+				if err := fail(no, fmt.Errorf("cannot parse line, missing =")); err != nil {
+					return err
+				}
+				doc.trivia(line)
+				continue
 			}
 			lhs := strings.TrimSpace(parts[0])
-			rhs := strings.TrimSpace(strings.Join(parts[1:], "="))
+			rhs := strings.TrimSpace(parts[1])
+			doc.keyLine(canonicalKeyLine(line, lhs, rhs), lhs)
+			if options.lookupEnv != nil && !isHook(lhs) {
+				expanded, err := expandEnv(rhs, options.lookupEnv)
+				if err != nil {
+					if err := fail(no, err); err != nil {
+						return err
+					}
+					continue
+				}
+				rhs = expanded
+			}
+			if seen[lhs] && !repeatableKeys[lhs] {
+				if options.mode != defaultMode {
+					if err := fail(no, fmt.Errorf("duplicate key %s", lhs)); err != nil {
+						return err
+					}
+				}
+			}
+			if seen != nil {
+				seen[lhs] = true
+			}
 
+			var err error
 			switch state {
 			case inter:
-				if err := parseInterfaceLine(cfg, lhs, rhs); err != nil {
-					return fmt.Errorf("[line %d]: %v", no+1, err)
+				if lhs == "Include" {
+					first := len(cfg.Peers)
+					err = options.include(cfg, rhs)
+					for i := first; i < len(cfg.Peers); i++ {
+						doc.included(i)
+					}
+				} else {
+					err = parseInterfaceLine(cfg, lhs, rhs)
 				}
 			case peer:
-				if err := parsePeerLine(peerCfg, lhs, rhs); err != nil {
-					return fmt.Errorf("[line %d]: %v", no+1, err)
+				err = options.parsePeerLine(peerCfg, lhs, rhs)
+				if err == nil && lhs == "Endpoint" && !isIPEndpoint(rhs) {
+					endpointHosts[len(cfg.Peers)-1] = rhs
 				}
 			default:
-				return fmt.Errorf("[line %d] cannot parse, unknown state", no+1)
+				err = fmt.Errorf("cannot parse, key outside of [Interface] or [Peer] section")
+			}
+			if err != nil {
+				if _, ok := err.(unknownDirectiveError); !ok {
+					err = fmt.Errorf("%s: %w", lhs, err)
+				}
+				if err := fail(no, err); err != nil {
+					return err
+				}
 			}
 		}
 	}
-	return nil
+	for i, host := range endpointHosts {
+		if cfg.EndpointHosts == nil {
+			cfg.EndpointHosts = make(map[wgtypes.Key]string)
+		}
+		cfg.EndpointHosts[cfg.Peers[i].PublicKey] = host
+	}
+	var err error
+	cfg.doc, err = doc.finish(cfg)
+	if cfg.doc != nil {
+		cfg.doc.lineOffset = options.lineOffset
+	}
+	return err
+}
+
+// invalidUTF8Column returns the 1-based column of the first invalid UTF-8 byte
+func invalidUTF8Column(line string) int {
+	for i, r := range line {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(line[i:]); size == 1 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// parseIPNet parses the IP in CIDR notation. Bare IP implies /32 for IPv4 and /128 for IPv6, like wg-quick does
+func parseIPNet(s string) (net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return net.IPNet{}, fmt.Errorf("invalid IP address: %s", s)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		return net.IPNet{IP: ip, Mask: fullMask(ip)}, nil
+	}
+	ip, cidr, err := net.ParseCIDR(s)
+	if err != nil {
+		return net.IPNet{}, err
+	}
+	return net.IPNet{IP: ip, Mask: cidr.Mask}, nil
 }
+
 func parseInterfaceLine(cfg *Config, lhs string, rhs string) error {
 	switch lhs {
 	case "Address":
 		for _, addr := range strings.Split(rhs, ",") {
-			ip, cidr, err := net.ParseCIDR(strings.TrimSpace(addr))
+			ipnet, opts, err := parseAddress(addr)
 			if err != nil {
 				return err
 			}
-			cfg.Address = append(cfg.Address, net.IPNet{IP: ip, Mask: cidr.Mask})
+			cfg.Address = append(cfg.Address, ipnet)
+			if opts != (AddressOptions{}) {
+				if cfg.AddressOptions == nil {
+					cfg.AddressOptions = make(map[string]AddressOptions)
+				}
+				cfg.AddressOptions[ipnet.String()] = opts
+			}
 		}
 	case "DNS":
 		for _, addr := range strings.Split(rhs, ",") {
@@ -199,11 +837,11 @@ func parseInterfaceLine(cfg *Config, lhs string, rhs string) error {
 		}
 		cfg.MTU = int(mtu)
 	case "Table":
-		tbl, err := strconv.ParseInt(rhs, 10, 64)
+		tbl, err := ParseRouteTable(rhs)
 		if err != nil {
 			return err
 		}
-		cfg.Table = int(tbl)
+		cfg.Table = tbl
 	case "ListenPort":
 		portI64, err := strconv.ParseInt(rhs, 10, 64)
 		if err != nil {
@@ -211,6 +849,17 @@ func parseInterfaceLine(cfg *Config, lhs string, rhs string) error {
 		}
 		port := int(portI64)
 		cfg.ListenPort = &port
+	case "FwMark":
+		mark := 0
+		if rhs != "off" {
+			// the mark is the 32-bit value, the high bit is commonly used, e.g. 0xca6c or 0x80000000
+			markU64, err := strconv.ParseUint(rhs, 0, 32)
+			if err != nil {
+				return err
+			}
+			mark = int(markU64)
+		}
+		cfg.FirewallMark = &mark
 	case "PreUp":
 		cfg.PreUp = rhs
 	case "PostUp":
@@ -225,45 +874,47 @@ func parseInterfaceLine(cfg *Config, lhs string, rhs string) error {
 			return err
 		}
 		cfg.SaveConfig = save
+	case "Jc", "Jmin", "Jmax", "S1", "S2", "H1", "H2", "H3", "H4":
+		return cfg.AmneziaWG.parseLine(lhs, rhs)
 	case "PrivateKey":
 		key, err := ParseKey(rhs)
 		if err != nil {
-			return fmt.Errorf("cannot decode key %v", err)
+			return fmt.Errorf("cannot decode key %w", err)
 		}
 		cfg.PrivateKey = &key
 	default:
-		return fmt.Errorf("unknown directive %s", lhs)
+		return unknownDirectiveError(lhs)
 	}
 	return nil
 }
 
-func parsePeerLine(peerCfg *wgtypes.PeerConfig, lhs string, rhs string) error {
+func (o *parseOptions) parsePeerLine(peerCfg *wgtypes.PeerConfig, lhs string, rhs string) error {
 	switch lhs {
 	case "PublicKey":
 		key, err := ParseKey(rhs)
 		if err != nil {
-			return fmt.Errorf("cannot decode key %v", err)
+			return fmt.Errorf("cannot decode key %w", err)
 		}
 		peerCfg.PublicKey = key
 	case "PresharedKey":
 		key, err := ParseKey(rhs)
 		if err != nil {
-			return fmt.Errorf("cannot decode key %v", err)
+			return fmt.Errorf("cannot decode key %w", err)
 		}
 		if peerCfg.PresharedKey != nil {
-			return fmt.Errorf("preshared key already defined %v", err)
+			return fmt.Errorf("preshared key already defined")
 		}
 		peerCfg.PresharedKey = &key
 	case "AllowedIPs":
 		for _, addr := range strings.Split(rhs, ",") {
-			ip, cidr, err := net.ParseCIDR(strings.TrimSpace(addr))
+			ipnet, err := parseIPNet(addr)
 			if err != nil {
-				return fmt.Errorf("cannot parse %s: %v", addr, err)
+				return fmt.Errorf("cannot parse %s: %w", addr, err)
 			}
-			peerCfg.AllowedIPs = append(peerCfg.AllowedIPs, net.IPNet{IP: ip, Mask: cidr.Mask})
+			peerCfg.AllowedIPs = append(peerCfg.AllowedIPs, ipnet)
 		}
 	case "Endpoint":
-		addr, err := net.ResolveUDPAddr("", rhs)
+		addr, err := o.resolveEndpoint(rhs)
 		if err != nil {
 			return err
 		}
@@ -276,7 +927,7 @@ func parsePeerLine(peerCfg *wgtypes.PeerConfig, lhs string, rhs string) error {
 		dur := time.Duration(t * int64(time.Second))
 		peerCfg.PersistentKeepaliveInterval = &dur
 	default:
-		return fmt.Errorf("unknown directive %s", lhs)
+		return unknownDirectiveError(lhs)
 	}
 	return nil
 }
@@ -1,9 +1,20 @@
 package wgquick
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 var testConfigs = map[string]string{
@@ -36,6 +47,15 @@ AllowedIPs = 10.192.122.4/32, 192.168.0.0/16
 [Peer]
 PublicKey = gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=
 AllowedIPs = 10.10.10.230/32
+`,
+	"dynamic-port": `[Interface]
+Address = 10.192.122.1/24
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 0
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.0/24
 `,
 	"sample-3": `[Interface]
 Address = 10.192.122.1/24
@@ -65,3 +85,392 @@ func TestExampleConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestEnvExpansion(t *testing.T) {
+	env := map[string]string{
+		"WG_PRIVATE_KEY": "oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=",
+		"WG_ENDPOINT":    "123.12.12.1",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	text := `[Interface]
+PrivateKey = ${WG_PRIVATE_KEY}
+PostUp = echo ${UNDEFINED}
+
+[Peer]
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+AllowedIPs = 0.0.0.0/0
+Endpoint = ${WG_ENDPOINT}:51820
+`
+	c := &Config{}
+	assert.Error(t, c.UnmarshalText([]byte(text)))
+	assert.NoError(t, c.Parse([]byte(text), WithEnvExpansion(lookup)))
+	assert.Equal(t, env["WG_PRIVATE_KEY"], c.PrivateKey.String())
+	assert.Equal(t, "123.12.12.1:51820", c.Peers[0].Endpoint.String())
+	assert.Equal(t, "echo ${UNDEFINED}", c.PostUp)
+
+	delete(env, "WG_ENDPOINT")
+	assert.Error(t, c.Parse([]byte(text), WithEnvExpansion(lookup)))
+}
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-include")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "peers"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "peers", "a.conf"), []byte(`[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.3/32
+`), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "peers", "b.conf"), []byte(`[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.192.122.4/32
+`), 0600))
+
+	text := `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+Include = peers/*.conf
+
+[Peer]
+PublicKey = gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=
+AllowedIPs = 10.10.10.230/32
+`
+	c := &Config{}
+	assert.Error(t, c.UnmarshalText([]byte(text)))
+	require.NoError(t, c.Parse([]byte(text), WithIncludes(dir)))
+	require.Len(t, c.Peers, 3)
+	assert.Equal(t, "10.192.122.3/32", c.Peers[0].AllowedIPs[0].String())
+	assert.Equal(t, "10.192.122.4/32", c.Peers[1].AllowedIPs[0].String())
+	assert.Equal(t, "10.10.10.230/32", c.Peers[2].AllowedIPs[0].String())
+	assert.Equal(t, text, c.StringWithSecrets(), "included peers are not inlined")
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "peers", "c.conf"), []byte("[Interface]\nMTU = 1420\n"), 0600))
+	assert.Error(t, c.Parse([]byte(text), WithIncludes(dir)))
+}
+
+func TestConfigPermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-perms")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wg0.conf")
+	require.NoError(t, ioutil.WriteFile(path, []byte(testConfigs["simple"]), 0600))
+	require.NoError(t, os.Chmod(path, 0644))
+
+	log, hook := logtest.NewNullLogger()
+	_, err = LoadConfig(path, nil, WarnInsecurePermissions(log))
+	require.NoError(t, err)
+	require.Len(t, hook.Entries, 1)
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+
+	_, err = LoadConfig(path, nil, RequirePrivatePermissions())
+	assert.Error(t, err)
+
+	require.NoError(t, os.Chmod(path, 0600))
+	hook.Reset()
+	_, err = LoadConfig(path, nil, WarnInsecurePermissions(log), RequirePrivatePermissions())
+	require.NoError(t, err)
+	assert.Empty(t, hook.Entries)
+}
+
+func TestPreserveComments(t *testing.T) {
+	text := `# managed by hand
+[Interface]
+# VPN address
+Address = 10.200.100.8/24
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+MTU = 1420
+
+# laptop
+[Peer]
+Endpoint = 123.12.12.1:51820
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+AllowedIPs = 10.200.100.2/32
+
+# phone
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.200.100.3/32
+`
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(text)))
+	assert.Equal(t, text, c.StringWithSecrets())
+
+	c.MTU = 1380
+	port := 51820
+	c.ListenPort = &port
+	c.Peers = c.Peers[:1]
+	c.Peers = append(c.Peers, testPeer(t, "TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=", "10.200.100.4/32"))
+	assert.Equal(t, `# managed by hand
+[Interface]
+# VPN address
+Address = 10.200.100.8/24
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+MTU = 1380
+ListenPort = 51820
+
+# laptop
+[Peer]
+Endpoint = 123.12.12.1:51820
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+AllowedIPs = 10.200.100.2/32
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.200.100.4/32
+`, c.StringWithSecrets())
+}
+
+func testPeer(t *testing.T, publicKey string, allowedIP string) wgtypes.PeerConfig {
+	key, err := ParseKey(publicKey)
+	require.NoError(t, err)
+	_, aip, err := net.ParseCIDR(allowedIP)
+	require.NoError(t, err)
+	return wgtypes.PeerConfig{PublicKey: key, AllowedIPs: []net.IPNet{*aip}}
+}
+
+func TestPeerNames(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+# laptop
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.3/32
+
+# owned by bob
+[Peer]
+# Name = phone
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.192.122.4/32
+`)))
+	assert.Equal(t, "laptop", c.PeerNames[c.Peers[0].PublicKey])
+	assert.Equal(t, "phone", c.PeerNames[c.Peers[1].PublicKey])
+	assert.Equal(t, "phone (TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=)", c.PeerLabel(c.Peers[1].PublicKey))
+
+	c.PeerNames[c.Peers[1].PublicKey] = "tablet"
+	c.doc = nil
+	assert.Equal(t, `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+[Peer]
+# Name = laptop
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.3/32
+
+[Peer]
+# Name = tablet
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 10.192.122.4/32
+`, c.StringWithSecrets())
+}
+
+func TestRedactedString(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	s := c.String()
+	assert.NotContains(t, s, "oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=")
+	assert.NotContains(t, s, "/UwcSPg38hW/D9Y3tcS1FOV0K1wuURMbS0sesJEP5ak=")
+	assert.Contains(t, s, "PrivateKey = (redacted)")
+	assert.Contains(t, s, "PresharedKey = (redacted)")
+	assert.NotContains(t, Peer(c.Peers[0]).String(), "/UwcSPg38hW/D9Y3tcS1FOV0K1wuURMbS0sesJEP5ak=")
+	assert.Equal(t, testConfigs["simple"], c.StringWithSecrets())
+}
+
+func TestParseModes(t *testing.T) {
+	text := `[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+MTU = 1420
+MTU = 1380
+FooBar = 1
+this line is broken
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.3/32
+AllowedIPs = 10.192.122.4/32
+PersistentKeepalive = often
+`
+	c := &Config{}
+	assert.Error(t, c.UnmarshalText([]byte(text)))
+	assert.Error(t, c.Parse([]byte(text), Strict()))
+
+	var warnings []ParseWarning
+	require.NoError(t, c.Parse([]byte(text), Lenient(&warnings)))
+	var lines []int
+	for _, w := range warnings {
+		lines = append(lines, w.Line)
+	}
+	assert.Equal(t, []int{4, 5, 6, 12}, lines)
+	assert.Equal(t, 1380, c.MTU)
+	assert.Len(t, c.Peers[0].AllowedIPs, 2)
+	assert.Nil(t, c.Peers[0].PersistentKeepaliveInterval)
+	assert.Equal(t, text, c.StringWithSecrets(), "skipped lines are preserved")
+
+	dup := "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\nMTU = 1420\nMTU = 1380\n"
+	assert.NoError(t, c.UnmarshalText([]byte(dup)))
+	err := c.Parse([]byte(dup), Strict())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "[line 4]")
+}
+
+func TestBareIPs(t *testing.T) {
+	text := `[Interface]
+Address = 10.0.0.2, fd00::2
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.0.0.1, 10.1.0.0/16
+`
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(text)))
+	assert.Equal(t, "10.0.0.2/32", c.Address[0].String())
+	assert.Equal(t, "fd00::2/128", c.Address[1].String())
+	assert.Equal(t, "10.0.0.1/32", c.Peers[0].AllowedIPs[0].String())
+	assert.Equal(t, "10.1.0.0/16", c.Peers[0].AllowedIPs[1].String())
+	assert.Equal(t, text, c.StringWithSecrets())
+	assert.Error(t, c.UnmarshalText([]byte("[Interface]\nAddress = 10.0.0.256\n")))
+}
+
+func TestTableKeywords(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte("[Interface]\nTable = off\n")))
+	assert.Equal(t, TableOff, c.Table)
+	c.doc = nil
+	assert.Equal(t, "[Interface]\nTable = off\n", c.StringWithSecrets())
+
+	require.NoError(t, c.UnmarshalText([]byte("[Interface]\nTable = auto\n")))
+	assert.Equal(t, TableAuto, c.Table)
+	require.NoError(t, c.UnmarshalText([]byte("[Interface]\nTable = 1234\n")))
+	assert.Equal(t, RouteTable(1234), c.Table)
+	assert.Error(t, c.UnmarshalText([]byte("[Interface]\nTable = -2\n")))
+}
+
+func TestFwMark(t *testing.T) {
+	for text, mark := range map[string]int{
+		"off":        0,
+		"51820":      51820,
+		"0xca6c":     0xca6c,
+		"0x80000000": 0x80000000,
+		"0xffffffff": 0xffffffff,
+	} {
+		c := &Config{}
+		require.NoError(t, c.UnmarshalText([]byte("[Interface]\nFwMark = "+text+"\n")), text)
+		require.NotNil(t, c.FirewallMark, text)
+		assert.Equal(t, mark, *c.FirewallMark, text)
+	}
+	for _, text := range []string{"-1", "0x100000000", "mark"} {
+		assert.Error(t, (&Config{}).UnmarshalText([]byte("[Interface]\nFwMark = "+text+"\n")), text)
+	}
+}
+
+func TestAddressOptions(t *testing.T) {
+	text := `[Interface]
+Address = 10.0.0.1/32 peer 10.0.0.2/32, 10.1.0.1/24 noprefixroute label wg0:lan
+Address = fd00::1/64 metric 100 valid_lft 3600 preferred_lft forever label wg0:v6
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+`
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(text)))
+	require.Len(t, c.Address, 3)
+	assert.Equal(t, "10.0.0.2/32", c.AddressOptions["10.0.0.1/32"].Peer.String())
+	assert.Nil(t, c.AddressOptions["10.1.0.1/24"].Peer)
+	assert.True(t, c.AddressOptions["10.1.0.1/24"].NoPrefixRoute)
+	assert.Equal(t, AddressOptions{Label: "wg0:v6", Metric: 100, ValidLifetime: time.Hour}, c.AddressOptions["fd00::1/64"])
+	c.AddressLabel = "wg0"
+	assert.Equal(t, "wg0", c.netlinkAddr(c.Address[0]).Label)
+	assert.Equal(t, "wg0:lan", c.netlinkAddr(c.Address[1]).Label)
+	assert.Equal(t, "", c.netlinkAddr(c.Address[2]).Label)
+	c.AddressLabel = ""
+	c.doc = nil
+	assert.Equal(t, `[Interface]
+Address = 10.0.0.1/32 peer 10.0.0.2/32
+Address = 10.1.0.1/24 noprefixroute label wg0:lan
+Address = fd00::1/64 label wg0:v6 metric 100 valid_lft 3600
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+`, c.StringWithSecrets())
+	assert.Error(t, c.UnmarshalText([]byte("[Interface]\nAddress = 10.0.0.1/32 peer\n")))
+	assert.Error(t, c.UnmarshalText([]byte("[Interface]\nAddress = 10.0.0.1/32 bogus\n")))
+	assert.Error(t, c.UnmarshalText([]byte("[Interface]\nAddress = 10.0.0.1/32 metric -1\n")))
+}
+
+func TestParseHardening(t *testing.T) {
+	c := &Config{}
+	err := c.UnmarshalText([]byte("[Interface]\nPrivateKey = c2hvcnQ=\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "[line 2]: PrivateKey: cannot decode key")
+
+	err = c.UnmarshalText([]byte("[Interface]\nPostUp = echo \xff\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "[line 2]: invalid UTF-8 at column 15")
+
+	err = c.UnmarshalText([]byte("[Interface]\nPostUp = " + strings.Repeat("x", MaxLineLength) + "\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeding")
+	assert.Error(t, c.UnmarshalText(make([]byte, MaxConfigSize+1)))
+
+	text := "[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\nPostUp = echo \xff\n"
+	var warnings []ParseWarning
+	require.NoError(t, c.Parse([]byte(text), Lenient(&warnings)))
+	require.Len(t, warnings, 1)
+	assert.Equal(t, 3, warnings[0].Line)
+	assert.Equal(t, text, c.StringWithSecrets(), "skipped lines are preserved")
+
+	b := &strings.Builder{}
+	b.WriteString("[Interface]\nPrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=\n")
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(b, "\n[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\nAllowedIPs = 10.%d.%d.0/24\n", i>>8, i&0xff)
+	}
+	require.NoError(t, c.UnmarshalText([]byte(b.String())))
+	assert.Len(t, c.Peers, 5000)
+}
+
+func TestKeyEncodings(t *testing.T) {
+	const std = "oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM="
+	want, err := ParseKey(std)
+	require.NoError(t, err)
+	for _, key := range []string{
+		"a0ae7a0c4f547bdccaefaac073ca4197aa29a61fb5bf7ea59bb7175ec40aad03",
+		"A0AE7A0C4F547BDCCAEFAAC073CA4197AA29A61FB5BF7EA59BB7175EC40AAD03",
+		"oK56DE9Ue9zK76rAc8pBl6opph-1v36lm7cXXsQKrQM=",
+		"oK56DE9Ue9zK76rAc8pBl6opph-1v36lm7cXXsQKrQM",
+	} {
+		got, err := ParseKey(key)
+		require.NoError(t, err, key)
+		assert.Equal(t, want, got, key)
+	}
+
+	for _, tc := range []struct {
+		name, key string
+	}{
+		{"std", "SAdAhWK+24tgzgXB3s/jrRa3IjCWfeAfZAt+Rym0n04="},
+		{"raw std", "SAdAhWK+24tgzgXB3s/jrRa3IjCWfeAfZAt+Rym0n04"},
+		{"url", "SAdAhWK-24tgzgXB3s_jrRa3IjCWfeAfZAt-Rym0n04="},
+		{"raw url", "SAdAhWK-24tgzgXB3s_jrRa3IjCWfeAfZAt-Rym0n04"},
+	} {
+		got, err := ParseKey(tc.key)
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, "SAdAhWK+24tgzgXB3s/jrRa3IjCWfeAfZAt+Rym0n04=", got.String(), tc.name)
+	}
+
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(`[Interface]
+PrivateKey = a0ae7a0c4f547bdccaefaac073ca4197aa29a61fb5bf7ea59bb7175ec40aad03
+
+[Peer]
+PublicKey = GtL7fZc_bLnqZldpVofMCD6hDjrK28SsdLxevJ-qtKU
+AllowedIPs = 10.0.0.2/32
+`)))
+	text, err := c.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, `[Interface]
+PrivateKey = `+std+`
+
+[Peer]
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+AllowedIPs = 10.0.0.2/32
+`, string(text))
+}
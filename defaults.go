@@ -0,0 +1,55 @@
+package wgquick
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultMTU is the MTU used when none is specified. It's 1500 minus the worst case (IPv6) wireguard overhead
+const DefaultMTU = 1420
+
+// DefaultRouteProtocol marks the routes Sync adds when no RouteProtocol is set, e.g. `ip route show proto 86`. Sync
+// deletes only the routes of the link carrying the config protocol, so the routes added by the other daemons (usually
+// RTPROT_BOOT or RTPROT_STATIC) are left alone. It differs from DomainRouteProtocol.
+const DefaultRouteProtocol = 86
+
+// DefaultSourceRulePriority is the priority of the source rules, picked to be before the main table lookup at 32766
+const DefaultSourceRulePriority = 10000
+
+// FillDefaults sets the unset fields to their defaults:
+// * MTU to DefaultMTU
+// * Address and AllowedIPs without the mask to /32 (IPv4) or /128 (IPv6)
+// * Table auto to the main routing table
+// * RouteProtocol to DefaultRouteProtocol
+// * SourceRulePriority to DefaultSourceRulePriority
+//
+// Sync (and thus Up) applies them to a copy of the passed config.
+func (cfg *Config) FillDefaults() {
+	if cfg.MTU == 0 {
+		cfg.MTU = DefaultMTU
+	}
+	for i := range cfg.Address {
+		fillMask(&cfg.Address[i])
+	}
+	for i := range cfg.Peers {
+		for j := range cfg.Peers[i].AllowedIPs {
+			fillMask(&cfg.Peers[i].AllowedIPs[j])
+		}
+	}
+	if cfg.Table == TableAuto {
+		cfg.Table = unix.RT_CLASS_MAIN
+	}
+	if cfg.RouteProtocol == 0 {
+		cfg.RouteProtocol = DefaultRouteProtocol
+	}
+	if cfg.SourceRulePriority == 0 {
+		cfg.SourceRulePriority = DefaultSourceRulePriority
+	}
+}
+
+func fillMask(n *net.IPNet) {
+	if len(n.Mask) == 0 {
+		n.Mask = fullMask(n.IP)
+	}
+}
@@ -0,0 +1,31 @@
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestFillDefaults(t *testing.T) {
+	c := &Config{
+		Address: []net.IPNet{{IP: net.ParseIP("10.0.0.1")}, {IP: net.ParseIP("fd00::1")}},
+		Config: wgtypes.Config{Peers: []wgtypes.PeerConfig{{
+			AllowedIPs: []net.IPNet{{IP: net.ParseIP("10.0.0.2")}},
+		}}},
+		MTU: 1380,
+	}
+	c.FillDefaults()
+	assert.Equal(t, 1380, c.MTU)
+	assert.Equal(t, "10.0.0.1/32", c.Address[0].String())
+	assert.Equal(t, "fd00::1/128", c.Address[1].String())
+	assert.Equal(t, "10.0.0.2/32", c.Peers[0].AllowedIPs[0].String())
+	assert.Equal(t, RouteTable(unix.RT_CLASS_MAIN), c.Table)
+	assert.Equal(t, DefaultRouteProtocol, c.RouteProtocol)
+
+	c = &Config{}
+	c.FillDefaults()
+	assert.Equal(t, DefaultMTU, c.MTU)
+}
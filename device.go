@@ -0,0 +1,98 @@
+package wgquick
+
+import (
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// deviceUpdate returns the config with only the peers differing from the device state, so a resync of a device with thousands
+// of peers sends just the changes. Peers present on the device but missing in the config are removed if cfg.ReplacePeers is set.
+func deviceUpdate(cfg wgtypes.Config, dev *wgtypes.Device) wgtypes.Config {
+	present := make(map[wgtypes.Key]*wgtypes.Peer, len(dev.Peers))
+	for i := range dev.Peers {
+		present[dev.Peers[i].PublicKey] = &dev.Peers[i]
+	}
+
+	update := cfg
+	update.Peers = nil
+	update.ReplacePeers = false
+	wanted := make(map[wgtypes.Key]bool, len(cfg.Peers))
+	for _, peer := range cfg.Peers {
+		wanted[peer.PublicKey] = true
+		if peer.Remove {
+			if _, ok := present[peer.PublicKey]; ok {
+				update.Peers = append(update.Peers, wgtypes.PeerConfig{PublicKey: peer.PublicKey, Remove: true})
+			}
+			continue
+		}
+		if cfg.ReplacePeers {
+			// replacing the peers resets the unset fields, so the update has to reset them explicitly
+			peer = resetPeer(peer)
+		}
+		if p, ok := present[peer.PublicKey]; ok && peerMatches(p, peer) {
+			continue
+		}
+		update.Peers = append(update.Peers, peer)
+	}
+	if cfg.ReplacePeers {
+		for _, p := range dev.Peers {
+			if !wanted[p.PublicKey] {
+				update.Peers = append(update.Peers, wgtypes.PeerConfig{PublicKey: p.PublicKey, Remove: true})
+			}
+		}
+	}
+	return update
+}
+
+// resetPeer returns the peer config with the unset preshared key and keepalive set to zero and the allowed IPs replaced
+func resetPeer(peer wgtypes.PeerConfig) wgtypes.PeerConfig {
+	if peer.PresharedKey == nil {
+		peer.PresharedKey = &wgtypes.Key{}
+	}
+	if peer.PersistentKeepaliveInterval == nil {
+		var keepalive time.Duration
+		peer.PersistentKeepaliveInterval = &keepalive
+	}
+	peer.ReplaceAllowedIPs = true
+	return peer
+}
+
+// peerMatches reports whether applying the peer config wouldn't change the device peer
+func peerMatches(p *wgtypes.Peer, cfg wgtypes.PeerConfig) bool {
+	if cfg.PresharedKey != nil && *cfg.PresharedKey != p.PresharedKey {
+		return false
+	}
+	if cfg.Endpoint != nil && udpAddrString(cfg.Endpoint) != udpAddrString(p.Endpoint) {
+		return false
+	}
+	if cfg.PersistentKeepaliveInterval != nil && *cfg.PersistentKeepaliveInterval != p.PersistentKeepaliveInterval {
+		return false
+	}
+	added, removed := diffIPNets(p.AllowedIPs, cfg.AllowedIPs)
+	if len(added) > 0 {
+		return false
+	}
+	return !cfg.ReplaceAllowedIPs || len(removed) == 0
+}
+
+// SetReplace chooses between the authoritative and additive device sync of the config. With peers the device peers missing
+// in the config are removed, with allowedIPs the peer allowed IPs missing in the config.
+func (cfg *Config) SetReplace(peers, allowedIPs bool) {
+	cfg.ReplacePeers = peers
+	for i := range cfg.Peers {
+		cfg.Peers[i].ReplaceAllowedIPs = allowedIPs
+	}
+}
+
+// RemovePeer marks the peer to be removed from the device by the next sync, so the additive sync can remove it too.
+// The peer is added to the config if missing.
+func (cfg *Config) RemovePeer(key wgtypes.Key) {
+	for i := range cfg.Peers {
+		if cfg.Peers[i].PublicKey == key {
+			cfg.Peers[i].Remove = true
+			return
+		}
+	}
+	cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{PublicKey: key, Remove: true})
+}
@@ -0,0 +1,160 @@
+package wgquick
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestDeviceUpdate(t *testing.T) {
+	cfg := &Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfigs["simple"])))
+	cfg.FillDefaults()
+	require.NotEmpty(t, cfg.Peers)
+	peer := cfg.Peers[0]
+
+	dev := &wgtypes.Device{Peers: []wgtypes.Peer{{
+		PublicKey:  peer.PublicKey,
+		Endpoint:   peer.Endpoint,
+		AllowedIPs: peer.AllowedIPs,
+	}}}
+	if peer.PresharedKey != nil {
+		dev.Peers[0].PresharedKey = *peer.PresharedKey
+	}
+	if peer.PersistentKeepaliveInterval != nil {
+		dev.Peers[0].PersistentKeepaliveInterval = *peer.PersistentKeepaliveInterval
+	}
+	assert.Empty(t, deviceUpdate(cfg.Config, dev).Peers)
+
+	stale := wgtypes.Peer{PublicKey: wgtypes.Key{1}}
+	dev.Peers = append(dev.Peers, stale)
+	assert.Empty(t, deviceUpdate(cfg.Config, dev).Peers)
+
+	cfg.ReplacePeers = true
+	update := deviceUpdate(cfg.Config, dev)
+	assert.False(t, update.ReplacePeers)
+	require.Len(t, update.Peers, 1)
+	assert.Equal(t, stale.PublicKey, update.Peers[0].PublicKey)
+	assert.True(t, update.Peers[0].Remove)
+
+	cfg.ReplacePeers = false
+	dev.Peers[0].AllowedIPs = nil
+	update = deviceUpdate(cfg.Config, dev)
+	require.Len(t, update.Peers, 1)
+	assert.Equal(t, peer.PublicKey, update.Peers[0].PublicKey)
+}
+
+func TestDeviceUpdateReplace(t *testing.T) {
+	cfg := &Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfigs["simple"])))
+	cfg.FillDefaults()
+	peer := cfg.Peers[0]
+	extra := net.IPNet{IP: net.IPv4(192, 168, 7, 0), Mask: net.CIDRMask(24, 32)}
+	dev := &wgtypes.Device{Peers: []wgtypes.Peer{{
+		PublicKey:  peer.PublicKey,
+		Endpoint:   peer.Endpoint,
+		AllowedIPs: append(append([]net.IPNet(nil), peer.AllowedIPs...), extra),
+	}}}
+	if peer.PresharedKey != nil {
+		dev.Peers[0].PresharedKey = *peer.PresharedKey
+	}
+	if peer.PersistentKeepaliveInterval != nil {
+		dev.Peers[0].PersistentKeepaliveInterval = *peer.PersistentKeepaliveInterval
+	}
+	assert.Empty(t, deviceUpdate(cfg.Config, dev).Peers)
+
+	cfg.SetReplace(false, true)
+	update := deviceUpdate(cfg.Config, dev)
+	require.Len(t, update.Peers, 1)
+	assert.True(t, update.Peers[0].ReplaceAllowedIPs)
+
+	cfg.SetReplace(false, false)
+	cfg.RemovePeer(wgtypes.Key{1})
+	assert.Empty(t, deviceUpdate(cfg.Config, dev).Peers)
+	cfg.RemovePeer(peer.PublicKey)
+	update = deviceUpdate(cfg.Config, dev)
+	require.Len(t, update.Peers, 1)
+	assert.Equal(t, wgtypes.PeerConfig{PublicKey: peer.PublicKey, Remove: true}, update.Peers[0])
+	assert.Empty(t, cfg.managedRoutes())
+	assert.NoError(t, cfg.Validate())
+}
+
+// peersConfig returns the config with n peers, each with a single /32 allowed IP
+func peersConfig(n int) *Config {
+	cfg := &Config{Address: []net.IPNet{{IP: net.IPv4(10, 0, 0, 1), Mask: net.CIDRMask(8, 32)}}}
+	for i := 0; i < n; i++ {
+		var key wgtypes.Key
+		key[0], key[1] = byte(i>>8), byte(i)
+		cfg.Peers = append(cfg.Peers, wgtypes.PeerConfig{
+			PublicKey:  key,
+			AllowedIPs: []net.IPNet{{IP: net.IPv4(10, 1, byte(i>>8), byte(i)), Mask: net.CIDRMask(32, 32)}},
+		})
+	}
+	return cfg
+}
+
+// BenchmarkDeviceUpdate measures computing the changed peers of a resync with 5k peers and a single change
+func BenchmarkDeviceUpdate(b *testing.B) {
+	cfg := peersConfig(5000)
+	dev := &wgtypes.Device{}
+	for _, p := range cfg.Peers {
+		dev.Peers = append(dev.Peers, wgtypes.Peer{PublicKey: p.PublicKey, AllowedIPs: p.AllowedIPs})
+	}
+	keepalive := 25 * time.Second
+	cfg.Peers[0].PersistentKeepaliveInterval = &keepalive
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if update := deviceUpdate(cfg.Config, dev); len(update.Peers) != 1 {
+			b.Fatalf("expected 1 changed peer, got %d", len(update.Peers))
+		}
+	}
+}
+
+// BenchmarkSyncPeers measures the bring-up and the resync of a link with 5k peers. It needs root and the wireguard kernel module.
+func BenchmarkSyncPeers(b *testing.B) {
+	c, err := NewClient()
+	if err != nil {
+		b.Skip(err)
+	}
+	defer c.Close()
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(b, err)
+	cfg := peersConfig(5000)
+	cfg.PrivateKey = &key
+	log := logrus.New()
+	log.Out = ioutil.Discard
+
+	const iface = "wgbench0"
+	for _, resync := range []bool{false, true} {
+		b.Run(fmt.Sprintf("resync=%v", resync), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if !resync || i == 0 {
+					b.StopTimer()
+					if link, err := c.nl.LinkByName(iface); err == nil {
+						require.NoError(b, c.nl.LinkDel(link))
+					}
+					if resync {
+						if err := c.Sync(cfg, iface, log); err != nil {
+							b.Skip(err)
+						}
+					}
+					b.StartTimer()
+				}
+				if err := c.Sync(cfg, iface, log); err != nil {
+					b.Skip(err)
+				}
+			}
+		})
+	}
+	if link, err := c.nl.LinkByName(iface); err == nil {
+		c.nl.LinkDel(link)
+	}
+}
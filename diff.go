@@ -0,0 +1,237 @@
+package wgquick
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// FieldChange is a change of a single scalar field. Secrets are never included, only the fact they changed
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// PeerDiff describes changes of a peer present in both configs
+type PeerDiff struct {
+	PublicKey         wgtypes.Key
+	Changes           []FieldChange
+	AllowedIPsAdded   []net.IPNet
+	AllowedIPsRemoved []net.IPNet
+}
+
+// ConfigDiff is the structured difference between two configs
+type ConfigDiff struct {
+	Interface        []FieldChange
+	AddressesAdded   []net.IPNet
+	AddressesRemoved []net.IPNet
+	DNSAdded         []net.IP
+	DNSRemoved       []net.IP
+	RoutesAdded      []net.IPNet
+	RoutesRemoved    []net.IPNet
+	PeersAdded       []wgtypes.PeerConfig
+	PeersRemoved     []wgtypes.PeerConfig
+	PeersChanged     []PeerDiff
+}
+
+// Empty reports whether there are no differences
+func (d *ConfigDiff) Empty() bool {
+	return len(d.Interface) == 0 &&
+		len(d.AddressesAdded) == 0 && len(d.AddressesRemoved) == 0 &&
+		len(d.DNSAdded) == 0 && len(d.DNSRemoved) == 0 &&
+		len(d.RoutesAdded) == 0 && len(d.RoutesRemoved) == 0 &&
+		len(d.PeersAdded) == 0 && len(d.PeersRemoved) == 0 && len(d.PeersChanged) == 0
+}
+
+// Diff compares the old config (e.g. live state) with the new one (e.g. desired state)
+func Diff(old, new *Config) *ConfigDiff {
+	d := &ConfigDiff{}
+	d.Interface = diffInterface(old, new)
+	d.AddressesAdded, d.AddressesRemoved = diffIPNets(old.Address, new.Address)
+	for _, addr := range new.Address {
+		if o, n := old.formatAddress(addr), new.formatAddress(addr); o != n && containsIPNet(old.Address, addr) {
+			d.Interface = append(d.Interface, FieldChange{Field: "Address", Old: o, New: n})
+		}
+	}
+	d.DNSAdded, d.DNSRemoved = diffIPs(old.DNS, new.DNS)
+	d.RoutesAdded, d.RoutesRemoved = diffIPNets(old.managedRoutes(), new.managedRoutes())
+
+	oldPeers := make(map[wgtypes.Key]wgtypes.PeerConfig, len(old.Peers))
+	for _, p := range old.Peers {
+		oldPeers[p.PublicKey] = p
+	}
+	newPeers := make(map[wgtypes.Key]bool, len(new.Peers))
+	for _, p := range new.Peers {
+		newPeers[p.PublicKey] = true
+		op, ok := oldPeers[p.PublicKey]
+		if !ok {
+			d.PeersAdded = append(d.PeersAdded, p)
+			continue
+		}
+		if pd := diffPeer(op, p); len(pd.Changes) > 0 || len(pd.AllowedIPsAdded) > 0 || len(pd.AllowedIPsRemoved) > 0 {
+			d.PeersChanged = append(d.PeersChanged, pd)
+		}
+	}
+	for _, p := range old.Peers {
+		if !newPeers[p.PublicKey] {
+			d.PeersRemoved = append(d.PeersRemoved, p)
+		}
+	}
+	return d
+}
+
+func diffInterface(old, new *Config) []FieldChange {
+	var changes []FieldChange
+	add := func(field, o, n string) {
+		if o != n {
+			changes = append(changes, FieldChange{Field: field, Old: o, New: n})
+		}
+	}
+	add("PrivateKey", publicKeyOf(old.PrivateKey), publicKeyOf(new.PrivateKey))
+	add("ListenPort", intPtrString(old.ListenPort), intPtrString(new.ListenPort))
+	add("FirewallMark", intPtrString(old.FirewallMark), intPtrString(new.FirewallMark))
+	add("MTU", strconv.Itoa(old.MTU), strconv.Itoa(new.MTU))
+	add("Table", old.Table.String(), new.Table.String())
+	add("PreUp", old.PreUp, new.PreUp)
+	add("PostUp", old.PostUp, new.PostUp)
+	add("PreDown", old.PreDown, new.PreDown)
+	add("PostDown", old.PostDown, new.PostDown)
+	add("HookShell", old.HookShell, new.HookShell)
+	add("HookUser", old.HookUser, new.HookUser)
+	add("DNSBackend", old.DNSBackend, new.DNSBackend)
+	add("ResolvconfAdd", old.ResolvconfAdd, new.ResolvconfAdd)
+	add("ResolvconfDelete", old.ResolvconfDelete, new.ResolvconfDelete)
+	add("ResolvconfRecord", old.ResolvconfRecord, new.ResolvconfRecord)
+	add("DNSDefaultRoute", strconv.FormatBool(old.DNSDefaultRoute), strconv.FormatBool(new.DNSDefaultRoute))
+	add("DNSSEC", old.DNSSEC, new.DNSSEC)
+	add("DNSOverTLS", old.DNSOverTLS, new.DNSOverTLS)
+	add("LLMNR", old.LLMNR, new.LLMNR)
+	add("HookCapabilities", strings.Join(old.HookCapabilities, ","), strings.Join(new.HookCapabilities, ","))
+	add("RouteProtocol", strconv.Itoa(old.RouteProtocol), strconv.Itoa(new.RouteProtocol))
+	add("RouteMetric", strconv.Itoa(old.RouteMetric), strconv.Itoa(new.RouteMetric))
+	add("Routes", routesString(old.Routes), routesString(new.Routes))
+	add("RouteOptions", routeOptionsString(old.RouteOptions), routeOptionsString(new.RouteOptions))
+	add("EventHooks", eventHooksString(old.EventHooks), eventHooksString(new.EventHooks))
+	add("SourceRules", strconv.FormatBool(old.SourceRules), strconv.FormatBool(new.SourceRules))
+	add("IPForward", strconv.FormatBool(old.IPForward), strconv.FormatBool(new.IPForward))
+	add("LANBypass", strconv.FormatBool(old.LANBypass), strconv.FormatBool(new.LANBypass))
+	add("ProxyDevice", old.ProxyDevice, new.ProxyDevice)
+	add("SourceRulePriority", strconv.Itoa(old.SourceRulePriority), strconv.Itoa(new.SourceRulePriority))
+	add("AddressLabel", old.AddressLabel, new.AddressLabel)
+	add("LinkAlias", old.LinkAlias, new.LinkAlias)
+	add("AmneziaWG", fmt.Sprintf("%+v", old.AmneziaWG), fmt.Sprintf("%+v", new.AmneziaWG))
+	add("TxQueueLen", strconv.Itoa(old.TxQueueLen), strconv.Itoa(new.TxQueueLen))
+	add("LinkGroup", strconv.FormatUint(uint64(old.LinkGroup), 10), strconv.FormatUint(uint64(new.LinkGroup), 10))
+	add("NumTxQueues", strconv.Itoa(old.NumTxQueues), strconv.Itoa(new.NumTxQueues))
+	add("NumRxQueues", strconv.Itoa(old.NumRxQueues), strconv.Itoa(new.NumRxQueues))
+	add("KillSwitch", old.KillSwitch.String(), new.KillSwitch.String())
+	add("SaveConfig", strconv.FormatBool(old.SaveConfig), strconv.FormatBool(new.SaveConfig))
+	return changes
+}
+
+func diffPeer(old, new wgtypes.PeerConfig) PeerDiff {
+	pd := PeerDiff{PublicKey: new.PublicKey}
+	add := func(field, o, n string) {
+		if o != n {
+			pd.Changes = append(pd.Changes, FieldChange{Field: field, Old: o, New: n})
+		}
+	}
+	if o, n := old.PresharedKey, new.PresharedKey; (o == nil) != (n == nil) || (o != nil && *o != *n) {
+		pd.Changes = append(pd.Changes, FieldChange{Field: "PresharedKey", Old: secretState(o), New: secretState(n)})
+	}
+	add("Endpoint", udpAddrString(old.Endpoint), udpAddrString(new.Endpoint))
+	add("PersistentKeepalive", durationPtrString(old.PersistentKeepaliveInterval), durationPtrString(new.PersistentKeepaliveInterval))
+	pd.AllowedIPsAdded, pd.AllowedIPsRemoved = diffIPNets(old.AllowedIPs, new.AllowedIPs)
+	return pd
+}
+
+func diffIPNets(old, new []net.IPNet) (added, removed []net.IPNet) {
+	oldSet := make(map[string]bool, len(old))
+	for _, n := range old {
+		oldSet[n.String()] = true
+	}
+	newSet := make(map[string]bool, len(new))
+	for _, n := range new {
+		newSet[n.String()] = true
+		if !oldSet[n.String()] {
+			added = append(added, n)
+		}
+	}
+	for _, n := range old {
+		if !newSet[n.String()] {
+			removed = append(removed, n)
+		}
+	}
+	return added, removed
+}
+
+func containsIPNet(nets []net.IPNet, n net.IPNet) bool {
+	for _, candidate := range nets {
+		if candidate.String() == n.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func diffIPs(old, new []net.IP) (added, removed []net.IP) {
+	oldSet := make(map[string]bool, len(old))
+	for _, ip := range old {
+		oldSet[ip.String()] = true
+	}
+	newSet := make(map[string]bool, len(new))
+	for _, ip := range new {
+		newSet[ip.String()] = true
+		if !oldSet[ip.String()] {
+			added = append(added, ip)
+		}
+	}
+	for _, ip := range old {
+		if !newSet[ip.String()] {
+			removed = append(removed, ip)
+		}
+	}
+	return added, removed
+}
+
+// publicKeyOf identifies the private key by its public counterpart, so the secret never leaves the diff
+func publicKeyOf(key *wgtypes.Key) string {
+	if key == nil {
+		return ""
+	}
+	pub := key.PublicKey()
+	return "(public key " + serializeKey(&pub) + ")"
+}
+
+func secretState(key *wgtypes.Key) string {
+	if key == nil {
+		return "(unset)"
+	}
+	return "(redacted)"
+}
+
+func intPtrString(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+func udpAddrString(addr *net.UDPAddr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func durationPtrString(d *time.Duration) string {
+	if d == nil {
+		return ""
+	}
+	return d.String()
+}
@@ -0,0 +1,63 @@
+package wgquick
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	old, new := &Config{}, &Config{}
+	require.NoError(t, old.UnmarshalText([]byte(testConfigs["sample-2"])))
+	require.NoError(t, new.UnmarshalText([]byte(testConfigs["sample-2"])))
+	assert.True(t, Diff(old, new).Empty())
+
+	require.NoError(t, new.UnmarshalText([]byte(testConfigs["sample-3"])))
+	d := Diff(old, new)
+	assert.False(t, d.Empty())
+	assert.Equal(t, []FieldChange{
+		{Field: "Table", Old: "auto", New: "1234"},
+		{Field: "PostUp", Old: "", New: "ip rule add ipproto tcp dport 22 table 1234"},
+		{Field: "PreDown", Old: "", New: "ip rule delete ipproto tcp dport 22 table 1234"},
+		{Field: "SaveConfig", Old: "true", New: "false"},
+	}, d.Interface)
+	require.Len(t, d.AddressesRemoved, 1)
+	assert.Equal(t, "10.10.0.1/16", d.AddressesRemoved[0].String())
+	assert.Len(t, d.PeersRemoved, 2)
+	assert.Len(t, d.PeersAdded, 0)
+	require.Len(t, d.PeersChanged, 1)
+	assert.Equal(t, []FieldChange{{Field: "PersistentKeepalive", Old: "", New: "25s"}}, d.PeersChanged[0].Changes)
+	assert.Len(t, d.PeersChanged[0].AllowedIPsAdded, 1)
+	assert.Len(t, d.PeersChanged[0].AllowedIPsRemoved, 2)
+}
+
+func TestDiffPlan(t *testing.T) {
+	old, new := &Config{}, &Config{}
+	require.NoError(t, old.UnmarshalText([]byte(testConfigs["sample-2"])))
+	require.NoError(t, new.UnmarshalText([]byte(testConfigs["sample-3"])))
+	d := Diff(old, new)
+	plan := d.Plan()
+	assert.Equal(t, PlanVersion, plan.Version)
+	assert.Equal(t, PlanItem{Op: PlanChange, Object: PlanInterface, Field: "Table", Before: "auto", After: "1234"}, plan.Operations[0])
+
+	counts := make(map[string]int)
+	for _, op := range plan.Operations {
+		counts[string(op.Op)+" "+op.Object]++
+		assert.NotContains(t, op.Before+op.After, "PrivateKey")
+	}
+	assert.Equal(t, len(d.Interface), counts["change interface"])
+	assert.Equal(t, 1, counts["remove address"])
+	assert.Equal(t, 2, counts["remove peer"])
+	assert.Equal(t, 1, counts["change peer"])
+	assert.Equal(t, 1, counts["add allowed-ip"])
+	assert.Equal(t, 2, counts["remove allowed-ip"])
+
+	b, err := json.Marshal(d)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `{"version":1,"operations":[{"op":"change","object":"interface","field":"Table","before":"auto","after":"1234"},`)
+	b, err = json.Marshal(Diff(old, old))
+	require.NoError(t, err)
+	assert.Equal(t, `{"version":1,"operations":[]}`, string(b))
+}
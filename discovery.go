@@ -0,0 +1,171 @@
+package wgquick
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// DefaultDiscoveryInterval is the DNS peer discovery refresh interval when none is specified
+const DefaultDiscoveryInterval = 5 * time.Minute
+
+// DiscoveryResolver looks up the peer records, *net.Resolver implements it
+type DiscoveryResolver interface {
+	Resolver
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DNSDiscovery discovers the peers from the DNS records of the zone, a lightweight alternative to the control plane
+// for small meshes. Every peer is the `_wireguard._udp.<zone>` SRV record pointing to the peer endpoint, with the TXT
+// record of the SRV target describing the peer:
+//
+//	_wireguard._udp.example.com. SRV 0 0 51820 a.example.com.
+//	a.example.com. TXT "pk=xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg= ips=10.0.0.2/32,192.168.1.0/24 ka=25"
+//
+// pk (public key) and ips (allowed IPs) are required, ka (persistent keepalive seconds) is optional. The TXT records
+// without pk= are ignored. The SRV target names the peer.
+type DNSDiscovery struct {
+	zone     string
+	resolver DiscoveryResolver
+	interval time.Duration
+	log      logrus.FieldLogger
+}
+
+// NewDNSDiscovery creates the discovery of the zone peers. The resolver is net.DefaultResolver if nil, the interval
+// DefaultDiscoveryInterval if 0.
+func NewDNSDiscovery(zone string, resolver DiscoveryResolver, interval time.Duration, log logrus.FieldLogger) *DNSDiscovery {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if interval == 0 {
+		interval = DefaultDiscoveryInterval
+	}
+	return &DNSDiscovery{zone: zone, resolver: resolver, interval: interval, log: log}
+}
+
+// Discover looks up the peers, returning the config with just the peers and their names, e.g. for Merge.
+// Any invalid peer record fails the whole discovery, so a broken zone doesn't remove the peers.
+func (d *DNSDiscovery) Discover(ctx context.Context) (*Config, error) {
+	_, srvs, err := d.resolver.LookupSRV(ctx, "wireguard", "udp", d.zone)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{PeerNames: make(map[wgtypes.Key]string)}
+	for _, srv := range srvs {
+		peer, err := d.peer(ctx, srv)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", srv.Target, err)
+		}
+		if _, ok := cfg.PeerNames[peer.PublicKey]; ok {
+			return nil, fmt.Errorf("%s: duplicate public key %s", srv.Target, peer.PublicKey)
+		}
+		cfg.Peers = append(cfg.Peers, peer)
+		cfg.PeerNames[peer.PublicKey] = strings.TrimSuffix(srv.Target, ".")
+	}
+	return cfg, nil
+}
+
+func (d *DNSDiscovery) peer(ctx context.Context, srv *net.SRV) (wgtypes.PeerConfig, error) {
+	var peer wgtypes.PeerConfig
+	txts, err := d.resolver.LookupTXT(ctx, srv.Target)
+	if err != nil {
+		return peer, err
+	}
+	found := false
+	for _, txt := range txts {
+		if !strings.HasPrefix(txt, "pk=") {
+			continue
+		}
+		if found {
+			return peer, fmt.Errorf("multiple peer TXT records")
+		}
+		found = true
+		if peer, err = parsePeerRecord(txt); err != nil {
+			return peer, err
+		}
+	}
+	if !found {
+		return peer, fmt.Errorf("no peer TXT record")
+	}
+	endpoint := net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+	peer.Endpoint, err = (&parseOptions{resolver: d.resolver}).resolveEndpoint(endpoint)
+	return peer, err
+}
+
+// parsePeerRecord parses the space separated key=value fields of the peer TXT record
+func parsePeerRecord(txt string) (wgtypes.PeerConfig, error) {
+	var peer wgtypes.PeerConfig
+	var hasKey bool
+	for _, field := range strings.Fields(txt) {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return peer, fmt.Errorf("invalid field %q", field)
+		}
+		switch parts[0] {
+		case "pk":
+			key, err := ParseKey(parts[1])
+			if err != nil {
+				return peer, fmt.Errorf("cannot decode key %w", err)
+			}
+			peer.PublicKey, hasKey = key, true
+		case "ips":
+			for _, s := range strings.Split(parts[1], ",") {
+				ipnet, err := parseIPNet(s)
+				if err != nil {
+					return peer, fmt.Errorf("cannot parse %s: %w", s, err)
+				}
+				peer.AllowedIPs = append(peer.AllowedIPs, ipnet)
+			}
+		case "ka":
+			t, err := strconv.ParseUint(parts[1], 10, 16)
+			if err != nil {
+				return peer, fmt.Errorf("invalid keepalive %q", parts[1])
+			}
+			dur := time.Duration(t) * time.Second
+			peer.PersistentKeepaliveInterval = &dur
+		}
+	}
+	if !hasKey {
+		return peer, fmt.Errorf("no public key")
+	}
+	if len(peer.AllowedIPs) == 0 {
+		return peer, fmt.Errorf("no allowed IPs")
+	}
+	return peer, nil
+}
+
+// Run discovers the peers every interval until the context is done, calling sync with the base config merged with
+// the discovered peers whenever they change. The discovered peers replace the ones on the device, except the base
+// config peers. A failed discovery or sync is logged and retried on the next interval, keeping the peers as they are.
+func (d *DNSDiscovery) Run(ctx context.Context, base *Config, sync func(*Config) error) error {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	var synced *Config
+	for {
+		discovered, err := d.Discover(ctx)
+		if err != nil {
+			d.log.WithError(err).WithField("zone", d.zone).Error("cannot discover peers")
+		} else if synced == nil || !Diff(synced, discovered).Empty() {
+			cfg := Merge(base, discovered)
+			cfg.ReplacePeers = true
+			if err := sync(cfg); err != nil {
+				d.log.WithError(err).Error("cannot sync discovered peers")
+			} else {
+				d.log.WithField("peers", len(discovered.Peers)).Info("synced discovered peers")
+				synced = discovered
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package wgquick
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticZone is the DiscoveryResolver answering from the maps
+type staticZone struct {
+	mu   sync.Mutex
+	srvs map[string][]*net.SRV
+	txts map[string][]string
+	ips  map[string][]net.IPAddr
+}
+
+func (z *staticZone) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	cname := "_" + service + "._" + proto + "." + name
+	if srvs, ok := z.srvs[cname]; ok {
+		return cname, srvs, nil
+	}
+	return "", nil, errors.New("no such host")
+}
+
+func (z *staticZone) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.txts[name], nil
+}
+
+func (z *staticZone) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if ips, ok := z.ips[host]; ok {
+		return ips, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func newStaticZone() *staticZone {
+	return &staticZone{
+		srvs: map[string][]*net.SRV{
+			"_wireguard._udp.example.com": {
+				{Target: "a.example.com.", Port: 51820},
+				{Target: "b.example.com.", Port: 51821},
+			},
+		},
+		txts: map[string][]string{
+			"a.example.com.": {"v=spf1 -all", "pk=xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg= ips=10.0.0.2/32,192.168.1.0/24 ka=25"},
+			"b.example.com.": {"pk=TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0= ips=10.0.0.3/32"},
+		},
+		ips: map[string][]net.IPAddr{
+			"a.example.com": {{IP: net.ParseIP("192.0.2.1")}},
+			"b.example.com": {{IP: net.ParseIP("192.0.2.2")}},
+		},
+	}
+}
+
+func TestDNSDiscovery(t *testing.T) {
+	zone := newStaticZone()
+	d := NewDNSDiscovery("example.com", zone, 0, logrus.New())
+	cfg, err := d.Discover(context.Background())
+	require.NoError(t, err)
+	require.Len(t, cfg.Peers, 2)
+	a := cfg.Peers[0]
+	assert.Equal(t, "a.example.com", cfg.PeerNames[a.PublicKey])
+	assert.Equal(t, "192.0.2.1:51820", a.Endpoint.String())
+	require.Len(t, a.AllowedIPs, 2)
+	assert.Equal(t, "10.0.0.2/32", a.AllowedIPs[0].String())
+	assert.Equal(t, "192.168.1.0/24", a.AllowedIPs[1].String())
+	assert.Equal(t, 25*time.Second, *a.PersistentKeepaliveInterval)
+	assert.Equal(t, "192.0.2.2:51821", cfg.Peers[1].Endpoint.String())
+	assert.Nil(t, cfg.Peers[1].PersistentKeepaliveInterval)
+
+	for name, txt := range map[string]string{
+		"missing record": "v=spf1 -all",
+		"invalid key":    "pk=abc ips=10.0.0.3/32",
+		"no allowed IPs": "pk=TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=",
+		"invalid ips":    "pk=TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0= ips=10.0.0.300/32",
+		"duplicate key":  "pk=xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg= ips=10.0.0.3/32",
+	} {
+		zone := newStaticZone()
+		zone.txts["b.example.com."] = []string{txt}
+		_, err := NewDNSDiscovery("example.com", zone, 0, logrus.New()).Discover(context.Background())
+		assert.Error(t, err, name)
+	}
+}
+
+func TestDNSDiscoveryRun(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	zone := newStaticZone()
+	d := NewDNSDiscovery("example.com", zone, 10*time.Millisecond, log)
+	base := &Config{}
+	require.NoError(t, base.UnmarshalText([]byte(testConfigs["simple"])))
+
+	synced := make(chan *Config, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- d.Run(ctx, base, func(cfg *Config) error {
+			synced <- cfg
+			return nil
+		})
+	}()
+
+	cfg := <-synced
+	assert.True(t, cfg.ReplacePeers)
+	assert.Len(t, cfg.Peers, 3, "the base peer is kept")
+
+	zone.mu.Lock()
+	zone.ips["b.example.com"] = []net.IPAddr{{IP: net.ParseIP("192.0.2.3")}}
+	zone.mu.Unlock()
+	cfg = <-synced
+	assert.Equal(t, "192.0.2.3:51821", cfg.Peers[len(cfg.Peers)-1].Endpoint.String())
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Empty(t, synced, "unchanged peers aren't synced")
+}
@@ -0,0 +1,193 @@
+package wgquick
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DNSBackendResolvconf sets the DNS servers with resolvconf, see Config.ResolvconfAdd. It's the default.
+	DNSBackendResolvconf = "resolvconf"
+	// DNSBackendNetworkManager sets the DNS servers on the link with nmcli, for the systems where NetworkManager owns
+	// resolv.conf and overwrites the resolvconf changes
+	DNSBackendNetworkManager = "networkmanager"
+	// DNSBackendResolved sets the DNS servers on the link with resolvectl, for the systems running systemd-resolved
+	// without the resolvconf compatibility
+	DNSBackendResolved = "resolved"
+	// DNSBackendAuto is the DefaultDNSBackendChain
+	DNSBackendAuto = "auto"
+	// DefaultDNSBackendChain is the fallback chain of DNSBackendAuto, see Config.DNSBackend
+	DefaultDNSBackendChain = DNSBackendResolved + "," + DNSBackendResolvconf + "," + DNSBackendFile
+
+	// resolvedRunDir exists while systemd-resolved runs
+	resolvedRunDir = "/run/systemd/resolve"
+)
+
+// dnsBackend returns the DNS backend of the config, DNSBackendResolvconf if not set
+func (cfg *Config) dnsBackend() string {
+	if cfg.DNSBackend == "" {
+		return DNSBackendResolvconf
+	}
+	return cfg.DNSBackend
+}
+
+// dnsBackendChain returns the DNS backends in the order they're tried
+func (cfg *Config) dnsBackendChain() []string {
+	s := cfg.DNSBackend
+	if s == DNSBackendAuto {
+		s = DefaultDNSBackendChain
+	}
+	var chain []string
+	for _, backend := range strings.Split(s, ",") {
+		if backend = strings.TrimSpace(backend); backend != "" {
+			chain = append(chain, backend)
+		}
+	}
+	return chain
+}
+
+// dnsBackendAvailable returns why the backend can't be used on this host, nil if it can
+func (c *Client) dnsBackendAvailable(cfg *Config, backend string) error {
+	var bin string
+	switch backend {
+	case DNSBackendResolved:
+		if _, err := os.Stat(resolvedRunDir); err != nil {
+			return fmt.Errorf("systemd-resolved isn't running")
+		}
+		bin = "resolvectl"
+	case DNSBackendNetworkManager:
+		bin = "nmcli"
+	case DNSBackendResolvconf:
+		bin = cfg.resolvconfBinary()
+	case DNSBackendFile:
+		if c.runDir(c.resolvConf, DefaultResolvConf) == "" {
+			return fmt.Errorf("no resolv.conf to rewrite")
+		}
+	}
+	if bin != "" {
+		if _, err := exec.LookPath(bin); err != nil {
+			return fmt.Errorf("no %s in PATH", bin)
+		}
+	}
+	return nil
+}
+
+// selectDNSBackend returns the first backend of the chain which is available
+func selectDNSBackend(chain []string, available func(backend string) error) (string, error) {
+	var problems []string
+	for _, backend := range chain {
+		err := available(backend)
+		if err == nil {
+			return backend, nil
+		}
+		problems = append(problems, backend+": "+err.Error())
+	}
+	return "", fmt.Errorf("no DNS backend available: %s", strings.Join(problems, "; "))
+}
+
+// withDNSBackend returns the config with the DNS backend chain resolved to the first backend available on this host,
+// logging which one it is, so DNSBackend is always the single backend name. It's cfg itself without DNS servers or
+// backend. With the other netlink than the kernel one, e.g. the fake, the first backend is taken.
+func (c *Client) withDNSBackend(cfg *Config, log logrus.FieldLogger) (*Config, error) {
+	chain := cfg.dnsBackendChain()
+	if len(cfg.DNS) == 0 || len(chain) == 0 {
+		return cfg, nil
+	}
+	// the single backend is only normalised, e.g. "resolved," or " resolved", it fails when used if it isn't available
+	backend := chain[0]
+	if len(chain) > 1 {
+		available := func(backend string) error { return c.dnsBackendAvailable(cfg, backend) }
+		if !c.kernelNetlink() {
+			available = func(string) error { return nil }
+		}
+		var err error
+		if backend, err = selectDNSBackend(chain, available); err != nil {
+			return nil, err
+		}
+		log.WithField("backend", backend).Info("selected DNS backend")
+	}
+	// shallow copy, the keys are shared so zeroizing the caller config covers it
+	out := *cfg
+	out.DNSBackend = backend
+	return &out, nil
+}
+
+// nmcliCommand returns the nmcli command setting the DNS servers on the link, %i is the interface name
+func (cfg *Config) nmcliCommand() string {
+	var v4, v6 []string
+	for _, ip := range cfg.DNS {
+		if ip.To4() != nil {
+			v4 = append(v4, ip.String())
+		} else {
+			v6 = append(v6, ip.String())
+		}
+	}
+	cmd := "nmcli device modify %i"
+	// the negative priority makes the tunnel servers the only ones used, as wg-quick does with resolvconf -x
+	for _, family := range []struct {
+		name string
+		ips  []string
+	}{{"ipv4", v4}, {"ipv6", v6}} {
+		if len(family.ips) > 0 {
+			cmd += fmt.Sprintf(" %s.dns '%s' %s.dns-priority -50", family.name, strings.Join(family.ips, " "), family.name)
+		}
+	}
+	return cmd
+}
+
+// resolvectlDNSCommand returns the resolvectl command setting the DNS servers on the link, %i is the interface name
+func (cfg *Config) resolvectlDNSCommand() string {
+	cmd := "resolvectl dns %i"
+	for _, ip := range cfg.DNS {
+		cmd += " " + ip.String()
+	}
+	return cmd
+}
+
+// nmcliManaged returns the error if NetworkManager doesn't manage the link, e.g. it's listed in unmanaged-devices of
+// NetworkManager.conf: `nmcli device modify` fails on it with the cryptic message.
+func nmcliManaged(iface string) error {
+	out, err := exec.Command("nmcli", "-g", "GENERAL.STATE", "device", "show", iface).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot read NetworkManager state of %s: %s", iface, bytes.TrimSpace(out))
+	}
+	return nmcliStateError(iface, strings.TrimSpace(string(out)))
+}
+
+// nmcliStateError returns the error for the GENERAL.STATE of the device, e.g. "10 (unmanaged)", nil for the managed one
+func nmcliStateError(iface, state string) error {
+	// NM_DEVICE_STATE_UNMANAGED
+	if !strings.HasPrefix(state, "10 ") {
+		return nil
+	}
+	return fmt.Errorf("NetworkManager doesn't manage %s (%s), so it can't set its DNS servers: allow the wireguard links in NetworkManager.conf unmanaged-devices or use the other DNS backend", iface, state)
+}
+
+// setLinkDNS sets the DNS servers with the backends needing the link, i.e. NetworkManager and systemd-resolved. They
+// forget the servers when the link is deleted.
+func (c *Client) setLinkDNS(cfg *Config, iface string, log logrus.FieldLogger) error {
+	if len(cfg.DNS) == 0 {
+		return nil
+	}
+	switch cfg.dnsBackend() {
+	case DNSBackendNetworkManager:
+		if err := nmcliManaged(iface); err != nil {
+			return err
+		}
+		if err := c.runSh(cfg.nmcliCommand(), iface, log); err != nil {
+			return err
+		}
+		log.WithField("dns", fmt.Sprint(cfg.DNS)).Info("set DNS with NetworkManager")
+	case DNSBackendResolved:
+		if err := c.runSh(cfg.resolvectlDNSCommand(), iface, log); err != nil {
+			return err
+		}
+		log.WithField("dns", fmt.Sprint(cfg.DNS)).Info("set DNS with systemd-resolved")
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package wgquick
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNmcliCommand(t *testing.T) {
+	cfg := &Config{DNS: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1"), net.ParseIP("10.0.0.2")}}
+	assert.Equal(t, DNSBackendResolvconf, cfg.dnsBackend())
+	assert.Equal(t, "nmcli device modify %i ipv4.dns '10.0.0.1 10.0.0.2' ipv4.dns-priority -50 ipv6.dns 'fd00::1' ipv6.dns-priority -50", cfg.nmcliCommand())
+	cfg.DNS = cfg.DNS[:1]
+	assert.Equal(t, "nmcli device modify %i ipv4.dns '10.0.0.1' ipv4.dns-priority -50", cfg.nmcliCommand())
+}
+
+func TestDNSBackendChain(t *testing.T) {
+	cfg := &Config{DNSBackend: DNSBackendAuto}
+	assert.Equal(t, []string{DNSBackendResolved, DNSBackendResolvconf, DNSBackendFile}, cfg.dnsBackendChain())
+	cfg.DNSBackend = "networkmanager, file"
+	assert.Equal(t, []string{DNSBackendNetworkManager, DNSBackendFile}, cfg.dnsBackendChain())
+	assert.NotContains(t, cfg.Validate().Error(), "bad-dns-backend")
+	cfg.DNSBackend = "resolved,bind"
+	assert.Contains(t, cfg.Validate().Error(), `bad-dns-backend]: unknown DNS backend "bind"`)
+
+	chain := []string{DNSBackendResolved, DNSBackendResolvconf, DNSBackendFile}
+	backend, err := selectDNSBackend(chain, func(backend string) error {
+		if backend == DNSBackendResolved {
+			return fmt.Errorf("systemd-resolved isn't running")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, DNSBackendResolvconf, backend)
+
+	_, err = selectDNSBackend(chain, func(backend string) error { return fmt.Errorf("missing") })
+	assert.EqualError(t, err, "no DNS backend available: resolved: missing; resolvconf: missing; file: missing")
+}
+
+func TestWithDNSBackend(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	c := &Client{}
+	for _, backend := range []string{"resolved,", " resolved", "resolved"} {
+		cfg := &Config{DNS: []net.IP{net.ParseIP("10.0.0.1")}, DNSBackend: backend}
+		out, err := c.withDNSBackend(cfg, log)
+		require.NoError(t, err)
+		assert.Equal(t, DNSBackendResolved, out.DNSBackend, backend)
+		assert.Equal(t, backend, cfg.DNSBackend, "the caller config isn't modified")
+	}
+	cfg := &Config{DNSBackend: "resolved,"}
+	out, err := c.withDNSBackend(cfg, log)
+	require.NoError(t, err)
+	assert.Equal(t, cfg, out, "without DNS servers the backend isn't used")
+}
+
+func TestNmcliStateError(t *testing.T) {
+	assert.NoError(t, nmcliStateError("wg0", "100 (connected (externally))"))
+	assert.NoError(t, nmcliStateError("wg0", "30 (disconnected)"))
+	err := nmcliStateError("wg0", "10 (unmanaged)")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NetworkManager doesn't manage wg0 (10 (unmanaged))")
+}
+
+func TestResolvectlDNSCommand(t *testing.T) {
+	cfg := &Config{DNS: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")}}
+	assert.Equal(t, "resolvectl dns %i 10.0.0.1 fd00::1", cfg.resolvectlDNSCommand())
+}
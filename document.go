@@ -0,0 +1,364 @@
+package wgquick
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// document is the lossless representation of the parsed config text. It lets MarshalText
+// reproduce comments and original key ordering for values which haven't changed since parsing.
+type document struct {
+	preamble        []string
+	sections        []*docSection
+	trailingNewline bool
+	// lineOffset is the line of the bundle the text starts at, see WithProfile
+	lineOffset int
+}
+
+type docLine struct {
+	raw string
+	key string // empty for comments and blank lines
+}
+
+type docSection struct {
+	// leading holds comment lines directly above the header
+	leading []string
+	header  string
+	body    []docLine
+	// peer is the index into Config.Peers, -1 for [Interface]
+	peer int
+	// included peers come from Include directive and have no lines in this document
+	included  bool
+	publicKey wgtypes.Key
+	// name is the peer name when parsed
+	name string
+	// snapshot holds the canonical lines as they were when parsed
+	snapshot *canonicalSection
+}
+
+type docBuilder struct {
+	doc     *document
+	pending []string
+}
+
+func newDocBuilder(text string) (*docBuilder, []string) {
+	lines := strings.Split(text, "\n")
+	doc := &document{}
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		doc.trailingNewline = true
+		lines = lines[:len(lines)-1]
+	}
+	return &docBuilder{doc: doc}, lines
+}
+
+// current returns the section the lines are added to. Lines after included peers belong to the section which included them.
+func (b *docBuilder) current() *docSection {
+	for i := len(b.doc.sections) - 1; i >= 0; i-- {
+		if sec := b.doc.sections[i]; !sec.included {
+			return sec
+		}
+	}
+	return nil
+}
+
+func (b *docBuilder) flush(upTo int) {
+	if sec := b.current(); sec != nil {
+		for _, raw := range b.pending[:upTo] {
+			sec.body = append(sec.body, docLine{raw: raw})
+		}
+	} else {
+		b.doc.preamble = append(b.doc.preamble, b.pending[:upTo]...)
+	}
+	b.pending = b.pending[upTo:]
+}
+
+func (b *docBuilder) trivia(raw string) {
+	b.pending = append(b.pending, raw)
+}
+
+func (b *docBuilder) header(raw string, peer int) {
+	// comments directly above the header describe the section
+	split := len(b.pending)
+	for split > 0 && strings.HasPrefix(strings.TrimSpace(b.pending[split-1]), "#") {
+		split--
+	}
+	b.flush(split)
+	b.doc.sections = append(b.doc.sections, &docSection{
+		leading: b.pending,
+		header:  raw,
+		peer:    peer,
+	})
+	b.pending = nil
+}
+
+func (b *docBuilder) included(peer int) {
+	b.doc.sections = append(b.doc.sections, &docSection{peer: peer, included: true})
+}
+
+func (b *docBuilder) keyLine(raw, key string) {
+	b.flush(len(b.pending))
+	if sec := b.current(); sec != nil {
+		sec.body = append(sec.body, docLine{raw: raw, key: key})
+	} else {
+		b.doc.preamble = append(b.doc.preamble, raw)
+	}
+}
+
+// finish snapshots the parsed config. It returns nil document if there's no [Interface] section to anchor to.
+func (b *docBuilder) finish(cfg *Config) (*document, error) {
+	b.flush(len(b.pending))
+	iface, peers, err := cfg.canonicalSections()
+	if err != nil {
+		return nil, err
+	}
+	hasInterface := false
+	for _, sec := range b.doc.sections {
+		if sec.peer < 0 {
+			hasInterface = true
+			sec.snapshot = iface
+			continue
+		}
+		sec.publicKey = cfg.Peers[sec.peer].PublicKey
+		sec.snapshot = peers[sec.peer]
+		if sec.name = sec.parseName(); sec.name != "" {
+			if cfg.PeerNames == nil {
+				cfg.PeerNames = make(map[wgtypes.Key]string)
+			}
+			cfg.PeerNames[sec.publicKey] = sec.name
+		}
+	}
+	if !hasInterface {
+		return nil, nil
+	}
+	return b.doc, nil
+}
+
+// line returns the 1-based line of the diagnostic field, e.g. Interface.PrivateKey or Peer[1].PublicKey, in the
+// parsed text: the first line of the key, or the section header if the key isn't there. It's 0 if the section isn't
+// in the text, e.g. the peers added after parsing or included from another file.
+func (doc *document) line(cfg *Config, field string) int {
+	peer, key := -1, strings.TrimPrefix(field, "Interface.")
+	if strings.HasPrefix(field, "Peer[") {
+		if _, err := fmt.Sscanf(field, "Peer[%d].%s", &peer, &key); err != nil || peer >= len(cfg.Peers) {
+			return 0
+		}
+	}
+	no := doc.lineOffset + len(doc.preamble)
+	for _, sec := range doc.sections {
+		if sec.included {
+			continue
+		}
+		no += len(sec.leading) + 1
+		if sec.peer == peer && (peer < 0 || cfg.Peers[peer].PublicKey == sec.publicKey) {
+			for i, ln := range sec.body {
+				if ln.key == key {
+					return no + i + 1
+				}
+			}
+			return no
+		}
+		no += len(sec.body)
+	}
+	return 0
+}
+
+var peerNameRegexp = regexp.MustCompile(`^#\s*Name\s*=\s*(.*?)\s*$`)
+
+func parseNameComment(raw string) (string, bool) {
+	m := peerNameRegexp.FindStringSubmatch(strings.TrimSpace(raw))
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// parseName prefers explicit `# Name = x` annotation in the section, and falls back to the first comment line directly above the header
+func (sec *docSection) parseName() string {
+	for _, ln := range sec.body {
+		if name, ok := parseNameComment(ln.raw); ln.key == "" && ok {
+			return name
+		}
+	}
+	for _, raw := range sec.leading {
+		if name, ok := parseNameComment(raw); ok {
+			return name
+		}
+	}
+	if len(sec.leading) > 0 {
+		return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(sec.leading[0]), "#"))
+	}
+	return ""
+}
+
+// canonicalSection holds the canonically rendered lines of the section, grouped by key
+type canonicalSection struct {
+	order []string
+	lines map[string][]string
+}
+
+func newCanonicalSection() *canonicalSection {
+	return &canonicalSection{lines: make(map[string][]string)}
+}
+
+func (c *canonicalSection) add(key, line string) {
+	if _, ok := c.lines[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.lines[key] = append(c.lines[key], line)
+}
+
+func (c *canonicalSection) flatten() []string {
+	var out []string
+	for _, key := range c.order {
+		out = append(out, c.lines[key]...)
+	}
+	return out
+}
+
+// canonicalSections renders the config and splits it into the interface and per peer sections
+func (cfg *Config) canonicalSections() (iface *canonicalSection, peers []*canonicalSection, err error) {
+	text, err := cfg.canonicalText()
+	if err != nil {
+		return nil, nil, err
+	}
+	var cur *canonicalSection
+	for _, ln := range strings.Split(string(text), "\n") {
+		switch ln {
+		case "":
+		case "[Interface]":
+			iface = newCanonicalSection()
+			cur = iface
+		case "[Peer]":
+			cur = newCanonicalSection()
+			peers = append(peers, cur)
+		default:
+			if strings.HasPrefix(ln, "#") {
+				continue // peer names are handled separately
+			}
+			cur.add(strings.TrimSpace(strings.SplitN(ln, "=", 2)[0]), ln)
+		}
+	}
+	return iface, peers, nil
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (doc *document) render(cfg *Config) ([]byte, error) {
+	iface, peers, err := cfg.canonicalSections()
+	if err != nil {
+		return nil, err
+	}
+	peerIdx := make(map[wgtypes.Key]int, len(cfg.Peers))
+	for i, p := range cfg.Peers {
+		peerIdx[p.PublicKey] = i
+	}
+
+	out := append([]string(nil), doc.preamble...)
+	emitted := make(map[int]bool)
+	for _, sec := range doc.sections {
+		if sec.peer < 0 {
+			out = sec.render(out, iface, "")
+			continue
+		}
+		i, ok := peerIdx[sec.publicKey]
+		if !ok || emitted[i] {
+			continue // peer removed
+		}
+		if sec.included {
+			if equalLines(sec.snapshot.flatten(), peers[i].flatten()) {
+				emitted[i] = true
+			}
+			continue
+		}
+		emitted[i] = true
+		out = sec.render(out, peers[i], cfg.PeerNames[sec.publicKey])
+	}
+	for i := range cfg.Peers {
+		if emitted[i] {
+			continue
+		}
+		if len(out) > 0 && out[len(out)-1] != "" {
+			out = append(out, "")
+		}
+		out = append(out, "[Peer]")
+		if name := cfg.PeerNames[cfg.Peers[i].PublicKey]; name != "" {
+			out = append(out, "# Name = "+name)
+		}
+		out = append(out, peers[i].flatten()...)
+	}
+
+	text := strings.Join(out, "\n")
+	if doc.trailingNewline {
+		text += "\n"
+	}
+	return []byte(text), nil
+}
+
+func (sec *docSection) hasNameComment() bool {
+	for _, ln := range sec.body {
+		if _, ok := parseNameComment(ln.raw); ln.key == "" && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (sec *docSection) render(out []string, current *canonicalSection, name string) []string {
+	out = append(out, sec.leading...)
+	out = append(out, sec.header)
+	renamed := name != sec.name
+	if renamed && name != "" && !sec.hasNameComment() {
+		out = append(out, "# Name = "+name)
+	}
+	lastKey := len(out)
+	written := make(map[string]bool)
+	for _, ln := range sec.body {
+		_, known := sec.snapshot.lines[ln.key]
+		_, wanted := current.lines[ln.key]
+		switch {
+		case ln.key == "":
+			if _, ok := parseNameComment(ln.raw); ok && renamed {
+				if name != "" {
+					out = append(out, "# Name = "+name)
+				}
+				continue
+			}
+			out = append(out, ln.raw)
+			continue
+		case !known && !wanted:
+			// directive not represented in the canonical form, e.g. Include
+			out = append(out, ln.raw)
+		case equalLines(sec.snapshot.lines[ln.key], current.lines[ln.key]):
+			out = append(out, ln.raw)
+		case !written[ln.key]:
+			out = append(out, current.lines[ln.key]...)
+		}
+		written[ln.key] = true
+		lastKey = len(out)
+	}
+
+	var added []string
+	for _, key := range current.order {
+		if !written[key] {
+			added = append(added, current.lines[key]...)
+		}
+	}
+	if len(added) == 0 {
+		return out
+	}
+	tail := append([]string(nil), out[lastKey:]...)
+	return append(append(out[:lastKey], added...), tail...)
+}
@@ -0,0 +1,198 @@
+package wgquick
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DomainRouteProtocol marks the domain routes, e.g. `ip route show proto 87`. It differs from the config RouteProtocol,
+	// so Sync leaves the domain routes alone.
+	DomainRouteProtocol = 87
+	// DefaultDomainRefreshInterval is how often DomainRouter.Run resolves the domains again when no interval is specified
+	DefaultDomainRefreshInterval = 5 * time.Minute
+	// DefaultDomainRouteRetention is how long the domain address is routed after it was last resolved when no retention
+	// is specified
+	DefaultDomainRouteRetention = 30 * time.Minute
+)
+
+// DomainRouter routes the addresses of the domains via the tunnel, e.g. to send only the traffic of a few SaaS
+// domains through the VPN. The peer AllowedIPs must cover the addresses, e.g. 0.0.0.0/0 and ::/0 with Table off.
+//
+// The DNS answers of such domains rotate between the address pools, so the address stays routed for the retention period
+// after it was last resolved, keeping the established connections in the tunnel. The routes are host routes on the
+// link in the config table (main with Table auto or off) with DomainRouteProtocol. They're gone with the link on Down.
+// DomainRouter isn't safe for concurrent use.
+type DomainRouter struct {
+	c         *Client
+	cfg       *Config
+	iface     string
+	domains   []string
+	resolver  Resolver
+	retention time.Duration
+	log       logrus.FieldLogger
+	// seen is when the address was last resolved, keyed by the address
+	seen map[string]time.Time
+}
+
+// NewDomainRouter creates the domain router for the interface. The resolver is net.DefaultResolver if nil and the
+// retention is DefaultDomainRouteRetention if 0.
+func (c *Client) NewDomainRouter(cfg *Config, iface string, domains []string, resolver Resolver, retention time.Duration, logger logrus.FieldLogger) *DomainRouter {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if retention == 0 {
+		retention = DefaultDomainRouteRetention
+	}
+	return &DomainRouter{
+		c:         c,
+		cfg:       cfg,
+		iface:     iface,
+		domains:   append([]string(nil), domains...),
+		resolver:  resolver,
+		retention: retention,
+		log:       logger.WithField("iface", iface),
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// Refresh resolves the domains and syncs the routes with the addresses resolved within the retention period. A domain
+// failing to resolve keeps its previous addresses until they expire, the routes of the others are synced anyway.
+func (r *DomainRouter) Refresh(ctx context.Context) error {
+	now := time.Now()
+	var resolveErr error
+	for _, domain := range r.domains {
+		log := r.log.WithField("domain", domain)
+		addrs, err := r.resolver.LookupIPAddr(ctx, domain)
+		if err != nil {
+			log.WithError(err).Warn("cannot resolve domain")
+			resolveErr = &OpError{Op: "resolve domain", Subject: domain, Err: err}
+			continue
+		}
+		for _, addr := range addrs {
+			r.seen[addr.IP.String()] = now
+		}
+		log.WithField("addresses", len(addrs)).Debug("resolved domain")
+	}
+	for addr, t := range r.seen {
+		if now.Sub(t) > r.retention {
+			delete(r.seen, addr)
+		}
+	}
+	if err := r.sync(); err != nil {
+		return err
+	}
+	return resolveErr
+}
+
+// Clear deletes all the domain routes of the interface, e.g. when the domain routing stops while the tunnel stays up
+func (r *DomainRouter) Clear() error {
+	r.seen = make(map[string]time.Time)
+	return r.sync()
+}
+
+// Run refreshes the routes right away and then every interval until the context is done. The interval is
+// DefaultDomainRefreshInterval if 0. A failed refresh is logged and retried on the next interval.
+func (r *DomainRouter) Run(ctx context.Context, interval time.Duration) error {
+	if interval == 0 {
+		interval = DefaultDomainRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Refresh(ctx); err != nil {
+			r.log.WithError(err).Error("cannot refresh domain routes")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// table returns the routing table of the domain routes
+func (r *DomainRouter) table() int {
+	if r.cfg.Table == TableAuto || r.cfg.Table == TableOff {
+		return unix.RT_TABLE_MAIN
+	}
+	return int(r.cfg.Table)
+}
+
+// sync adds the routes of the seen addresses and deletes the expired ones
+func (r *DomainRouter) sync() error {
+	link, err := r.c.nl.LinkByName(r.iface)
+	if err != nil {
+		return err
+	}
+	present, err := r.c.listRoutes(&netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Table:     r.table(),
+		Protocol:  DomainRouteProtocol,
+	}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL)
+	if err != nil {
+		return err
+	}
+	presentDsts := make(map[string]bool, len(present))
+	for _, rt := range present {
+		presentDsts[rt.Dst.String()] = true
+	}
+
+	var addrs []string
+	for addr := range r.seen {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	wanted := make(map[string]bool, len(addrs))
+	errs := r.c.newItemErrors()
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		dst := net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+		if ip4 := ip.To4(); ip4 != nil {
+			dst = net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+		}
+		wanted[dst.String()] = true
+		if presentDsts[dst.String()] {
+			continue
+		}
+		rt := netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Dst:       &dst,
+			Table:     r.table(),
+			Protocol:  DomainRouteProtocol,
+			Priority:  r.cfg.RouteMetric,
+		}
+		fillRouteDefaults(&rt)
+		log := r.log.WithField("route", dst.String())
+		if err := r.c.nl.RouteReplace(&rt); err != nil {
+			log.WithError(err).Error("cannot add domain route")
+			if err := errs.add("add domain route", dst.String(), err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("domain route added")
+	}
+	for _, rt := range present {
+		rt := rt // make copy
+		if wanted[rt.Dst.String()] {
+			continue
+		}
+		log := r.log.WithField("route", rt.Dst.String())
+		if err := r.c.nl.RouteDel(&rt); err != nil {
+			log.WithError(err).Error("cannot delete domain route")
+			if err := errs.add("delete domain route", rt.Dst.String(), err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("domain route deleted")
+	}
+	return errs.err()
+}
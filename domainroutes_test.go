@@ -0,0 +1,62 @@
+package wgquick_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainRouter(t *testing.T) {
+	c, nl, _ := newFakeClient(t)
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+
+	answers := map[string][]string{
+		"app.example.com": {"203.0.113.7", "2001:db8::7"},
+		"api.example.com": {"203.0.113.8"},
+	}
+	resolver := wgquick.ResolverFunc(func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		ips, ok := answers[host]
+		if !ok {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		var addrs []net.IPAddr
+		for _, ip := range ips {
+			addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+		return addrs, nil
+	})
+	domainRoutes := func() []string {
+		var dsts []string
+		for _, rt := range nl.Routes() {
+			if rt.Protocol == wgquick.DomainRouteProtocol {
+				dsts = append(dsts, rt.Dst.String())
+			}
+		}
+		return dsts
+	}
+
+	r := c.NewDomainRouter(cfg, "wg0", []string{"app.example.com", "api.example.com"}, resolver, time.Nanosecond, testLog)
+	require.NoError(t, r.Refresh(context.Background()))
+	assert.ElementsMatch(t, []string{"203.0.113.7/32", "2001:db8::7/128", "203.0.113.8/32"}, domainRoutes())
+
+	// the sync leaves the domain routes alone
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+	assert.Len(t, domainRoutes(), 3)
+
+	answers["app.example.com"] = []string{"203.0.113.9"}
+	delete(answers, "api.example.com")
+	assert.Error(t, r.Refresh(context.Background()))
+	assert.ElementsMatch(t, []string{"203.0.113.9/32"}, domainRoutes())
+
+	require.NoError(t, r.Clear())
+	assert.Empty(t, domainRoutes())
+}
@@ -0,0 +1,231 @@
+package wgquick
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// EncryptionFormat is the at-rest encryption of a config file
+type EncryptionFormat int
+
+const (
+	// Plaintext is a regular wg-quick config file
+	Plaintext EncryptionFormat = iota
+	// AgeEncrypted is an age (https://age-encryption.org) encrypted file, either binary or armored
+	AgeEncrypted
+	// GPGEncrypted is an OpenPGP encrypted file, either binary or armored
+	GPGEncrypted
+)
+
+func (f EncryptionFormat) String() string {
+	switch f {
+	case Plaintext:
+		return "plaintext"
+	case AgeEncrypted:
+		return "age"
+	case GPGEncrypted:
+		return "gpg"
+	default:
+		return fmt.Sprintf("EncryptionFormat(%d)", int(f))
+	}
+}
+
+const (
+	ageHeader      = "age-encryption.org/v1"
+	ageArmorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+	gpgArmorHeader = "-----BEGIN PGP MESSAGE-----"
+)
+
+// DetectEncryption guesses the encryption format from the file extension and content headers.
+func DetectEncryption(filename string, data []byte) EncryptionFormat {
+	head := strings.TrimSpace(string(data[:minInt(len(data), 64)]))
+	switch {
+	case strings.HasPrefix(head, ageHeader), strings.HasPrefix(head, ageArmorHeader):
+		return AgeEncrypted
+	case strings.HasPrefix(head, gpgArmorHeader):
+		return GPGEncrypted
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".age":
+		return AgeEncrypted
+	case ".gpg", ".pgp", ".asc":
+		return GPGEncrypted
+	}
+	return Plaintext
+}
+
+// Decrypter decrypts an encrypted config file in memory. Implementations hold the caller supplied identity, see
+// AgeDecrypter and GPGDecrypter.
+type Decrypter interface {
+	Decrypt(format EncryptionFormat, ciphertext []byte) ([]byte, error)
+}
+
+// DecrypterFunc adapts a function to the Decrypter interface
+type DecrypterFunc func(format EncryptionFormat, ciphertext []byte) ([]byte, error)
+
+// Decrypt calls f(format, ciphertext)
+func (f DecrypterFunc) Decrypt(format EncryptionFormat, ciphertext []byte) ([]byte, error) {
+	return f(format, ciphertext)
+}
+
+// AgeDecrypter decrypts age files with the age command, which has to be installed, e.g. the age package of the
+// distribution. The plaintext is read from its output and never written to disk.
+type AgeDecrypter struct {
+	// Identity is the content of the age identity file, i.e. the age-keygen output or an SSH private key. It's passed
+	// to the command over a pipe.
+	Identity []byte
+	// Command is the age compatible command, "age" if empty
+	Command string
+}
+
+var _ Decrypter = (*AgeDecrypter)(nil)
+
+// Decrypt decrypts binary or armored age file, equivalent to: `age --decrypt -i $identity`
+func (d *AgeDecrypter) Decrypt(format EncryptionFormat, ciphertext []byte) ([]byte, error) {
+	if format != AgeEncrypted {
+		return nil, fmt.Errorf("unsupported encryption format %v", format)
+	}
+	command := d.Command
+	if command == "" {
+		command = "age"
+	}
+	return decryptCommand(exec.Command(command, "--decrypt", "-i", "/dev/fd/3"), ciphertext, "identity", d.Identity)
+}
+
+// GPGDecrypter decrypts OpenPGP messages with the gpg command, using the keys of its home directory. The plaintext is
+// read from its output and never written to disk.
+type GPGDecrypter struct {
+	// Homedir is the gpg home directory with the keys, the user's default one if empty
+	Homedir string
+	// Passphrase unlocks the secret key or the symmetrically encrypted message, passed to the command over a pipe.
+	// Without it the gpg agent has to have the key unlocked.
+	Passphrase []byte
+	// Command is the gpg compatible command, "gpg" if empty
+	Command string
+}
+
+var _ Decrypter = (*GPGDecrypter)(nil)
+
+// Decrypt decrypts binary or armored OpenPGP message, equivalent to: `gpg --batch --decrypt`
+func (d *GPGDecrypter) Decrypt(format EncryptionFormat, ciphertext []byte) ([]byte, error) {
+	if format != GPGEncrypted {
+		return nil, fmt.Errorf("unsupported encryption format %v", format)
+	}
+	command := d.Command
+	if command == "" {
+		command = "gpg"
+	}
+	args := []string{"--batch", "--quiet", "--no-tty"}
+	if d.Homedir != "" {
+		args = append(args, "--homedir", d.Homedir)
+	}
+	if len(d.Passphrase) > 0 {
+		args = append(args, "--pinentry-mode", "loopback", "--passphrase-fd", "3")
+	}
+	args = append(args, "--decrypt")
+	return decryptCommand(exec.Command(command, args...), ciphertext, "passphrase", d.Passphrase)
+}
+
+// decryptCommand runs the decrypting command with the ciphertext on the input and the secret on the file descriptor 3,
+// returning its output
+func decryptCommand(cmd *exec.Cmd, ciphertext []byte, name string, secret []byte) ([]byte, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdin = bytes.NewReader(ciphertext)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// the secret is the first extra file, i.e. fd 3 of the command
+	cmd.ExtraFiles = []*os.File{r}
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+	// the command has its copy, closing ours makes the write fail instead of blocking if the command exits without reading
+	r.Close()
+	written := make(chan error, 1)
+	go func() {
+		_, err := w.Write(secret)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		written <- err
+	}()
+	err = cmd.Wait()
+	werr := <-written
+	if err != nil {
+		zeroBytes(stdout.Bytes())
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%s: %w", msg, err)
+		}
+		if werr != nil {
+			err = fmt.Errorf("%w (cannot pass the %s: %v)", err, name, werr)
+		}
+		return nil, err
+	}
+	if werr != nil {
+		zeroBytes(stdout.Bytes())
+		return nil, fmt.Errorf("cannot pass the %s: %w", name, werr)
+	}
+	return stdout.Bytes(), nil
+}
+
+// ParseConfig parses the config file content, transparently decrypting it if it's encrypted. The *.toml files (or
+// e.g. *.toml.age encrypted ones) are parsed as TOML, see ParseTOML.
+// filename is only used for format detection and may be empty.
+func ParseConfig(filename string, data []byte, dec Decrypter, opts ...ParseOption) (*Config, error) {
+	if format := DetectEncryption(filename, data); format != Plaintext {
+		if ext := strings.ToLower(filepath.Ext(filename)); ext == ".age" || ext == ".gpg" || ext == ".pgp" || ext == ".asc" {
+			filename = strings.TrimSuffix(filename, filepath.Ext(filename))
+		}
+		if dec == nil {
+			return nil, fmt.Errorf("config is %v encrypted, but no decrypter provided", format)
+		}
+		plain, err := dec.Decrypt(format, data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt config: %w", err)
+		}
+		defer zeroBytes(plain)
+		data = plain
+	}
+	c := &Config{}
+	if strings.ToLower(filepath.Ext(filename)) == ".toml" {
+		if err := c.ParseTOML(data, opts...); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	if err := c.Parse(data, opts...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadConfig reads and parses the config file, transparently decrypting it if it's encrypted.
+// See WarnInsecurePermissions and RequirePrivatePermissions for checking the file permissions.
+func LoadConfig(path string, dec Decrypter, opts ...ParseOption) (*Config, error) {
+	options := &parseOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	b, err := options.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(b)
+	return ParseConfig(path, b, dec, opts...)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
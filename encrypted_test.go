@@ -0,0 +1,73 @@
+package wgquick
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectEncryption(t *testing.T) {
+	assert.Equal(t, Plaintext, DetectEncryption("wg0.conf", []byte(testConfigs["simple"])))
+	assert.Equal(t, AgeEncrypted, DetectEncryption("wg0.conf", []byte("age-encryption.org/v1\n-> X25519 abc\n")))
+	assert.Equal(t, AgeEncrypted, DetectEncryption("wg0.conf.age", []byte{0x00, 0x01}))
+	assert.Equal(t, GPGEncrypted, DetectEncryption("wg0.conf", []byte("-----BEGIN PGP MESSAGE-----\n")))
+	assert.Equal(t, GPGEncrypted, DetectEncryption("wg0.conf.gpg", []byte{0x8c, 0x0d}))
+}
+
+func TestParseGPGEncryptedConfig(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip(err)
+	}
+	dir, err := ioutil.TempDir("", "wg-quick-gpg")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// the gpg agent started for the home directory
+	defer exec.Command("gpgconf", "--homedir", dir, "--kill", "gpg-agent").Run()
+	passphrase := []byte("correct horse battery staple")
+	cmd := exec.Command("gpg", "--homedir", dir, "--batch", "--quiet", "--armor", "--symmetric", "--pinentry-mode", "loopback", "--passphrase-fd", "3")
+	ciphertext, err := decryptCommand(cmd, []byte(testConfigs["simple"]), "passphrase", passphrase)
+	if err != nil {
+		t.Skipf("cannot encrypt: %v", err)
+	}
+
+	_, err = ParseConfig("wg0.conf", ciphertext, nil)
+	assert.Error(t, err)
+	_, err = ParseConfig("wg0.conf", ciphertext, &GPGDecrypter{Homedir: dir, Passphrase: []byte("wrong")})
+	assert.Error(t, err)
+
+	c, err := ParseConfig("wg0.conf", ciphertext, &GPGDecrypter{Homedir: dir, Passphrase: passphrase})
+	require.NoError(t, err)
+	assert.Equal(t, testConfigs["simple"], c.StringWithSecrets())
+}
+
+func TestParseAgeEncryptedConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-age")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// the fake age "decrypts" by copying the input, if the identity is right
+	age := filepath.Join(dir, "age")
+	require.NoError(t, ioutil.WriteFile(age, []byte(`#!/bin/sh
+[ "$1 $2" = "--decrypt -i" ] && [ "$(cat "$3")" = "AGE-SECRET-KEY-1TEST" ] || { echo "age: error: no identity matched any of the recipients" >&2; exit 1; }
+cat
+`), 0755))
+
+	data := []byte(testConfigs["simple"])
+	c, err := ParseConfig("wg0.conf.age", data, &AgeDecrypter{Identity: []byte("AGE-SECRET-KEY-1TEST"), Command: age})
+	require.NoError(t, err)
+	assert.Equal(t, testConfigs["simple"], c.StringWithSecrets())
+
+	_, err = ParseConfig("wg0.conf.age", data, &AgeDecrypter{Identity: []byte("AGE-SECRET-KEY-1OTHER"), Command: age})
+	assert.EqualError(t, err, "cannot decrypt config: age: error: no identity matched any of the recipients: exit status 1")
+	_, err = (&AgeDecrypter{Command: age}).Decrypt(GPGEncrypted, data)
+	assert.Error(t, err)
+
+	// the command exiting without reading the identity
+	_, err = (&AgeDecrypter{Identity: make([]byte, 1<<20), Command: "true"}).Decrypt(AgeEncrypted, data)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot pass the identity")
+}
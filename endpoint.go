@@ -0,0 +1,137 @@
+package wgquick
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Resolver resolves the peer endpoint host names. *net.Resolver implements it, e.g. with a custom Dial to resolve over
+// the specific interface or DNS server.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// ResolverFunc adapts the function to Resolver, e.g. to resolve from the static map in tests
+type ResolverFunc func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+// LookupIPAddr calls f
+func (f ResolverFunc) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return f(ctx, host)
+}
+
+// WithResolver resolves the Endpoint host names with r instead of the system resolver
+func WithResolver(r Resolver) ParseOption {
+	return func(o *parseOptions) {
+		o.resolver = r
+	}
+}
+
+// EndpointFamily is the address family policy of the endpoint host names with both IPv4 and IPv6 addresses
+type EndpointFamily int
+
+const (
+	// PreferIPv4 picks the IPv4 address if there's any, like net.ResolveUDPAddr does
+	PreferIPv4 EndpointFamily = iota
+	// PreferIPv6 picks the IPv6 address if there's any
+	PreferIPv6
+	// RequireIPv4 fails without the IPv4 address
+	RequireIPv4
+	// RequireIPv6 fails without the IPv6 address
+	RequireIPv6
+)
+
+var endpointFamilyNames = map[EndpointFamily]string{
+	PreferIPv4:  "prefer-ipv4",
+	PreferIPv6:  "prefer-ipv6",
+	RequireIPv4: "require-ipv4",
+	RequireIPv6: "require-ipv6",
+}
+
+func (f EndpointFamily) String() string {
+	if name, ok := endpointFamilyNames[f]; ok {
+		return name
+	}
+	return strconv.Itoa(int(f))
+}
+
+// ParseEndpointFamily parses the policy name: prefer-ipv4, prefer-ipv6, require-ipv4 or require-ipv6
+func ParseEndpointFamily(s string) (EndpointFamily, error) {
+	for f, name := range endpointFamilyNames {
+		if name == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown endpoint family %q", s)
+}
+
+// WithEndpointFamily picks the Endpoint address according to the policy, PreferIPv4 by default
+func WithEndpointFamily(f EndpointFamily) ParseOption {
+	return func(o *parseOptions) {
+		o.endpointFamily = f
+	}
+}
+
+// pick returns the address by the policy
+func (f EndpointFamily) pick(addrs []net.IPAddr) (net.IPAddr, error) {
+	wantV4 := f == PreferIPv4 || f == RequireIPv4
+	for _, a := range addrs {
+		if (a.IP.To4() != nil) == wantV4 {
+			return a, nil
+		}
+	}
+	if f == RequireIPv4 || f == RequireIPv6 || len(addrs) == 0 {
+		return net.IPAddr{}, fmt.Errorf("no address matching %s", f)
+	}
+	return addrs[0], nil
+}
+
+// isIPEndpoint reports whether the host:port endpoint is an IP literal, which isn't resolved
+func isIPEndpoint(endpoint string) bool {
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return false
+	}
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	return net.ParseIP(host) != nil
+}
+
+// resolveEndpoint resolves host:port endpoint. The IP literals aren't resolved, but still have to match the required
+// family. Of the host addresses the one is picked by the endpoint family policy.
+func (o *parseOptions) resolveEndpoint(endpoint string) (*net.UDPAddr, error) {
+	host, portStr, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	port, err := net.LookupPort("udp", portStr)
+	if err != nil {
+		return nil, err
+	}
+	literal, zone := host, ""
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		literal, zone = host[:i], host[i+1:]
+	}
+	if ip := net.ParseIP(literal); ip != nil {
+		if _, err := o.endpointFamily.pick([]net.IPAddr{{IP: ip}}); err != nil {
+			return nil, err
+		}
+		return &net.UDPAddr{IP: ip, Port: port, Zone: zone}, nil
+	}
+	var r Resolver = net.DefaultResolver
+	if o.resolver != nil {
+		r = o.resolver
+	}
+	addrs, err := r.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := o.endpointFamily.pick(addrs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", host, err)
+	}
+	return &net.UDPAddr{IP: addr.IP, Port: port, Zone: addr.Zone}, nil
+}
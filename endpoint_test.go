@@ -0,0 +1,96 @@
+package wgquick
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithResolver(t *testing.T) {
+	hosts := map[string][]net.IPAddr{
+		"vpn.example.com": {{IP: net.ParseIP("2001:db8::1")}, {IP: net.ParseIP("192.0.2.1")}},
+		"v6.example.com":  {{IP: net.ParseIP("2001:db8::2")}},
+	}
+	var looked []string
+	resolver := ResolverFunc(func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		looked = append(looked, host)
+		if addrs, ok := hosts[host]; ok {
+			return addrs, nil
+		}
+		return nil, errors.New("no such host")
+	})
+	for endpoint, want := range map[string]string{
+		"vpn.example.com:51820": "192.0.2.1:51820",
+		"v6.example.com:51820":  "[2001:db8::2]:51820",
+		"198.51.100.1:51820":    "198.51.100.1:51820",
+		"[fe80::1%eth0]:51820":  "[fe80::1%eth0]:51820",
+	} {
+		cfg := &Config{}
+		require.NoError(t, cfg.Parse([]byte(`[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = `+endpoint), WithResolver(resolver)), endpoint)
+		assert.Equal(t, want, cfg.Peers[0].Endpoint.String(), endpoint)
+		if isIPEndpoint(endpoint) {
+			assert.Empty(t, cfg.EndpointHosts, endpoint)
+		} else {
+			assert.Equal(t, endpoint, cfg.EndpointHosts[cfg.Peers[0].PublicKey])
+		}
+	}
+	assert.ElementsMatch(t, []string{"vpn.example.com", "v6.example.com"}, looked, "IP literals aren't resolved")
+
+	cfg := &Config{}
+	err := cfg.Parse([]byte(`[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = unknown.example.com:51820`), WithResolver(resolver))
+	assert.Error(t, err)
+}
+
+func TestWithEndpointFamily(t *testing.T) {
+	resolver := ResolverFunc(func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		switch host {
+		case "dual.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.1")}, {IP: net.ParseIP("2001:db8::1")}}, nil
+		case "v4.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.2")}}, nil
+		}
+		return nil, errors.New("no such host")
+	})
+	tests := []struct {
+		family   EndpointFamily
+		endpoint string
+		want     string
+	}{
+		{PreferIPv4, "dual.example.com:1", "192.0.2.1:1"},
+		{PreferIPv6, "dual.example.com:1", "[2001:db8::1]:1"},
+		{PreferIPv6, "v4.example.com:1", "192.0.2.2:1"},
+		{RequireIPv4, "dual.example.com:1", "192.0.2.1:1"},
+		{RequireIPv6, "dual.example.com:1", "[2001:db8::1]:1"},
+		{RequireIPv6, "v4.example.com:1", ""},
+		{RequireIPv6, "192.0.2.3:1", ""},
+		{RequireIPv4, "192.0.2.3:1", "192.0.2.3:1"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{}
+		err := cfg.Parse([]byte(`[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+Endpoint = `+tt.endpoint), WithResolver(resolver), WithEndpointFamily(tt.family))
+		if tt.want == "" {
+			assert.Error(t, err, "%s %s", tt.family, tt.endpoint)
+			continue
+		}
+		require.NoError(t, err, "%s %s", tt.family, tt.endpoint)
+		assert.Equal(t, tt.want, cfg.Peers[0].Endpoint.String(), "%s %s", tt.family, tt.endpoint)
+	}
+
+	for f := range endpointFamilyNames {
+		parsed, err := ParseEndpointFamily(f.String())
+		require.NoError(t, err)
+		assert.Equal(t, f, parsed)
+	}
+	_, err := ParseEndpointFamily("ipv5")
+	assert.Error(t, err)
+}
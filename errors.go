@@ -0,0 +1,49 @@
+package wgquick
+
+import "strings"
+
+// OpError is the failed operation with its context, e.g. `wg0: routes: replace route 10.0.0.0/24: invalid argument`.
+// It unwraps to the underlying error, so the callers can check it with errors.Is, e.g. errors.Is(err, syscall.EEXIST).
+type OpError struct {
+	// Iface is the interface name
+	Iface string
+	// Phase is the sync phase, e.g. "routes"
+	Phase string
+	// Op is the operation, e.g. "replace route"
+	Op string
+	// Subject is the subject of the operation, e.g. the route or the address
+	Subject string
+	Err     error
+}
+
+func (e *OpError) Error() string {
+	var parts []string
+	for _, s := range []string{e.Iface, e.Phase, strings.TrimSpace(e.Op + " " + e.Subject)} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(append(parts, e.Err.Error()), ": ")
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// opContext attaches the interface and the phase to the error, filling them in if it's already OpError
+func opContext(err error, iface, phase string) error {
+	if err == nil {
+		return nil
+	}
+	oe, ok := err.(*OpError)
+	if !ok {
+		return &OpError{Iface: iface, Phase: phase, Err: err}
+	}
+	if oe.Iface == "" {
+		oe.Iface = iface
+	}
+	if oe.Phase == "" {
+		oe.Phase = phase
+	}
+	return oe
+}
@@ -0,0 +1,242 @@
+package wgquick
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// DefaultEventInterval is how often RunEventMonitor polls the interface when no interval is specified
+const DefaultEventInterval = 5 * time.Second
+
+// EventType is the runtime event of the interface, see RunEventMonitor
+type EventType int
+
+const (
+	// EventFirstHandshake is the first handshake with the peer since the monitor started
+	EventFirstHandshake EventType = iota + 1
+	// EventEndpointChange is the peer endpoint change, e.g. the roaming peer
+	EventEndpointChange
+	// EventHandshakeTimeout is the last handshake with the peer getting older than HandshakeTimeout
+	EventHandshakeTimeout
+	// EventRouteRemoved is the managed route removed by someone else
+	EventRouteRemoved
+)
+
+var eventTypeNames = map[EventType]string{
+	EventFirstHandshake:   "first-handshake",
+	EventEndpointChange:   "endpoint-change",
+	EventHandshakeTimeout: "handshake-timeout",
+	EventRouteRemoved:     "route-removed",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// ParseEventType parses the event type name: first-handshake, endpoint-change, handshake-timeout or route-removed
+func ParseEventType(s string) (EventType, error) {
+	for t, name := range eventTypeNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown event type %q", s)
+}
+
+// Event is the runtime event of the interface. Peer and Endpoint are set for the peer events, Route for EventRouteRemoved.
+type Event struct {
+	Type  EventType
+	Iface string
+	Time  time.Time
+	Peer  wgtypes.Key
+	// Endpoint is the current peer endpoint, the new one for EventEndpointChange
+	Endpoint *net.UDPAddr
+	Route    *net.IPNet
+}
+
+func (e Event) String() string {
+	s := e.Iface + " " + e.Type.String()
+	switch e.Type {
+	case EventRouteRemoved:
+		s += " " + e.Route.String()
+	default:
+		s += " " + serializeKey(&e.Peer)
+		if e.Endpoint != nil {
+			s += " " + e.Endpoint.String()
+		}
+	}
+	return s
+}
+
+// EventHandler is called with every event by RunEventMonitor
+type EventHandler func(Event)
+
+// hookCommand returns the event hook with the event placeholders expanded: %p the peer public key, %e the endpoint and
+// %r the route. %i is expanded by execHook.
+func (e Event) hookCommand(hook string) string {
+	endpoint, route := "", ""
+	if e.Endpoint != nil {
+		endpoint = e.Endpoint.String()
+	}
+	if e.Route != nil {
+		route = e.Route.String()
+	}
+	peer := ""
+	if e.Peer != (wgtypes.Key{}) {
+		peer = serializeKey(&e.Peer)
+	}
+	return strings.NewReplacer("%p", peer, "%e", endpoint, "%r", route).Replace(hook)
+}
+
+func eventHooksString(hooks map[EventType]string) string {
+	var items []string
+	for t, hook := range hooks {
+		items = append(items, t.String()+"="+hook)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ", ")
+}
+
+// eventPeer is the peer state seen by the previous poll
+type eventPeer struct {
+	handshake time.Time
+	endpoint  string
+	timedOut  bool
+}
+
+// eventMonitor keeps the interface state between the polls
+type eventMonitor struct {
+	c       *Client
+	cfg     *Config
+	iface   string
+	handler EventHandler
+	log     logrus.FieldLogger
+	peers   map[wgtypes.Key]*eventPeer
+	routes  map[string]bool
+}
+
+// RunEventMonitor polls the interface every interval (DefaultEventInterval if 0) until the context is done, running
+// cfg.EventHooks and calling the handler (if not nil) for every event. The first poll records the state the events
+// are relative to, e.g. the peer which already has a handshake gets no EventFirstHandshake. The failed hooks and polls
+// are logged.
+func (c *Client) RunEventMonitor(ctx context.Context, cfg *Config, iface string, interval time.Duration, handler EventHandler, logger logrus.FieldLogger) error {
+	if interval == 0 {
+		interval = DefaultEventInterval
+	}
+	cfg = cfg.clone()
+	cfg.FillDefaults()
+	m := &eventMonitor{c: c, cfg: cfg, iface: iface, handler: handler, log: logger.WithField("iface", iface)}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.poll(); err != nil {
+			m.log.WithError(err).Warn("cannot poll interface events")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll compares the interface with the previous poll, emitting the events
+func (m *eventMonitor) poll() error {
+	cl, err := m.c.wgctrl()
+	if err != nil {
+		return err
+	}
+	dev, err := cl.Device(m.iface)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	first := m.peers == nil
+	if first {
+		m.peers = make(map[wgtypes.Key]*eventPeer)
+	}
+	for _, p := range dev.Peers {
+		endpoint := ""
+		if p.Endpoint != nil {
+			endpoint = p.Endpoint.String()
+		}
+		timedOut := !p.LastHandshakeTime.IsZero() && now.Sub(p.LastHandshakeTime) > HandshakeTimeout
+		prev, ok := m.peers[p.PublicKey]
+		m.peers[p.PublicKey] = &eventPeer{handshake: p.LastHandshakeTime, endpoint: endpoint, timedOut: timedOut}
+		if first {
+			continue
+		}
+		ev := Event{Iface: m.iface, Time: now, Peer: p.PublicKey, Endpoint: p.Endpoint}
+		if !ok {
+			prev = &eventPeer{}
+		}
+		if prev.handshake.IsZero() && !p.LastHandshakeTime.IsZero() {
+			ev.Type = EventFirstHandshake
+			m.emit(ev)
+		}
+		if prev.endpoint != "" && endpoint != "" && prev.endpoint != endpoint {
+			ev.Type = EventEndpointChange
+			m.emit(ev)
+		}
+		if timedOut && !prev.timedOut {
+			ev.Type = EventHandshakeTimeout
+			m.emit(ev)
+		}
+	}
+	return m.pollRoutes(now)
+}
+
+// pollRoutes emits EventRouteRemoved for the managed routes present in the previous poll, but missing now
+func (m *eventMonitor) pollRoutes(now time.Time) error {
+	if m.cfg.Table == TableOff {
+		return nil
+	}
+	link, err := m.c.nl.LinkByName(m.iface)
+	if err != nil {
+		return err
+	}
+	present, err := m.c.listOwnedRoutes(m.cfg, link)
+	if err != nil {
+		return err
+	}
+	routes := make(map[string]bool, len(present))
+	for _, rt := range present {
+		routes[rt.Dst.String()] = true
+	}
+	wanted := m.cfg.managedRoutes()
+	for _, rt := range m.cfg.Routes {
+		wanted = append(wanted, rt.Dst)
+	}
+	for _, dst := range wanted {
+		dst := dst // make copy
+		if m.routes != nil && m.routes[dst.String()] && !routes[dst.String()] {
+			m.emit(Event{Type: EventRouteRemoved, Iface: m.iface, Time: now, Route: &dst})
+		}
+	}
+	m.routes = routes
+	return nil
+}
+
+// emit runs the event hook and calls the handler
+func (m *eventMonitor) emit(ev Event) {
+	log := m.log.WithField("event", ev.String())
+	log.Info("interface event")
+	if hook := m.cfg.EventHooks[ev.Type]; hook != "" {
+		if err := m.c.runHook(m.cfg, ev.hookCommand(hook), m.iface, log); err != nil {
+			log.WithError(err).Warn("event hook failed")
+		}
+	}
+	if m.handler != nil {
+		m.handler(ev)
+	}
+}
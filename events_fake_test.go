@@ -0,0 +1,71 @@
+package wgquick_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestRunEventMonitor(t *testing.T) {
+	c, nl, wg := newFakeClient(t)
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	peer := cfg.Peers[0].PublicKey
+
+	events := make(chan wgquick.Event, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.RunEventMonitor(ctx, cfg, "wg0", time.Millisecond, func(ev wgquick.Event) { events <- ev }, testLog)
+	next := func() wgquick.Event {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+			return wgquick.Event{}
+		}
+	}
+	setEndpoint := func(endpoint string) {
+		addr, err := net.ResolveUDPAddr("udp", endpoint)
+		require.NoError(t, err)
+		require.NoError(t, wg.ConfigureDevice("wg0", wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: peer, UpdateOnly: true, Endpoint: addr}}}))
+	}
+	// let the first poll record the state
+	time.Sleep(20 * time.Millisecond)
+
+	require.NoError(t, wg.SetLastHandshake("wg0", peer, time.Now()))
+	ev := next()
+	assert.Equal(t, wgquick.EventFirstHandshake, ev.Type)
+	assert.Equal(t, peer, ev.Peer)
+
+	setEndpoint("198.51.100.1:51820")
+	time.Sleep(20 * time.Millisecond)
+	setEndpoint("198.51.100.2:51820")
+	ev = next()
+	assert.Equal(t, wgquick.EventEndpointChange, ev.Type)
+	assert.Equal(t, "198.51.100.2:51820", ev.Endpoint.String())
+
+	require.NoError(t, wg.SetLastHandshake("wg0", peer, time.Now().Add(-time.Hour)))
+	assert.Equal(t, wgquick.EventHandshakeTimeout, next().Type)
+
+	rt := nl.Routes()[0]
+	require.NoError(t, nl.RouteDel(&rt))
+	ev = next()
+	assert.Equal(t, wgquick.EventRouteRemoved, ev.Type)
+	assert.Equal(t, rt.Dst.String(), ev.Route.String())
+
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %v", ev)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
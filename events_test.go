@@ -0,0 +1,32 @@
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventType(t *testing.T) {
+	for typ := range eventTypeNames {
+		parsed, err := ParseEventType(typ.String())
+		require.NoError(t, err)
+		assert.Equal(t, typ, parsed)
+	}
+	_, err := ParseEventType("link-down")
+	assert.Error(t, err)
+}
+
+func TestEventHookCommand(t *testing.T) {
+	key, err := ParseKey("xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=")
+	require.NoError(t, err)
+	ev := Event{Type: EventEndpointChange, Iface: "wg0", Peer: key, Endpoint: &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 51820}}
+	assert.Equal(t, "logger %i xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg= 198.51.100.1:51820 ", ev.hookCommand("logger %i %p %e %r"))
+
+	_, dst, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	ev = Event{Type: EventRouteRemoved, Iface: "wg0", Route: dst}
+	assert.Equal(t, "ip route add 10.0.0.0/8 dev %i", ev.hookCommand("ip route add %r dev %i"))
+	assert.Equal(t, "wg0 route-removed 10.0.0.0/8", ev.String())
+}
@@ -0,0 +1,143 @@
+package wgquick
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExitNode configures the host as the exit node for the tunnel peers, forwarding and masquerading their traffic out of
+// the egress device. The firewall rules are managed with iptables and ip6tables.
+type ExitNode struct {
+	// Egress is the device the peer traffic leaves the host through, e.g. eth0
+	Egress string
+	// Hairpin forwards the traffic between the peers back into the tunnel, so they can reach each other via the exit node
+	Hairpin bool
+}
+
+// exitNodeRules returns the iptables rules (without the action) for the tunnel, in the order they're added.
+// The masquerade is limited to the tunnel networks, so the host's own and the hairpin traffic are left alone.
+func (e ExitNode) exitNodeRules(cfg *Config, iface string) [][]string {
+	var rules [][]string
+	for _, cmd := range []string{"iptables", "ip6tables"} {
+		var nets []string
+		for _, addr := range cfg.Address {
+			if (addr.IP.To4() != nil) != (cmd == "iptables") {
+				continue
+			}
+			n := net.IPNet{IP: addr.IP.Mask(addr.Mask), Mask: addr.Mask}
+			nets = append(nets, n.String())
+		}
+		if len(nets) == 0 {
+			continue
+		}
+		rules = append(rules,
+			[]string{cmd, "-w", "FORWARD", "-i", iface, "-o", e.Egress, "-j", "ACCEPT"},
+			[]string{cmd, "-w", "FORWARD", "-i", e.Egress, "-o", iface, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+		)
+		if e.Hairpin {
+			rules = append(rules, []string{cmd, "-w", "FORWARD", "-i", iface, "-o", iface, "-j", "ACCEPT"})
+		}
+		for _, n := range nets {
+			rules = append(rules, []string{cmd, "-w", "-t", "nat", "POSTROUTING", "-s", n, "-o", e.Egress, "-j", "MASQUERADE"})
+		}
+	}
+	return rules
+}
+
+// iptablesArgs returns the arguments of the iptables rule with the action (-A, -I, -C, -D) inserted before the chain,
+// after the -w and -t table options
+func iptablesArgs(rule []string, action string) []string {
+	i := 2
+	if rule[2] == "-t" {
+		i = 4
+	}
+	return append(append(append([]string(nil), rule[:i]...), action), rule[i:]...)
+}
+
+// iptablesRulePresent reports whether the rule is in its chain, i.e. `iptables -C` succeeds
+func iptablesRulePresent(rule []string) bool {
+	args := iptablesArgs(rule, "-C")
+	return exec.Command(args[0], args[1:]...).Run() == nil
+}
+
+// addIptablesRules adds the rules with the action, -A appending them or -I inserting them before e.g. the default drop
+// rule. The present rules are skipped, so adding them again doesn't duplicate them. On failure the rules added so far
+// are deleted.
+func (c *Client) addIptablesRules(rules [][]string, action string, log logrus.FieldLogger) error {
+	var added [][]string
+	for _, rule := range rules {
+		if iptablesRulePresent(rule) {
+			log.WithField("rule", strings.Join(rule, " ")).Debug("firewall rule present")
+			continue
+		}
+		if err := c.runCommand(iptablesArgs(rule, action), log); err != nil {
+			log.WithError(err).Errorln("cannot add firewall rule")
+			c.deleteIptablesRules(added, log)
+			return err
+		}
+		added = append(added, rule)
+	}
+	return nil
+}
+
+// UpExitNode brings the interface up with forwarding enabled (see Config.IPForward) and installs the exit node firewall
+// rules. On failure everything done so far is reverted.
+func (c *Client) UpExitNode(cfg *Config, iface string, exit ExitNode, logger logrus.FieldLogger) error {
+	if exit.Egress == "" {
+		return fmt.Errorf("exit node: egress device not set")
+	}
+	log := logger.WithFields(map[string]interface{}{"iface": iface, "egress": exit.Egress})
+	if _, err := c.nl.LinkByName(exit.Egress); err != nil {
+		log.WithError(err).Errorln("cannot find egress device")
+		return err
+	}
+	cfg = cfg.clone()
+	cfg.IPForward = true
+	rules := exit.exitNodeRules(cfg, iface)
+	if err := c.Up(cfg, iface, logger); err != nil {
+		return err
+	}
+	// inserted, the FORWARD chain may end with the rule dropping the rest
+	err := c.addIptablesRules(rules, "-I", log)
+	if err == nil {
+		err = c.recordFirewallRules(iface, rules, nil, log)
+	}
+	if err != nil {
+		c.deleteIptablesRules(rules, log)
+		if err := c.Down(cfg, iface, logger); err != nil {
+			log.WithError(err).Errorln("cannot bring the interface down")
+		}
+		return err
+	}
+	log.Infoln("exit node up")
+	return nil
+}
+
+// DownExitNode deletes the exit node firewall rules and brings the interface down, restoring the forwarding sysctls.
+// The rules which are already gone are skipped. With the state files Down alone deletes them too.
+func (c *Client) DownExitNode(cfg *Config, iface string, exit ExitNode, logger logrus.FieldLogger) error {
+	if exit.Egress == "" {
+		return fmt.Errorf("exit node: egress device not set")
+	}
+	log := logger.WithFields(map[string]interface{}{"iface": iface, "egress": exit.Egress})
+	c.deleteIptablesRules(exit.exitNodeRules(cfg, iface), log)
+	cfg = cfg.clone()
+	cfg.IPForward = true
+	return c.Down(cfg, iface, logger)
+}
+
+// deleteIptablesRules deletes the rules in reverse order, skipping the ones which are gone and logging the failures
+func (c *Client) deleteIptablesRules(rules [][]string, log logrus.FieldLogger) {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if !iptablesRulePresent(rules[i]) {
+			continue
+		}
+		if err := c.runCommand(iptablesArgs(rules[i], "-D"), log); err != nil {
+			log.WithError(err).Warnln("cannot delete firewall rule")
+		}
+	}
+}
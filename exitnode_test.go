@@ -0,0 +1,66 @@
+package wgquick
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitNodeRules(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	c.Address = nil
+	for _, s := range []string{"10.200.100.8/24", "fd00::8/64"} {
+		addr, err := parseIPNet(s)
+		require.NoError(t, err)
+		c.Address = append(c.Address, addr)
+	}
+
+	var cmds []string
+	for _, rule := range (ExitNode{Egress: "eth0", Hairpin: true}).exitNodeRules(c, "wg0") {
+		cmds = append(cmds, strings.Join(iptablesArgs(rule, "-I"), " "))
+	}
+	assert.Equal(t, []string{
+		"iptables -w -I FORWARD -i wg0 -o eth0 -j ACCEPT",
+		"iptables -w -I FORWARD -i eth0 -o wg0 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT",
+		"iptables -w -I FORWARD -i wg0 -o wg0 -j ACCEPT",
+		"iptables -w -t nat -I POSTROUTING -s 10.200.100.0/24 -o eth0 -j MASQUERADE",
+		"ip6tables -w -I FORWARD -i wg0 -o eth0 -j ACCEPT",
+		"ip6tables -w -I FORWARD -i eth0 -o wg0 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT",
+		"ip6tables -w -I FORWARD -i wg0 -o wg0 -j ACCEPT",
+		"ip6tables -w -t nat -I POSTROUTING -s fd00::/64 -o eth0 -j MASQUERADE",
+	}, cmds)
+
+	c.Address = c.Address[:1]
+	rules := (ExitNode{Egress: "eth0"}).exitNodeRules(c, "wg0")
+	require.Len(t, rules, 3)
+	assert.Equal(t, "iptables -w -t nat -D POSTROUTING -s 10.200.100.0/24 -o eth0 -j MASQUERADE", strings.Join(iptablesArgs(rules[2], "-D"), " "))
+}
+
+func TestRecordFirewallRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	c := &Client{stateDir: &dir}
+	require.NoError(t, c.saveState("wg0", &State{}))
+
+	forward := []string{"iptables", "-w", "FORWARD", "-i", "wg0", "-o", "eth0", "-j", "ACCEPT"}
+	nat := []string{"iptables", "-w", "-t", "nat", "POSTROUTING", "-o", "eth0", "-j", "MASQUERADE"}
+	require.NoError(t, c.recordFirewallRules("wg0", [][]string{forward, nat}, nil, log))
+	require.NoError(t, c.recordFirewallRules("wg0", [][]string{forward}, nil, log))
+	st, err := c.LoadState("wg0")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{nat, forward}, st.FirewallRules, "recorded once")
+
+	require.NoError(t, c.recordFirewallRules("wg0", nil, [][]string{nat}, log))
+	st, err = c.LoadState("wg0")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{forward}, st.FirewallRules)
+}
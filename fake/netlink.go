@@ -0,0 +1,484 @@
+// Package fake provides in-memory implementations of the wgquick Netlink and Wireguard interfaces, so the code using
+// wgquick.Client can be tested without root and a real kernel:
+//
+//	nl := fake.NewNetlink()
+//	c, err := wgquick.NewClient(wgquick.WithNetlink(nl), wgquick.WithWireguard(fake.NewWireguard(nl)))
+//
+// They model the kernel state closely enough for Sync to converge, not the full kernel semantics.
+package fake
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Netlink keeps the links, addresses, routes and rules in memory. It's safe for concurrent use.
+type Netlink struct {
+	mu        sync.Mutex
+	links     map[string]*netlink.GenericLink
+	nextIndex int
+	// groups of the links by index, netlink.LinkAttrs has no group
+	groups map[int]uint32
+	addrs  map[int][]netlink.Addr
+	routes []netlink.Route
+	rules  []netlink.Rule
+	neighs []netlink.Neigh
+	// watchers get the link index of the network changes, see WatchNetwork
+	watchers map[chan<- int]bool
+}
+
+// NewNetlink returns the empty fake with only the loopback link
+func NewNetlink() *Netlink {
+	n := &Netlink{
+		links:    make(map[string]*netlink.GenericLink),
+		addrs:    make(map[int][]netlink.Addr),
+		groups:   make(map[int]uint32),
+		watchers: make(map[chan<- int]bool),
+	}
+	n.LinkAdd(&netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Name: "lo"}, LinkType: "loopback"})
+	return n
+}
+
+// Routes returns all the routes
+func (n *Netlink) Routes() []netlink.Route {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]netlink.Route(nil), n.routes...)
+}
+
+// Rules returns all the rules
+func (n *Netlink) Rules() []netlink.Rule {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]netlink.Rule(nil), n.rules...)
+}
+
+// WatchNetwork sends the link index of every link up or delete, address change and default route change to changes until
+// done is closed. The changes are dropped if the channel is full.
+func (n *Netlink) WatchNetwork(changes chan<- int, done <-chan struct{}) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.watchers[changes] = true
+	go func() {
+		<-done
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.watchers, changes)
+	}()
+	return nil
+}
+
+// notify sends the change to the watchers, the lock must be held
+func (n *Netlink) notify(index int) {
+	for ch := range n.watchers {
+		select {
+		case ch <- index:
+		default:
+		}
+	}
+}
+
+func isDefaultRoute(rt netlink.Route) bool {
+	if rt.Dst == nil {
+		return true
+	}
+	ones, _ := rt.Dst.Mask.Size()
+	return ones == 0
+}
+
+func copyLink(l *netlink.GenericLink) netlink.Link {
+	cp := *l
+	return &cp
+}
+
+// link returns the stored link, syscall.ENODEV if it doesn't exist
+func (n *Netlink) link(link netlink.Link) (*netlink.GenericLink, error) {
+	for _, l := range n.links {
+		if l.Index == link.Attrs().Index {
+			return l, nil
+		}
+	}
+	return nil, syscall.ENODEV
+}
+
+// LinkList lists the links ordered by index
+func (n *Netlink) LinkList() ([]netlink.Link, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	links := make([]netlink.Link, 0, len(n.links))
+	for _, l := range n.links {
+		links = append(links, copyLink(l))
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Attrs().Index < links[j].Attrs().Index })
+	return links, nil
+}
+
+// LinkByName returns the link, syscall.ENODEV if it doesn't exist
+func (n *Netlink) LinkByName(name string) (netlink.Link, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	l, ok := n.links[name]
+	if !ok {
+		return nil, syscall.ENODEV
+	}
+	return copyLink(l), nil
+}
+
+// LinkAdd adds the link with the next free index
+func (n *Netlink) LinkAdd(link netlink.Link) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	attrs := *link.Attrs()
+	if _, ok := n.links[attrs.Name]; ok {
+		return syscall.EEXIST
+	}
+	n.nextIndex++
+	attrs.Index = n.nextIndex
+	n.links[attrs.Name] = &netlink.GenericLink{LinkAttrs: attrs, LinkType: link.Type()}
+	return nil
+}
+
+// LinkDel deletes the link together with its addresses, routes and neighbor entries
+func (n *Netlink) LinkDel(link netlink.Link) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	l, err := n.link(link)
+	if err != nil {
+		return err
+	}
+	delete(n.links, l.Name)
+	delete(n.addrs, l.Index)
+	delete(n.groups, l.Index)
+	var routes []netlink.Route
+	for _, rt := range n.routes {
+		if rt.LinkIndex != l.Index {
+			routes = append(routes, rt)
+		}
+	}
+	n.routes = routes
+	var neighs []netlink.Neigh
+	for _, neigh := range n.neighs {
+		if neigh.LinkIndex != l.Index {
+			neighs = append(neighs, neigh)
+		}
+	}
+	n.neighs = neighs
+	n.notify(l.Index)
+	return nil
+}
+
+// LinkSetUp sets the link up
+func (n *Netlink) LinkSetUp(link netlink.Link) error {
+	return n.setLink(link, func(l *netlink.GenericLink) {
+		l.Flags |= net.FlagUp
+		l.OperState = netlink.OperUp
+		n.notify(l.Index)
+	})
+}
+
+// LinkSetAlias sets the link alias
+func (n *Netlink) LinkSetAlias(link netlink.Link, name string) error {
+	return n.setLink(link, func(l *netlink.GenericLink) { l.Alias = name })
+}
+
+// LinkSetTxQLen sets the link transmit queue length
+func (n *Netlink) LinkSetTxQLen(link netlink.Link, qlen int) error {
+	return n.setLink(link, func(l *netlink.GenericLink) { l.TxQLen = qlen })
+}
+
+// LinkSetGroup sets the link group
+func (n *Netlink) LinkSetGroup(link netlink.Link, group uint32) error {
+	return n.setLink(link, func(l *netlink.GenericLink) { n.groups[l.Index] = group })
+}
+
+// LinkGroup returns the link group
+func (n *Netlink) LinkGroup(name string) uint32 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if l, ok := n.links[name]; ok {
+		return n.groups[l.Index]
+	}
+	return 0
+}
+
+func (n *Netlink) setLink(link netlink.Link, set func(l *netlink.GenericLink)) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	l, err := n.link(link)
+	if err != nil {
+		return err
+	}
+	set(l)
+	return nil
+}
+
+func addrFamily(addr netlink.Addr) int {
+	if addr.IP.To4() != nil {
+		return unix.AF_INET
+	}
+	return unix.AF_INET6
+}
+
+// AddrList lists the link addresses of the family, or all of them for FAMILY_ALL
+func (n *Netlink) AddrList(link netlink.Link, family int) ([]netlink.Addr, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	l, err := n.link(link)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []netlink.Addr
+	for _, addr := range n.addrs[l.Index] {
+		if family == netlink.FAMILY_ALL || addrFamily(addr) == family {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+// AddrAdd adds the address, syscall.EEXIST if the link already has it
+func (n *Netlink) AddrAdd(link netlink.Link, addr *netlink.Addr) error {
+	return n.addrAdd(link, addr, false)
+}
+
+// AddrReplaceMetric adds or replaces the address. The metric isn't modelled
+func (n *Netlink) AddrReplaceMetric(link netlink.Link, addr *netlink.Addr, metric int) error {
+	return n.addrAdd(link, addr, true)
+}
+
+func (n *Netlink) addrAdd(link netlink.Link, addr *netlink.Addr, replace bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	l, err := n.link(link)
+	if err != nil {
+		return err
+	}
+	stored := *addr
+	addrs := n.addrs[l.Index]
+	for i, present := range addrs {
+		if present.IPNet.String() == addr.IPNet.String() {
+			if !replace {
+				return syscall.EEXIST
+			}
+			addrs[i] = stored
+			n.notify(l.Index)
+			return nil
+		}
+	}
+	n.addrs[l.Index] = append(addrs, stored)
+	n.notify(l.Index)
+	return nil
+}
+
+// AddrDel deletes the address, syscall.EADDRNOTAVAIL if the link doesn't have it
+func (n *Netlink) AddrDel(link netlink.Link, addr *netlink.Addr) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	l, err := n.link(link)
+	if err != nil {
+		return err
+	}
+	addrs := n.addrs[l.Index]
+	for i, present := range addrs {
+		if present.IPNet.String() == addr.IPNet.String() {
+			n.addrs[l.Index] = append(addrs[:i:i], addrs[i+1:]...)
+			n.notify(l.Index)
+			return nil
+		}
+	}
+	return syscall.EADDRNOTAVAIL
+}
+
+func routeFamily(rt netlink.Route) int {
+	if rt.Dst != nil && rt.Dst.IP.To4() == nil {
+		return unix.AF_INET6
+	}
+	return unix.AF_INET
+}
+
+// RouteListFiltered lists the routes matching the filter. Like the netlink library, routes outside the main table
+// are only listed when filtering on the table.
+func (n *Netlink) RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var routes []netlink.Route
+	for _, rt := range n.routes {
+		switch {
+		case family != netlink.FAMILY_ALL && routeFamily(rt) != family:
+		case filterMask&netlink.RT_FILTER_TABLE == 0 && rt.Table != unix.RT_TABLE_MAIN:
+		case filter == nil:
+			routes = append(routes, rt)
+		case filterMask&netlink.RT_FILTER_TABLE != 0 && filter.Table != unix.RT_TABLE_UNSPEC && rt.Table != filter.Table:
+		case filterMask&netlink.RT_FILTER_PROTOCOL != 0 && rt.Protocol != filter.Protocol:
+		case filterMask&netlink.RT_FILTER_SCOPE != 0 && rt.Scope != filter.Scope:
+		case filterMask&netlink.RT_FILTER_TYPE != 0 && rt.Type != filter.Type:
+		case filterMask&netlink.RT_FILTER_TOS != 0 && rt.Tos != filter.Tos:
+		case filterMask&netlink.RT_FILTER_OIF != 0 && rt.LinkIndex != filter.LinkIndex:
+		case filterMask&netlink.RT_FILTER_GW != 0 && !rt.Gw.Equal(filter.Gw):
+		case filterMask&netlink.RT_FILTER_DST != 0 && filter.Dst != nil && (rt.Dst == nil || rt.Dst.String() != filter.Dst.String()):
+		default:
+			routes = append(routes, rt)
+		}
+	}
+	return routes, nil
+}
+
+// routeKey identifies the route like the kernel does: table, destination, tos and metric
+func routeKey(rt netlink.Route) [4]interface{} {
+	dst := ""
+	if rt.Dst != nil {
+		dst = rt.Dst.String()
+	}
+	return [4]interface{}{rt.Table, dst, rt.Tos, rt.Priority}
+}
+
+// RouteReplace adds or replaces the route with the same table, destination, tos and metric
+func (n *Netlink) RouteReplace(route *netlink.Route) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, rt := range n.routes {
+		if routeKey(rt) == routeKey(*route) {
+			n.routes[i] = *route
+			n.notifyRoute(*route)
+			return nil
+		}
+	}
+	n.routes = append(n.routes, *route)
+	n.notifyRoute(*route)
+	return nil
+}
+
+// notifyRoute notifies the default route changes, the lock must be held
+func (n *Netlink) notifyRoute(rt netlink.Route) {
+	if isDefaultRoute(rt) {
+		n.notify(rt.LinkIndex)
+	}
+}
+
+// RouteReplaceMTULock is RouteReplace, the MTU lock isn't recorded
+func (n *Netlink) RouteReplaceMTULock(route *netlink.Route) error {
+	return n.RouteReplace(route)
+}
+
+// RouteDel deletes the route with the same table, destination, tos and metric, syscall.ESRCH if there's none
+func (n *Netlink) RouteDel(route *netlink.Route) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, rt := range n.routes {
+		if routeKey(rt) == routeKey(*route) {
+			n.routes = append(n.routes[:i:i], n.routes[i+1:]...)
+			n.notifyRoute(rt)
+			return nil
+		}
+	}
+	return syscall.ESRCH
+}
+
+func ruleFamily(rule netlink.Rule) int {
+	switch {
+	case rule.Family != 0:
+		return rule.Family
+	case rule.Src != nil && rule.Src.IP.To4() == nil, rule.Dst != nil && rule.Dst.IP.To4() == nil:
+		return unix.AF_INET6
+	default:
+		return unix.AF_INET
+	}
+}
+
+func ipNetString(n *net.IPNet) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
+
+// ruleMatches reports whether the rule matches the selector of RuleDel: priority, table, family, src and dst
+func ruleMatches(rule, sel netlink.Rule) bool {
+	return rule.Priority == sel.Priority && rule.Table == sel.Table && ruleFamily(rule) == ruleFamily(sel) &&
+		ipNetString(rule.Src) == ipNetString(sel.Src) && ipNetString(rule.Dst) == ipNetString(sel.Dst)
+}
+
+// RuleList lists the rules of the family, or all of them for FAMILY_ALL
+func (n *Netlink) RuleList(family int) ([]netlink.Rule, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var rules []netlink.Rule
+	for _, rule := range n.rules {
+		if family == netlink.FAMILY_ALL || ruleFamily(rule) == family {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// RuleAdd adds the rule. Like the kernel, it stores the family and reports the unset mark and mask as -1
+func (n *Netlink) RuleAdd(rule *netlink.Rule) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	stored := *rule
+	stored.Family = ruleFamily(stored)
+	if stored.Mark == 0 && stored.Mask <= 0 {
+		stored.Mark, stored.Mask = -1, -1
+	}
+	n.rules = append(n.rules, stored)
+	return nil
+}
+
+// RuleDel deletes the first matching rule, syscall.ENOENT if there's none
+func (n *Netlink) RuleDel(rule *netlink.Rule) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, present := range n.rules {
+		if ruleMatches(present, *rule) {
+			n.rules = append(n.rules[:i:i], n.rules[i+1:]...)
+			return nil
+		}
+	}
+	return syscall.ENOENT
+}
+
+func neighMatches(neigh, sel netlink.Neigh) bool {
+	return neigh.LinkIndex == sel.LinkIndex && neigh.IP.Equal(sel.IP) && neigh.Flags&netlink.NTF_PROXY == sel.Flags&netlink.NTF_PROXY
+}
+
+// Neighs returns all the neighbor entries
+func (n *Netlink) Neighs() []netlink.Neigh {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]netlink.Neigh(nil), n.neighs...)
+}
+
+// NeighSet adds the neighbor entry or replaces the one with the same link, IP and proxy flag
+func (n *Netlink) NeighSet(neigh *netlink.Neigh) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, err := n.link(&netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Index: neigh.LinkIndex}}); err != nil {
+		return err
+	}
+	for i, present := range n.neighs {
+		if neighMatches(present, *neigh) {
+			n.neighs[i] = *neigh
+			return nil
+		}
+	}
+	n.neighs = append(n.neighs, *neigh)
+	return nil
+}
+
+// NeighDel deletes the neighbor entry, syscall.ENOENT if there's none
+func (n *Netlink) NeighDel(neigh *netlink.Neigh) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, present := range n.neighs {
+		if neighMatches(present, *neigh) {
+			n.neighs = append(n.neighs[:i:i], n.neighs[i+1:]...)
+			return nil
+		}
+	}
+	return syscall.ENOENT
+}
@@ -0,0 +1,149 @@
+package fake
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Wireguard keeps the wireguard devices in memory. The devices are the fake Netlink links of type wireguard.
+// It's safe for concurrent use.
+type Wireguard struct {
+	nl      *Netlink
+	mu      sync.Mutex
+	devices map[int]*wgtypes.Device
+}
+
+// NewWireguard returns the fake configuring the wireguard links of nl
+func NewWireguard(nl *Netlink) *Wireguard {
+	return &Wireguard{nl: nl, devices: make(map[int]*wgtypes.Device)}
+}
+
+// device returns the device of the wireguard link, os.ErrNotExist if there's no such link.
+// The device state is reset when the link is recreated.
+func (w *Wireguard) device(name string) (*wgtypes.Device, error) {
+	link, err := w.nl.LinkByName(name)
+	if err != nil || link.Type() != "wireguard" {
+		return nil, os.ErrNotExist
+	}
+	dev, ok := w.devices[link.Attrs().Index]
+	if !ok {
+		dev = &wgtypes.Device{Name: name, Type: wgtypes.LinuxKernel}
+		w.devices[link.Attrs().Index] = dev
+	}
+	return dev, nil
+}
+
+// Device returns the copy of the device state
+func (w *Wireguard) Device(name string) (*wgtypes.Device, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dev, err := w.device(name)
+	if err != nil {
+		return nil, err
+	}
+	cp := *dev
+	cp.Peers = nil
+	for _, p := range dev.Peers {
+		p.AllowedIPs = append(p.AllowedIPs[:0:0], p.AllowedIPs...)
+		cp.Peers = append(cp.Peers, p)
+	}
+	return &cp, nil
+}
+
+// SetLastHandshake sets the last handshake time of the device peer, simulating the peer connecting
+func (w *Wireguard) SetLastHandshake(name string, key wgtypes.Key, t time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dev, err := w.device(name)
+	if err != nil {
+		return err
+	}
+	for i := range dev.Peers {
+		if dev.Peers[i].PublicKey == key {
+			dev.Peers[i].LastHandshakeTime = t
+			return nil
+		}
+	}
+	return os.ErrNotExist
+}
+
+// ConfigureDevice applies the config like the kernel does. The listen port 0 picks 51820 instead of a random port
+func (w *Wireguard) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dev, err := w.device(name)
+	if err != nil {
+		return err
+	}
+	if cfg.PrivateKey != nil {
+		dev.PrivateKey = *cfg.PrivateKey
+		dev.PublicKey = cfg.PrivateKey.PublicKey()
+	}
+	if cfg.ListenPort != nil {
+		dev.ListenPort = *cfg.ListenPort
+		if dev.ListenPort == 0 {
+			dev.ListenPort = 51820
+		}
+	}
+	if cfg.FirewallMark != nil {
+		dev.FirewallMark = *cfg.FirewallMark
+	}
+	if cfg.ReplacePeers {
+		dev.Peers = nil
+	}
+	for _, pc := range cfg.Peers {
+		i := 0
+		for ; i < len(dev.Peers) && dev.Peers[i].PublicKey != pc.PublicKey; i++ {
+		}
+		if pc.Remove {
+			if i < len(dev.Peers) {
+				dev.Peers = append(dev.Peers[:i:i], dev.Peers[i+1:]...)
+			}
+			continue
+		}
+		if i == len(dev.Peers) {
+			if pc.UpdateOnly {
+				continue
+			}
+			dev.Peers = append(dev.Peers, wgtypes.Peer{PublicKey: pc.PublicKey})
+		}
+		p := &dev.Peers[i]
+		if pc.PresharedKey != nil {
+			p.PresharedKey = *pc.PresharedKey
+		}
+		if pc.Endpoint != nil {
+			endpoint := *pc.Endpoint
+			p.Endpoint = &endpoint
+		}
+		if pc.PersistentKeepaliveInterval != nil {
+			p.PersistentKeepaliveInterval = *pc.PersistentKeepaliveInterval
+		}
+		if pc.ReplaceAllowedIPs {
+			p.AllowedIPs = nil
+		}
+		for _, ip := range pc.AllowedIPs {
+			if !containsIPNet(p.AllowedIPs, ip) {
+				p.AllowedIPs = append(p.AllowedIPs, ip)
+			}
+		}
+	}
+	return nil
+}
+
+// Close does nothing
+func (w *Wireguard) Close() error {
+	return nil
+}
+
+func containsIPNet(nets []net.IPNet, n net.IPNet) bool {
+	for _, candidate := range nets {
+		if candidate.String() == n.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package wgquick
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Features are the kernel capabilities relevant for the wireguard tunnels, see DetectFeatures
+type Features struct {
+	// KernelRelease is the running kernel release, e.g. 5.10.0-8-amd64
+	KernelRelease string
+	// Wireguard is true if the wireguard generic netlink family is available, i.e. the module is loaded or built in
+	Wireguard bool
+	// GenlVersion is the wireguard generic netlink API version
+	GenlVersion uint32
+	// ModuleVersion is the wireguard module version, empty if unknown
+	ModuleVersion string
+	// InTree is true if the kernel ships wireguard (5.6+), false for the backported out-of-tree module
+	InTree bool
+	// NetNS is true if the network namespaces are supported, so the link can be moved between namespaces
+	NetNS bool
+	// SuppressPrefixLength is true if the rules support suppress_prefixlength (3.12+), needed to route everything
+	// through the tunnel in a separate table while keeping the more specific main table routes
+	SuppressPrefixLength bool
+	// SrcValidMark is true if net.ipv4.conf.all.src_valid_mark is set, so the reverse path filter honors the firewall
+	// mark of the tunnel packets
+	SrcValidMark bool
+}
+
+// the files the features are detected from
+const (
+	wireguardModuleVersion = "/sys/module/wireguard/version"
+	netNSPath              = "/proc/self/ns/net"
+	srcValidMarkPath       = "/proc/sys/net/ipv4/conf/all/src_valid_mark"
+)
+
+// DetectFeatures detects the kernel features, so the callers can disable the unsupported ones instead of failing in Up.
+// It needs no privileges.
+func DetectFeatures() (*Features, error) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return nil, err
+	}
+	release := uts.Release[:]
+	if i := bytes.IndexByte(release, 0); i >= 0 {
+		release = release[:i]
+	}
+	f := &Features{KernelRelease: string(release)}
+	major, minor, err := kernelVersion(f.KernelRelease)
+	if err != nil {
+		return nil, err
+	}
+	f.InTree = major > 5 || major == 5 && minor >= 6
+	f.SuppressPrefixLength = major > 3 || major == 3 && minor >= 12
+
+	if family, err := netlink.GenlFamilyGet("wireguard"); err == nil {
+		f.Wireguard = true
+		f.GenlVersion = family.Version
+	}
+	if version, err := ioutil.ReadFile(wireguardModuleVersion); err == nil {
+		f.ModuleVersion = strings.TrimSpace(string(version))
+	}
+	if _, err := os.Stat(netNSPath); err == nil {
+		f.NetNS = true
+	}
+	if mark, err := ioutil.ReadFile(srcValidMarkPath); err == nil {
+		f.SrcValidMark = strings.TrimSpace(string(mark)) == "1"
+	}
+	return f, nil
+}
+
+// kernelVersion parses the major and minor version of the kernel release
+func kernelVersion(release string) (major, minor int, err error) {
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid kernel release %q", release)
+	}
+	major, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid kernel release %q", release)
+	}
+	// the minor version may be followed by the suffix, e.g. 3.12-rc1
+	end := strings.IndexFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(parts[1])
+	}
+	minor, err = strconv.Atoi(parts[1][:end])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid kernel release %q", release)
+	}
+	return major, minor, nil
+}
@@ -0,0 +1,35 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernelVersion(t *testing.T) {
+	for release, want := range map[string][2]int{
+		"5.10.0-8-amd64":     {5, 10},
+		"6.1":                {6, 1},
+		"4.19.0+":            {4, 19},
+		"3.12-rc1":           {3, 12},
+		"5.4.0-1045-aws.x86": {5, 4},
+	} {
+		major, minor, err := kernelVersion(release)
+		require.NoError(t, err, release)
+		assert.Equal(t, want, [2]int{major, minor}, release)
+	}
+	for _, release := range []string{"", "5", "x.1", "5.y"} {
+		_, _, err := kernelVersion(release)
+		assert.Error(t, err, release)
+	}
+}
+
+func TestDetectFeatures(t *testing.T) {
+	f, err := DetectFeatures()
+	require.NoError(t, err)
+	assert.NotEmpty(t, f.KernelRelease)
+	if f.Wireguard {
+		assert.NotZero(t, f.GenlVersion)
+	}
+}
@@ -0,0 +1,181 @@
+package wgquick
+
+import (
+	"fmt"
+	"strings"
+)
+
+// formatKeyOrder is the canonical key order of the sections, the order MarshalText writes them in. The unknown keys
+// follow in their original order.
+var formatKeyOrder = map[string][]string{
+	"[Interface]": {"Address", "DNS", "PrivateKey", "ListenPort", "FwMark", "MTU", "Jc", "Jmin", "Jmax", "S1", "S2",
+		"H1", "H2", "H3", "H4", "Table", "PreUp", "PostUp", "PreDown", "PostDown", "SaveConfig", "Include"},
+	"[Peer]": {"PublicKey", "AllowedIPs", "PresharedKey", "PersistentKeepalive", "Endpoint"},
+}
+
+// formatKey is the key of the formatted section with its values and the comments directly above its lines
+type formatKey struct {
+	key      string
+	comments []string
+	values   []string
+}
+
+// formatSection is the section of the formatted config
+type formatSection struct {
+	// leading are the comments directly above the header
+	leading []string
+	header  string
+	// free are the comments not directly above a key, e.g. the peer name
+	free []string
+	keys []*formatKey
+}
+
+func (sec *formatSection) key(name string) *formatKey {
+	for _, k := range sec.keys {
+		if k.key == name {
+			return k
+		}
+	}
+	k := &formatKey{key: name}
+	sec.keys = append(sec.keys, k)
+	return k
+}
+
+// lines returns the formatted section lines
+func (sec *formatSection) lines() []string {
+	out := append(append([]string(nil), sec.leading...), sec.header)
+	out = append(out, sec.free...)
+	written := make(map[string]bool)
+	write := func(k *formatKey) {
+		written[k.key] = true
+		out = append(out, k.comments...)
+		switch {
+		case listKeys[k.key]:
+			out = append(out, formatLine(k.key, strings.Join(k.values, ", ")))
+		case repeatableKeys[k.key]:
+			for _, v := range k.values {
+				out = append(out, formatLine(k.key, v))
+			}
+		default:
+			// the last one wins, like in Parse
+			out = append(out, formatLine(k.key, k.values[len(k.values)-1]))
+		}
+	}
+	for _, name := range formatKeyOrder[sec.header] {
+		for _, k := range sec.keys {
+			if k.key == name {
+				write(k)
+			}
+		}
+	}
+	for _, k := range sec.keys {
+		if !written[k.key] {
+			write(k)
+		}
+	}
+	return out
+}
+
+func formatLine(key, value string) string {
+	if value == "" {
+		return key + " ="
+	}
+	return key + " = " + value
+}
+
+// formatValue returns the canonical value of the key: the list items separated by `, ` and the keys in the canonical
+// base64. The values with ${VAR} references are left as is, see WithEnvExpansion.
+func formatValue(key, value string) ([]string, error) {
+	if listKeys[key] {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+	if isKeyDirective(key) && !strings.Contains(value, "${") {
+		k, err := ParseKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode key %w", err)
+		}
+		value = serializeKey(&k)
+		zeroKey(&k)
+	}
+	return []string{value}, nil
+}
+
+// Format normalizes the config text without changing its meaning: the keys are in the canonical order (see
+// MarshalText) with single spaces around =, the repeated Address, DNS and AllowedIPs are merged into one line, of the
+// other repeated keys only the last one (the one Parse uses) is kept, and the keys, hex and base64url ones too, are in
+// the standard base64. The
+// comments directly above a key move with it, the other ones stay at the top of their section. The sections are
+// separated by one blank line. Nothing is resolved or expanded, the values are only checked as far as they're
+// rewritten, so Format works with the configs using ${VAR} references and endpoint host names.
+func Format(text []byte) ([]byte, error) {
+	if len(text) > MaxConfigSize {
+		return nil, fmt.Errorf("config is %d bytes, exceeding the %d bytes limit", len(text), MaxConfigSize)
+	}
+	var (
+		preamble []string
+		sections []*formatSection
+		comments []string
+		cur      *formatSection
+	)
+	// flushComments moves the pending comments, which aren't directly above a key or a header, out of the way
+	flushComments := func() {
+		if cur == nil {
+			if len(preamble) > 0 && len(comments) > 0 {
+				preamble = append(preamble, "")
+			}
+			preamble = append(preamble, comments...)
+		} else {
+			cur.free = append(cur.free, comments...)
+		}
+		comments = nil
+	}
+	for no, line := range strings.Split(string(text), "\n") {
+		ln := strings.TrimSpace(line)
+		switch {
+		case ln == "":
+			flushComments()
+		case ln[0] == '#':
+			comments = append(comments, ln)
+		case ln == "[Interface]", ln == "[Peer]":
+			cur = &formatSection{leading: comments, header: ln}
+			comments = nil
+			sections = append(sections, cur)
+		default:
+			parts := strings.SplitN(ln, "=", 2)
+			if len(parts) < 2 {
+				return nil, fmt.Errorf("[line %d]: cannot parse line, missing =", no+1)
+			}
+			if cur == nil {
+				return nil, fmt.Errorf("[line %d]: cannot parse, key outside of [Interface] or [Peer] section", no+1)
+			}
+			lhs, rhs := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			values, err := formatValue(lhs, rhs)
+			if err != nil {
+				return nil, fmt.Errorf("[line %d]: %s: %w", no+1, lhs, err)
+			}
+			k := cur.key(lhs)
+			k.comments = append(k.comments, comments...)
+			k.values = append(k.values, values...)
+			comments = nil
+		}
+	}
+	flushComments()
+
+	out := preamble
+	for _, sec := range sections {
+		if len(out) > 0 {
+			out = append(out, "")
+		}
+		out = append(out, sec.lines()...)
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return []byte(strings.Join(out, "\n") + "\n"), nil
+}
@@ -0,0 +1,74 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	text, err := Format([]byte(`# office tunnel
+
+  [Interface]
+PrivateKey=oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+# the tunnel addresses
+Address = 10.200.100.8/24
+MTU = 1500
+
+Address = fd00::8/64 ,10.200.101.8/24
+PostUp = ${HOOK}
+MTU   =   1420
+# rarely needed
+[Peer]
+# Name = gateway
+
+Endpoint = vpn.example.com:51820
+AllowedIPs = 0.0.0.0/0
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKV=
+[Peer]
+PublicKey = ${PEER_KEY}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, `# office tunnel
+
+[Interface]
+# the tunnel addresses
+Address = 10.200.100.8/24, fd00::8/64, 10.200.101.8/24
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+MTU = 1420
+PostUp = ${HOOK}
+
+# rarely needed
+[Peer]
+# Name = gateway
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+AllowedIPs = 0.0.0.0/0
+Endpoint = vpn.example.com:51820
+
+[Peer]
+PublicKey = ${PEER_KEY}
+`, string(text))
+
+	again, err := Format(text)
+	require.NoError(t, err)
+	assert.Equal(t, string(text), string(again))
+
+	for name, cfg := range testConfigs {
+		if name == "sample-2" {
+			continue // repeated Address
+		}
+		text, err := Format([]byte(cfg))
+		require.NoError(t, err)
+		assert.Equal(t, cfg, string(text), name)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	_, err := Format([]byte("[Interface]\nPrivateKey = short\n"))
+	assert.Contains(t, err.Error(), "[line 2]: PrivateKey")
+	_, err = Format([]byte("MTU = 1420\n"))
+	assert.Contains(t, err.Error(), "[line 1]")
+	_, err = Format([]byte("[Interface]\nMTU\n"))
+	assert.Contains(t, err.Error(), "[line 2]: cannot parse line")
+}
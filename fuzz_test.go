@@ -0,0 +1,47 @@
+//go:build go1.18
+// +build go1.18
+
+package wgquick
+
+import (
+	"testing"
+)
+
+func FuzzUnmarshalText(f *testing.F) {
+	for _, text := range testConfigs {
+		f.Add([]byte(text))
+	}
+	f.Fuzz(func(t *testing.T, text []byte) {
+		c := &Config{}
+		if err := c.UnmarshalText(text); err != nil {
+			return
+		}
+		out, err := c.MarshalText()
+		if err != nil {
+			t.Fatalf("cannot marshal parsed config: %v", err)
+		}
+		if err := (&Config{}).UnmarshalText(out); err != nil {
+			t.Fatalf("cannot parse marshaled config: %v\n%s", err, out)
+		}
+	})
+}
+
+func FuzzParseKey(f *testing.F) {
+	f.Add("yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=")
+	f.Add("c2hvcnQ=")
+	f.Fuzz(func(t *testing.T, s string) {
+		key, err := ParseKey(s)
+		if err != nil {
+			return
+		}
+		// the hex and base64url forms parse too, so compare the bytes, not the text
+		serialized := serializeKey(&key)
+		again, err := ParseKey(serialized)
+		if err != nil {
+			t.Fatalf("cannot parse key %q serialized from %q: %v", serialized, s, err)
+		}
+		if again != key {
+			t.Fatalf("key %q serialized as %q parses to the other key", s, serialized)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package wgquick
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HandshakeTimeout is the age of the last handshake after which the peer session expired, REJECT_AFTER_TIME of wireguard
+const HandshakeTimeout = 180 * time.Second
+
+// syncRecord is the outcome of the last sync of the interface
+type syncRecord struct {
+	at  time.Time
+	err error
+}
+
+// syncRecords records the last syncs of the client interfaces, for the health handler
+type syncRecords struct {
+	mu      sync.Mutex
+	records map[string]syncRecord
+}
+
+func (r *syncRecords) record(iface string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.records == nil {
+		r.records = make(map[string]syncRecord)
+	}
+	r.records[iface] = syncRecord{at: time.Now(), err: err}
+}
+
+func (r *syncRecords) last(iface string) (syncRecord, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.records[iface]
+	return rec, ok
+}
+
+// Health is the tunnel health reported by HealthHandler
+type Health struct {
+	Iface string `json:"iface"`
+	// Healthy is true if the interface is up and the last sync by this client (if any) succeeded
+	Healthy bool `json:"healthy"`
+	Up      bool `json:"up"`
+	Peers   int  `json:"peers"`
+	// ActivePeers are the peers with the handshake within HandshakeTimeout
+	ActivePeers   int        `json:"activePeers"`
+	LastSync      *time.Time `json:"lastSync,omitempty"`
+	LastSyncError string     `json:"lastSyncError,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// Health checks the interface health, see Health
+func (c *Client) Health(iface string) *Health {
+	h := &Health{Iface: iface}
+	if rec, ok := c.syncs.last(iface); ok {
+		h.LastSync = &rec.at
+		if rec.err != nil {
+			h.LastSyncError = rec.err.Error()
+		}
+	}
+	s, err := c.Status(nil, iface)
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	h.Up = s.Wireguard && s.Up
+	if h.Up {
+		if err := c.countPeers(h, iface); err != nil {
+			h.Error = err.Error()
+		}
+	}
+	h.Healthy = h.Up && h.Error == "" && h.LastSyncError == ""
+	return h
+}
+
+// countPeers counts the device peers and the active ones
+func (c *Client) countPeers(h *Health, iface string) error {
+	cl, err := c.wgctrl()
+	if err != nil {
+		return err
+	}
+	dev, err := cl.Device(iface)
+	if err != nil {
+		return err
+	}
+	h.Peers = len(dev.Peers)
+	for _, p := range dev.Peers {
+		if !p.LastHandshakeTime.IsZero() && time.Since(p.LastHandshakeTime) < HandshakeTimeout {
+			h.ActivePeers++
+		}
+	}
+	return nil
+}
+
+// HealthHandler returns the handler reporting the interface Health in JSON, with the status 503 if it isn't healthy,
+// e.g. to mount on the daemon health endpoint.
+func (c *Client) HealthHandler(iface string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := c.Health(iface)
+		w.Header().Set("Content-Type", "application/json")
+		if !h.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(h)
+	})
+}
@@ -0,0 +1,44 @@
+package wgquick_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthHandler(t *testing.T) {
+	c, _, _ := newFakeClient(t)
+	defer c.Close()
+	handler := c.HealthHandler("wg0")
+	check := func(wantCode int) wgquick.Health {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+		assert.Equal(t, wantCode, rec.Code)
+		var h wgquick.Health
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &h))
+		return h
+	}
+
+	h := check(http.StatusServiceUnavailable)
+	assert.False(t, h.Up)
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	h = check(http.StatusOK)
+	assert.True(t, h.Healthy)
+	assert.Equal(t, 2, h.Peers)
+	assert.Zero(t, h.ActivePeers)
+	assert.NotNil(t, h.LastSync)
+
+	cfg.ProxyDevice = "missing0"
+	assert.Error(t, c.Sync(cfg, "wg0", testLog))
+	h = check(http.StatusServiceUnavailable)
+	assert.True(t, h.Up)
+	assert.NotEmpty(t, h.LastSyncError)
+}
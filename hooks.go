@@ -0,0 +1,96 @@
+package wgquick
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// hookCapabilities are the capabilities the hooks can keep, see Config.HookCapabilities
+var hookCapabilities = map[string]uintptr{
+	"CAP_CHOWN":            unix.CAP_CHOWN,
+	"CAP_DAC_OVERRIDE":     unix.CAP_DAC_OVERRIDE,
+	"CAP_KILL":             unix.CAP_KILL,
+	"CAP_NET_ADMIN":        unix.CAP_NET_ADMIN,
+	"CAP_NET_BIND_SERVICE": unix.CAP_NET_BIND_SERVICE,
+	"CAP_NET_RAW":          unix.CAP_NET_RAW,
+	"CAP_SETGID":           unix.CAP_SETGID,
+	"CAP_SETUID":           unix.CAP_SETUID,
+	"CAP_SYS_ADMIN":        unix.CAP_SYS_ADMIN,
+}
+
+// parseCapability parses the capability name, e.g. CAP_NET_ADMIN or net_admin
+func parseCapability(name string) (uintptr, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+	c, ok := hookCapabilities[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported capability %s", name)
+	}
+	return c, nil
+}
+
+// lookupUser resolves the user name or uid
+func lookupUser(s string) (*user.User, error) {
+	if _, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return user.LookupId(s)
+	}
+	return user.Lookup(s)
+}
+
+// lookupGroup resolves the group name or gid to gid
+func lookupGroup(s string) (uint32, error) {
+	if gid, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(gid), nil
+	}
+	g, err := user.LookupGroup(s)
+	if err != nil {
+		return 0, err
+	}
+	gid, err := strconv.ParseUint(g.Gid, 10, 32)
+	return uint32(gid), err
+}
+
+// hookProcAttr returns the process attributes running the hooks as Config.HookUser, nil without it
+func (cfg *Config) hookProcAttr() (*syscall.SysProcAttr, error) {
+	if cfg.HookUser == "" {
+		return nil, nil
+	}
+	name, group := cfg.HookUser, ""
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name, group = name[:i], name[i+1:]
+	}
+	u, err := lookupUser(name)
+	if err != nil {
+		return nil, fmt.Errorf("hook user: %w", err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("hook user: %w", err)
+	}
+	if group == "" {
+		group = u.Gid
+	}
+	gid, err := lookupGroup(group)
+	if err != nil {
+		return nil, fmt.Errorf("hook group: %w", err)
+	}
+	attr := &syscall.SysProcAttr{
+		// no supplementary groups, e.g. root's
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: gid, Groups: []uint32{}},
+	}
+	for _, name := range cfg.HookCapabilities {
+		c, err := parseCapability(name)
+		if err != nil {
+			return nil, err
+		}
+		attr.AmbientCaps = append(attr.AmbientCaps, c)
+	}
+	return attr, nil
+}
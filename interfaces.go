@@ -0,0 +1,146 @@
+package wgquick
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// maxIfaceNameLen is the longest interface name, IFNAMSIZ without the terminating zero
+const maxIfaceNameLen = 15
+
+// InterfaceInfo describes the existing wireguard link
+type InterfaceInfo struct {
+	Name  string
+	Index int
+	MTU   int
+	Alias string
+	// Up is true if the link is administratively up
+	Up bool
+	// Managed is true if the link has the state file, i.e. it was set up by this library
+	Managed bool
+}
+
+// ListInterfaces lists the links of type wireguard, only the ones set up by this library with managedOnly.
+// Only links with the state file count as managed, see WithStateDir.
+func (c *Client) ListInterfaces(managedOnly bool) ([]InterfaceInfo, error) {
+	links, err := c.nl.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	var infos []InterfaceInfo
+	for _, link := range links {
+		if link.Type() != "wireguard" {
+			continue
+		}
+		attrs := link.Attrs()
+		info := InterfaceInfo{
+			Name:  attrs.Name,
+			Index: attrs.Index,
+			MTU:   attrs.MTU,
+			Alias: attrs.Alias,
+			Up:    attrs.Flags&net.FlagUp != 0,
+		}
+		if path := c.statePath(attrs.Name); path != "" {
+			if _, err := os.Stat(path); err == nil {
+				info.Managed = true
+			}
+		}
+		if managedOnly && !info.Managed {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// InterfaceStatus is the readiness of the interface, see Client.Status
+type InterfaceStatus struct {
+	// Exists is true if there's a link with the interface name, of any type
+	Exists bool
+	// Wireguard is true if the link is of type wireguard
+	Wireguard bool
+	// Up is true if the link is administratively up
+	Up bool
+	// KeyMatches is true if the device has the config private key
+	KeyMatches bool
+}
+
+// Ready reports whether the interface is the administratively up wireguard link with the config key
+func (s InterfaceStatus) Ready() bool {
+	return s.Wireguard && s.Up && s.KeyMatches
+}
+
+// Status checks the interface without changing anything, e.g. for the readiness probes. The key is only checked with
+// the config having the private key, cfg may be nil.
+func (c *Client) Status(cfg *Config, iface string) (InterfaceStatus, error) {
+	var s InterfaceStatus
+	link, err := c.nl.LinkByName(iface)
+	if err != nil {
+		if isLinkNotFound(err) {
+			return s, nil
+		}
+		return s, err
+	}
+	s.Exists = true
+	s.Wireguard = link.Type() == "wireguard"
+	s.Up = link.Attrs().Flags&net.FlagUp != 0
+	if !s.Wireguard || cfg == nil || cfg.PrivateKey == nil {
+		return s, nil
+	}
+	cl, err := c.wgctrl()
+	if err != nil {
+		return s, err
+	}
+	dev, err := cl.Device(iface)
+	if err != nil {
+		return s, err
+	}
+	s.KeyMatches = subtle.ConstantTimeCompare(dev.PrivateKey[:], cfg.PrivateKey[:]) == 1
+	return s, nil
+}
+
+// Exists reports whether the wireguard link exists
+func (c *Client) Exists(iface string) (bool, error) {
+	s, err := c.Status(nil, iface)
+	return s.Wireguard, err
+}
+
+// IsUp reports whether the wireguard link exists and is administratively up
+func (c *Client) IsUp(iface string) (bool, error) {
+	s, err := c.Status(nil, iface)
+	return s.Wireguard && s.Up, err
+}
+
+// AllocateInterface creates the wireguard link with the first free name prefix0, prefix1, ... (wg0, wg1, ... without prefix)
+// and returns its name, so the concurrent callers never get the same name. The link is down and unconfigured until
+// Sync with the returned name; Up refuses the existing link with os.ErrExist, like it does for any other.
+func (c *Client) AllocateInterface(prefix string, log logrus.FieldLogger) (string, error) {
+	if prefix == "" {
+		prefix = "wg"
+	}
+	for i := 0; ; i++ {
+		name := prefix + strconv.Itoa(i)
+		if len(name) > maxIfaceNameLen {
+			return "", fmt.Errorf("no free interface name with prefix %q", prefix)
+		}
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = name
+		err := c.nl.LinkAdd(&netlink.GenericLink{LinkAttrs: attrs, LinkType: "wireguard"})
+		if err == syscall.EEXIST {
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithField("iface", name).Error("cannot create link")
+			return "", err
+		}
+		log.WithField("iface", name).Info("allocated interface")
+		return name, nil
+	}
+}
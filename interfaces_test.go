@@ -0,0 +1,107 @@
+package wgquick_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestListInterfaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c, nl, _ := newFakeClient(t, wgquick.WithStateDir(dir))
+	defer c.Close()
+
+	require.NoError(t, nl.LinkAdd(&netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Name: "wg1"}, LinkType: "wireguard"}))
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+
+	infos, err := c.ListInterfaces(false)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, "wg1", infos[0].Name)
+	assert.False(t, infos[0].Managed)
+	assert.False(t, infos[0].Up)
+	assert.Equal(t, "wg0", infos[1].Name)
+	assert.True(t, infos[1].Managed)
+	assert.True(t, infos[1].Up)
+
+	infos, err = c.ListInterfaces(true)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "wg0", infos[0].Name)
+}
+
+func TestStatus(t *testing.T) {
+	c, _, _ := newFakeClient(t)
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	s, err := c.Status(cfg, "wg0")
+	require.NoError(t, err)
+	assert.Equal(t, wgquick.InterfaceStatus{}, s)
+	ok, err := c.Exists("lo")
+	require.NoError(t, err)
+	assert.False(t, ok, "not a wireguard link")
+
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	s, err = c.Status(cfg, "wg0")
+	require.NoError(t, err)
+	assert.True(t, s.Ready())
+	ok, err = c.IsUp("wg0")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	other := &wgquick.Config{}
+	require.NoError(t, other.UnmarshalText([]byte(testConfig)))
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	other.PrivateKey = &key
+	s, err = c.Status(other, "wg0")
+	require.NoError(t, err)
+	assert.True(t, s.Up)
+	assert.False(t, s.KeyMatches)
+}
+
+func TestAllocateInterface(t *testing.T) {
+	c, nl, _ := newFakeClient(t)
+	defer c.Close()
+
+	require.NoError(t, nl.LinkAdd(&netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Name: "wg0"}, LinkType: "wireguard"}))
+	names := make(chan string, 10)
+	for i := 0; i < cap(names); i++ {
+		go func() {
+			name, err := c.AllocateInterface("", testLog)
+			assert.NoError(t, err)
+			names <- name
+		}()
+	}
+	seen := map[string]bool{}
+	for i := 0; i < cap(names); i++ {
+		seen[<-names] = true
+	}
+	assert.Len(t, seen, cap(names))
+	assert.False(t, seen["wg0"])
+
+	name, err := c.AllocateInterface("tun", testLog)
+	require.NoError(t, err)
+	assert.Equal(t, "tun0", name)
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	assert.Equal(t, os.ErrExist, c.Up(cfg, name, testLog))
+	require.NoError(t, c.Sync(cfg, name, testLog))
+	up, err := c.IsUp(name)
+	require.NoError(t, err)
+	assert.True(t, up)
+	_, err = c.AllocateInterface("abcdefghijklmno", testLog)
+	assert.Error(t, err)
+}
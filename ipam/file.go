@@ -0,0 +1,71 @@
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// FileStore keeps the allocations in the JSON file, so the processes sharing the file never allocate the same address.
+// The updates take the flock on the path.lock file and replace the file atomically.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore returns the store of the file, it's created by the first update
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Update calls f with the allocations read from the file, writing them back if f succeeds
+func (s *FileStore) Update(f func(allocations map[string]string) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot open lock file: %w", err)
+	}
+	defer lock.Close() // releases the flock
+	for {
+		err = unix.Flock(int(lock.Fd()), unix.LOCK_EX)
+		if err != unix.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot lock %s: %w", s.path, err)
+	}
+
+	allocations := make(map[string]string)
+	b, err := ioutil.ReadFile(s.path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(b, &allocations); err != nil {
+			return fmt.Errorf("invalid allocations file %s: %w", s.path, err)
+		}
+	}
+	if err := f(allocations); err != nil {
+		return err
+	}
+	b, err = json.MarshalIndent(allocations, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,147 @@
+// Package ipam allocates the tunnel addresses from the address pools, e.g. when generating the peer configs of the
+// hub-and-spoke deployment, so no two peers get the same address:
+//
+//	_, pool, _ := net.ParseCIDR("10.100.0.0/24")
+//	p := ipam.NewPool(ipam.NewFileStore("/var/lib/wg-quick-go/wg0.ipam"), []net.IPNet{*pool}, net.ParseIP("10.100.0.1"))
+//	addr, err := p.Allocate(peerPublicKey.String())
+//
+// The allocations are keyed by the owner, e.g. the peer public key or name, so allocating again returns the same address.
+package ipam
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+)
+
+// Store persists the allocations, the owner to the address (IP without the mask) map
+type Store interface {
+	// Update calls f with the current allocations and persists them if f succeeds. The updates have to be atomic,
+	// i.e. the concurrent updates (from the other processes too, if the store is shared) are serialized.
+	Update(f func(allocations map[string]string) error) error
+}
+
+// ErrExhausted is returned when the pools have no free address
+var ErrExhausted = errors.New("address pools exhausted")
+
+// Pool allocates the host addresses (/32 or /128) from the prefixes
+type Pool struct {
+	store    Store
+	prefixes []net.IPNet
+	reserved map[string]bool
+}
+
+// NewPool creates the pool allocating from the prefixes in order. The reserved addresses, e.g. the hub address, are
+// never allocated, neither are the IPv4 network and broadcast addresses.
+func NewPool(store Store, prefixes []net.IPNet, reserved ...net.IP) *Pool {
+	p := &Pool{store: store, prefixes: prefixes, reserved: make(map[string]bool)}
+	for _, ip := range reserved {
+		p.reserved[ip.String()] = true
+	}
+	return p
+}
+
+// Allocate returns the owner address, allocating the first free one if it has none
+func (p *Pool) Allocate(owner string) (net.IPNet, error) {
+	var addr net.IPNet
+	err := p.store.Update(func(allocations map[string]string) error {
+		if s, ok := allocations[owner]; ok {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return fmt.Errorf("invalid allocated address %q of %s", s, owner)
+			}
+			addr = hostNet(ip)
+			return nil
+		}
+		used := make(map[string]bool, len(allocations))
+		for _, s := range allocations {
+			used[s] = true
+		}
+		for _, prefix := range p.prefixes {
+			if ip := p.free(prefix, used); ip != nil {
+				allocations[owner] = ip.String()
+				addr = hostNet(ip)
+				return nil
+			}
+		}
+		return ErrExhausted
+	})
+	return addr, err
+}
+
+// Release frees the owner address, it's no-op if the owner has none
+func (p *Pool) Release(owner string) error {
+	return p.store.Update(func(allocations map[string]string) error {
+		delete(allocations, owner)
+		return nil
+	})
+}
+
+// free returns the first address of the prefix neither used nor reserved, nil if there's none
+func (p *Pool) free(prefix net.IPNet, used map[string]bool) net.IP {
+	ones, bits := prefix.Mask.Size()
+	ip := prefix.IP.Mask(prefix.Mask)
+	if ip == nil || bits == 0 {
+		return nil
+	}
+	first := new(big.Int).SetBytes(ip)
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	last := new(big.Int).Add(first, size)
+	last.Sub(last, big.NewInt(1))
+	if bits == 32 && bits-ones >= 2 {
+		// the network and broadcast addresses
+		first.Add(first, big.NewInt(1))
+		last.Sub(last, big.NewInt(1))
+	}
+	// there's at most len(used)+len(reserved) taken addresses, so the scan is short even for the huge IPv6 prefixes
+	for n := first; n.Cmp(last) <= 0; n.Add(n, big.NewInt(1)) {
+		candidate := intToIP(n, len(ip))
+		s := candidate.String()
+		if !used[s] && !p.reserved[s] {
+			return candidate
+		}
+	}
+	return nil
+}
+
+func intToIP(n *big.Int, size int) net.IP {
+	b := n.Bytes()
+	ip := make(net.IP, size)
+	copy(ip[size-len(b):], b)
+	return ip
+}
+
+func hostNet(ip net.IP) net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// MemoryStore keeps the allocations in memory, e.g. for the tests or the single process generating all configs
+type MemoryStore struct {
+	mu          sync.Mutex
+	allocations map[string]string
+}
+
+// NewMemoryStore returns the empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{allocations: make(map[string]string)}
+}
+
+// Update calls f with the copy of the allocations, keeping it if f succeeds
+func (s *MemoryStore) Update(f func(allocations map[string]string) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := make(map[string]string, len(s.allocations))
+	for owner, addr := range s.allocations {
+		cp[owner] = addr
+	}
+	if err := f(cp); err != nil {
+		return err
+	}
+	s.allocations = cp
+	return nil
+}
@@ -0,0 +1,78 @@
+package ipam
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustCIDR(t *testing.T, s string) net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	return *n
+}
+
+func TestPool(t *testing.T) {
+	p := NewPool(NewMemoryStore(), []net.IPNet{mustCIDR(t, "10.0.0.0/30"), mustCIDR(t, "fd00::/126")}, net.ParseIP("10.0.0.1"))
+
+	a, err := p.Allocate("a")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2/32", a.String())
+	again, err := p.Allocate("a")
+	require.NoError(t, err)
+	assert.Equal(t, a.String(), again.String(), "the owner keeps its address")
+
+	var got []string
+	for _, owner := range []string{"b", "c", "d", "e"} {
+		addr, err := p.Allocate(owner)
+		require.NoError(t, err)
+		got = append(got, addr.String())
+	}
+	assert.Equal(t, []string{"fd00::/128", "fd00::1/128", "fd00::2/128", "fd00::3/128"}, got)
+	_, err = p.Allocate("f")
+	assert.Equal(t, ErrExhausted, err)
+
+	require.NoError(t, p.Release("a"))
+	f, err := p.Allocate("f")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2/32", f.String(), "the released address is reused")
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipam")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wg0.ipam")
+	prefixes := []net.IPNet{mustCIDR(t, "10.0.0.0/24")}
+
+	// every pool has its own store, like the separate processes sharing the file
+	var wg sync.WaitGroup
+	addrs := make(chan string, 20)
+	for i := 0; i < cap(addrs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			addr, err := NewPool(NewFileStore(path), prefixes).Allocate(fmt.Sprint("peer", i))
+			assert.NoError(t, err)
+			addrs <- addr.String()
+		}(i)
+	}
+	wg.Wait()
+	close(addrs)
+	seen := map[string]bool{}
+	for addr := range addrs {
+		assert.False(t, seen[addr], addr)
+		seen[addr] = true
+	}
+
+	addr, err := NewPool(NewFileStore(path), prefixes).Allocate("peer3")
+	require.NoError(t, err)
+	assert.True(t, seen[addr.String()], "allocations are persisted")
+}
@@ -0,0 +1,124 @@
+package wgquick
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// KillSwitch is the route type replacing the tunnel routes while the tunnel is down, so the traffic meant for the tunnel doesn't leak via other routes
+type KillSwitch int
+
+const (
+	// KillSwitchOff deletes the tunnel routes together with the link
+	KillSwitchOff KillSwitch = 0
+	// KillSwitchBlackhole silently drops the traffic
+	KillSwitchBlackhole KillSwitch = unix.RTN_BLACKHOLE
+	// KillSwitchUnreachable rejects the traffic with ICMP unreachable
+	KillSwitchUnreachable KillSwitch = unix.RTN_UNREACHABLE
+	// KillSwitchProhibit rejects the traffic with ICMP prohibited
+	KillSwitchProhibit KillSwitch = unix.RTN_PROHIBIT
+)
+
+func (k KillSwitch) String() string {
+	switch k {
+	case KillSwitchOff:
+		return "off"
+	case KillSwitchBlackhole:
+		return "blackhole"
+	case KillSwitchUnreachable:
+		return "unreachable"
+	case KillSwitchProhibit:
+		return "prohibit"
+	default:
+		return fmt.Sprintf("KillSwitch(%d)", int(k))
+	}
+}
+
+// ParseKillSwitch parses kill switch value: "off", "blackhole", "unreachable" or "prohibit"
+func ParseKillSwitch(s string) (KillSwitch, error) {
+	for _, k := range []KillSwitch{KillSwitchOff, KillSwitchBlackhole, KillSwitchUnreachable, KillSwitchProhibit} {
+		if s == k.String() {
+			return k, nil
+		}
+	}
+	return KillSwitchOff, fmt.Errorf("unknown kill switch %q", s)
+}
+
+// killSwitchRoutes returns the kill switch routes for the managed routes. They have the same table, protocol and metric
+// as the tunnel routes, so they're replaced in place in both directions.
+func (cfg *Config) killSwitchRoutes(typ KillSwitch) []netlink.Route {
+	var routes []netlink.Route
+	dsts := cfg.managedRoutes()
+	for _, rt := range cfg.Routes {
+		dsts = append(dsts, rt.Dst)
+	}
+	for _, dst := range dsts {
+		dst := dst // make copy
+		rt := netlink.Route{
+			Dst:      &dst,
+			Table:    int(cfg.Table),
+			Protocol: cfg.RouteProtocol,
+			Priority: cfg.RouteMetric,
+			Type:     int(typ),
+		}
+		fillRouteDefaults(&rt)
+		routes = append(routes, rt)
+	}
+	return routes
+}
+
+// EngageKillSwitch replaces the tunnel routes with cfg.KillSwitch routes. They aren't bound to the link, so they outlive it
+// until Up (or Sync) replaces them with the tunnel routes again, or ReleaseKillSwitch is called. With Table off it does nothing.
+func (c *Client) EngageKillSwitch(cfg *Config, logger logrus.FieldLogger) error {
+	if cfg.KillSwitch == KillSwitchOff || cfg.Table == TableOff {
+		return nil
+	}
+	cfg = cfg.clone()
+	cfg.FillDefaults()
+	for _, rt := range cfg.killSwitchRoutes(cfg.KillSwitch) {
+		rt := rt // make copy
+		log := logger.WithFields(map[string]interface{}{
+			"route": rt.Dst.String(),
+			"table": rt.Table,
+			"type":  cfg.KillSwitch,
+		})
+		if err := c.nl.RouteReplace(&rt); err != nil {
+			log.WithError(err).Errorln("cannot add kill switch route")
+			return err
+		}
+		log.Infoln("kill switch route added")
+	}
+	return nil
+}
+
+// ReleaseKillSwitch deletes the kill switch routes of any type for the config managed routes, letting the traffic use other routes.
+func (c *Client) ReleaseKillSwitch(cfg *Config, logger logrus.FieldLogger) error {
+	if cfg.Table == TableOff {
+		return nil
+	}
+	cfg = cfg.clone()
+	cfg.FillDefaults()
+	for _, typ := range []KillSwitch{KillSwitchBlackhole, KillSwitchUnreachable, KillSwitchProhibit} {
+		for _, rt := range cfg.killSwitchRoutes(typ) {
+			rt := rt // make copy
+			log := logger.WithFields(map[string]interface{}{
+				"route": rt.Dst.String(),
+				"table": rt.Table,
+				"type":  typ,
+			})
+			if err := c.nl.RouteDel(&rt); err != nil {
+				if err == syscall.ESRCH {
+					continue
+				}
+				log.WithError(err).Errorln("cannot delete kill switch route")
+				return err
+			}
+			log.Infoln("kill switch route deleted")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseKillSwitch(t *testing.T) {
+	for _, k := range []KillSwitch{KillSwitchOff, KillSwitchBlackhole, KillSwitchUnreachable, KillSwitchProhibit} {
+		parsed, err := ParseKillSwitch(k.String())
+		require.NoError(t, err)
+		assert.Equal(t, k, parsed)
+	}
+	_, err := ParseKillSwitch("drop")
+	assert.Error(t, err)
+}
+
+func TestKillSwitchRoutes(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	c.FillDefaults()
+	c.RouteMetric = 50
+	routes := c.killSwitchRoutes(KillSwitchBlackhole)
+	require.NotEmpty(t, routes)
+	require.Len(t, routes, len(c.managedRoutes()))
+	for i, rt := range routes {
+		assert.Equal(t, c.managedRoutes()[i].String(), rt.Dst.String())
+		assert.Equal(t, unix.RTN_BLACKHOLE, rt.Type)
+		assert.Equal(t, unix.RT_CLASS_MAIN, rt.Table)
+		assert.Equal(t, DefaultRouteProtocol, rt.Protocol)
+		assert.Equal(t, 50, rt.Priority)
+		assert.Zero(t, rt.LinkIndex)
+	}
+}
@@ -0,0 +1,162 @@
+package wgquick
+
+import (
+	"net"
+	"sort"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// dedicatedTable reports whether the config routes into a dedicated table, not the main one or none
+func (cfg *Config) dedicatedTable() bool {
+	return cfg.Table != TableAuto && cfg.Table != TableOff && cfg.Table != unix.RT_CLASS_MAIN
+}
+
+// fullTunnel reports whether the config routes the default route of any family over the interface
+func (cfg *Config) fullTunnel() bool {
+	for _, dst := range cfg.managedRoutes() {
+		if isDefaultDst(&dst) {
+			return true
+		}
+	}
+	return false
+}
+
+// lanPrefixes returns the prefixes of the addresses on the up links other than the given one and loopback.
+// The link local and host (/32, /128) addresses are skipped, they have no LAN behind them.
+func (c *Client) lanPrefixes(link netlink.Link) ([]net.IPNet, error) {
+	links, err := c.nl.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var prefixes []net.IPNet
+	for _, l := range links {
+		attrs := l.Attrs()
+		if attrs.Index == link.Attrs().Index || attrs.Flags&net.FlagLoopback != 0 || attrs.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := c.nl.AddrList(l, netlink.FAMILY_ALL)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if addr.IPNet == nil || addr.IP.IsLinkLocalUnicast() || addr.IP.IsLoopback() {
+				continue
+			}
+			if ones, bits := addr.Mask.Size(); ones == bits {
+				continue
+			}
+			prefix := net.IPNet{IP: addr.IP.Mask(addr.Mask), Mask: addr.Mask}
+			if seen[prefix.String()] {
+				continue
+			}
+			seen[prefix.String()] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return prefixes[i].String() < prefixes[j].String() })
+	return prefixes, nil
+}
+
+// lanBypassRoute returns the `throw` route for the prefix in the config table
+func (cfg *Config) lanBypassRoute(prefix net.IPNet) netlink.Route {
+	return netlink.Route{
+		Dst:      &prefix,
+		Table:    int(cfg.Table),
+		Protocol: cfg.RouteProtocol,
+		Type:     unix.RTN_THROW,
+	}
+}
+
+// listLANBypass lists the present LAN bypass routes: the throw routes in the config table with the config protocol
+func (c *Client) listLANBypass(cfg *Config) ([]netlink.Route, error) {
+	return c.listRoutes(&netlink.Route{
+		Table:    int(cfg.Table),
+		Protocol: cfg.RouteProtocol,
+		Type:     unix.RTN_THROW,
+	}, netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL|netlink.RT_FILTER_TYPE)
+}
+
+// SyncLANBypass adds the throw routes for the LAN prefixes of the other links with cfg.LANBypass and a full tunnel,
+// and deletes the ones no longer wanted. It does nothing unless the config routes into a dedicated table.
+func (c *Client) SyncLANBypass(cfg *Config, link netlink.Link, log logrus.FieldLogger) error {
+	if !cfg.dedicatedTable() {
+		return nil
+	}
+	present, err := c.listLANBypass(cfg)
+	if err != nil {
+		log.WithError(err).Error("cannot read LAN bypass routes")
+		return err
+	}
+	var prefixes []net.IPNet
+	if cfg.LANBypass && cfg.fullTunnel() {
+		if prefixes, err = c.lanPrefixes(link); err != nil {
+			log.WithError(err).Error("cannot read LAN prefixes")
+			return err
+		}
+	}
+
+	presentDsts := make(map[string]bool, len(present))
+	for _, rt := range present {
+		presentDsts[rt.Dst.String()] = true
+	}
+	wanted := make(map[string]bool, len(prefixes))
+	errs := c.newItemErrors()
+	for _, prefix := range prefixes {
+		wanted[prefix.String()] = true
+		if presentDsts[prefix.String()] {
+			continue
+		}
+		rt := cfg.lanBypassRoute(prefix)
+		log := log.WithField("prefix", prefix.String())
+		if err := c.nl.RouteReplace(&rt); err != nil {
+			log.WithError(err).Error("cannot add LAN bypass route")
+			if err := errs.add("add LAN bypass route", prefix.String(), err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("LAN bypass route added")
+	}
+	for _, rt := range present {
+		rt := rt // make copy
+		if wanted[rt.Dst.String()] {
+			continue
+		}
+		log := log.WithField("prefix", rt.Dst.String())
+		if err := c.nl.RouteDel(&rt); err != nil {
+			log.WithError(err).Error("cannot delete LAN bypass route")
+			if err := errs.add("delete LAN bypass route", rt.Dst.String(), err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("LAN bypass route deleted")
+	}
+	return errs.err()
+}
+
+// deleteLANBypass deletes the LAN bypass routes, they aren't bound to the link so they outlive it. Already deleted ones are ignored.
+func (c *Client) deleteLANBypass(cfg *Config, log logrus.FieldLogger) error {
+	cfg = cfg.clone()
+	cfg.FillDefaults()
+	if !cfg.dedicatedTable() {
+		return nil
+	}
+	present, err := c.listLANBypass(cfg)
+	if err != nil {
+		return err
+	}
+	for _, rt := range present {
+		rt := rt // make copy
+		if err := c.nl.RouteDel(&rt); err != nil && err != syscall.ESRCH {
+			log.WithError(err).WithField("prefix", rt.Dst.String()).Error("cannot delete LAN bypass route")
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package wgquick_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestLANBypass(t *testing.T) {
+	c, nl, _ := newFakeClient(t)
+	defer c.Close()
+
+	require.NoError(t, nl.LinkAdd(&netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}, LinkType: "device"}))
+	eth0, err := nl.LinkByName("eth0")
+	require.NoError(t, err)
+	require.NoError(t, nl.LinkSetUp(eth0))
+	for _, s := range []string{"192.168.1.10/24", "fe80::1/64"} {
+		addr, err := netlink.ParseAddr(s)
+		require.NoError(t, err)
+		require.NoError(t, nl.AddrAdd(eth0, addr))
+	}
+	throwRoutes := func() []string {
+		var dsts []string
+		for _, rt := range nl.Routes() {
+			if rt.Type == unix.RTN_THROW {
+				assert.Equal(t, 1234, rt.Table)
+				dsts = append(dsts, rt.Dst.String())
+			}
+		}
+		return dsts
+	}
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.Table = 1234
+	cfg.LANBypass = true
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	assert.Empty(t, throwRoutes(), "no full tunnel, no bypass")
+
+	_, dst, err := net.ParseCIDR("0.0.0.0/0")
+	require.NoError(t, err)
+	cfg.Peers[1].AllowedIPs = []net.IPNet{*dst}
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+	assert.Equal(t, []string{"192.168.1.0/24"}, throwRoutes())
+
+	addr, err := netlink.ParseAddr("10.1.0.5/16")
+	require.NoError(t, err)
+	require.NoError(t, nl.AddrAdd(eth0, addr))
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+	assert.ElementsMatch(t, []string{"10.1.0.0/16", "192.168.1.0/24"}, throwRoutes())
+
+	require.NoError(t, c.Down(cfg, "wg0", testLog))
+	assert.Empty(t, throwRoutes())
+}
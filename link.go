@@ -0,0 +1,47 @@
+package wgquick
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// syncLinkAttrs reconciles the tunable link attributes: transmit queue length, link group and queue counts
+func (c *Client) syncLinkAttrs(cfg *Config, link netlink.Link, log logrus.FieldLogger) error {
+	attrs := link.Attrs()
+	if cfg.TxQueueLen != 0 && attrs.TxQLen != cfg.TxQueueLen {
+		if err := c.nl.LinkSetTxQLen(link, cfg.TxQueueLen); err != nil {
+			log.WithError(err).Error("cannot set link txqueuelen")
+			return err
+		}
+		log.WithField("txqueuelen", cfg.TxQueueLen).Info("set link txqueuelen")
+	}
+	if cfg.LinkGroup != 0 {
+		if err := c.nl.LinkSetGroup(link, cfg.LinkGroup); err != nil {
+			log.WithError(err).Error("cannot set link group")
+			return err
+		}
+		log.WithField("group", cfg.LinkGroup).Debug("set link group")
+	}
+	if (cfg.NumTxQueues != 0 && attrs.NumTxQueues != cfg.NumTxQueues) || (cfg.NumRxQueues != 0 && attrs.NumRxQueues != cfg.NumRxQueues) {
+		log.WithFields(map[string]interface{}{
+			"numtxqueues": attrs.NumTxQueues,
+			"numrxqueues": attrs.NumRxQueues,
+		}).Warn("link queue count differs from config, it can only be changed by recreating the link")
+	}
+	return nil
+}
+
+// linkSetGroup sets the link group over the sockets, see netlinkHandle.withSocket. Equivalent to:
+// `ip link set $link group $group`
+func linkSetGroup(sockets map[int]*nl.SocketHandle, link netlink.Link, group uint32) error {
+	req := nl.NewNetlinkRequest(unix.RTM_SETLINK, unix.NLM_F_ACK)
+	req.Sockets = sockets
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(link.Attrs().Index)
+	req.AddData(msg)
+	req.AddData(nl.NewRtAttr(unix.IFLA_GROUP, nl.Uint32Attr(group)))
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
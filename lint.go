@@ -0,0 +1,103 @@
+package wgquick
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Lint flags risky, but valid config patterns. Unlike Validate it never fails, it returns warnings only.
+func (cfg *Config) Lint() []Diagnostic {
+	var diags []Diagnostic
+	add := func(code, field, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     code,
+			Field:    field,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if cfg.PrivateKey != nil && *cfg.PrivateKey != (wgtypes.Key{}) && !isClamped(*cfg.PrivateKey) {
+		add("unclamped-private-key", "Interface.PrivateKey", "private key isn't clamped like the `wg genkey` ones, check it isn't a public key")
+	}
+
+	if (cfg.DNSSEC != "" || cfg.DNSOverTLS != "") && len(cfg.DNS) == 0 {
+		add("secure-dns-without-dns", "Interface.DNS", "DNSSEC or DNSOverTLS is set, but the tunnel has no DNS servers to apply it to")
+	}
+
+	switch cfg.RouteProtocol {
+	case unix.RTPROT_REDIRECT, unix.RTPROT_KERNEL, unix.RTPROT_BOOT, unix.RTPROT_STATIC, DomainRouteProtocol:
+		add("shared-route-protocol", "Interface.RouteProtocol", "protocol %d is shared with the routes not added by Sync, which deletes them from the link; leave it unset", cfg.RouteProtocol)
+	}
+
+	if cfg.LANBypass && (cfg.Table == TableAuto || cfg.Table == TableOff || cfg.Table == unix.RT_CLASS_MAIN) {
+		add("lan-bypass-table", "Interface.LANBypass", "LAN bypass needs a dedicated routing table, it does nothing with table %v", cfg.Table)
+	}
+
+	for i, peer := range cfg.Peers {
+		if len(peer.AllowedIPs) == 0 && !peer.Remove {
+			// valid, e.g. the peer only reaching this interface, wg-quick accepts it too
+			add("missing-allowed-ips", peerField(i, "AllowedIPs"), "no AllowedIPs, no traffic will be routed to this peer")
+		}
+		for _, aip := range peer.AllowedIPs {
+			if !aip.IP.Equal(aip.IP.Mask(aip.Mask)) {
+				add("non-canonical-allowed-ip", peerField(i, "AllowedIPs"), "%v has host bits set, it's the same as %v", aip.String(), (&net.IPNet{IP: aip.IP.Mask(aip.Mask), Mask: aip.Mask}).String())
+			}
+			if ones, _ := aip.Mask.Size(); ones == 0 && (cfg.Table == TableAuto || cfg.Table == unix.RT_CLASS_MAIN) {
+				add("default-route-main-table", peerField(i, "AllowedIPs"), "%v routes all traffic via the main table, including the traffic to the peer endpoints; set Table and add routing rules", aip.String())
+			}
+			for _, addr := range cfg.Address {
+				if netContains(aip, net.IPNet{IP: addr.IP, Mask: fullMask(addr.IP)}) {
+					add("address-in-allowed-ips", peerField(i, "AllowedIPs"), "%v contains interface address %v", aip.String(), addr.IP)
+				}
+			}
+		}
+
+		for j := i + 1; j < len(cfg.Peers); j++ {
+			for _, a := range peer.AllowedIPs {
+				for _, b := range cfg.Peers[j].AllowedIPs {
+					switch {
+					case a.String() == b.String():
+						// wireguard picks the peer by the packet destination, not the route nexthop, see Multipath
+						add("overlapping-allowed-ips", peerField(j, "AllowedIPs"), "%v is also claimed by Peer[%d], only the last peer gets the traffic; use an interface per gateway and a multipath route over them", b.String(), i)
+					case netContains(a, b) || netContains(b, a):
+						add("overlapping-allowed-ips", peerField(j, "AllowedIPs"), "%v overlaps with %v from Peer[%d]", b.String(), a.String(), i)
+					}
+				}
+			}
+		}
+
+		if peer.Endpoint != nil && peer.PersistentKeepaliveInterval == nil && cfg.ListenPort == nil {
+			add("missing-persistent-keepalive", peerField(i, "PersistentKeepalive"), "endpoint is set without ListenPort or PersistentKeepalive; if behind NAT the peer cannot reach this interface")
+		}
+	}
+	cfg.setLines(diags)
+	return diags
+}
+
+// netContains reports whether network a fully contains network b
+func netContains(a, b net.IPNet) bool {
+	onesA, bitsA := a.Mask.Size()
+	onesB, bitsB := b.Mask.Size()
+	if bitsA != bitsB || onesA > onesB {
+		return false
+	}
+	return a.Contains(b.IP)
+}
+
+func fullMask(ip net.IP) net.IPMask {
+	if ip.To4() != nil {
+		return net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)
+	}
+	return net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)
+}
+
+// isClamped reports whether the key has the bits as clamping leaves them: the low 3 bits of the first byte clear and the
+// second highest bit of the last one set. A public key passes by 1/16 chance, its highest bit is always clear so it isn't
+// checked.
+func isClamped(key wgtypes.Key) bool {
+	return key[0]&7 == 0 && key[31]&0x40 != 0
+}
@@ -0,0 +1,132 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestLint(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(`[Interface]
+Address = 10.0.0.1/24
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 0.0.0.0/0
+Endpoint = 123.12.12.1:51820
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 192.168.1.1/24
+`)))
+	require.NoError(t, c.Validate())
+
+	var codes []string
+	for _, d := range c.Lint() {
+		assert.Equal(t, SeverityWarning, d.Severity)
+		codes = append(codes, d.Code)
+	}
+	assert.ElementsMatch(t, []string{
+		"default-route-main-table",
+		"address-in-allowed-ips",
+		"overlapping-allowed-ips",
+		"missing-persistent-keepalive",
+		"non-canonical-allowed-ip",
+	}, codes)
+}
+
+func TestLintDuplicateAllowedIPs(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 192.168.1.0/24
+
+[Peer]
+PublicKey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+AllowedIPs = 192.168.1.0/24
+`)))
+	diags := c.Lint()
+	require.Len(t, diags, 1)
+	assert.Equal(t, "overlapping-allowed-ips", diags[0].Code)
+	assert.Contains(t, diags[0].Message, "only the last peer gets the traffic")
+}
+
+func TestLintMissingAllowedIPs(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(`[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+`)))
+	require.NoError(t, c.Validate())
+	diags := c.Lint()
+	require.Len(t, diags, 1)
+	assert.Equal(t, "missing-allowed-ips", diags[0].Code)
+	assert.Equal(t, SeverityWarning, diags[0].Severity)
+}
+
+func TestLintUnclampedPrivateKey(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["sample-2"])))
+	for _, d := range c.Lint() {
+		assert.NotEqual(t, "unclamped-private-key", d.Code)
+	}
+
+	// the peer public key pasted as the private key
+	key := c.Peers[0].PublicKey
+	c.PrivateKey = &key
+	var codes []string
+	for _, d := range c.Lint() {
+		codes = append(codes, d.Code)
+	}
+	assert.Contains(t, codes, "unclamped-private-key")
+
+	var k wgtypes.Key
+	assert.False(t, isClamped(k), "the bit clamping sets is clear")
+	k[31] = 0x40
+	assert.True(t, isClamped(k))
+	k[0] = 1
+	assert.False(t, isClamped(k))
+}
+
+func TestLintSecureDNSWithoutDNS(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["sample-2"])))
+	c.DNSOverTLS = "yes"
+	var codes []string
+	for _, d := range c.Lint() {
+		codes = append(codes, d.Code)
+	}
+	assert.Contains(t, codes, "secure-dns-without-dns")
+
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	c.DNSOverTLS = "yes"
+	for _, d := range c.Lint() {
+		assert.NotEqual(t, "secure-dns-without-dns", d.Code)
+	}
+}
+
+func TestLintSharedRouteProtocol(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	for _, d := range c.Lint() {
+		assert.NotEqual(t, "shared-route-protocol", d.Code)
+	}
+	c.RouteProtocol = unix.RTPROT_BOOT
+	var codes []string
+	for _, d := range c.Lint() {
+		codes = append(codes, d.Code)
+	}
+	assert.Contains(t, codes, "shared-route-protocol")
+}
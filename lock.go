@@ -0,0 +1,81 @@
+package wgquick
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultLockDir holds the per-interface lock files
+const DefaultLockDir = "/run/wg-quick-go"
+
+var (
+	ifaceLocksMu sync.Mutex
+	// ifaceLocks serialize the operations on the interface within the process
+	ifaceLocks = make(map[string]*sync.Mutex)
+)
+
+// WithLockDir sets the directory of the per-interface lock files serializing Up, Down and Sync across processes.
+// It's DefaultLockDir for the kernel netlink and none for the others, e.g. fakes. Empty dir disables the lock files,
+// leaving only the in-process locking.
+func WithLockDir(dir string) ClientOption {
+	return func(c *Client) {
+		c.lockDir = &dir
+	}
+}
+
+// lockIface locks the interface for the process with the mutex and for the other processes with flock on the lock file
+func (c *Client) lockIface(iface string) (unlock func(), err error) {
+	if iface == "" || strings.ContainsRune(iface, '/') {
+		return nil, fmt.Errorf("invalid interface name %q", iface)
+	}
+	dir := c.runDir(c.lockDir, DefaultLockDir)
+
+	ifaceLocksMu.Lock()
+	mu, ok := ifaceLocks[iface]
+	if !ok {
+		mu = &sync.Mutex{}
+		ifaceLocks[iface] = mu
+	}
+	ifaceLocksMu.Unlock()
+	mu.Lock()
+	if dir == "" {
+		return mu.Unlock, nil
+	}
+
+	f, err := lockFile(filepath.Join(dir, iface+".lock"))
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		f.Close() // releases the flock
+		mu.Unlock()
+	}, nil
+}
+
+// lockFile opens the lock file and takes the exclusive flock on it, waiting for the other holders
+func lockFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("cannot create lock dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open lock file: %w", err)
+	}
+	for {
+		err = unix.Flock(int(f.Fd()), unix.LOCK_EX)
+		if err != unix.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot lock %s: %w", path, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,49 @@
+package wgquick
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestLockIface(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c := &Client{}
+	WithLockDir(dir)(c)
+
+	unlock, err := c.lockIface("wg0")
+	require.NoError(t, err)
+
+	// other processes see the flock
+	f, err := os.Open(filepath.Join(dir, "wg0.lock"))
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, unix.EWOULDBLOCK, unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB))
+
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := c.lockIface("wg0")
+		close(locked)
+		if assert.NoError(t, err) {
+			unlock()
+		}
+	}()
+	select {
+	case <-locked:
+		t.Fatal("interface locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+
+	_, err = c.lockIface("../wg0")
+	assert.Error(t, err)
+}
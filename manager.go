@@ -0,0 +1,135 @@
+package wgquick
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Manager owns the set of interface configs and reconciles them, the building block of the daemons managing many
+// tunnels. The interfaces are brought up when missing and synced otherwise. It's safe for concurrent use.
+type Manager struct {
+	c      *Client
+	log    logrus.FieldLogger
+	mu     sync.Mutex
+	ifaces map[string]*managedIface
+}
+
+type managedIface struct {
+	cfg      *Config
+	lastSync time.Time
+	err      error
+}
+
+// ManagedInterface is the manager view of the interface
+type ManagedInterface struct {
+	Name string
+	// LastSync is the time of the last reconcile, zero if there was none yet
+	LastSync time.Time
+	// Err is the error of the last reconcile
+	Err error
+}
+
+// NewManager creates the manager of no interfaces, reconciling them with the client
+func NewManager(c *Client, log logrus.FieldLogger) *Manager {
+	return &Manager{c: c, log: log, ifaces: make(map[string]*managedIface)}
+}
+
+// Add adds or replaces the interface config and reconciles it. The config is kept as is, the reconciles use its copies.
+func (m *Manager) Add(iface string, cfg *Config) error {
+	m.mu.Lock()
+	m.ifaces[iface] = &managedIface{cfg: cfg.clone()}
+	m.mu.Unlock()
+	return m.Resync(iface)
+}
+
+// Remove tears the interface down and forgets it
+func (m *Manager) Remove(iface string) error {
+	m.mu.Lock()
+	mi, ok := m.ifaces[iface]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("interface %s is not managed", iface)
+	}
+	if err := m.c.Down(mi.cfg.clone(), iface, m.log); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if m.ifaces[iface] == mi {
+		delete(m.ifaces, iface)
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// Resync reconciles the interface with its config, bringing it up if it's missing
+func (m *Manager) Resync(iface string) error {
+	m.mu.Lock()
+	mi, ok := m.ifaces[iface]
+	var cfg *Config
+	if ok {
+		cfg = mi.cfg.clone()
+	}
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("interface %s is not managed", iface)
+	}
+
+	err := m.reconcile(cfg, iface)
+	if err != nil {
+		m.log.WithError(err).WithField("iface", iface).Error("cannot reconcile interface")
+	}
+	m.mu.Lock()
+	mi.lastSync, mi.err = time.Now(), err
+	m.mu.Unlock()
+	return err
+}
+
+func (m *Manager) reconcile(cfg *Config, iface string) error {
+	exists, err := m.c.Exists(iface)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return m.c.Sync(cfg, iface, m.log)
+	}
+	return m.c.Up(cfg, iface, m.log)
+}
+
+// ResyncAll reconciles all the interfaces, returning the errors by the interface name
+func (m *Manager) ResyncAll() map[string]error {
+	errs := make(map[string]error)
+	for _, iface := range m.names() {
+		if err := m.Resync(iface); err != nil {
+			errs[iface] = err
+		}
+	}
+	return errs
+}
+
+// Interfaces returns the managed interfaces ordered by name
+func (m *Manager) Interfaces() []ManagedInterface {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []ManagedInterface
+	for name, mi := range m.ifaces {
+		out = append(out, ManagedInterface{Name: name, LastSync: mi.lastSync, Err: mi.err})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// names returns the managed interface names ordered
+func (m *Manager) names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name := range m.ifaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
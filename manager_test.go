@@ -0,0 +1,48 @@
+package wgquick_test
+
+import (
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager(t *testing.T) {
+	c, nl, _ := newFakeClient(t)
+	defer c.Close()
+	m := wgquick.NewManager(c, testLog)
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	require.NoError(t, m.Add("wg0", cfg))
+	require.NoError(t, m.Add("wg1", cfg))
+	broken := &wgquick.Config{}
+	require.NoError(t, broken.UnmarshalText([]byte(testConfig)))
+	broken.ProxyDevice = "missing0"
+	assert.Error(t, m.Add("wg2", broken))
+
+	ifaces := m.Interfaces()
+	require.Len(t, ifaces, 3)
+	assert.Equal(t, "wg0", ifaces[0].Name)
+	assert.NoError(t, ifaces[0].Err)
+	assert.False(t, ifaces[0].LastSync.IsZero())
+	assert.Error(t, ifaces[2].Err)
+
+	link, err := nl.LinkByName("wg1")
+	require.NoError(t, err)
+	require.NoError(t, nl.LinkDel(link))
+	errs := m.ResyncAll()
+	assert.Len(t, errs, 1)
+	assert.Error(t, errs["wg2"])
+	ok, err := c.Exists("wg1")
+	require.NoError(t, err)
+	assert.True(t, ok, "deleted interface is brought back up")
+
+	require.NoError(t, m.Remove("wg0"))
+	ok, err = c.Exists("wg0")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Len(t, m.Interfaces(), 2)
+	assert.Error(t, m.Resync("wg0"), "removed interface isn't managed")
+}
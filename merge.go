@@ -0,0 +1,260 @@
+package wgquick
+
+import (
+	"net"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Merge overlays overrides on top of the base config, in order, returning the new config. Inputs are not modified.
+//
+// Semantics:
+// * scalar fields (MTU, Table, hooks, ...) are replaced if set (non-zero) in the override. Booleans can only be turned on.
+// * pointer fields (PrivateKey, ListenPort, FirewallMark) are replaced if non-nil in the override
+// * Address (together with AddressOptions), Routes and DNS lists are replaced as a whole if non-empty in the override
+// * peer names, endpoint host names, RouteOptions and EventHooks are merged, the override wins
+// * peers are matched by public key. Matching peers are merged with the same scalar semantics and AllowedIPs replaced if non-empty; other peers are appended
+func Merge(base *Config, overrides ...*Config) *Config {
+	out := base.clone()
+	for _, o := range overrides {
+		if o.PrivateKey != nil {
+			key := *o.PrivateKey
+			out.PrivateKey = &key
+		}
+		if o.ListenPort != nil {
+			port := *o.ListenPort
+			out.ListenPort = &port
+		}
+		if o.FirewallMark != nil {
+			mark := *o.FirewallMark
+			out.FirewallMark = &mark
+		}
+		out.ReplacePeers = out.ReplacePeers || o.ReplacePeers
+		if len(o.Address) > 0 {
+			out.Address = append([]net.IPNet(nil), o.Address...)
+			out.AddressOptions = cloneAddressOptions(o.AddressOptions)
+		}
+		if len(o.Routes) > 0 {
+			out.Routes = cloneRoutes(o.Routes)
+		}
+		for dst, opts := range o.RouteOptions {
+			if out.RouteOptions == nil {
+				out.RouteOptions = make(map[string]RouteOptions, len(o.RouteOptions))
+			}
+			out.RouteOptions[dst] = opts
+		}
+		if len(o.DNS) > 0 {
+			out.DNS = append([]net.IP(nil), o.DNS...)
+		}
+		mergeInt(&out.MTU, o.MTU)
+		if o.Table != TableAuto {
+			out.Table = o.Table
+		}
+		mergeString(&out.PreUp, o.PreUp)
+		mergeString(&out.PostUp, o.PostUp)
+		mergeString(&out.PreDown, o.PreDown)
+		mergeString(&out.PostDown, o.PostDown)
+		for t, hook := range o.EventHooks {
+			if out.EventHooks == nil {
+				out.EventHooks = make(map[EventType]string, len(o.EventHooks))
+			}
+			out.EventHooks[t] = hook
+		}
+		mergeString(&out.HookShell, o.HookShell)
+		mergeString(&out.HookUser, o.HookUser)
+		mergeString(&out.DNSBackend, o.DNSBackend)
+		mergeString(&out.ResolvconfAdd, o.ResolvconfAdd)
+		mergeString(&out.ResolvconfDelete, o.ResolvconfDelete)
+		mergeString(&out.ResolvconfRecord, o.ResolvconfRecord)
+		out.DNSDefaultRoute = out.DNSDefaultRoute || o.DNSDefaultRoute
+		mergeString(&out.DNSSEC, o.DNSSEC)
+		mergeString(&out.DNSOverTLS, o.DNSOverTLS)
+		mergeString(&out.LLMNR, o.LLMNR)
+		if len(o.HookCapabilities) > 0 {
+			out.HookCapabilities = o.HookCapabilities
+		}
+		mergeInt(&out.RouteProtocol, o.RouteProtocol)
+		mergeInt(&out.RouteMetric, o.RouteMetric)
+		out.SourceRules = out.SourceRules || o.SourceRules
+		out.IPForward = out.IPForward || o.IPForward
+		out.LANBypass = out.LANBypass || o.LANBypass
+		mergeString(&out.ProxyDevice, o.ProxyDevice)
+		mergeInt(&out.SourceRulePriority, o.SourceRulePriority)
+		mergeString(&out.AddressLabel, o.AddressLabel)
+		mergeString(&out.LinkAlias, o.LinkAlias)
+		if !o.AmneziaWG.IsZero() {
+			out.AmneziaWG = o.AmneziaWG
+		}
+		mergeInt(&out.TxQueueLen, o.TxQueueLen)
+		if o.LinkGroup != 0 {
+			out.LinkGroup = o.LinkGroup
+		}
+		mergeInt(&out.NumTxQueues, o.NumTxQueues)
+		mergeInt(&out.NumRxQueues, o.NumRxQueues)
+		if o.KillSwitch != KillSwitchOff {
+			out.KillSwitch = o.KillSwitch
+		}
+		out.SaveConfig = out.SaveConfig || o.SaveConfig
+
+		for key, name := range o.PeerNames {
+			if out.PeerNames == nil {
+				out.PeerNames = make(map[wgtypes.Key]string)
+			}
+			out.PeerNames[key] = name
+		}
+		for key, host := range o.EndpointHosts {
+			if out.EndpointHosts == nil {
+				out.EndpointHosts = make(map[wgtypes.Key]string)
+			}
+			out.EndpointHosts[key] = host
+		}
+		for _, op := range o.Peers {
+			op := clonePeer(op)
+			if _, ok := o.EndpointHosts[op.PublicKey]; op.Endpoint != nil && !ok {
+				// the IP endpoint replaces the host name
+				delete(out.EndpointHosts, op.PublicKey)
+			}
+			idx := -1
+			for i := range out.Peers {
+				if out.Peers[i].PublicKey == op.PublicKey {
+					idx = i
+					break
+				}
+			}
+			if idx < 0 {
+				out.Peers = append(out.Peers, op)
+				continue
+			}
+			mergePeer(&out.Peers[idx], op)
+		}
+	}
+	return out
+}
+
+func mergePeer(p *wgtypes.PeerConfig, o wgtypes.PeerConfig) {
+	p.Remove = p.Remove || o.Remove
+	p.UpdateOnly = p.UpdateOnly || o.UpdateOnly
+	p.ReplaceAllowedIPs = p.ReplaceAllowedIPs || o.ReplaceAllowedIPs
+	if o.PresharedKey != nil {
+		p.PresharedKey = o.PresharedKey
+	}
+	if o.Endpoint != nil {
+		p.Endpoint = o.Endpoint
+	}
+	if o.PersistentKeepaliveInterval != nil {
+		p.PersistentKeepaliveInterval = o.PersistentKeepaliveInterval
+	}
+	if len(o.AllowedIPs) > 0 {
+		p.AllowedIPs = o.AllowedIPs
+	}
+}
+
+func mergeInt(dst *int, v int) {
+	if v != 0 {
+		*dst = v
+	}
+}
+
+func mergeString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// clone returns a deep copy of the config
+func (cfg *Config) clone() *Config {
+	out := *cfg
+	if cfg.PrivateKey != nil {
+		key := *cfg.PrivateKey
+		out.PrivateKey = &key
+	}
+	if cfg.ListenPort != nil {
+		port := *cfg.ListenPort
+		out.ListenPort = &port
+	}
+	if cfg.FirewallMark != nil {
+		mark := *cfg.FirewallMark
+		out.FirewallMark = &mark
+	}
+	out.Address = append([]net.IPNet(nil), cfg.Address...)
+	out.DNS = append([]net.IP(nil), cfg.DNS...)
+	out.HookCapabilities = append([]string(nil), cfg.HookCapabilities...)
+	out.AddressOptions = cloneAddressOptions(cfg.AddressOptions)
+	out.Routes = cloneRoutes(cfg.Routes)
+	if cfg.RouteOptions != nil {
+		out.RouteOptions = make(map[string]RouteOptions, len(cfg.RouteOptions))
+		for dst, opts := range cfg.RouteOptions {
+			out.RouteOptions[dst] = opts
+		}
+	}
+	if cfg.EventHooks != nil {
+		out.EventHooks = make(map[EventType]string, len(cfg.EventHooks))
+		for t, hook := range cfg.EventHooks {
+			out.EventHooks[t] = hook
+		}
+	}
+	if cfg.PeerNames != nil {
+		out.PeerNames = make(map[wgtypes.Key]string, len(cfg.PeerNames))
+		for key, name := range cfg.PeerNames {
+			out.PeerNames[key] = name
+		}
+	}
+	if cfg.EndpointHosts != nil {
+		out.EndpointHosts = make(map[wgtypes.Key]string, len(cfg.EndpointHosts))
+		for key, host := range cfg.EndpointHosts {
+			out.EndpointHosts[key] = host
+		}
+	}
+	out.Peers = nil
+	for _, p := range cfg.Peers {
+		out.Peers = append(out.Peers, clonePeer(p))
+	}
+	return &out
+}
+
+func cloneAddressOptions(opts map[string]AddressOptions) map[string]AddressOptions {
+	if opts == nil {
+		return nil
+	}
+	out := make(map[string]AddressOptions, len(opts))
+	for addr, o := range opts {
+		if o.Peer != nil {
+			peer := *o.Peer
+			o.Peer = &peer
+		}
+		out[addr] = o
+	}
+	return out
+}
+
+func cloneRoutes(routes []Route) []Route {
+	if routes == nil {
+		return nil
+	}
+	out := make([]Route, len(routes))
+	for i, rt := range routes {
+		rt.Gateway = append(net.IP(nil), rt.Gateway...)
+		if len(rt.Gateway) == 0 {
+			rt.Gateway = nil
+		}
+		out[i] = rt
+	}
+	return out
+}
+
+func clonePeer(p wgtypes.PeerConfig) wgtypes.PeerConfig {
+	if p.PresharedKey != nil {
+		key := *p.PresharedKey
+		p.PresharedKey = &key
+	}
+	if p.Endpoint != nil {
+		ep := *p.Endpoint
+		p.Endpoint = &ep
+	}
+	if p.PersistentKeepaliveInterval != nil {
+		dur := *p.PersistentKeepaliveInterval
+		p.PersistentKeepaliveInterval = &dur
+	}
+	p.AllowedIPs = append([]net.IPNet(nil), p.AllowedIPs...)
+	return p
+}
@@ -0,0 +1,171 @@
+package wgquick
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// MultipathNexthop is the tunnel interface carrying a share of the multipath route
+type MultipathNexthop struct {
+	Iface string
+	// Weight is the share of the flows relative to the other nexthops, 1 if 0. The kernel supports 1 to 256.
+	Weight int
+}
+
+// Multipath is the route spreading the flows to the destinations over several tunnel interfaces, e.g. to active-active
+// gateways. The peers claiming the same AllowedIPs on one interface can't do it, wireguard picks the peer by the packet
+// destination and only the last one gets the traffic. Each gateway gets its own interface instead, with the shared
+// prefixes in its peer AllowedIPs and Table = off, so its Sync doesn't replace the multipath route.
+type Multipath struct {
+	Dsts     []net.IPNet
+	Nexthops []MultipathNexthop
+	// Table is the routing table, the main one if 0
+	Table int
+	// Metric is the route priority
+	Metric int
+	// Protocol tags the routes, DefaultRouteProtocol if 0. SyncMultipath deletes the multipath routes in the table tagged
+	// with it which aren't wanted anymore, use another one for each Multipath sharing the table.
+	Protocol int
+}
+
+// multipathRoutes returns the routes of the destinations over the nexthop links
+func (c *Client) multipathRoutes(mp Multipath) ([]netlink.Route, error) {
+	if len(mp.Dsts) == 0 {
+		return nil, nil
+	}
+	if len(mp.Nexthops) == 0 {
+		return nil, fmt.Errorf("multipath route without nexthops")
+	}
+	var nexthops []*netlink.NexthopInfo
+	for _, nh := range mp.Nexthops {
+		weight := nh.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		if weight < 1 || weight > 256 {
+			return nil, fmt.Errorf("nexthop %s weight %d out of range 1-256", nh.Iface, nh.Weight)
+		}
+		link, err := c.nl.LinkByName(nh.Iface)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find nexthop %s: %w", nh.Iface, err)
+		}
+		// the kernel keeps the weight minus one in rtnh_hops
+		nexthops = append(nexthops, &netlink.NexthopInfo{LinkIndex: link.Attrs().Index, Hops: weight - 1})
+	}
+	var routes []netlink.Route
+	for _, dst := range mp.Dsts {
+		dst := net.IPNet{IP: dst.IP.Mask(dst.Mask), Mask: dst.Mask}
+		rt := netlink.Route{
+			Dst:       &dst,
+			Table:     mp.Table,
+			Protocol:  mp.Protocol,
+			Priority:  mp.Metric,
+			MultiPath: nexthops,
+		}
+		fillRouteDefaults(&rt)
+		routes = append(routes, rt)
+	}
+	return routes, nil
+}
+
+// listMultipath lists the multipath routes in the table tagged with the protocol of mp
+func (c *Client) listMultipath(mp Multipath) ([]netlink.Route, error) {
+	filter := netlink.Route{Table: mp.Table, Protocol: mp.Protocol}
+	fillRouteDefaults(&filter)
+	routes, err := c.listRoutes(&filter, netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL)
+	if err != nil {
+		return nil, err
+	}
+	var multipath []netlink.Route
+	for _, rt := range routes {
+		if len(rt.MultiPath) > 0 {
+			multipath = append(multipath, rt)
+		}
+	}
+	return multipath, nil
+}
+
+// nexthopsMatch reports whether the routes have the same nexthops with the same weights, in the same order
+func nexthopsMatch(a, b []*netlink.NexthopInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].LinkIndex != b[i].LinkIndex || a[i].Hops != b[i].Hops || !a[i].Gw.Equal(b[i].Gw) {
+			return false
+		}
+	}
+	return true
+}
+
+// SyncMultipath adds or replaces the multipath routes to the destinations over the nexthop interfaces, and deletes the
+// other multipath routes in the table tagged with the protocol. Call it again with the remaining nexthops when
+// a gateway goes away. Equivalent to:
+// `ip route replace $dst table $table proto $proto metric $metric nexthop dev wg0 weight 2 nexthop dev wg1 weight 1`
+func (c *Client) SyncMultipath(mp Multipath, log logrus.FieldLogger) error {
+	wanted, err := c.multipathRoutes(mp)
+	if err != nil {
+		log.WithError(err).Error("cannot build multipath routes")
+		return err
+	}
+	present, err := c.listMultipath(mp)
+	if err != nil {
+		log.WithError(err).Error("cannot read multipath routes")
+		return err
+	}
+	// the routes are keyed by the destination and the metric, the route with another metric is a different one
+	key := func(rt netlink.Route) string {
+		return fmt.Sprintf("%s metric %d", rt.Dst, rt.Priority)
+	}
+	presentByKey := make(map[string]netlink.Route, len(present))
+	for _, rt := range present {
+		presentByKey[key(rt)] = rt
+	}
+
+	wantedKeys := make(map[string]bool, len(wanted))
+	errs := c.newItemErrors()
+	for _, rt := range wanted {
+		rt := rt // make copy
+		wantedKeys[key(rt)] = true
+		log := log.WithField("route", rt.Dst.String())
+		if p, ok := presentByKey[key(rt)]; ok && nexthopsMatch(p.MultiPath, rt.MultiPath) {
+			log.Debug("multipath route present")
+			continue
+		}
+		if err := c.nl.RouteReplace(&rt); err != nil {
+			log.WithError(err).Error("cannot add/replace multipath route")
+			if err := errs.add("replace multipath route", rt.Dst.String(), err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.WithField("nexthops", len(rt.MultiPath)).Info("multipath route added/replaced")
+	}
+	for _, rt := range present {
+		rt := rt // make copy
+		if wantedKeys[key(rt)] {
+			continue
+		}
+		log := log.WithField("route", rt.Dst.String())
+		if err := c.nl.RouteDel(&rt); err != nil && err != syscall.ESRCH {
+			log.WithError(err).Error("cannot delete multipath route")
+			if err := errs.add("delete multipath route", rt.Dst.String(), err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("multipath route deleted")
+	}
+	return errs.err()
+}
+
+// DeleteMultipath deletes the multipath routes in the table tagged with the protocol of mp, e.g. before the tunnel
+// interfaces go down
+func (c *Client) DeleteMultipath(mp Multipath, log logrus.FieldLogger) error {
+	mp.Dsts = nil
+	return c.SyncMultipath(mp, log)
+}
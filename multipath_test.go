@@ -0,0 +1,64 @@
+package wgquick_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+func TestSyncMultipath(t *testing.T) {
+	c, nl, _ := newFakeClient(t)
+	defer c.Close()
+	for _, name := range []string{"wg0", "wg1"} {
+		require.NoError(t, nl.LinkAdd(&netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Name: name}, LinkType: "wireguard"}))
+	}
+	wg0, err := nl.LinkByName("wg0")
+	require.NoError(t, err)
+	wg1, err := nl.LinkByName("wg1")
+	require.NoError(t, err)
+
+	_, dst, err := net.ParseCIDR("10.50.0.0/16")
+	require.NoError(t, err)
+	_, other, err := net.ParseCIDR("fd50::/64")
+	require.NoError(t, err)
+	mp := wgquick.Multipath{
+		Dsts:     []net.IPNet{*dst, *other},
+		Nexthops: []wgquick.MultipathNexthop{{Iface: "wg0", Weight: 3}, {Iface: "wg1"}},
+		Table:    51820,
+	}
+	require.NoError(t, c.SyncMultipath(mp, testLog))
+	routes := nl.Routes()
+	require.Len(t, routes, 2)
+	assert.Equal(t, "10.50.0.0/16", routes[0].Dst.String())
+	assert.Equal(t, 51820, routes[0].Table)
+	assert.Equal(t, wgquick.DefaultRouteProtocol, routes[0].Protocol)
+	require.Len(t, routes[0].MultiPath, 2)
+	assert.Equal(t, wg0.Attrs().Index, routes[0].MultiPath[0].LinkIndex)
+	assert.Equal(t, 2, routes[0].MultiPath[0].Hops, "the kernel keeps the weight minus one")
+	assert.Equal(t, wg1.Attrs().Index, routes[0].MultiPath[1].LinkIndex)
+	assert.Equal(t, 0, routes[0].MultiPath[1].Hops)
+
+	// the gateway behind wg0 is gone, the other destination too and the metric changed
+	mp.Nexthops = mp.Nexthops[1:]
+	mp.Dsts = mp.Dsts[:1]
+	mp.Metric = 10
+	require.NoError(t, c.SyncMultipath(mp, testLog))
+	routes = nl.Routes()
+	require.Len(t, routes, 1)
+	assert.Equal(t, 10, routes[0].Priority)
+	require.Len(t, routes[0].MultiPath, 1)
+	assert.Equal(t, wg1.Attrs().Index, routes[0].MultiPath[0].LinkIndex)
+
+	bad := mp
+	bad.Nexthops = []wgquick.MultipathNexthop{{Iface: "wg1", Weight: 300}}
+	assert.Error(t, c.SyncMultipath(bad, testLog))
+	bad.Nexthops = []wgquick.MultipathNexthop{{Iface: "wg9"}}
+	assert.Error(t, c.SyncMultipath(bad, testLog))
+
+	require.NoError(t, c.DeleteMultipath(mp, testLog))
+	assert.Empty(t, nl.Routes())
+}
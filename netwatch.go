@@ -0,0 +1,159 @@
+package wgquick
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// NetworkWatcher is implemented by the Netlink implementations which can report the network changes, e.g. the netlink
+// handle and the fake. RunNetworkWatcher needs it.
+type NetworkWatcher interface {
+	// WatchNetwork sends the link index of every link, address and default route change to changes until done is closed
+	WatchNetwork(changes chan<- int, done <-chan struct{}) error
+}
+
+// WatchNetwork subscribes to the link, address and route updates of the handle's network namespace. Only the default
+// route updates are reported of the routes.
+func (h netlinkHandle) WatchNetwork(changes chan<- int, done <-chan struct{}) error {
+	ns := h.ns
+	links := make(chan netlink.LinkUpdate)
+	addrs := make(chan netlink.AddrUpdate)
+	routes := make(chan netlink.RouteUpdate)
+	if err := netlink.LinkSubscribeWithOptions(links, done, netlink.LinkSubscribeOptions{Namespace: &ns}); err != nil {
+		return err
+	}
+	if err := netlink.AddrSubscribeWithOptions(addrs, done, netlink.AddrSubscribeOptions{Namespace: &ns}); err != nil {
+		return err
+	}
+	if err := netlink.RouteSubscribeWithOptions(routes, done, netlink.RouteSubscribeOptions{Namespace: &ns}); err != nil {
+		return err
+	}
+	go func() {
+		for links != nil || addrs != nil || routes != nil {
+			index := 0
+			select {
+			case u, ok := <-links:
+				if !ok {
+					links = nil
+					continue
+				}
+				index = int(u.Index)
+			case u, ok := <-addrs:
+				if !ok {
+					addrs = nil
+					continue
+				}
+				index = u.LinkIndex
+			case u, ok := <-routes:
+				if !ok {
+					routes = nil
+					continue
+				}
+				if !isDefaultDst(u.Dst) {
+					continue
+				}
+				index = u.LinkIndex
+			}
+			select {
+			case changes <- index:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// networkWatcher returns the client netlink as NetworkWatcher, if it is one
+func (c *Client) networkWatcher() (NetworkWatcher, bool) {
+	nl := c.nl
+	if a, ok := nl.(auditNetlink); ok {
+		nl = a.Netlink
+	}
+	w, ok := nl.(NetworkWatcher)
+	return w, ok
+}
+
+// RefreshEndpoints resolves cfg.EndpointHosts again and sets the endpoints of all the peers with one on the device,
+// updating cfg with the new addresses. Setting the endpoint makes the kernel forget the cached source address, so the
+// packets leave via the new route, and setting the persistent keepalive sends the keepalive right away, nudging the
+// handshake. The opts are the ones the config was parsed with, e.g. WithResolver and WithEndpointFamily. A host failing
+// to resolve keeps its previous address.
+func (c *Client) RefreshEndpoints(cfg *Config, iface string, logger logrus.FieldLogger, opts ...ParseOption) error {
+	log := logger.WithField("iface", iface)
+	options := &parseOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	update := wgtypes.Config{}
+	for i := range cfg.Peers {
+		peer := &cfg.Peers[i]
+		if peer.Remove || peer.Endpoint == nil {
+			continue
+		}
+		log := log.WithField("peer", cfg.PeerLabel(peer.PublicKey))
+		if host, ok := cfg.EndpointHosts[peer.PublicKey]; ok {
+			addr, err := options.resolveEndpoint(host)
+			switch {
+			case err != nil:
+				log.WithError(err).WithField("endpoint", host).Warn("cannot resolve endpoint, keeping the previous address")
+			case addr.String() != peer.Endpoint.String():
+				log.WithFields(map[string]interface{}{"old": peer.Endpoint.String(), "new": addr.String()}).Info("endpoint changed")
+				peer.Endpoint = addr
+			}
+		}
+		p := wgtypes.PeerConfig{PublicKey: peer.PublicKey, UpdateOnly: true, Endpoint: peer.Endpoint}
+		if ka := peer.PersistentKeepaliveInterval; ka != nil && *ka > 0 {
+			p.PersistentKeepaliveInterval = ka
+		}
+		update.Peers = append(update.Peers, p)
+	}
+	if len(update.Peers) == 0 {
+		return nil
+	}
+	cl, err := c.wgctrl()
+	if err != nil {
+		return err
+	}
+	err = cl.ConfigureDevice(iface, update)
+	c.recordDevice(iface, update, err)
+	if err != nil {
+		log.WithError(err).Error("cannot refresh endpoints")
+		return err
+	}
+	log.WithField("peers", len(update.Peers)).Info("refreshed endpoints")
+	return nil
+}
+
+// RunNetworkWatcher refreshes the endpoints (see RefreshEndpoints) after every burst of network changes until the
+// context is done, e.g. on the Wi-Fi roam or the new default route, so the tunnel recovers without waiting for the
+// handshake timeout. The changes of the tunnel link itself are ignored. The bursts are coalesced over the quiet period,
+// see Resyncer. The caller mustn't sync cfg concurrently.
+func (c *Client) RunNetworkWatcher(ctx context.Context, cfg *Config, iface string, quiet time.Duration, log logrus.FieldLogger, opts ...ParseOption) error {
+	w, ok := c.networkWatcher()
+	if !ok {
+		return fmt.Errorf("netlink %T can't watch the network changes", c.nl)
+	}
+	changes := make(chan int, 16)
+	if err := w.WatchNetwork(changes, ctx.Done()); err != nil {
+		return err
+	}
+	r := NewResyncer(quiet, func() error { return c.RefreshEndpoints(cfg, iface, log, opts...) }, log)
+	go r.Run(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case index := <-changes:
+			if link, err := c.nl.LinkByName(iface); err == nil && link.Attrs().Index == index {
+				continue
+			}
+			r.Trigger()
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package wgquick_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+func TestRunNetworkWatcher(t *testing.T) {
+	c, nl, wg := newFakeClient(t)
+	defer c.Close()
+
+	var mu sync.Mutex
+	answer := "203.0.113.7"
+	resolver := wgquick.WithResolver(wgquick.ResolverFunc(func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return []net.IPAddr{{IP: net.ParseIP(answer)}}, nil
+	}))
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.Parse([]byte(testConfig+"Endpoint = vpn.example.com:51820\nPersistentKeepalive = 25\n"), resolver))
+	assert.Equal(t, "vpn.example.com:51820", cfg.EndpointHosts[cfg.Peers[1].PublicKey])
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- c.RunNetworkWatcher(ctx, cfg, "wg0", time.Millisecond, testLog, resolver) }()
+
+	endpoint := func() string {
+		dev, err := wg.Device("wg0")
+		require.NoError(t, err)
+		for _, p := range dev.Peers {
+			if p.PublicKey == cfg.Peers[1].PublicKey && p.Endpoint != nil {
+				return p.Endpoint.String()
+			}
+		}
+		return ""
+	}
+	assert.Equal(t, "203.0.113.7:51820", endpoint())
+
+	mu.Lock()
+	answer = "203.0.113.9"
+	mu.Unlock()
+	require.NoError(t, nl.LinkAdd(&netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Name: "wlan0"}, LinkType: "device"}))
+	wlan0, err := nl.LinkByName("wlan0")
+	require.NoError(t, err)
+	for deadline := time.Now().Add(time.Second); endpoint() != "203.0.113.9:51820" && time.Now().Before(deadline); {
+		// the watcher may subscribe after the link is up, keep the network changing
+		require.NoError(t, nl.LinkSetUp(wlan0))
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, "203.0.113.9:51820", endpoint())
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
@@ -0,0 +1,193 @@
+// Package nstest runs end-to-end tests of wgquick in throwaway network namespaces, e.g. in CI environments allowing
+// CAP_NET_ADMIN. The tests are skipped when namespaces or the wireguard kernel module aren't available:
+//
+//	a, b := nstest.New(t), nstest.New(t)
+//	defer a.Close()
+//	defer b.Close()
+//	nstest.RequireWireguard(t, a)
+//	require.NoError(t, nstest.Veth(a, "veth0", "192.168.100.1/24", b, "veth0", "192.168.100.2/24"))
+//	c, err := a.Client()
+//	require.NoError(t, err)
+//	require.NoError(t, a.Do(func() error { return c.Up(cfg, "wg0", log) }))
+//
+// Up and Down have to run in Do, since the hooks and resolvconf run in the calling thread's namespace.
+// The ParallelSync client option isn't supported, its goroutines run outside of the namespace.
+package nstest
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.zx2c4.com/wireguard/wgctrl"
+)
+
+// Namespace is the throwaway network namespace, deleted with the last reference on Close
+type Namespace struct {
+	ns netns.NsHandle
+	// Netlink is the handle for inspecting the namespace
+	Netlink *netlink.Handle
+	closers []func() error
+}
+
+// New creates the namespace with the loopback link up. The test is skipped if namespaces can't be created.
+func New(t testing.TB) *Namespace {
+	n, err := newNamespace()
+	if err != nil {
+		t.Skipf("cannot create network namespace: %v", err)
+	}
+	return n
+}
+
+func newNamespace() (*Namespace, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	orig, err := netns.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer orig.Close()
+	ns, err := netns.New()
+	if err != nil {
+		return nil, err
+	}
+	if err := netns.Set(orig); err != nil {
+		// the thread is stuck in the new namespace, let it exit with the goroutine
+		runtime.LockOSThread()
+		ns.Close()
+		return nil, err
+	}
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		ns.Close()
+		return nil, err
+	}
+	n := &Namespace{ns: ns, Netlink: h}
+	lo, err := h.LinkByName("lo")
+	if err == nil {
+		err = h.LinkSetUp(lo)
+	}
+	if err != nil {
+		n.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// Do runs f with the calling thread in the namespace, so everything f does on the calling goroutine, including the
+// executed commands, applies to the namespace
+func (n *Namespace) Do(f func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	orig, err := netns.Get()
+	if err != nil {
+		return err
+	}
+	defer orig.Close()
+	if err := netns.Set(n.ns); err != nil {
+		return err
+	}
+	ferr := f()
+	if err := netns.Set(orig); err != nil {
+		// the thread is stuck in the namespace, let it exit with the goroutine
+		runtime.LockOSThread()
+		return err
+	}
+	return ferr
+}
+
+// Client returns the wgquick client operating in the namespace. It's closed with the namespace.
+func (n *Namespace) Client(opts ...wgquick.ClientOption) (*wgquick.Client, error) {
+	var wg *wgctrl.Client
+	// the wgctrl sockets are bound to the namespace they're created in
+	if err := n.Do(func() (err error) {
+		wg, err = wgctrl.New()
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	n.closers = append(n.closers, wg.Close)
+	c, err := wgquick.NewClient(append([]wgquick.ClientOption{wgquick.WithNetlinkHandle(n.Netlink, n.ns), wgquick.WithWgctrlClient(wg)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	n.closers = append(n.closers, c.Close)
+	return c, nil
+}
+
+// Close releases the namespace together with the clients. The kernel deletes it with the links once unused.
+func (n *Namespace) Close() error {
+	var firstErr error
+	for i := len(n.closers) - 1; i >= 0; i-- {
+		if err := n.closers[i](); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	n.closers = nil
+	n.Netlink.Delete()
+	if err := n.ns.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// RequireWireguard skips the test if the namespace can't create wireguard links, e.g. the kernel module is missing
+func RequireWireguard(t testing.TB, n *Namespace) {
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = "wgprobe"
+	link := &netlink.GenericLink{LinkAttrs: attrs, LinkType: "wireguard"}
+	if err := n.Netlink.LinkAdd(link); err != nil {
+		t.Skipf("cannot create wireguard link: %v", err)
+	}
+	if err := n.Netlink.LinkDel(link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Veth connects the namespaces with the veth pair, setting the addresses (in CIDR notation) and the links up
+func Veth(a *Namespace, nameA, addrA string, b *Namespace, nameB, addrB string) error {
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = nameA
+	if err := a.Netlink.LinkAdd(&netlink.Veth{LinkAttrs: attrs, PeerName: "nstest-peer"}); err != nil {
+		return fmt.Errorf("cannot create veth: %w", err)
+	}
+	peer, err := a.Netlink.LinkByName("nstest-peer")
+	if err != nil {
+		return err
+	}
+	if err := a.Netlink.LinkSetNsFd(peer, int(b.ns)); err != nil {
+		return fmt.Errorf("cannot move veth peer: %w", err)
+	}
+	peer, err = b.Netlink.LinkByName("nstest-peer")
+	if err != nil {
+		return err
+	}
+	if err := b.Netlink.LinkSetName(peer, nameB); err != nil {
+		return err
+	}
+	if err := a.setupLink(nameA, addrA); err != nil {
+		return err
+	}
+	return b.setupLink(nameB, addrB)
+}
+
+// setupLink adds the address to the link and sets it up
+func (n *Namespace) setupLink(name, addr string) error {
+	link, err := n.Netlink.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	ip, ipnet, err := net.ParseCIDR(addr)
+	if err != nil {
+		return err
+	}
+	ipnet.IP = ip
+	if err := n.Netlink.AddrAdd(link, &netlink.Addr{IPNet: ipnet}); err != nil {
+		return fmt.Errorf("cannot add address %s: %w", addr, err)
+	}
+	return n.Netlink.LinkSetUp(link)
+}
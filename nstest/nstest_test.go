@@ -0,0 +1,247 @@
+package nstest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func tunnelConfig(t *testing.T, key wgtypes.Key, addr string, port int, peer wgtypes.Key, peerAddr string, endpoint string) *wgquick.Config {
+	_, ipnet, err := net.ParseCIDR(addr + "/24")
+	require.NoError(t, err)
+	ipnet.IP = net.ParseIP(addr)
+	_, allowed, err := net.ParseCIDR(peerAddr + "/32")
+	require.NoError(t, err)
+	ep, err := net.ResolveUDPAddr("udp", endpoint)
+	require.NoError(t, err)
+	return &wgquick.Config{
+		Config: wgtypes.Config{
+			PrivateKey: &key,
+			ListenPort: &port,
+			Peers: []wgtypes.PeerConfig{{
+				PublicKey:  peer.PublicKey(),
+				Endpoint:   ep,
+				AllowedIPs: []net.IPNet{*allowed},
+			}},
+		},
+		Address: []net.IPNet{*ipnet},
+	}
+}
+
+func TestTunnel(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	a, b := New(t), New(t)
+	defer a.Close()
+	defer b.Close()
+	RequireWireguard(t, a)
+	require.NoError(t, Veth(a, "veth0", "192.168.100.1/24", b, "veth0", "192.168.100.2/24"))
+
+	keyA, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	keyB, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	cfgA := tunnelConfig(t, keyA, "10.0.0.1", 51820, keyB, "10.0.0.2", "192.168.100.2:51820")
+	cfgB := tunnelConfig(t, keyB, "10.0.0.2", 51820, keyA, "10.0.0.1", "192.168.100.1:51820")
+
+	clA, err := a.Client()
+	require.NoError(t, err)
+	clB, err := b.Client()
+	require.NoError(t, err)
+	require.NoError(t, a.Do(func() error { return clA.Up(cfgA, "wg0", log) }))
+	require.NoError(t, b.Do(func() error { return clB.Up(cfgB, "wg0", log) }))
+
+	var conn net.PacketConn
+	require.NoError(t, b.Do(func() (err error) {
+		conn, err = net.ListenPacket("udp", "10.0.0.2:9000")
+		return err
+	}))
+	defer conn.Close()
+	require.NoError(t, a.Do(func() error {
+		c, err := net.Dial("udp", "10.0.0.2:9000")
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		_, err = c.Write([]byte("ping"))
+		return err
+	}))
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 16)
+	n, from, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf[:n]))
+	assert.Equal(t, "10.0.0.1", from.(*net.UDPAddr).IP.String())
+
+	require.NoError(t, a.Do(func() error { return clA.Down(cfgA, "wg0", log) }))
+	_, err = a.Netlink.LinkByName("wg0")
+	assert.Error(t, err)
+}
+
+func TestNetlinkNamespace(t *testing.T) {
+	a := New(t)
+	defer a.Close()
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = "veth0"
+	if err := a.Netlink.LinkAdd(&netlink.Veth{LinkAttrs: attrs, PeerName: "veth1"}); err != nil {
+		t.Skipf("cannot create veth link: %v", err)
+	}
+	link, err := a.Netlink.LinkByName("veth0")
+	require.NoError(t, err)
+	require.NoError(t, a.Netlink.LinkSetUp(link))
+
+	// the raw requests go to the handle's namespace, not the calling thread's one
+	n := wgquick.NewNetlink(a.Netlink, a.ns)
+	require.NoError(t, n.LinkSetGroup(link, 7))
+	require.NoError(t, a.Do(func() error {
+		out, err := exec.Command("ip", "-o", "link", "show", "veth0").Output()
+		if err == nil && !strings.Contains(string(out), " group 7 ") {
+			err = fmt.Errorf("group not set: %s", out)
+		}
+		return err
+	}))
+
+	_, ipnet, err := net.ParseCIDR("10.9.0.1/24")
+	require.NoError(t, err)
+	ipnet.IP = net.ParseIP("10.9.0.1")
+	require.NoError(t, n.AddrReplaceMetric(link, &netlink.Addr{IPNet: ipnet}, 300))
+	_, dst, err := net.ParseCIDR("10.8.0.0/16")
+	require.NoError(t, err)
+	require.NoError(t, n.RouteReplaceMTULock(&netlink.Route{LinkIndex: link.Attrs().Index, Dst: dst, Table: unix.RT_TABLE_MAIN, Type: unix.RTN_UNICAST, MTU: 1280}))
+
+	routes, err := a.Netlink.RouteList(link, netlink.FAMILY_V4)
+	require.NoError(t, err)
+	byDst := make(map[string]netlink.Route)
+	for _, rt := range routes {
+		byDst[rt.Dst.String()] = rt
+	}
+	assert.Equal(t, 300, byDst["10.9.0.0/24"].Priority)
+	assert.Equal(t, 1280, byDst["10.8.0.0/16"].MTU)
+}
+
+func TestWatchNetworkNamespace(t *testing.T) {
+	a := New(t)
+	defer a.Close()
+	w, ok := wgquick.NewNetlink(a.Netlink, a.ns).(wgquick.NetworkWatcher)
+	require.True(t, ok)
+	changes := make(chan int, 16)
+	done := make(chan struct{})
+	defer close(done)
+	require.NoError(t, w.WatchNetwork(changes, done))
+
+	// the link is only in the handle's namespace, the subscription in the calling thread's one wouldn't see it
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = "veth0"
+	if err := a.Netlink.LinkAdd(&netlink.Veth{LinkAttrs: attrs, PeerName: "veth1"}); err != nil {
+		t.Skipf("cannot create veth link: %v", err)
+	}
+	link, err := a.Netlink.LinkByName("veth0")
+	require.NoError(t, err)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case index := <-changes:
+			if index == link.Attrs().Index {
+				return
+			}
+		case <-timeout:
+			t.Fatal("no change of the namespace link")
+		}
+	}
+}
+
+func TestRouteReplaceBatch(t *testing.T) {
+	a := New(t)
+	defer a.Close()
+	lo, err := a.Netlink.LinkByName("lo")
+	require.NoError(t, err)
+
+	var routes []netlink.Route
+	for i := 0; i < 300; i++ {
+		routes = append(routes, netlink.Route{
+			LinkIndex: lo.Attrs().Index,
+			Dst:       &net.IPNet{IP: net.IPv4(10, 1, byte(i>>8), byte(i)), Mask: net.CIDRMask(32, 32)},
+			Table:     51820,
+			Protocol:  unix.RTPROT_STATIC,
+			Scope:     netlink.SCOPE_LINK,
+			Type:      unix.RTN_UNICAST,
+		})
+	}
+	// the gateway isn't reachable over the link
+	routes[200].Gw = net.ParseIP("192.0.2.1")
+	routes[200].Scope = netlink.SCOPE_UNIVERSE
+
+	errs := wgquick.NewNetlink(a.Netlink, a.ns).(wgquick.RouteBatcher).RouteReplaceBatch(routes)
+	require.Len(t, errs, len(routes))
+	for i, err := range errs {
+		if i == 200 {
+			assert.Equal(t, syscall.ENETUNREACH, err)
+			continue
+		}
+		assert.NoError(t, err, "route %d", i)
+	}
+	present, err := a.Netlink.RouteListFiltered(unix.AF_INET, &netlink.Route{Table: 51820}, netlink.RT_FILTER_TABLE)
+	require.NoError(t, err)
+	assert.Len(t, present, len(routes)-1, "the failed route doesn't stop the batch")
+}
+
+func TestSyncMultipath(t *testing.T) {
+	a := New(t)
+	defer a.Close()
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = "veth0"
+	if err := a.Netlink.LinkAdd(&netlink.Veth{LinkAttrs: attrs, PeerName: "veth1"}); err != nil {
+		t.Skipf("cannot create veth link: %v", err)
+	}
+	for _, name := range []string{"veth0", "veth1"} {
+		link, err := a.Netlink.LinkByName(name)
+		require.NoError(t, err)
+		require.NoError(t, a.Netlink.LinkSetUp(link))
+	}
+	replaced := 0
+	c, err := wgquick.NewClient(wgquick.WithNetlinkHandle(a.Netlink, a.ns), wgquick.WithAuditSink(wgquick.AuditFunc(func(e wgquick.AuditEvent) {
+		if e.Op == "replace route" {
+			replaced++
+		}
+	})))
+	require.NoError(t, err)
+	defer c.Close()
+	log := logrus.New()
+	log.Out = ioutil.Discard
+
+	_, dst, err := net.ParseCIDR("10.50.0.0/16")
+	require.NoError(t, err)
+	mp := wgquick.Multipath{
+		Dsts:     []net.IPNet{*dst},
+		Nexthops: []wgquick.MultipathNexthop{{Iface: "veth0", Weight: 3}, {Iface: "veth1"}},
+		Table:    51820,
+		Metric:   10,
+	}
+	require.NoError(t, c.SyncMultipath(mp, log))
+	routes, err := a.Netlink.RouteListFiltered(unix.AF_INET, &netlink.Route{Table: 51820}, netlink.RT_FILTER_TABLE)
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	require.Len(t, routes[0].MultiPath, 2)
+	assert.Equal(t, 2, routes[0].MultiPath[0].Hops)
+	assert.Equal(t, 0, routes[0].MultiPath[1].Hops)
+
+	require.NoError(t, c.SyncMultipath(mp, log))
+	assert.Equal(t, 1, replaced, "the present route isn't replaced again")
+	require.NoError(t, c.DeleteMultipath(mp, log))
+	routes, err = a.Netlink.RouteListFiltered(unix.AF_INET, &netlink.Route{Table: 51820}, netlink.RT_FILTER_TABLE)
+	require.NoError(t, err)
+	assert.Empty(t, routes)
+}
@@ -0,0 +1,211 @@
+package wgquick
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SyncError aggregates the errors of the failed sync phases
+type SyncError struct {
+	// Phases maps the phase name (e.g. "addresses", "routes") to its error
+	Phases map[string]error
+}
+
+func (e *SyncError) Error() string {
+	var names []string
+	for name := range e.Phases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		err := e.Phases[name]
+		if oe, ok := err.(*OpError); ok && oe.Phase == name {
+			// already prefixed with the phase
+			parts = append(parts, err.Error())
+			continue
+		}
+		parts = append(parts, name+": "+err.Error())
+	}
+	return "sync failed: " + strings.Join(parts, "; ")
+}
+
+// Unwrap returns the phase errors, so errors.Is and errors.As check all of them (Go 1.20+, see Is and As)
+func (e *SyncError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Phases {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Is reports whether any phase error matches the target, for errors.Is before Go 1.20 ignoring Unwrap() []error
+func (e *SyncError) Is(target error) bool {
+	return anyIs(e.Unwrap(), target)
+}
+
+// As finds the first phase error matching the target, for errors.As before Go 1.20 ignoring Unwrap() []error
+func (e *SyncError) As(target interface{}) bool {
+	return anyAs(e.Unwrap(), target)
+}
+
+// ItemsError aggregates the errors of the failed items of a sync phase with ContinueOnError
+type ItemsError struct {
+	// Items maps the item (e.g. "replace route 10.0.0.0/24") to its OpError
+	Items map[string]error
+}
+
+func (e *ItemsError) Error() string {
+	var names []string
+	for name := range e.Items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, e.Items[name].Error())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Unwrap returns the item errors, so errors.Is and errors.As check all of them (Go 1.20+, see Is and As)
+func (e *ItemsError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Items {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Is reports whether any item error matches the target, see SyncError.Is
+func (e *ItemsError) Is(target error) bool {
+	return anyIs(e.Unwrap(), target)
+}
+
+// As finds the first item error matching the target, see SyncError.As
+func (e *ItemsError) As(target interface{}) bool {
+	return anyAs(e.Unwrap(), target)
+}
+
+func anyIs(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyAs(errs []error, target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// itemErrors collects the errors of the failed items of a sync phase
+type itemErrors struct {
+	keepGoing bool
+	items     map[string]error
+}
+
+func (c *Client) newItemErrors() *itemErrors {
+	return &itemErrors{keepGoing: c.continueOnError}
+}
+
+// add records the error of the operation on the subject. It returns the error back as OpError unless the phase continues
+// past the failed items.
+func (e *itemErrors) add(op, subject string, err error) error {
+	err = &OpError{Op: op, Subject: subject, Err: err}
+	if !e.keepGoing {
+		return err
+	}
+	if e.items == nil {
+		e.items = make(map[string]error)
+	}
+	e.items[op+" "+subject] = err
+	return nil
+}
+
+// err returns the ItemsError of the recorded errors, if any
+func (e *itemErrors) err() error {
+	if len(e.items) == 0 {
+		return nil
+	}
+	return &ItemsError{Items: e.items}
+}
+
+type syncPhase struct {
+	name string
+	run  func() error
+}
+
+// in returns the phase attaching the interface and the phase name to its error, see OpError
+func (p syncPhase) in(iface string) syncPhase {
+	return syncPhase{name: p.name, run: func() error { return opContext(p.run(), iface, p.name) }}
+}
+
+// then returns the phase running p and next in sequence
+func (p syncPhase) then(next syncPhase) syncPhase {
+	return syncPhase{name: p.name + "+" + next.name, run: func() error {
+		if err := p.run(); err != nil {
+			return err
+		}
+		return next.run()
+	}}
+}
+
+// runPhases runs the phases in order, stopping on the first error. With ParallelSync they run concurrently and all the errors are returned as SyncError.
+// With ContinueOnError they run in order past the failed ones, the errors are returned as SyncError too.
+func (c *Client) runPhases(phases []syncPhase) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = make(map[string]error)
+	)
+	if !c.parallel {
+		for _, p := range phases {
+			if err := p.run(); err != nil {
+				if !c.continueOnError {
+					return err
+				}
+				errs[p.name] = err
+			}
+		}
+		if len(errs) > 0 {
+			return &SyncError{Phases: errs}
+		}
+		return nil
+	}
+
+	for _, p := range phases {
+		wg.Add(1)
+		go func(p syncPhase) {
+			defer wg.Done()
+			if err := p.run(); err != nil {
+				mu.Lock()
+				errs[p.name] = err
+				mu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return &SyncError{Phases: errs}
+	}
+	return nil
+}
+
+// routesNeedAddresses reports whether some routes have the gateway which is only reachable via the interface addresses
+func (cfg *Config) routesNeedAddresses() bool {
+	for _, rt := range cfg.Routes {
+		if rt.Gateway != nil && !rt.OnLink {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package wgquick
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPhases(t *testing.T) {
+	var ran int32
+	phases := []syncPhase{
+		{name: "addresses", run: func() error { atomic.AddInt32(&ran, 1); return errors.New("boom") }},
+		{name: "routes", run: func() error { atomic.AddInt32(&ran, 1); return nil }},
+		{name: "rules", run: func() error { atomic.AddInt32(&ran, 1); return errors.New("bang") }},
+	}
+
+	c := &Client{}
+	assert.EqualError(t, c.runPhases(phases), "boom")
+	assert.Equal(t, int32(1), ran)
+
+	ran = 0
+	c.parallel = true
+	err := c.runPhases(phases)
+	require.Error(t, err)
+	assert.Equal(t, int32(3), ran)
+	assert.Len(t, err.(*SyncError).Phases, 2)
+	assert.Equal(t, "sync failed: addresses: boom; rules: bang", err.Error())
+}
+
+func TestSyncErrorIs(t *testing.T) {
+	opErr := &OpError{Op: "replace route", Phase: "routes", Err: os.ErrExist}
+	err := &SyncError{Phases: map[string]error{
+		"addresses": errors.New("boom"),
+		"routes":    &ItemsError{Items: map[string]error{"replace route 10.0.0.0/24": opErr}},
+	}}
+	// the methods errors.Is and errors.As call before Go 1.20, which don't unwrap the multi-errors themselves
+	assert.True(t, err.Is(os.ErrExist))
+	assert.False(t, err.Is(os.ErrNotExist))
+	var target *OpError
+	require.True(t, err.As(&target))
+	assert.Equal(t, opErr, target)
+	assert.True(t, errors.Is(err, os.ErrExist))
+}
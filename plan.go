@@ -0,0 +1,122 @@
+package wgquick
+
+import (
+	"encoding/json"
+	"net"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// PlanVersion is the version of the Plan JSON schema, bumped on the incompatible changes only
+const PlanVersion = 1
+
+// PlanOp is the kind of the planned operation
+type PlanOp string
+
+// The planned operations
+const (
+	PlanAdd    PlanOp = "add"
+	PlanRemove PlanOp = "remove"
+	PlanChange PlanOp = "change"
+)
+
+// The objects of the planned operations
+const (
+	PlanInterface = "interface"
+	PlanAddress   = "address"
+	PlanDNS       = "dns"
+	PlanRoute     = "route"
+	PlanPeer      = "peer"
+	PlanAllowedIP = "allowed-ip"
+)
+
+// PlanItem is a single planned operation. Name identifies the object: the address, DNS server or route in CIDR notation,
+// the base64 public key of the peer, empty for the interface. The field changes name the Field. Before is empty for
+// the added objects and the unset fields, After for the removed ones. Secrets are never included, see ConfigDiff.
+type PlanItem struct {
+	Op     PlanOp `json:"op"`
+	Object string `json:"object"`
+	Name   string `json:"name,omitempty"`
+	// Peer is the public key of the peer owning the allowed IP
+	Peer   string `json:"peer,omitempty"`
+	Field  string `json:"field,omitempty"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// Plan is the list of the operations applying the diff in the stable JSON schema, e.g. for the configuration management
+// tools rendering and gating the changes
+type Plan struct {
+	Version    int        `json:"version"`
+	Operations []PlanItem `json:"operations"`
+}
+
+// Plan returns the operations applying the diff, in the order of the diff
+func (d *ConfigDiff) Plan() *Plan {
+	p := &Plan{Version: PlanVersion, Operations: []PlanItem{}}
+	add := func(item PlanItem) {
+		p.Operations = append(p.Operations, item)
+	}
+	for _, c := range d.Interface {
+		add(PlanItem{Op: PlanChange, Object: PlanInterface, Field: c.Field, Before: c.Old, After: c.New})
+	}
+	ipNets := func(object string, nets []net.IPNet, op PlanOp) {
+		for _, n := range nets {
+			add(planValue(op, PlanItem{Object: object, Name: n.String()}, n.String()))
+		}
+	}
+	ipNets(PlanAddress, d.AddressesAdded, PlanAdd)
+	ipNets(PlanAddress, d.AddressesRemoved, PlanRemove)
+	ips := func(ips []net.IP, op PlanOp) {
+		for _, ip := range ips {
+			add(planValue(op, PlanItem{Object: PlanDNS, Name: ip.String()}, ip.String()))
+		}
+	}
+	ips(d.DNSAdded, PlanAdd)
+	ips(d.DNSRemoved, PlanRemove)
+	ipNets(PlanRoute, d.RoutesAdded, PlanAdd)
+	ipNets(PlanRoute, d.RoutesRemoved, PlanRemove)
+
+	for _, peer := range d.PeersAdded {
+		key := serializeKey(&peer.PublicKey)
+		add(PlanItem{Op: PlanAdd, Object: PlanPeer, Name: key})
+		for _, c := range diffPeer(wgtypes.PeerConfig{}, peer).Changes {
+			add(PlanItem{Op: PlanChange, Object: PlanPeer, Name: key, Field: c.Field, Before: c.Old, After: c.New})
+		}
+		allowedIPs(add, key, peer.AllowedIPs, PlanAdd)
+	}
+	for _, peer := range d.PeersRemoved {
+		add(PlanItem{Op: PlanRemove, Object: PlanPeer, Name: serializeKey(&peer.PublicKey)})
+	}
+	for _, pd := range d.PeersChanged {
+		key := serializeKey(&pd.PublicKey)
+		for _, c := range pd.Changes {
+			add(PlanItem{Op: PlanChange, Object: PlanPeer, Name: key, Field: c.Field, Before: c.Old, After: c.New})
+		}
+		allowedIPs(add, key, pd.AllowedIPsAdded, PlanAdd)
+		allowedIPs(add, key, pd.AllowedIPsRemoved, PlanRemove)
+	}
+	return p
+}
+
+func allowedIPs(add func(PlanItem), peer string, nets []net.IPNet, op PlanOp) {
+	for _, n := range nets {
+		add(planValue(op, PlanItem{Object: PlanAllowedIP, Name: n.String(), Peer: peer}, n.String()))
+	}
+}
+
+// planValue sets the operation and the value as Before of the removal or After of the addition
+func planValue(op PlanOp, item PlanItem, value string) PlanItem {
+	item.Op = op
+	if op == PlanRemove {
+		item.Before = value
+	} else {
+		item.After = value
+	}
+	return item
+}
+
+// MarshalJSON encodes the diff as its Plan
+func (d *ConfigDiff) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Plan())
+}
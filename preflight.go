@@ -0,0 +1,102 @@
+package wgquick
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// PreflightError lists the missing prerequisites found before making any change
+type PreflightError struct {
+	Problems []string
+}
+
+func (e *PreflightError) Error() string {
+	return "preflight check failed: " + strings.Join(e.Problems, "; ")
+}
+
+// procStatus is read for the process capabilities
+const procStatus = "/proc/self/status"
+
+// Preflight checks the prerequisites of Up: CAP_NET_ADMIN for the netlink calls, resolvconf if cfg.DNS is set
+// and resolvectl for the systemd-resolved options. Up and Sync also check NetworkManager manages the existing link.
+// It returns PreflightError with actionable problems instead of the raw EPERM from the middle of the sync.
+// Up, Down and Sync run it when the client uses the kernel netlink (i.e. not a fake one).
+func (c *Client) Preflight(cfg *Config) error {
+	return c.preflight(cfg, "", len(cfg.DNS) > 0 || cfg.resolved())
+}
+
+// preflight checks the prerequisites, the ones of the existing link too if iface is set
+func (c *Client) preflight(cfg *Config, iface string, dns bool) error {
+	if !c.kernelNetlink() {
+		return nil
+	}
+	var problems []string
+	status, err := ioutil.ReadFile(procStatus)
+	if err == nil {
+		var ok bool
+		ok, err = hasCapability(status, unix.CAP_NET_ADMIN)
+		if err == nil && !ok {
+			problems = append(problems, "need CAP_NET_ADMIN to configure the network, run as root")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot check capabilities: %w", err)
+	}
+	if dns && cfg.resolved() {
+		if _, err := exec.LookPath("resolvectl"); err != nil {
+			problems = append(problems, "need resolvectl in PATH to set the systemd-resolved options")
+		}
+	}
+	if dns && len(cfg.DNS) > 0 && cfg.dnsBackend() == DNSBackendResolved {
+		if _, err := exec.LookPath("resolvectl"); err != nil {
+			problems = append(problems, "need resolvectl in PATH to set DNS with systemd-resolved")
+		}
+	}
+	if dns && len(cfg.DNS) > 0 && cfg.dnsBackend() == DNSBackendNetworkManager {
+		if _, err := exec.LookPath("nmcli"); err != nil {
+			problems = append(problems, "need nmcli in PATH to set DNS with NetworkManager")
+		} else if iface != "" {
+			// the link Up creates is checked once it exists, see setLinkDNS
+			if _, err := c.nl.LinkByName(iface); err == nil {
+				if err := nmcliManaged(iface); err != nil {
+					problems = append(problems, err.Error())
+				}
+			}
+		}
+	}
+	if dns && len(cfg.DNS) > 0 && cfg.dnsBackend() == DNSBackendResolvconf {
+		if bin := cfg.resolvconfBinary(); bin != "" {
+			if _, err := exec.LookPath(bin); err != nil {
+				problems = append(problems, fmt.Sprintf("need %s in PATH to set DNS, install it or set DNS in PostUp instead", bin))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &PreflightError{Problems: problems}
+	}
+	return nil
+}
+
+// hasCapability reports whether the effective capabilities in /proc/<pid>/status content include cap
+func hasCapability(status []byte, cap uint) (bool, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(status))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != "CapEff:" {
+			continue
+		}
+		caps, err := strconv.ParseUint(fields[1], 16, 64)
+		if err != nil {
+			return false, fmt.Errorf("cannot parse CapEff: %w", err)
+		}
+		return caps&(1<<cap) != 0, nil
+	}
+	return false, fmt.Errorf("no CapEff in process status")
+}
@@ -0,0 +1,24 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestHasCapability(t *testing.T) {
+	root := []byte("Name:\twg-quick\nCapInh:\t0000000000000000\nCapPrm:\t000001ffffffffff\nCapEff:\t000001ffffffffff\n")
+	ok, err := hasCapability(root, unix.CAP_NET_ADMIN)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	user := []byte("Name:\twg-quick\nCapEff:\t0000000000000000\n")
+	ok, err = hasCapability(user, unix.CAP_NET_ADMIN)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = hasCapability([]byte("Name:\twg-quick\n"), unix.CAP_NET_ADMIN)
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package wgquick
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ProbeTimeout is how long Probe waits for every echo reply
+const ProbeTimeout = time.Second
+
+// ProbeResult is the outcome of the connectivity probe
+type ProbeResult struct {
+	Addr     net.IP
+	Sent     int
+	Received int
+	// RTT is the average round trip time of the received replies
+	RTT time.Duration
+}
+
+// Reachable reports whether any probe was answered
+func (r *ProbeResult) Reachable() bool {
+	return r.Received > 0
+}
+
+// Probe sends count ICMP echo requests to addr one after another, e.g. to the peer tunnel address after Up, telling
+// whether the traffic actually flows rather than just the handshake succeeded. The unanswered probes aren't an error,
+// see ProbeResult.Reachable. It uses the unprivileged ICMP socket if net.ipv4.ping_group_range allows it, the raw one
+// (needing CAP_NET_RAW) otherwise.
+func Probe(ctx context.Context, addr net.IP, count int) (*ProbeResult, error) {
+	conn, dst, proto, err := listenICMP(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if proto == ipv6ICMPProto {
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+
+	res := &ProbeResult{Addr: addr}
+	id := os.Getpid() & 0xffff
+	var total time.Duration
+	buf := make([]byte, 1500)
+	for seq := 0; seq < count; seq++ {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		msg := icmp.Message{Type: echoType, Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("wg-quick-go probe")}}
+		b, err := msg.Marshal(nil)
+		if err != nil {
+			return res, err
+		}
+		start := time.Now()
+		if _, err := conn.WriteTo(b, dst); err != nil {
+			return res, err
+		}
+		res.Sent++
+		deadline := start.Add(ProbeTimeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return res, err
+		}
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return res, err
+			}
+			// the socket gets the replies to the other probes of this process too, e.g. the concurrent ones
+			if !isFrom(from, addr) {
+				continue
+			}
+			reply, err := icmp.ParseMessage(proto, buf[:n])
+			if err != nil || reply.Type != replyType {
+				continue
+			}
+			// the unprivileged socket replaces the ID with its port, so the replies are matched by the sequence only
+			echo, ok := reply.Body.(*icmp.Echo)
+			if !ok || echo.Seq != seq {
+				continue
+			}
+			total += time.Since(start)
+			res.Received++
+			break
+		}
+	}
+	if res.Received > 0 {
+		res.RTT = total / time.Duration(res.Received)
+	}
+	return res, nil
+}
+
+// isFrom reports whether the packet source is the address, the unprivileged socket reports it as UDPAddr, the raw one
+// as IPAddr
+func isFrom(from net.Addr, addr net.IP) bool {
+	switch a := from.(type) {
+	case *net.UDPAddr:
+		return a.IP.Equal(addr)
+	case *net.IPAddr:
+		return a.IP.Equal(addr)
+	}
+	return false
+}
+
+const (
+	ipv4ICMPProto = 1
+	ipv6ICMPProto = 58
+)
+
+// listenICMP opens the unprivileged ICMP socket for the address family, falling back to the raw one
+func listenICMP(addr net.IP) (conn *icmp.PacketConn, dst net.Addr, proto int, err error) {
+	network, raw, laddr, proto := "udp4", "ip4:icmp", "0.0.0.0", ipv4ICMPProto
+	if addr.To4() == nil {
+		network, raw, laddr, proto = "udp6", "ip6:ipv6-icmp", "::", ipv6ICMPProto
+	}
+	if conn, err = icmp.ListenPacket(network, laddr); err == nil {
+		return conn, &net.UDPAddr{IP: addr}, proto, nil
+	}
+	if conn, err = icmp.ListenPacket(raw, laddr); err == nil {
+		return conn, &net.IPAddr{IP: addr}, proto, nil
+	}
+	return nil, nil, 0, fmt.Errorf("cannot open ICMP socket: %w", err)
+}
+
+// ProbePeer probes the peer at its first host AllowedIP (/32 or /128), i.e. its tunnel address. See Probe
+func ProbePeer(ctx context.Context, peer wgtypes.PeerConfig, count int) (*ProbeResult, error) {
+	addr := peerTunnelAddress(peer)
+	if addr == nil {
+		return nil, fmt.Errorf("peer %s has no host AllowedIPs to probe", peer.PublicKey)
+	}
+	return Probe(ctx, addr, count)
+}
+
+func peerTunnelAddress(peer wgtypes.PeerConfig) net.IP {
+	for _, ipnet := range peer.AllowedIPs {
+		if ones, bits := ipnet.Mask.Size(); ones == bits {
+			return ipnet.IP
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package wgquick
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestProbe(t *testing.T) {
+	conn, _, _, err := listenICMP(net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Skipf("no ICMP socket: %v", err)
+	}
+	conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := Probe(ctx, net.IPv4(127, 0, 0, 1), 3)
+	require.NoError(t, err)
+	assert.True(t, res.Reachable())
+	assert.Equal(t, 3, res.Sent)
+	assert.Equal(t, 3, res.Received)
+	assert.NotZero(t, res.RTT)
+}
+
+func TestIsFrom(t *testing.T) {
+	addr := net.ParseIP("10.0.0.2")
+	assert.True(t, isFrom(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2)}, addr))
+	assert.True(t, isFrom(&net.IPAddr{IP: net.IPv4(10, 0, 0, 2)}, addr))
+	assert.False(t, isFrom(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 3)}, addr))
+	assert.False(t, isFrom(nil, addr))
+}
+
+func TestPeerTunnelAddress(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("192.168.0.0/16")
+	require.NoError(t, err)
+	_, host, err := net.ParseCIDR("10.0.0.2/32")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", peerTunnelAddress(wgtypes.PeerConfig{AllowedIPs: []net.IPNet{*subnet, *host}}).String())
+	assert.Nil(t, peerTunnelAddress(wgtypes.PeerConfig{AllowedIPs: []net.IPNet{*subnet}}))
+
+	_, err = ProbePeer(context.Background(), wgtypes.PeerConfig{AllowedIPs: []net.IPNet{*subnet}}, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,171 @@
+package wgquick
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The profile bundle is the document with several named tunnel configs, each starting with the `[Profile <name>]`
+// header followed by its [Interface] and [Peer] sections, e.g.
+//
+//	[Profile office]
+//	[Interface]
+//	...
+//	[Peer]
+//	...
+//
+//	[Profile home]
+//	[Interface]
+//	...
+//
+// Only the comments and blank lines may precede the first profile, they're dropped.
+
+// profileHeaderRegexp matches the trimmed profile header line
+var profileHeaderRegexp = regexp.MustCompile(`^\[Profile\s+(\S.*?)\s*\]$`)
+
+// Profile is the named config of the profile bundle
+type Profile struct {
+	Name   string
+	Config *Config
+}
+
+// profileText is the text of the bundle profile
+type profileText struct {
+	name string
+	text []byte
+	// line is the 0-based bundle line the profile text starts at
+	line int
+}
+
+// splitProfiles splits the bundle into the profile texts, in the order of the bundle
+func splitProfiles(text []byte) ([]profileText, error) {
+	if len(text) > MaxConfigSize {
+		return nil, fmt.Errorf("config is %d bytes, exceeding the %d bytes limit", len(text), MaxConfigSize)
+	}
+	lines := strings.Split(string(text), "\n")
+	var profiles []profileText
+	seen := make(map[string]bool)
+	start := -1
+	finish := func(end int) {
+		if start < 0 {
+			return
+		}
+		p := &profiles[len(profiles)-1]
+		p.text = []byte(strings.Join(lines[start:end], "\n"))
+		if end < len(lines) {
+			p.text = append(p.text, '\n')
+		}
+	}
+	for no, line := range lines {
+		ln := strings.TrimSpace(line)
+		m := profileHeaderRegexp.FindStringSubmatch(ln)
+		if m == nil {
+			if start < 0 && ln != "" && ln[0] != '#' {
+				return nil, fmt.Errorf("[line %d]: expected [Profile <name>] header", no+1)
+			}
+			continue
+		}
+		if seen[m[1]] {
+			return nil, fmt.Errorf("[line %d]: duplicate profile %s", no+1, m[1])
+		}
+		seen[m[1]] = true
+		finish(no)
+		profiles = append(profiles, profileText{name: m[1], line: no + 1})
+		start = no + 1
+	}
+	finish(len(lines))
+	return profiles, nil
+}
+
+// WithProfile makes Parse (and LoadConfig) read the profile bundle, parsing only the profile of the name. The line
+// numbers of the errors are the bundle ones.
+func WithProfile(name string) ParseOption {
+	return func(o *parseOptions) {
+		o.profile = name
+	}
+}
+
+func (cfg *Config) parseProfile(text []byte, options *parseOptions) error {
+	profiles, err := splitProfiles(text)
+	if err != nil {
+		return err
+	}
+	for _, p := range profiles {
+		if p.name != options.profile {
+			continue
+		}
+		sub := *options
+		sub.profile = ""
+		sub.lineOffset = p.line
+		if err := cfg.parse(p.text, &sub); err != nil {
+			return fmt.Errorf("profile %s: %w", p.name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no profile %s", options.profile)
+}
+
+// ParseProfiles parses all the profiles of the bundle with given options, in the order of the bundle
+func ParseProfiles(text []byte, opts ...ParseOption) ([]Profile, error) {
+	options := &parseOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	texts, err := splitProfiles(text)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]Profile, 0, len(texts))
+	for _, p := range texts {
+		sub := *options
+		sub.profile = ""
+		sub.lineOffset = p.line
+		cfg := &Config{}
+		if err := cfg.parse(p.text, &sub); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", p.name, err)
+		}
+		profiles = append(profiles, Profile{Name: p.name, Config: cfg})
+	}
+	return profiles, nil
+}
+
+// ProfileNames lists the profile names of the bundle without parsing the profiles
+func ProfileNames(text []byte) ([]string, error) {
+	texts, err := splitProfiles(text)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, p := range texts {
+		names = append(names, p.name)
+	}
+	return names, nil
+}
+
+// MarshalProfiles serializes the profile bundle. The profiles keep their comments and key ordering like MarshalText.
+func MarshalProfiles(profiles []Profile) ([]byte, error) {
+	out := &bytes.Buffer{}
+	seen := make(map[string]bool)
+	for i, p := range profiles {
+		if p.Name == "" || strings.ContainsAny(p.Name, "]\n") || p.Name != strings.TrimSpace(p.Name) {
+			return nil, fmt.Errorf("invalid profile name %q", p.Name)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("duplicate profile %s", p.Name)
+		}
+		seen[p.Name] = true
+		text, err := p.Config.MarshalText()
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		if i > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n\n")) {
+			out.WriteByte('\n')
+		}
+		out.WriteString("[Profile " + p.Name + "]\n")
+		out.Write(text)
+		zeroBytes(text)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,63 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBundle = `# appliance profiles
+[Profile office]
+[Interface]
+Address = 10.200.100.8/24
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+
+[Peer]
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+AllowedIPs = 0.0.0.0/0
+
+[Profile home]
+[Interface]
+Address = 10.192.122.1/24
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+`
+
+func TestProfiles(t *testing.T) {
+	names, err := ProfileNames([]byte(testBundle))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"office", "home"}, names)
+
+	cfg := &Config{}
+	require.NoError(t, cfg.Parse([]byte(testBundle), WithProfile("home")))
+	assert.Equal(t, "10.192.122.1/24", cfg.Address[0].String())
+	assert.Empty(t, cfg.Peers)
+	assert.Error(t, cfg.Parse([]byte(testBundle), WithProfile("cafe")))
+
+	profiles, err := ParseProfiles([]byte(testBundle))
+	require.NoError(t, err)
+	require.Len(t, profiles, 2)
+	assert.Equal(t, "office", profiles[0].Name)
+	assert.Len(t, profiles[0].Config.Peers, 1)
+
+	text, err := MarshalProfiles(profiles)
+	require.NoError(t, err)
+	assert.Equal(t, testBundle[len("# appliance profiles\n"):], string(text))
+}
+
+func TestProfileErrors(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.Parse([]byte("[Profile a]\n[Interface]\n\n[Profile b]\n[Interface]\nMTU = x\n"), WithProfile("b"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "profile b: [line 6]: MTU")
+
+	_, err = ParseProfiles([]byte("[Profile a]\n[Interface]\n[Profile a]\n"))
+	assert.Contains(t, err.Error(), "[line 3]: duplicate profile a")
+
+	_, err = ParseProfiles([]byte("[Interface]\n[Profile a]\n"))
+	assert.Contains(t, err.Error(), "[line 1]: expected [Profile <name>] header")
+
+	_, err = MarshalProfiles([]Profile{{Name: "bad]", Config: &Config{}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,64 @@
+package wgquick
+
+import "github.com/sirupsen/logrus"
+
+// Progress is reported as the sync phases and their items complete, see WithProgress
+type Progress struct {
+	Iface string
+	// Phase is the sync phase, e.g. "link", "device" or "routes"
+	Phase string
+	// Op and Item describe the completed item of the phase, e.g. "replace route" and "10.0.0.0/24 table 254".
+	// They're empty when the whole phase completed.
+	Op   string
+	Item string
+	// Done counts the completed items of the phase out of Total, both are 0 when the whole phase completed
+	Done  int
+	Total int
+	// Err is the error of the item or the phase, nil if it succeeded
+	Err error
+}
+
+// ProgressFunc receives the sync progress. It's called synchronously by the sync, concurrently with ParallelSync.
+type ProgressFunc func(p Progress)
+
+// WithProgress reports the progress of Up, Sync and Reload to f as each phase and each address and route completes,
+// including the failures, e.g. for the UIs showing the long bring-ups.
+func WithProgress(f ProgressFunc) ClientOption {
+	return func(c *Client) {
+		c.progress = f
+	}
+}
+
+// phase returns the sync phase of the interface retried by the retry policy and reporting its completion, see WithProgress
+func (c *Client) phase(p syncPhase, iface string, log logrus.FieldLogger) syncPhase {
+	p = c.retrying(p.in(iface), log)
+	if c.progress == nil {
+		return p
+	}
+	return syncPhase{name: p.name, run: func() error {
+		err := p.run()
+		c.progress(Progress{Iface: iface, Phase: p.name, Err: err})
+		return err
+	}}
+}
+
+// itemProgress reports the completed items of a sync phase
+type itemProgress struct {
+	report ProgressFunc
+	iface  string
+	phase  string
+	done   int
+	total  int
+}
+
+func (c *Client) newItemProgress(iface, phase string, total int) *itemProgress {
+	return &itemProgress{report: c.progress, iface: iface, phase: phase, total: total}
+}
+
+// item reports the completed item
+func (p *itemProgress) item(op, item string, err error) {
+	p.done++
+	if p.report != nil {
+		p.report(Progress{Iface: p.iface, Phase: p.phase, Op: op, Item: item, Done: p.done, Total: p.total, Err: err})
+	}
+}
@@ -0,0 +1,41 @@
+package wgquick_test
+
+import (
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress(t *testing.T) {
+	var progress []wgquick.Progress
+	c, _, _ := newFakeClient(t, wgquick.WithProgress(func(p wgquick.Progress) {
+		progress = append(progress, p)
+	}))
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+
+	var phases []string
+	var routes []wgquick.Progress
+	for _, p := range progress {
+		assert.Equal(t, "wg0", p.Iface)
+		assert.NoError(t, p.Err)
+		switch {
+		case p.Op == "":
+			phases = append(phases, p.Phase)
+		case p.Phase == "routes":
+			routes = append(routes, p)
+		}
+	}
+	assert.Equal(t, []string{"dns", "link", "device", "addresses", "routes", "rules", "proxy"}, phases)
+	require.Len(t, routes, 4)
+	for i, p := range routes {
+		assert.Equal(t, "replace route", p.Op)
+		assert.Equal(t, i+1, p.Done)
+		assert.Equal(t, 4, p.Total)
+	}
+}
@@ -0,0 +1,84 @@
+package wgquick
+
+import (
+	"net"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// proxyNeighbors returns the peer host AllowedIPs to proxy on ProxyDevice, none without it
+func (cfg *Config) proxyNeighbors() []net.IP {
+	if cfg.ProxyDevice == "" {
+		return nil
+	}
+	var ips []net.IP
+	for _, dst := range cfg.managedRoutes() {
+		if ones, bits := dst.Mask.Size(); ones == bits {
+			ips = append(ips, dst.IP)
+		}
+	}
+	return ips
+}
+
+func proxyNeigh(link netlink.Link, ip net.IP) *netlink.Neigh {
+	return &netlink.Neigh{LinkIndex: link.Attrs().Index, IP: ip, Flags: netlink.NTF_PROXY}
+}
+
+// syncProxyNeighbors installs the proxy entries of the config, deleting the ones recorded in the previous state but no longer wanted
+func (c *Client) syncProxyNeighbors(cfg *Config, prev *State, log logrus.FieldLogger) error {
+	wanted := cfg.proxyNeighbors()
+	errs := c.newItemErrors()
+	if len(wanted) > 0 {
+		link, err := c.nl.LinkByName(cfg.ProxyDevice)
+		if err != nil {
+			log.WithError(err).WithField("device", cfg.ProxyDevice).Error("cannot read proxy device")
+			return err
+		}
+		for _, ip := range wanted {
+			if err := c.nl.NeighSet(proxyNeigh(link, ip)); err != nil {
+				log.WithError(err).WithField("ip", ip).Error("cannot add proxy neighbor")
+				if err := errs.add("add proxy neighbor", ip.String(), err); err != nil {
+					return err
+				}
+			}
+		}
+		log.WithField("device", cfg.ProxyDevice).WithField("count", len(wanted)).Debug("added proxy neighbors")
+	}
+	if prev == nil {
+		return errs.err()
+	}
+	present := make(map[string]bool, len(wanted))
+	if prev.ProxyDevice == cfg.ProxyDevice {
+		for _, ip := range wanted {
+			present[ip.String()] = true
+		}
+	}
+	var stale []net.IP
+	for _, s := range prev.ProxyNeighbors {
+		if !present[s] {
+			stale = append(stale, net.ParseIP(s))
+		}
+	}
+	c.deleteProxyNeighbors(prev.ProxyDevice, stale, log)
+	return errs.err()
+}
+
+// deleteProxyNeighbors deletes the proxy entries, logging the failures, e.g. if the device is gone
+func (c *Client) deleteProxyNeighbors(device string, ips []net.IP, log logrus.FieldLogger) {
+	if len(ips) == 0 {
+		return
+	}
+	link, err := c.nl.LinkByName(device)
+	if err != nil {
+		log.WithError(err).WithField("device", device).Warn("cannot read proxy device")
+		return
+	}
+	for _, ip := range ips {
+		if err := c.nl.NeighDel(proxyNeigh(link, ip)); err != nil {
+			log.WithError(err).WithField("ip", ip).Warn("cannot delete proxy neighbor")
+			continue
+		}
+		log.WithField("ip", ip).Info("deleted proxy neighbor")
+	}
+}
@@ -0,0 +1,66 @@
+package wgquick_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+)
+
+func TestProxyNeighbors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sysctl := filepath.Join(dir, "sys/net/ipv6/conf/eth0/proxy_ndp")
+	require.NoError(t, os.MkdirAll(filepath.Dir(sysctl), 0755))
+	require.NoError(t, ioutil.WriteFile(sysctl, []byte("0\n"), 0644))
+	c, nl, _ := newFakeClient(t, wgquick.WithStateDir(dir), wgquick.WithSysctlDir(filepath.Join(dir, "sys")))
+	defer c.Close()
+	require.NoError(t, nl.LinkAdd(&netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}, LinkType: "device"}))
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.ProxyDevice = "eth0"
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	neighs := nl.Neighs()
+	require.Len(t, neighs, 2, "only the host AllowedIPs are proxied")
+	assert.Equal(t, "10.192.122.3", neighs[0].IP.String())
+	assert.Equal(t, netlink.NTF_PROXY, neighs[0].Flags)
+	b, err := ioutil.ReadFile(sysctl)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", string(b))
+
+	cfg.Peers = cfg.Peers[1:]
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+	neighs = nl.Neighs()
+	require.Len(t, neighs, 1)
+	assert.Equal(t, "10.192.122.4", neighs[0].IP.String())
+
+	require.NoError(t, c.Down(cfg, "wg0", testLog))
+	assert.Empty(t, nl.Neighs())
+	b, err = ioutil.ReadFile(sysctl)
+	require.NoError(t, err)
+	assert.Equal(t, "0\n", string(b))
+}
+
+func TestProxyNeighborsParallelSync(t *testing.T) {
+	c, nl, _ := newFakeClient(t, wgquick.ParallelSync())
+	defer c.Close()
+	require.NoError(t, nl.LinkAdd(&netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}, LinkType: "device"}))
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.ProxyDevice = "eth0"
+	// the gateway route makes the routes wait for the addresses, the proxy phase still runs
+	_, dst, err := net.ParseCIDR("10.50.0.0/16")
+	require.NoError(t, err)
+	cfg.Routes = []wgquick.Route{{Dst: *dst, Gateway: net.ParseIP("10.192.122.3")}}
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	assert.Len(t, nl.Neighs(), 2)
+}
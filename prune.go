@@ -0,0 +1,89 @@
+package wgquick
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// DefaultPruneInterval is the stale peer pruner interval when none is specified
+const DefaultPruneInterval = time.Minute
+
+// StalePeers returns the device peers with the last handshake older than maxAge. The peers without any handshake are
+// never stale, their age is unknown; a freshly provisioned peer mustn't be pruned before it had a chance to connect.
+func (c *Client) StalePeers(iface string, maxAge time.Duration) ([]wgtypes.Key, error) {
+	cl, err := c.wgctrl()
+	if err != nil {
+		return nil, err
+	}
+	dev, err := cl.Device(iface)
+	if err != nil {
+		return nil, err
+	}
+	var stale []wgtypes.Key
+	for _, p := range dev.Peers {
+		if !p.LastHandshakeTime.IsZero() && time.Since(p.LastHandshakeTime) > maxAge {
+			stale = append(stale, p.PublicKey)
+		}
+	}
+	return stale, nil
+}
+
+// PruneStalePeers removes the peers with the last handshake older than maxAge from the device together with their routes,
+// e.g. on the servers with the dynamically provisioned ephemeral clients. The pruned peers are also removed from cfg,
+// so the next Sync doesn't add them back; cfg is the config the interface was synced with. It returns the pruned peers.
+func (c *Client) PruneStalePeers(cfg *Config, iface string, maxAge time.Duration, log logrus.FieldLogger) ([]wgtypes.Key, error) {
+	stale, err := c.StalePeers(iface, maxAge)
+	if err != nil || len(stale) == 0 {
+		return nil, err
+	}
+	pruned := cfg.clone()
+	pruned.ReplacePeers = false
+	for _, key := range stale {
+		pruned.RemovePeer(key)
+		log.WithField("peer", cfg.PeerLabel(key)).Info("pruning stale peer")
+	}
+	if err := c.Reload(pruned, iface, log); err != nil {
+		return nil, err
+	}
+
+	removed := make(map[wgtypes.Key]bool, len(stale))
+	for _, key := range stale {
+		removed[key] = true
+		delete(cfg.PeerNames, key)
+	}
+	peers := cfg.Peers[:0]
+	for _, p := range cfg.Peers {
+		if !removed[p.PublicKey] {
+			peers = append(peers, p)
+		}
+	}
+	cfg.Peers = peers
+	return stale, nil
+}
+
+// RunStalePeerPruner prunes the stale peers every interval until the context is done, see PruneStalePeers.
+// The interval is DefaultPruneInterval if 0. A failed prune is logged and retried on the next interval. The caller mustn't
+// sync cfg concurrently.
+func (c *Client) RunStalePeerPruner(ctx context.Context, cfg *Config, iface string, maxAge, interval time.Duration, log logrus.FieldLogger) error {
+	if interval == 0 {
+		interval = DefaultPruneInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		pruned, err := c.PruneStalePeers(cfg, iface, maxAge, log)
+		if err != nil {
+			log.WithError(err).Error("cannot prune stale peers")
+		} else if len(pruned) > 0 {
+			log.WithField("peers", len(pruned)).Info("pruned stale peers")
+		}
+	}
+}
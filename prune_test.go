@@ -0,0 +1,43 @@
+package wgquick_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestPruneStalePeers(t *testing.T) {
+	c, nl, wg := newFakeClient(t)
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	assert.Len(t, nl.Routes(), 4)
+	stale, fresh := cfg.Peers[0].PublicKey, cfg.Peers[1].PublicKey
+
+	pruned, err := c.PruneStalePeers(cfg, "wg0", time.Minute, testLog)
+	require.NoError(t, err)
+	assert.Empty(t, pruned, "the peers without handshake are kept")
+
+	require.NoError(t, wg.SetLastHandshake("wg0", stale, time.Now().Add(-time.Hour)))
+	require.NoError(t, wg.SetLastHandshake("wg0", fresh, time.Now()))
+	pruned, err = c.PruneStalePeers(cfg, "wg0", time.Minute, testLog)
+	require.NoError(t, err)
+	assert.Equal(t, []wgtypes.Key{stale}, pruned)
+	require.Len(t, cfg.Peers, 1)
+	assert.Equal(t, fresh, cfg.Peers[0].PublicKey)
+
+	dev, err := wg.Device("wg0")
+	require.NoError(t, err)
+	require.Len(t, dev.Peers, 1)
+	assert.Equal(t, fresh, dev.Peers[0].PublicKey)
+	for _, rt := range nl.Routes() {
+		assert.NotEqual(t, "10.192.122.3/32", rt.Dst.String())
+	}
+	assert.Len(t, nl.Routes(), 2)
+}
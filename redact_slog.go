@@ -0,0 +1,58 @@
+//go:build go1.21
+// +build go1.21
+
+package wgquick
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+var _ slog.LogValuer = (*Config)(nil)
+var _ slog.LogValuer = Peer{}
+
+// LogValue implements slog.LogValuer, redacting the private and preshared keys
+func (cfg *Config) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("address", fmt.Sprint(cfg.Address)),
+		slog.String("dns", fmt.Sprint(cfg.DNS)),
+	}
+	if cfg.PrivateKey != nil {
+		pub := cfg.PrivateKey.PublicKey()
+		attrs = append(attrs,
+			slog.String("private_key", redacted),
+			slog.String("public_key", serializeKey(&pub)),
+		)
+	}
+	if cfg.ListenPort != nil {
+		attrs = append(attrs, slog.Int("listen_port", *cfg.ListenPort))
+	}
+	attrs = append(attrs,
+		slog.Int("mtu", cfg.MTU),
+		slog.String("table", cfg.Table.String()),
+	)
+	peers := make([]any, 0, len(cfg.Peers))
+	for _, p := range cfg.Peers {
+		peers = append(peers, slog.Any(cfg.PeerLabel(p.PublicKey), Peer(p)))
+	}
+	attrs = append(attrs, slog.Group("peers", peers...))
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue implements slog.LogValuer, redacting the preshared key
+func (p Peer) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("public_key", serializeKey(&p.PublicKey)),
+		slog.String("allowed_ips", fmt.Sprint(p.AllowedIPs)),
+	}
+	if p.Endpoint != nil {
+		attrs = append(attrs, slog.String("endpoint", p.Endpoint.String()))
+	}
+	if p.PresharedKey != nil {
+		attrs = append(attrs, slog.String("preshared_key", redacted))
+	}
+	if p.PersistentKeepaliveInterval != nil {
+		attrs = append(attrs, slog.Duration("persistent_keepalive", *p.PersistentKeepaliveInterval))
+	}
+	return slog.GroupValue(attrs...)
+}
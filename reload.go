@@ -0,0 +1,87 @@
+package wgquick
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// Reload applies the wireguard settings and the routes of the config to the existing interface, without touching the link,
+// addresses, DNS, rules, proxy neighbors or running the hooks. Mostly equivalent to `wg syncconf iface <(wg-quick strip iface)`
+// followed by the route update, it's the zero-downtime config refresh; unchanged peers keep their sessions. Like syncconf
+// it's authoritative: the device peers and allowed IPs missing in the config are removed, regardless of SetReplace.
+// The interface must be up already.
+func (c *Client) Reload(cfg *Config, iface string, logger logrus.FieldLogger) (err error) {
+	if c.zeroize {
+		defer cfg.Zeroize()
+	}
+	if err := c.preflight(cfg, iface, false); err != nil {
+		return err
+	}
+	unlock, err := c.lockIface(iface)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer func() { c.syncs.record(iface, err) }()
+	log := logger.WithField("iface", iface)
+	cfg = cfg.clone()
+	defer cfg.Zeroize()
+	cfg.FillDefaults()
+	cfg.SetReplace(true, true)
+
+	link, err := c.nl.LinkByName(iface)
+	if err != nil {
+		log.WithError(err).Error("cannot read link")
+		return err
+	}
+	prev, err := c.LoadState(iface)
+	if err != nil {
+		return err
+	}
+
+	device := syncPhase{name: "device", run: func() error { return c.SyncWireguardDevice(cfg, link, log) }}
+	if err := c.phase(device, iface, log).run(); err != nil {
+		log.WithError(err).Errorln("cannot sync wireguard device")
+		return err
+	}
+	log.Info("reloaded device")
+
+	var displaced []netlink.Route
+	if cfg.Table != TableOff {
+		if displaced, err = c.displacedRoutes(cfg, link); err != nil {
+			log.WithError(err).Errorln("cannot read displaced routes")
+			return err
+		}
+	}
+	routes := syncPhase{name: "routes", run: func() error {
+		if err := c.SyncRoutes(cfg, link, cfg.managedRoutes(), log); err != nil {
+			return err
+		}
+		return c.SyncLANBypass(cfg, link, log)
+	}}
+	if err := c.phase(routes, iface, log).run(); err != nil {
+		log.WithError(err).Errorln("cannot sync routes")
+		return err
+	}
+	log.Info("reloaded routes")
+
+	if err := c.recordState(iface, cfg, displaced, log); err != nil {
+		return err
+	}
+	if prev == nil {
+		return nil
+	}
+	// the untouched settings stay as applied before
+	st, err := c.LoadState(iface)
+	if err != nil || st == nil {
+		return err
+	}
+	st.Address = prev.Address
+	st.SourceRules, st.SourceRulePriority = prev.SourceRules, prev.SourceRulePriority
+	st.ProxyDevice, st.ProxyNeighbors = prev.ProxyDevice, prev.ProxyNeighbors
+	if err := c.saveState(iface, st); err != nil {
+		log.WithError(err).Error("cannot record state")
+		return err
+	}
+	return nil
+}
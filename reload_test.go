@@ -0,0 +1,48 @@
+package wgquick_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c, nl, wg := newFakeClient(t, wgquick.WithStateDir(dir))
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	assert.Error(t, c.Reload(cfg, "wg0", testLog), "reload requires the interface")
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+
+	cfg.Address = cfg.Address[:1]
+	cfg.Peers = cfg.Peers[:1]
+	cfg.Peers[0].AllowedIPs = cfg.Peers[0].AllowedIPs[:1]
+	require.NoError(t, c.Reload(cfg, "wg0", testLog))
+
+	link, err := nl.LinkByName("wg0")
+	require.NoError(t, err)
+	addrs, err := nl.AddrList(link, unix.AF_INET)
+	require.NoError(t, err)
+	assert.Len(t, addrs, 2, "addresses are untouched")
+	assert.Len(t, nl.Routes(), 1)
+	dev, err := wg.Device("wg0")
+	require.NoError(t, err)
+	require.Len(t, dev.Peers, 1, "removed peers are gone")
+	assert.Len(t, dev.Peers[0].AllowedIPs, 1, "removed allowed IPs are gone")
+	st, err := c.LoadState("wg0")
+	require.NoError(t, err)
+	assert.Len(t, st.Address, 2)
+	assert.Len(t, st.Routes, 1)
+
+	require.NoError(t, c.Down(cfg, "wg0", testLog))
+	assert.Empty(t, nl.Routes())
+}
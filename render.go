@@ -0,0 +1,61 @@
+package wgquick
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+var renderFuncMap = template.FuncMap(map[string]interface{}{
+	"publicKey":  publicKeyFromString,
+	"ulaPrefix":  ulaPrefixString,
+	"ulaAddress": ulaAddressString,
+})
+
+func publicKeyFromString(privateKey string) (string, error) {
+	key, err := ParseKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	pub := key.PublicKey()
+	return serializeKey(&pub), nil
+}
+
+// ConfigTemplate is a text/template producing wg-quick configs, e.g. many per-host configs from a single template
+type ConfigTemplate struct {
+	tmpl *template.Template
+}
+
+// ParseConfigTemplate parses the config template. Referencing missing map keys while rendering is an error.
+// Besides the standard template functions, `publicKey` derives the base64 public key from the base64 private key,
+// `ulaPrefix` the IPv6 ULA prefix from the seed and `ulaAddress` the address within the prefix from the public key,
+// e.g. `Address = {{ ulaAddress (ulaPrefix "mesh") (publicKey .PrivateKey) }}`. See ULAPrefix and ULAAddress.
+func ParseConfigTemplate(text string) (*ConfigTemplate, error) {
+	t, err := template.New("wg-quick").Funcs(renderFuncMap).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse template: %w", err)
+	}
+	return &ConfigTemplate{tmpl: t}, nil
+}
+
+// Render executes the template with the given variables and parses the result
+func (t *ConfigTemplate) Render(vars interface{}) (*Config, error) {
+	buff := &bytes.Buffer{}
+	if err := t.tmpl.Execute(buff, vars); err != nil {
+		return nil, fmt.Errorf("cannot render template: %w", err)
+	}
+	c := &Config{}
+	if err := c.UnmarshalText(buff.Bytes()); err != nil {
+		return nil, fmt.Errorf("cannot parse rendered template: %w", err)
+	}
+	return c, nil
+}
+
+// RenderConfig parses and renders the config template in one go
+func RenderConfig(text string, vars interface{}) (*Config, error) {
+	t, err := ParseConfigTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	return t.Render(vars)
+}
@@ -0,0 +1,47 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderConfig(t *testing.T) {
+	tmpl, err := ParseConfigTemplate(`[Interface]
+Address = {{ .Address }}
+PrivateKey = {{ .PrivateKey }}
+
+[Peer]
+PublicKey = {{ publicKey .HubPrivateKey }}
+AllowedIPs = 10.200.100.0/24
+`)
+	require.NoError(t, err)
+
+	c, err := tmpl.Render(map[string]string{
+		"Address":       "10.200.100.8/24",
+		"PrivateKey":    "oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=",
+		"HubPrivateKey": "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "10.200.100.8/24", c.Address[0].String())
+	hub, err := ParseKey("yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=")
+	require.NoError(t, err)
+	assert.Equal(t, hub.PublicKey(), c.Peers[0].PublicKey)
+
+	_, err = tmpl.Render(map[string]string{"Address": "10.200.100.8/24"})
+	assert.Error(t, err)
+}
+
+func TestRenderULA(t *testing.T) {
+	c, err := RenderConfig(`[Interface]
+Address = {{ ulaAddress (ulaPrefix "mesh") (publicKey .PrivateKey) }}
+PrivateKey = {{ .PrivateKey }}
+`, map[string]string{"PrivateKey": "oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM="})
+	require.NoError(t, err)
+	key, err := ParseKey("oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=")
+	require.NoError(t, err)
+	want, err := ULAAddress(ULAPrefix("mesh"), key.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, want.String(), c.Address[0].String())
+}
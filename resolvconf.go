@@ -0,0 +1,33 @@
+package wgquick
+
+import "strings"
+
+const (
+	// DefaultResolvconfAdd is the command setting the DNS servers, fed `nameserver <ip>` lines on stdin
+	DefaultResolvconfAdd = "resolvconf -a %r -m 0 -x"
+	// DefaultResolvconfDelete is the command removing the DNS servers
+	DefaultResolvconfDelete = "resolvconf -d %r"
+	// DefaultResolvconfRecord is the resolvconf interface record name
+	DefaultResolvconfRecord = "tun.%i"
+)
+
+// resolvconfCommand returns the command, or def if empty, with %r replaced by the interface record name. It's run by
+// execSh, replacing %i with the interface name.
+func (cfg *Config) resolvconfCommand(command, def string) string {
+	if command == "" {
+		command = def
+	}
+	record := cfg.ResolvconfRecord
+	if record == "" {
+		record = DefaultResolvconfRecord
+	}
+	return strings.ReplaceAll(command, "%r", record)
+}
+
+// resolvconfBinary returns the binary of the resolvconf add command, checked by the preflight
+func (cfg *Config) resolvconfBinary() string {
+	if args := strings.Fields(cfg.resolvconfCommand(cfg.ResolvconfAdd, DefaultResolvconfAdd)); len(args) > 0 {
+		return args[0]
+	}
+	return ""
+}
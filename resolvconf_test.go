@@ -0,0 +1,20 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvconfCommand(t *testing.T) {
+	cfg := &Config{}
+	assert.Equal(t, "resolvconf -a tun.%i -m 0 -x", cfg.resolvconfCommand(cfg.ResolvconfAdd, DefaultResolvconfAdd))
+	assert.Equal(t, "resolvconf -d tun.%i", cfg.resolvconfCommand(cfg.ResolvconfDelete, DefaultResolvconfDelete))
+	assert.Equal(t, "resolvconf", cfg.resolvconfBinary())
+
+	cfg.ResolvconfAdd = "/sbin/resolvconf -a %r"
+	cfg.ResolvconfRecord = "%i.wg"
+	assert.Equal(t, "/sbin/resolvconf -a %i.wg", cfg.resolvconfCommand(cfg.ResolvconfAdd, DefaultResolvconfAdd))
+	assert.Equal(t, "resolvconf -d %i.wg", cfg.resolvconfCommand(cfg.ResolvconfDelete, DefaultResolvconfDelete))
+	assert.Equal(t, "/sbin/resolvconf", cfg.resolvconfBinary())
+}
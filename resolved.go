@@ -0,0 +1,45 @@
+package wgquick
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// resolved reports whether the config sets any systemd-resolved link options
+func (cfg *Config) resolved() bool {
+	return cfg.DNSDefaultRoute || cfg.DNSSEC != "" || cfg.DNSOverTLS != "" || cfg.LLMNR != ""
+}
+
+// resolvedCommands returns the resolvectl commands applying the systemd-resolved link options, %i is the interface name
+func (cfg *Config) resolvedCommands() []string {
+	var cmds []string
+	if cfg.DNSDefaultRoute {
+		// route all the queries without a more specific routing domain to the tunnel
+		cmds = append(cmds, "resolvectl domain %i '~.'", "resolvectl default-route %i true")
+	}
+	if cfg.DNSSEC != "" {
+		cmds = append(cmds, fmt.Sprintf("resolvectl dnssec %%i %s", cfg.DNSSEC))
+	}
+	if cfg.DNSOverTLS != "" {
+		cmds = append(cmds, fmt.Sprintf("resolvectl dnsovertls %%i %s", cfg.DNSOverTLS))
+	}
+	if cfg.LLMNR != "" {
+		cmds = append(cmds, fmt.Sprintf("resolvectl llmnr %%i %s", cfg.LLMNR))
+	}
+	return cmds
+}
+
+// setResolved applies the systemd-resolved link options. They need the link, so unlike resolvconf it runs after the sync.
+// resolved forgets them when the link is deleted, Down has nothing to undo.
+func (c *Client) setResolved(cfg *Config, iface string, log logrus.FieldLogger) error {
+	for _, cmd := range cfg.resolvedCommands() {
+		if err := c.runSh(cmd, iface, log); err != nil {
+			return err
+		}
+	}
+	if cfg.resolved() {
+		log.Info("set systemd-resolved link options")
+	}
+	return nil
+}
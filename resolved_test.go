@@ -0,0 +1,43 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvedCommands(t *testing.T) {
+	cfg := &Config{}
+	assert.False(t, cfg.resolved())
+	assert.Empty(t, cfg.resolvedCommands())
+
+	cfg.DNSDefaultRoute = true
+	cfg.DNSSEC = "allow-downgrade"
+	cfg.DNSOverTLS = "opportunistic"
+	cfg.LLMNR = "no"
+	assert.True(t, cfg.resolved())
+	assert.Equal(t, []string{
+		"resolvectl domain %i '~.'",
+		"resolvectl default-route %i true",
+		"resolvectl dnssec %i allow-downgrade",
+		"resolvectl dnsovertls %i opportunistic",
+		"resolvectl llmnr %i no",
+	}, cfg.resolvedCommands())
+}
+
+func TestValidateResolved(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	c.DNSSEC = "maybe"
+	c.LLMNR = "resolve"
+	err := c.Validate()
+	require.Error(t, err)
+	assert.Equal(t, "bad-dnssec", err.(*ValidationError).Diagnostics[0].Code)
+	c.DNSSEC = "yes"
+	assert.NoError(t, c.Validate())
+	c.DNSOverTLS = "strict"
+	err = c.Validate()
+	require.Error(t, err)
+	assert.Equal(t, "bad-dns-over-tls", err.(*ValidationError).Diagnostics[0].Code)
+}
@@ -0,0 +1,150 @@
+package wgquick
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DNSBackendFile rewrites resolv.conf directly, for the minimal containers and appliances without a resolver manager.
+	// The original file is backed up and restored by Down, or removed if there was none, so with more such tunnels the
+	// first one down restores it for all.
+	DNSBackendFile = "file"
+
+	// DefaultResolvConf is the resolv.conf rewritten by DNSBackendFile
+	DefaultResolvConf = "/etc/resolv.conf"
+	// resolvConfBackup is appended to the resolv.conf path of its backup
+	resolvConfBackup = ".wg-quick-go.bak"
+	// resolvConfAbsent is appended to the resolv.conf path of the marker recording there was no resolv.conf to back up
+	resolvConfAbsent = ".wg-quick-go.absent"
+)
+
+// WithResolvConf sets the resolv.conf rewritten by DNSBackendFile. It's DefaultResolvConf for the kernel netlink and
+// none for the others, e.g. fakes. Empty path disables the backend.
+func WithResolvConf(path string) ClientOption {
+	return func(c *Client) {
+		c.resolvConf = &path
+	}
+}
+
+// resolvConfContent returns the resolv.conf with the config DNS servers
+func (cfg *Config) resolvConfContent(iface string) []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "# generated by wg-quick-go for %s, the original is restored on down\n", iface)
+	for _, ip := range cfg.DNS {
+		fmt.Fprintf(b, "nameserver %s\n", ip)
+	}
+	return b.Bytes()
+}
+
+// writeResolvConf backs up resolv.conf, unless there's the backup already, and atomically replaces it with the config DNS servers
+func (c *Client) writeResolvConf(cfg *Config, iface string, log logrus.FieldLogger) error {
+	path := c.runDir(c.resolvConf, DefaultResolvConf)
+	if path == "" {
+		return nil
+	}
+	backedUp, err := anyExists(path+resolvConfBackup, path+resolvConfAbsent)
+	if err != nil {
+		return err
+	}
+	if !backedUp {
+		if err := backupFile(path, path+resolvConfBackup, path+resolvConfAbsent); err != nil {
+			return fmt.Errorf("cannot back up %s: %w", path, err)
+		}
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := ioutil.WriteFile(tmp, cfg.resolvConfContent(iface), 0644); err != nil {
+		return err
+	}
+	err = os.Rename(tmp, path)
+	c.record("write resolv.conf", path, err)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	log.WithField("path", path).Info("rewrote resolv.conf")
+	return nil
+}
+
+// anyExists reports whether any of the paths exists
+func anyExists(paths ...string) (bool, error) {
+	for _, p := range paths {
+		_, err := os.Lstat(p)
+		if err == nil {
+			return true, nil
+		}
+		if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// backupFile hard links the file to backup, keeping it as is (e.g. the symlink to the resolver stub), or copies it
+// with its mode across the file systems. If the file doesn't exist, the absent marker is created instead, so the
+// restore removes the written file.
+func backupFile(path, backup, absent string) error {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return ioutil.WriteFile(absent, nil, 0600)
+	}
+	if err := os.Link(path, backup); err == nil {
+		return nil
+	}
+	return copyFile(path, backup)
+}
+
+// copyFile copies the file content and mode
+func copyFile(src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(dst, b, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	// WriteFile applies the umask
+	return os.Chmod(dst, fi.Mode().Perm())
+}
+
+// restoreResolvConf moves the backup back over resolv.conf, or removes resolv.conf if there was none
+func (c *Client) restoreResolvConf(log logrus.FieldLogger) error {
+	path := c.runDir(c.resolvConf, DefaultResolvConf)
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Lstat(path + resolvConfAbsent); err == nil {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		c.record("remove resolv.conf", path, err)
+		if err != nil {
+			return err
+		}
+		log.WithField("path", path).Info("removed resolv.conf, there was none before")
+		return os.Remove(path + resolvConfAbsent)
+	}
+	backup := path + resolvConfBackup
+	err := os.Rename(backup, path)
+	if !os.IsNotExist(err) {
+		c.record("restore resolv.conf", path, err)
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.WithField("path", path).Warn("no resolv.conf backup to restore")
+			return nil
+		}
+		return err
+	}
+	log.WithField("path", path).Info("restored resolv.conf")
+	return nil
+}
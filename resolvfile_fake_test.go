@@ -0,0 +1,67 @@
+package wgquick_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvConfBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	resolvConf := filepath.Join(dir, "resolv.conf")
+	require.NoError(t, ioutil.WriteFile(resolvConf, []byte("nameserver 192.168.1.1\n"), 0644))
+	c, _, _ := newFakeClient(t,
+		wgquick.WithStateDir(filepath.Join(dir, "state")), wgquick.WithResolvConf(resolvConf))
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.DNS = []net.IP{net.ParseIP("10.192.122.1")}
+	cfg.DNSBackend = wgquick.DNSBackendFile
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	b, err := ioutil.ReadFile(resolvConf)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "nameserver 10.192.122.1\n")
+	assert.NotContains(t, string(b), "192.168.1.1")
+
+	cfg.DNSBackend = ""
+	require.NoError(t, c.Down(cfg, "wg0", testLog), "down uses the recorded backend")
+	b, err = ioutil.ReadFile(resolvConf)
+	require.NoError(t, err)
+	assert.Equal(t, "nameserver 192.168.1.1\n", string(b))
+	_, err = os.Stat(resolvConf + ".wg-quick-go.bak")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestResolvConfBackendWithoutResolvConf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	resolvConf := filepath.Join(dir, "resolv.conf")
+	c, _, _ := newFakeClient(t, wgquick.WithResolvConf(resolvConf))
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.DNS = []net.IP{net.ParseIP("10.192.122.1")}
+	cfg.DNSBackend = wgquick.DNSBackendFile
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	b, err := ioutil.ReadFile(resolvConf)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "nameserver 10.192.122.1\n")
+
+	require.NoError(t, c.Down(cfg, "wg0", testLog))
+	_, err = os.Lstat(resolvConf)
+	assert.True(t, os.IsNotExist(err), "the resolv.conf missing before up is removed")
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files, "no backup or marker is left")
+}
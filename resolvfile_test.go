@@ -0,0 +1,29 @@
+package wgquick
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-resolv")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "resolv.conf")
+	require.NoError(t, ioutil.WriteFile(src, []byte("nameserver 192.168.1.1\n"), 0600))
+	require.NoError(t, os.Chmod(src, 0664))
+
+	dst := src + resolvConfBackup
+	require.NoError(t, copyFile(src, dst))
+	b, err := ioutil.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "nameserver 192.168.1.1\n", string(b))
+	fi, err := os.Stat(dst)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0664), fi.Mode().Perm(), "the mode is kept despite the umask")
+}
@@ -0,0 +1,128 @@
+package wgquick
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultQuietPeriod is the quiet period of the Resyncer when none is specified
+const DefaultQuietPeriod = 500 * time.Millisecond
+
+// DefaultMaxResyncBackoff is the longest wait of the Resyncer before retrying the failed sync, see ResyncRetry
+const DefaultMaxResyncBackoff = 30 * time.Second
+
+// Resyncer coalesces bursts of resync triggers, e.g. netlink or config file events, into a single sync.
+// The sync runs once no trigger arrived for the quiet period, so a burst of events results in one consolidated sync,
+// but at most the max delay after the first trigger of the burst, so a flapping link doesn't postpone it forever.
+// The failed sync is retried with backoff.
+type Resyncer struct {
+	quiet      time.Duration
+	maxDelay   time.Duration
+	backoff    time.Duration
+	maxBackoff time.Duration
+	sync       func() error
+	log        logrus.FieldLogger
+	trigger    chan struct{}
+}
+
+// ResyncerOption configures the Resyncer
+type ResyncerOption func(r *Resyncer)
+
+// ResyncMaxDelay bounds the wait of the sync after the first trigger of a burst, 10 quiet periods by default
+func ResyncMaxDelay(d time.Duration) ResyncerOption {
+	return func(r *Resyncer) {
+		r.maxDelay = d
+	}
+}
+
+// ResyncRetry sets the wait before retrying the failed sync, doubled with every next failure up to maxBackoff.
+// By default it's the quiet period, up to DefaultMaxResyncBackoff.
+func ResyncRetry(backoff, maxBackoff time.Duration) ResyncerOption {
+	return func(r *Resyncer) {
+		r.backoff = backoff
+		r.maxBackoff = maxBackoff
+	}
+}
+
+// NewResyncer creates the resyncer calling sync (e.g. a closure calling Client.Sync with the current config) once per burst.
+// The quiet period is DefaultQuietPeriod if 0.
+func NewResyncer(quiet time.Duration, sync func() error, log logrus.FieldLogger, opts ...ResyncerOption) *Resyncer {
+	if quiet == 0 {
+		quiet = DefaultQuietPeriod
+	}
+	r := &Resyncer{
+		quiet:      quiet,
+		maxDelay:   10 * quiet,
+		backoff:    quiet,
+		maxBackoff: DefaultMaxResyncBackoff,
+		sync:       sync,
+		log:        log,
+		trigger:    make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Trigger requests a resync. It never blocks, triggers arriving before the sync are coalesced.
+func (r *Resyncer) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs the syncs until the context is done. A failed sync is logged and retried after the backoff, or on the next
+// trigger if it comes first.
+func (r *Resyncer) Run(ctx context.Context) error {
+	timer := time.NewTimer(r.quiet)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	// pending is set while the timer runs, deadline is the latest time the pending sync runs at
+	pending := false
+	var deadline time.Time
+	backoff := r.backoff
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-r.trigger:
+			now := time.Now()
+			if pending && !timer.Stop() {
+				<-timer.C
+			}
+			if !pending {
+				deadline = now.Add(r.maxDelay)
+			}
+			pending = true
+			delay := r.quiet
+			if d := deadline.Sub(now); d < delay {
+				delay = d
+			}
+			if delay < 0 {
+				delay = 0
+			}
+			timer.Reset(delay)
+		case <-timer.C:
+			pending = false
+			err := r.sync()
+			if err == nil {
+				backoff = r.backoff
+				continue
+			}
+			r.log.WithError(err).WithField("backoff", backoff).Error("cannot resync, retrying")
+			pending = true
+			deadline = time.Now().Add(backoff)
+			timer.Reset(backoff)
+			backoff *= 2
+			if r.maxBackoff > 0 && backoff > r.maxBackoff {
+				backoff = r.maxBackoff
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package wgquick
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResyncerCoalesces(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	var syncs int32
+	r := NewResyncer(50*time.Millisecond, func() error {
+		atomic.AddInt32(&syncs, 1)
+		return nil
+	}, log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx) }()
+
+	for i := 0; i < 10; i++ {
+		r.Trigger()
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&syncs))
+
+	r.Trigger()
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&syncs))
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestResyncerMaxDelay(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	var syncs int32
+	r := NewResyncer(50*time.Millisecond, func() error {
+		atomic.AddInt32(&syncs, 1)
+		return nil
+	}, log, ResyncMaxDelay(100*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx) }()
+
+	// the triggers come more often than the quiet period
+	for i := 0; i < 50; i++ {
+		r.Trigger()
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, atomic.LoadInt32(&syncs) >= 2, "synced %d times during the burst", atomic.LoadInt32(&syncs))
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestResyncerRetries(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	var syncs int32
+	r := NewResyncer(10*time.Millisecond, func() error {
+		if atomic.AddInt32(&syncs, 1) < 3 {
+			return errors.New("boom")
+		}
+		return nil
+	}, log, ResyncRetry(10*time.Millisecond, 20*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx) }()
+
+	r.Trigger()
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&syncs), "retried without another trigger until it succeeded")
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
@@ -0,0 +1,83 @@
+package wgquick
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RetryPolicy retries the failed sync phases (link, device, addresses, routes, ...) with exponential backoff
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts of a phase, including the first one
+	Attempts int
+	// Backoff is the wait before the first retry, doubled with every next one up to MaxBackoff (if set)
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable reports whether the error is worth retrying, IsTransient if nil
+	Retryable func(error) bool
+}
+
+// WithRetry makes Up and Sync retry the phases failing with the transient errors according to the policy, instead of
+// failing right away. The phases are idempotent, so the retried phase just continues where the failed one stopped.
+// The Endpoint host names are resolved by the parser, before Up, so the endpoint not resolvable yet isn't retried
+// here, the caller retries loading the config.
+func WithRetry(p RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = &p
+	}
+}
+
+// IsTransient reports whether the error is likely to go away on its own: the busy or interrupted netlink calls,
+// the temporary network errors (e.g. the UAPI socket timeouts) and the failed resolvconf calls
+func IsTransient(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EBUSY, syscall.EAGAIN, syscall.EINTR, syscall.ENOBUFS, syscall.ETIMEDOUT} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && (ne.Timeout() || ne.Temporary()) {
+		return true
+	}
+	var te temporaryError
+	return errors.As(err, &te)
+}
+
+// temporaryError marks the error as transient for IsTransient
+type temporaryError struct {
+	error
+}
+
+// retrying returns the phase retrying p according to the client retry policy, p itself without the policy
+func (c *Client) retrying(p syncPhase, log logrus.FieldLogger) syncPhase {
+	policy := c.retry
+	if policy == nil || policy.Attempts <= 1 {
+		return p
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+	return syncPhase{name: p.name, run: func() error {
+		backoff := policy.Backoff
+		for attempt := 1; ; attempt++ {
+			err := p.run()
+			if err == nil || attempt >= policy.Attempts || !retryable(err) {
+				return err
+			}
+			log.WithError(err).WithFields(map[string]interface{}{
+				"phase":   p.name,
+				"attempt": attempt,
+				"backoff": backoff,
+			}).Warn("phase failed, retrying")
+			time.Sleep(backoff)
+			backoff *= 2
+			if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+				backoff = policy.MaxBackoff
+			}
+		}
+	}}
+}
@@ -0,0 +1,64 @@
+package wgquick
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(syscall.EBUSY))
+	assert.True(t, IsTransient(&net.DNSError{Err: "timeout", IsTimeout: true}))
+	assert.True(t, IsTransient(temporaryError{errors.New("resolvconf failed")}))
+	assert.False(t, IsTransient(syscall.EPERM))
+	assert.False(t, IsTransient(&net.DNSError{Err: "no such host", IsNotFound: true}))
+	assert.False(t, IsTransient(errors.New("boom")))
+}
+
+func TestRetrying(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	c := &Client{retry: &RetryPolicy{Attempts: 3, Backoff: time.Millisecond}}
+
+	calls := 0
+	flaky := syncPhase{name: "flaky", run: func() error {
+		calls++
+		if calls < 3 {
+			return syscall.EBUSY
+		}
+		return nil
+	}}
+	assert.NoError(t, c.retrying(flaky, log).run())
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	busy := syncPhase{name: "busy", run: func() error {
+		calls++
+		return syscall.EBUSY
+	}}
+	assert.Equal(t, syscall.EBUSY, c.retrying(busy, log).run())
+	assert.Equal(t, 3, calls, "gives up after the attempts")
+
+	calls = 0
+	denied := syncPhase{name: "denied", run: func() error {
+		calls++
+		return syscall.EPERM
+	}}
+	assert.Equal(t, syscall.EPERM, c.retrying(denied, log).run())
+	assert.Equal(t, 1, calls, "permanent errors aren't retried")
+
+	c.retry.Retryable = func(err error) bool { return true }
+	calls = 0
+	assert.Equal(t, syscall.EPERM, c.retrying(denied, log).run())
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	assert.Equal(t, syscall.EBUSY, (&Client{}).retrying(busy, log).run())
+	assert.Equal(t, 1, calls, "no retries without the policy")
+}
@@ -0,0 +1,420 @@
+package wgquick
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// Route is additional route via the wireguard link, beyond the AllowedIPs routes. It's used when the link is a transit link
+// to further networks behind the peer, e.g. `ip route add 192.168.0.0/16 via 10.0.0.2 dev wg0 onlink`
+type Route struct {
+	Dst net.IPNet
+	// Gateway is the next hop, nil routes directly to the link
+	Gateway net.IP
+	// OnLink pretends the gateway is directly reachable via the link, even if no link address covers it
+	OnLink bool
+}
+
+func (r Route) String() string {
+	s := r.Dst.String()
+	if r.Gateway != nil {
+		s += " via " + r.Gateway.String()
+	}
+	if r.OnLink {
+		s += " onlink"
+	}
+	return s
+}
+
+// RouteOptions are additional attributes of the routes to a single destination, both the AllowedIPs and Routes ones
+type RouteOptions struct {
+	// MTU sets the path MTU towards the destination, e.g. when it's lower than the link MTU and PMTUD is unreliable. 0 keeps the link MTU
+	MTU int
+	// MTULock stops the kernel from lowering the MTU on the ICMP fragmentation needed messages
+	MTULock bool
+}
+
+func (o RouteOptions) String() string {
+	if o.MTU == 0 {
+		return ""
+	}
+	if o.MTULock {
+		return "mtu lock " + strconv.Itoa(o.MTU)
+	}
+	return "mtu " + strconv.Itoa(o.MTU)
+}
+
+// ParseRouteOptions parses the comma separated route options in the `ip route` syntax, keyed by the destination CIDR,
+// e.g. `192.168.7.0/24 mtu 1280, 10.0.0.0/8 mtu lock 1400`
+func ParseRouteOptions(s string) (map[string]RouteOptions, error) {
+	opts := make(map[string]RouteOptions)
+	for _, item := range strings.Split(s, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		dst, err := parseIPNet(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %w", fields[0], err)
+		}
+		var o RouteOptions
+		switch {
+		case len(fields) == 3 && fields[1] == "mtu":
+		case len(fields) == 4 && fields[1] == "mtu" && fields[2] == "lock":
+			o.MTULock = true
+		default:
+			return nil, fmt.Errorf("cannot parse route options %q, expected `<dst> mtu [lock] <mtu>`", strings.TrimSpace(item))
+		}
+		if o.MTU, err = strconv.Atoi(fields[len(fields)-1]); err != nil {
+			return nil, fmt.Errorf("cannot parse mtu: %w", err)
+		}
+		opts[dst.String()] = o
+	}
+	return opts, nil
+}
+
+func routeOptionsString(opts map[string]RouteOptions) string {
+	var parts []string
+	for dst, o := range opts {
+		parts = append(parts, dst+" "+o.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+func routesString(routes []Route) string {
+	var parts []string
+	for _, rt := range routes {
+		parts = append(parts, rt.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// listOwnedRoutes lists the routes owned by the config: on the link, in the config table and with the config protocol.
+// The netlink library still dumps all the routes and filters them in userspace, but the foreign ones are dropped right away.
+func (c *Client) listOwnedRoutes(cfg *Config, link netlink.Link) ([]netlink.Route, error) {
+	filter := &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Table:     int(cfg.Table),
+		Protocol:  cfg.RouteProtocol,
+	}
+	if cfg.Table == TableAuto {
+		filter.Table = unix.RT_CLASS_MAIN
+	}
+	return c.listRoutes(filter, netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL)
+}
+
+// deleteProtocolRoutes deletes the routes the config owned while tagged with the previous protocol. Sync calls it once after
+// RouteProtocol changed: the wanted routes are already replaced with the new protocol, so only the stale ones are left.
+func (c *Client) deleteProtocolRoutes(cfg *Config, link netlink.Link, protocol int, log logrus.FieldLogger) error {
+	prev := *cfg
+	prev.RouteProtocol = protocol
+	routes, err := c.listOwnedRoutes(&prev, link)
+	if err != nil {
+		return err
+	}
+	errs := c.newItemErrors()
+	for _, rt := range routes {
+		rt := rt
+		if err := c.nl.RouteDel(&rt); err != nil && err != syscall.ESRCH {
+			log.WithError(err).WithField("route", rt.Dst.String()).Error("cannot delete route")
+			if err := errs.add("delete route", routeItem(rt), err); err != nil {
+				return err
+			}
+			continue
+		}
+		log.WithFields(map[string]interface{}{"route": rt.Dst.String(), "protocol": protocol}).Info("previous protocol route deleted")
+	}
+	return errs.err()
+}
+
+// listRoutes lists the IPv4 and IPv6 routes matching the filter. The default routes are dumped without destination,
+// it's set to 0.0.0.0/0 or ::/0 so they compare equal to the wanted ones.
+func (c *Client) listRoutes(filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	var routes []netlink.Route
+	for _, family := range []int{unix.AF_INET, unix.AF_INET6} {
+		rts, err := c.nl.RouteListFiltered(family, filter, filterMask)
+		if err != nil {
+			return nil, err
+		}
+		for _, rt := range rts {
+			if rt.Dst == nil {
+				rt.Dst = defaultDst(family)
+			}
+			routes = append(routes, rt)
+		}
+	}
+	return routes, nil
+}
+
+func defaultDst(family int) *net.IPNet {
+	if family == unix.AF_INET6 {
+		return &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+	}
+	return &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+}
+
+func isDefaultDst(dst *net.IPNet) bool {
+	if dst == nil {
+		return true
+	}
+	ones, _ := dst.Mask.Size()
+	return ones == 0
+}
+
+// displacedRoutes returns the foreign routes the config default routes replace, e.g. the system default route when
+// the metric of the tunnel route is the same. They're recorded in the state and restored by Down.
+func (c *Client) displacedRoutes(cfg *Config, link netlink.Link) ([]netlink.Route, error) {
+	var wanted []net.IPNet
+	for _, dst := range cfg.managedRoutes() {
+		if isDefaultDst(&dst) {
+			wanted = append(wanted, dst)
+		}
+	}
+	if len(wanted) == 0 {
+		return nil, nil
+	}
+	present, err := c.listRoutes(&netlink.Route{Table: int(cfg.Table)}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, err
+	}
+	var displaced []netlink.Route
+	for _, rt := range present {
+		if rt.LinkIndex == link.Attrs().Index || rt.Priority != cfg.RouteMetric || rt.Tos != 0 || !isDefaultDst(rt.Dst) {
+			continue
+		}
+		for _, dst := range wanted {
+			if rt.Dst.String() == dst.String() {
+				displaced = append(displaced, rt)
+			}
+		}
+	}
+	return displaced, nil
+}
+
+// restoreRoutes adds back the displaced routes, skipping the ones which can't be restored, e.g. because their link is gone
+func (c *Client) restoreRoutes(routes []netlink.Route, log logrus.FieldLogger) {
+	for _, rt := range routes {
+		rt := rt // make copy
+		log := log.WithFields(map[string]interface{}{
+			"route":   rt.Dst.String(),
+			"gateway": rt.Gw,
+			"table":   rt.Table,
+		})
+		if err := c.nl.RouteReplace(&rt); err != nil {
+			log.WithError(err).Warn("cannot restore displaced route")
+			continue
+		}
+		log.Info("displaced route restored")
+	}
+}
+
+// netlinkRoute returns the netlink route for the link, with the config table, protocol and metric
+func (cfg *Config) netlinkRoute(link netlink.Link, dst net.IPNet, gw net.IP, onLink bool) netlink.Route {
+	nrt := netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       &dst,
+		Gw:        gw,
+		Table:     int(cfg.Table),
+		Protocol:  cfg.RouteProtocol,
+		Priority:  cfg.RouteMetric,
+		MTU:       cfg.RouteOptions[dst.String()].MTU,
+	}
+	if onLink {
+		nrt.SetFlag(netlink.FLAG_ONLINK)
+	}
+	fillRouteDefaults(&nrt)
+	return nrt
+}
+
+// routeMatches reports whether the present route has the wanted attributes, the MTU too which Route.Equal ignores.
+// The MTU lock can't be read back, the locked routes are replaced on every sync.
+func (cfg *Config) routeMatches(present, wanted netlink.Route) bool {
+	return present.Equal(wanted) && present.MTU == wanted.MTU && !cfg.RouteOptions[wanted.Dst.String()].MTULock
+}
+
+// routeReplace adds or replaces the route, locking its MTU if the config says so
+func (c *Client) routeReplace(cfg *Config, rt *netlink.Route) error {
+	if rt.MTU != 0 && cfg.RouteOptions[rt.Dst.String()].MTULock {
+		return c.nl.RouteReplaceMTULock(rt)
+	}
+	return c.nl.RouteReplace(rt)
+}
+
+// replaceRoutes adds or replaces the routes, batching the requests if the Netlink implements RouteBatcher. The routes
+// with the locked MTU are replaced one by one in between. It calls done with the outcome of every route in order and stops
+// on the first error it returns, the rest of the failed batch is applied nonetheless.
+func (c *Client) replaceRoutes(cfg *Config, routes []netlink.Route, done func(rt netlink.Route, err error) error) error {
+	batcher, ok := c.nl.(RouteBatcher)
+	var batch []netlink.Route
+	flush := func() error {
+		errs := batcher.RouteReplaceBatch(batch)
+		for i, rt := range batch {
+			if err := done(rt, errs[i]); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for _, rt := range routes {
+		rt := rt // make copy
+		if ok && (rt.MTU == 0 || !cfg.RouteOptions[rt.Dst.String()].MTULock) {
+			batch = append(batch, rt)
+			continue
+		}
+		if ok && len(batch) > 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if err := done(rt, c.routeReplace(cfg, &rt)); err != nil {
+			return err
+		}
+	}
+	if len(batch) > 0 {
+		return flush()
+	}
+	return nil
+}
+
+// routeReplaceMTULock adds or replaces the unicast route with the locked MTU over the sockets, which the netlink library
+// doesn't support. Equivalent to:
+// `ip route replace $dst via $gw dev $link table $table proto $proto metric $metric mtu lock $mtu`
+func routeReplaceMTULock(sockets map[int]*nl.SocketHandle, route *netlink.Route) error {
+	req := routeRequest(route, true)
+	req.Sockets = sockets
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+// routeBatchSize is the number of the route requests sent at once. The acks of a batch have to fit into the default
+// socket receive buffer, otherwise the kernel drops them.
+const routeBatchSize = 128
+
+// routeReplaceBatch adds or replaces the unicast routes over the socket, sending routeBatchSize requests in a single
+// message and reading their acks afterwards, like `ip -batch`. It returns the error of every route, the failed routes
+// don't stop the rest of the batch.
+func routeReplaceBatch(s *nl.NetlinkSocket, routes []netlink.Route) []error {
+	errs := make([]error, len(routes))
+	fail := func(indexes []int, err error) {
+		for _, i := range indexes {
+			errs[i] = err
+		}
+	}
+	var all []int
+	for i := range routes {
+		all = append(all, i)
+	}
+	pid, err := s.GetPid()
+	if err != nil {
+		fail(all, err)
+		return errs
+	}
+
+	var seq uint32
+	for len(all) > 0 {
+		batch := all
+		if len(batch) > routeBatchSize {
+			batch = batch[:routeBatchSize]
+		}
+		all = all[len(batch):]
+
+		var msg []byte
+		pending := make(map[uint32]int, len(batch))
+		for _, i := range batch {
+			req := routeRequest(&routes[i], false)
+			seq++
+			req.Seq = seq
+			pending[req.Seq] = i
+			msg = append(msg, req.Serialize()...)
+		}
+		if err := unix.Sendto(s.GetFd(), msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+			fail(batch, err)
+			continue
+		}
+		for len(pending) > 0 {
+			msgs, err := s.Receive()
+			if err != nil {
+				for _, i := range pending {
+					errs[i] = err
+				}
+				break
+			}
+			for _, m := range msgs {
+				i, ok := pending[m.Header.Seq]
+				if !ok || m.Header.Pid != pid || m.Header.Type != unix.NLMSG_ERROR {
+					continue
+				}
+				delete(pending, m.Header.Seq)
+				if code := int32(nl.NativeEndian().Uint32(m.Data[0:4])); code != 0 {
+					errs[i] = syscall.Errno(-code)
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// routeRequest returns the request adding or replacing the unicast route, with the MTU locked if lock is set
+func routeRequest(route *netlink.Route, lock bool) *nl.NetlinkRequest {
+	req := nl.NewNetlinkRequest(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_REPLACE|unix.NLM_F_ACK)
+	family := nl.GetIPFamily(route.Dst.IP)
+	ipData := func(ip net.IP) []byte {
+		if family == nl.FAMILY_V4 {
+			return ip.To4()
+		}
+		return ip.To16()
+	}
+	msg := nl.NewRtMsg()
+	msg.Family = uint8(family)
+	dstLen, _ := route.Dst.Mask.Size()
+	msg.Dst_len = uint8(dstLen)
+	msg.Scope = uint8(route.Scope)
+	msg.Tos = uint8(route.Tos)
+	msg.Flags = uint32(route.Flags)
+	if route.Protocol > 0 {
+		msg.Protocol = uint8(route.Protocol)
+	}
+	if route.Type > 0 {
+		msg.Type = uint8(route.Type)
+	}
+	var attrs []*nl.RtAttr
+	if route.Table >= 256 {
+		msg.Table = unix.RT_TABLE_UNSPEC
+		attrs = append(attrs, nl.NewRtAttr(unix.RTA_TABLE, nl.Uint32Attr(uint32(route.Table))))
+	} else if route.Table > 0 {
+		msg.Table = uint8(route.Table)
+	}
+	req.AddData(msg)
+
+	attrs = append(attrs, nl.NewRtAttr(unix.RTA_DST, ipData(route.Dst.IP)))
+	if route.Gw != nil {
+		attrs = append(attrs, nl.NewRtAttr(unix.RTA_GATEWAY, ipData(route.Gw)))
+	}
+	attrs = append(attrs, nl.NewRtAttr(unix.RTA_OIF, nl.Uint32Attr(uint32(route.LinkIndex))))
+	if route.Priority > 0 {
+		attrs = append(attrs, nl.NewRtAttr(unix.RTA_PRIORITY, nl.Uint32Attr(uint32(route.Priority))))
+	}
+	if route.MTU > 0 {
+		metrics := nl.NewRtAttr(unix.RTA_METRICS, nil)
+		if lock {
+			nl.NewRtAttrChild(metrics, unix.RTAX_LOCK, nl.Uint32Attr(1<<unix.RTAX_MTU))
+		}
+		nl.NewRtAttrChild(metrics, unix.RTAX_MTU, nl.Uint32Attr(uint32(route.MTU)))
+		attrs = append(attrs, metrics)
+	}
+	for _, attr := range attrs {
+		req.AddData(attr)
+	}
+	return req
+}
@@ -0,0 +1,71 @@
+package wgquick_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestSyncKeepsForeignRoutes(t *testing.T) {
+	c, nl, _ := newFakeClient(t)
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	for _, rt := range nl.Routes() {
+		assert.Equal(t, wgquick.DefaultRouteProtocol, rt.Protocol)
+	}
+
+	// e.g. `ip route add 172.16.0.0/12 dev wg0` by the other daemon
+	link, err := nl.LinkByName("wg0")
+	require.NoError(t, err)
+	_, dst, err := net.ParseCIDR("172.16.0.0/12")
+	require.NoError(t, err)
+	require.NoError(t, nl.RouteReplace(&netlink.Route{LinkIndex: link.Attrs().Index, Dst: dst, Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_BOOT, Type: unix.RTN_UNICAST}))
+
+	cfg.Peers = cfg.Peers[:1]
+	cfg.ReplacePeers = true
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+	var dsts []string
+	for _, rt := range nl.Routes() {
+		dsts = append(dsts, rt.Dst.String())
+	}
+	assert.ElementsMatch(t, []string{"10.192.122.3/32", "10.192.124.1/24", "172.16.0.0/12"}, dsts)
+}
+
+func TestSyncMigratesRouteProtocol(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c, nl, _ := newFakeClient(t, wgquick.WithStateDir(dir))
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.RouteProtocol = unix.RTPROT_BOOT
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	require.Len(t, nl.Routes(), 4)
+
+	cfg.RouteProtocol = 0
+	cfg.Peers = cfg.Peers[:1]
+	cfg.ReplacePeers = true
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+	var dsts []string
+	for _, rt := range nl.Routes() {
+		assert.Equal(t, wgquick.DefaultRouteProtocol, rt.Protocol)
+		dsts = append(dsts, rt.Dst.String())
+	}
+	assert.ElementsMatch(t, []string{"10.192.122.3/32", "10.192.124.1/24"}, dsts, "the previous protocol routes are deleted")
+	st, err := c.LoadState("wg0")
+	require.NoError(t, err)
+	require.NotNil(t, st)
+	assert.Equal(t, wgquick.DefaultRouteProtocol, st.RouteProtocol)
+}
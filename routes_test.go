@@ -0,0 +1,104 @@
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestNetlinkRoute(t *testing.T) {
+	_, dst, err := net.ParseCIDR("192.168.0.0/16")
+	require.NoError(t, err)
+	rt := Route{Dst: *dst, Gateway: net.ParseIP("10.0.0.2"), OnLink: true}
+	assert.Equal(t, "192.168.0.0/16 via 10.0.0.2 onlink", rt.String())
+
+	cfg := &Config{Table: 51820, RouteMetric: 10}
+	link := &netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Index: 7}, LinkType: "wireguard"}
+	nrt := cfg.netlinkRoute(link, rt.Dst, rt.Gateway, rt.OnLink)
+	assert.Equal(t, 7, nrt.LinkIndex)
+	assert.Equal(t, "10.0.0.2", nrt.Gw.String())
+	assert.Equal(t, int(netlink.FLAG_ONLINK), nrt.Flags)
+	assert.Equal(t, 51820, nrt.Table)
+	assert.Equal(t, 10, nrt.Priority)
+	assert.Equal(t, DefaultRouteProtocol, nrt.Protocol)
+
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	c.Routes = []Route{rt, {Dst: *dst, Gateway: net.ParseIP("fd00::2")}}
+	err = c.Validate()
+	require.Error(t, err)
+	require.Len(t, err.(*ValidationError).Diagnostics, 1)
+	assert.Equal(t, "Interface.Routes[1]", err.(*ValidationError).Diagnostics[0].Field)
+}
+
+func TestRouteOptions(t *testing.T) {
+	opts, err := ParseRouteOptions("192.168.7.0/24 mtu 1280, 10.0.0.0/8 mtu lock 1400")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]RouteOptions{
+		"192.168.7.0/24": {MTU: 1280},
+		"10.0.0.0/8":     {MTU: 1400, MTULock: true},
+	}, opts)
+	assert.Equal(t, "10.0.0.0/8 mtu lock 1400, 192.168.7.0/24 mtu 1280", routeOptionsString(opts))
+	_, err = ParseRouteOptions("10.0.0.0/8 lock 1400")
+	assert.Error(t, err)
+
+	_, dst, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	cfg := &Config{RouteOptions: opts}
+	link := &netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Index: 7}, LinkType: "wireguard"}
+	nrt := cfg.netlinkRoute(link, *dst, nil, false)
+	assert.Equal(t, 1400, nrt.MTU)
+	assert.False(t, cfg.routeMatches(nrt, nrt), "the locked route is always replaced")
+	present := nrt
+	present.MTU = 1420
+	cfg.RouteOptions = map[string]RouteOptions{dst.String(): {MTU: 1400}}
+	assert.False(t, cfg.routeMatches(present, nrt))
+	assert.True(t, cfg.routeMatches(nrt, nrt))
+
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	c.RouteOptions = map[string]RouteOptions{"fd00::/64": {MTU: 1000}, "10.0.0.0/8": {MTULock: true}}
+	err = c.Validate()
+	require.Error(t, err)
+	assert.Len(t, err.(*ValidationError).Diagnostics, 2)
+}
+
+// BenchmarkListRoutes compares listing the owned routes with the full dump filtered afterwards. It runs against the host routing tables.
+func BenchmarkListRoutes(b *testing.B) {
+	c, err := NewClient()
+	if err != nil {
+		b.Skip(err)
+	}
+	defer c.Close()
+	link, err := c.nl.LinkByName("lo")
+	if err != nil {
+		b.Skip(err)
+	}
+	cfg := &Config{Table: unix.RT_TABLE_MAIN, RouteProtocol: unix.RTPROT_BOOT}
+
+	b.Run("owned", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := c.listOwnedRoutes(cfg, link); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("all", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			routes, err := c.nl.RouteListFiltered(unix.AF_UNSPEC, &netlink.Route{}, netlink.RT_FILTER_TABLE)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var owned []netlink.Route
+			for _, rt := range routes {
+				if rt.LinkIndex == link.Attrs().Index && rt.Table == int(cfg.Table) && rt.Protocol == cfg.RouteProtocol {
+					owned = append(owned, rt)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package wgquick
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// ruleFamily returns the address family of the rule. Rules without the family and src/dst selectors default to IPv4
+func ruleFamily(rule netlink.Rule) int {
+	switch {
+	case rule.Family != 0:
+		return rule.Family
+	case rule.Src != nil && rule.Src.IP.To4() == nil, rule.Dst != nil && rule.Dst.IP.To4() == nil:
+		return unix.AF_INET6
+	default:
+		return unix.AF_INET
+	}
+}
+
+// normalizeRule fills in the values the kernel reports back for the rule, so wanted and present rules can be compared
+func normalizeRule(rule netlink.Rule) netlink.Rule {
+	rule.Family = ruleFamily(rule)
+	if rule.Mark == 0 && rule.Mask <= 0 {
+		rule.Mark, rule.Mask = -1, -1
+	}
+	if rule.Mark > 0 && rule.Mask < 0 {
+		rule.Mask = 0xffffffff
+	}
+	return rule
+}
+
+func ruleEqual(a, b netlink.Rule) bool {
+	a, b = normalizeRule(a), normalizeRule(b)
+	aSrc, bSrc := ipNetString(a.Src), ipNetString(b.Src)
+	aDst, bDst := ipNetString(a.Dst), ipNetString(b.Dst)
+	a.Src, a.Dst, b.Src, b.Dst = nil, nil, nil, nil
+	return a == b && aSrc == bSrc && aDst == bDst
+}
+
+func ipNetString(n *net.IPNet) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
+
+// ruleOwned reports whether the present rule is managed, i.e. it shares the priority and family with one of the wanted rules.
+func ruleOwned(rule netlink.Rule, wanted []netlink.Rule) bool {
+	for _, w := range wanted {
+		if w.Priority == rule.Priority && ruleFamily(w) == ruleFamily(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceRules returns `from <address> lookup <Table>` rule for every address
+func (cfg *Config) sourceRules() []netlink.Rule {
+	var rules []netlink.Rule
+	for _, addr := range cfg.Address {
+		rule := netlink.NewRule()
+		rule.Priority = cfg.SourceRulePriority
+		rule.Table = int(cfg.Table)
+		rule.Src = &net.IPNet{IP: addr.IP, Mask: fullMask(addr.IP)}
+		rules = append(rules, *rule)
+	}
+	return rules
+}
+
+// deleteSourceRules deletes the source rules, ignoring already deleted ones
+func (c *Client) deleteSourceRules(cfg *Config, log logrus.FieldLogger) error {
+	cfg = cfg.clone()
+	cfg.FillDefaults()
+	for _, rule := range cfg.sourceRules() {
+		rule := rule // make copy
+		rule.Family = ruleFamily(rule)
+		log := log.WithField("rule", rule.String())
+		if err := c.nl.RuleDel(&rule); err != nil && err != syscall.ENOENT {
+			log.WithError(err).Error("cannot delete rule")
+			return err
+		}
+		log.Info("rule deleted")
+	}
+	return nil
+}
+
+// SyncRules adds/deletes policy routing rules, so the managed set of rules is exactly the wanted one. Equivalent to a set of `ip rule add/del` calls.
+//
+// Wanted rules must have explicit priority, the family is taken from the src/dst selectors if unset. The priorities
+// of the wanted rules define the managed set: present rules with the same priority and family are deleted if not wanted.
+// Use dedicated priorities for the managed rules.
+func (c *Client) SyncRules(cfg *Config, rules []netlink.Rule, log logrus.FieldLogger) error {
+	for _, rule := range rules {
+		if rule.Priority < 0 {
+			return fmt.Errorf("rule %v: priority must be set", rule)
+		}
+	}
+
+	errs := c.newItemErrors()
+	for _, family := range []int{unix.AF_INET, unix.AF_INET6} {
+		presentRules, err := c.nl.RuleList(family)
+		if err != nil {
+			log.WithError(err).Error("cannot read existing rules")
+			return err
+		}
+		for i := range presentRules {
+			presentRules[i].Family = family
+		}
+
+		for _, rule := range rules {
+			rule := rule // make copy
+			if ruleFamily(rule) != family {
+				continue
+			}
+			rule.Family = family
+			log := log.WithField("rule", rule.String())
+			present := false
+			for _, p := range presentRules {
+				if ruleEqual(p, rule) {
+					present = true
+					break
+				}
+			}
+			if present {
+				log.Debug("rule present")
+				continue
+			}
+			if err := c.nl.RuleAdd(&rule); err != nil && err != syscall.EEXIST {
+				log.WithError(err).Error("cannot add rule")
+				if err := errs.add("add rule", rule.String(), err); err != nil {
+					return err
+				}
+				continue
+			}
+			log.Info("rule added")
+		}
+
+		for _, rule := range presentRules {
+			rule := rule // make copy
+			log := log.WithField("rule", rule.String())
+			if !ruleOwned(rule, rules) {
+				continue
+			}
+			wanted := false
+			for _, w := range rules {
+				if ruleEqual(rule, w) {
+					wanted = true
+					break
+				}
+			}
+			if wanted {
+				log.Debug("rule wanted, skipping deleting")
+				continue
+			}
+			if err := c.nl.RuleDel(&rule); err != nil && err != syscall.ENOENT {
+				log.WithError(err).Error("cannot delete rule")
+				if err := errs.add("delete rule", rule.String(), err); err != nil {
+					return err
+				}
+				continue
+			}
+			log.Info("rule deleted")
+		}
+	}
+	return errs.err()
+}
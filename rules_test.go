@@ -0,0 +1,78 @@
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestRuleEqual(t *testing.T) {
+	wanted := *netlink.NewRule()
+	wanted.Priority = 100
+	wanted.Table = 51820
+	wanted.Mark = 51820
+	wanted.Invert = true
+
+	// as listed by the kernel
+	present := *netlink.NewRule()
+	present.Family = unix.AF_INET
+	present.Priority = 100
+	present.Table = 51820
+	present.Mark = 51820
+	present.Mask = 0xffffffff
+	present.Invert = true
+	assert.True(t, ruleEqual(wanted, present))
+
+	present.Invert = false
+	assert.False(t, ruleEqual(wanted, present))
+
+	_, src, _ := net.ParseCIDR("10.0.0.1/32")
+	from := *netlink.NewRule()
+	from.Priority = 200
+	from.Table = 51820
+	from.Src = src
+	listed := from
+	listed.Family = unix.AF_INET
+	listed.Src = &net.IPNet{IP: src.IP.To4(), Mask: src.Mask}
+	assert.True(t, ruleEqual(from, listed))
+	listed.Family = unix.AF_INET6
+	assert.False(t, ruleEqual(from, listed))
+}
+
+func TestRuleOwned(t *testing.T) {
+	wanted := *netlink.NewRule()
+	wanted.Priority = 100
+	wanted.Table = unix.RT_TABLE_MAIN
+	wanted.SuppressPrefixlen = 0
+
+	other := *netlink.NewRule()
+	other.Family = unix.AF_INET
+	other.Priority = 32766
+	other.Table = unix.RT_TABLE_MAIN
+
+	assert.False(t, ruleOwned(other, []netlink.Rule{wanted}))
+	other.Priority = 100
+	assert.True(t, ruleOwned(other, []netlink.Rule{wanted}))
+	other.Family = unix.AF_INET6
+	assert.False(t, ruleOwned(other, []netlink.Rule{wanted}))
+}
+
+func TestSourceRules(t *testing.T) {
+	c := &Config{}
+	assert.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	c.Table = 51820
+	c.SourceRules = true
+	c.FillDefaults()
+	rules := c.sourceRules()
+	assert.Len(t, rules, len(c.Address))
+	for i, rule := range rules {
+		assert.Equal(t, DefaultSourceRulePriority, rule.Priority)
+		assert.Equal(t, 51820, rule.Table)
+		assert.Equal(t, c.Address[i].IP.String(), rule.Src.IP.String())
+		ones, _ := rule.Src.Mask.Size()
+		assert.Equal(t, 8*len(fullMask(c.Address[i].IP)), ones)
+	}
+}
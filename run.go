@@ -0,0 +1,65 @@
+package wgquick
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Run brings the tunnel up, resyncs the config on SIGHUP and tears the tunnel down on SIGTERM, SIGINT or when
+// the context is done. An existing interface is synced instead of failing Up, e.g. after the previous run crashed.
+// It returns the error of Up or Down; the failed resyncs are logged and the tunnel keeps running.
+func (c *Client) Run(ctx context.Context, cfg *Config, iface string, log logrus.FieldLogger) error {
+	return c.RunLoader(ctx, func() (*Config, error) { return cfg, nil }, iface, log)
+}
+
+// RunLoader is Run loading the config with load on the start and every SIGHUP, e.g. re-reading the config file.
+// Reloading is required with ZeroizeKeys, which wipes the keys of the synced config.
+func (c *Client) RunLoader(ctx context.Context, load func() (*Config, error), iface string, log logrus.FieldLogger) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sigs)
+
+	cfg, err := load()
+	if err != nil {
+		return err
+	}
+	if exists, err := c.Exists(iface); err != nil {
+		return err
+	} else if exists {
+		log.Warn("interface exists, syncing it")
+		err = c.Sync(cfg, iface, log)
+	} else {
+		err = c.Up(cfg, iface, log)
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("context done, tearing down")
+			return c.Down(cfg, iface, log)
+		case sig := <-sigs:
+			if sig != syscall.SIGHUP {
+				log.WithField("signal", sig).Info("tearing down")
+				return c.Down(cfg, iface, log)
+			}
+			reloaded, err := load()
+			if err != nil {
+				log.WithError(err).Error("cannot reload config")
+				continue
+			}
+			if err := c.Sync(reloaded, iface, log); err != nil {
+				log.WithError(err).Error("cannot resync")
+				continue
+			}
+			cfg = reloaded
+			log.Info("resynced on SIGHUP")
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package wgquick_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	c, _, wg := newFakeClient(t)
+	defer c.Close()
+
+	var mu sync.Mutex
+	peers := 2
+	load := func() (*wgquick.Config, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		cfg := &wgquick.Config{}
+		if err := cfg.UnmarshalText([]byte(testConfig)); err != nil {
+			return nil, err
+		}
+		cfg.Peers = cfg.Peers[:peers]
+		cfg.ReplacePeers = true
+		return cfg, nil
+	}
+	devicePeers := func() int {
+		dev, err := wg.Device("wg0")
+		if err != nil {
+			return -1
+		}
+		return len(dev.Peers)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.RunLoader(ctx, load, "wg0", testLog) }()
+	waitFor(t, func() bool { return devicePeers() == 2 })
+
+	mu.Lock()
+	peers = 1
+	mu.Unlock()
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	waitFor(t, func() bool { return devicePeers() == 1 })
+
+	cancel()
+	require.NoError(t, <-done)
+	ok, err := c.Exists("wg0")
+	require.NoError(t, err)
+	assert.False(t, ok, "torn down")
+}
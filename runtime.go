@@ -0,0 +1,126 @@
+package wgquick
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// GetRuntimeConfig reads the config back from the live interface, the inverse of Sync: the link MTU, alias and addresses,
+// the wireguard device and the additional routes. The route table, protocol, metric, DNS and source rules are only known
+// from the state file, the defaults are assumed without it.
+func (c *Client) GetRuntimeConfig(iface string) (*Config, error) {
+	link, err := c.nl.LinkByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	if link.Type() != "wireguard" {
+		return nil, fmt.Errorf("%s is %s link, not wireguard", iface, link.Type())
+	}
+	cl, err := c.wgctrl()
+	if err != nil {
+		return nil, err
+	}
+	dev, err := cl.Device(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		MTU:       link.Attrs().MTU,
+		LinkAlias: link.Attrs().Alias,
+	}
+	cfg.Config = deviceConfig(dev)
+	for _, family := range []int{unix.AF_INET, unix.AF_INET6} {
+		addrs, err := c.nl.AddrList(link, family)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if addr.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			cfg.Address = append(cfg.Address, *addr.IPNet)
+		}
+	}
+
+	st, err := c.LoadState(iface)
+	if err != nil {
+		return nil, err
+	}
+	if st != nil {
+		applied, err := st.apply(cfg)
+		if err != nil {
+			return nil, err
+		}
+		// the state routes are replaced by the live ones below, the rest comes from the device and the link
+		cfg.DNS = applied.DNS
+		cfg.Table = applied.Table
+		cfg.RouteProtocol = applied.RouteProtocol
+		cfg.RouteMetric = applied.RouteMetric
+		cfg.SourceRules = applied.SourceRules
+		cfg.SourceRulePriority = applied.SourceRulePriority
+	}
+	// the routes are listed with the defaults Sync added them with
+	filled := cfg.clone()
+	filled.FillDefaults()
+	routes, err := c.listOwnedRoutes(filled, link)
+	if err != nil {
+		return nil, err
+	}
+	managed := make(map[string]bool)
+	for _, dst := range cfg.managedRoutes() {
+		managed[dst.String()] = true
+	}
+	for _, rt := range routes {
+		if rt.Gw == nil && managed[rt.Dst.String()] {
+			continue
+		}
+		cfg.Routes = append(cfg.Routes, Route{
+			Dst:     *rt.Dst,
+			Gateway: rt.Gw,
+			OnLink:  rt.Flags&int(netlink.FLAG_ONLINK) != 0,
+		})
+	}
+	return cfg, nil
+}
+
+// deviceConfig returns the config of the device, with only the set optional values
+func deviceConfig(dev *wgtypes.Device) wgtypes.Config {
+	var cfg wgtypes.Config
+	if dev.PrivateKey != (wgtypes.Key{}) {
+		key := dev.PrivateKey
+		cfg.PrivateKey = &key
+	}
+	if dev.ListenPort != 0 {
+		port := dev.ListenPort
+		cfg.ListenPort = &port
+	}
+	if dev.FirewallMark != 0 {
+		mark := dev.FirewallMark
+		cfg.FirewallMark = &mark
+	}
+	for _, p := range dev.Peers {
+		peer := wgtypes.PeerConfig{
+			PublicKey:  p.PublicKey,
+			AllowedIPs: append([]net.IPNet(nil), p.AllowedIPs...),
+		}
+		if p.PresharedKey != (wgtypes.Key{}) {
+			key := p.PresharedKey
+			peer.PresharedKey = &key
+		}
+		if p.Endpoint != nil {
+			endpoint := *p.Endpoint
+			peer.Endpoint = &endpoint
+		}
+		if p.PersistentKeepaliveInterval != 0 {
+			interval := p.PersistentKeepaliveInterval
+			peer.PersistentKeepaliveInterval = &interval
+		}
+		cfg.Peers = append(cfg.Peers, peer)
+	}
+	return cfg
+}
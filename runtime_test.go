@@ -0,0 +1,48 @@
+package wgquick_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRuntimeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c, _, _ := newFakeClient(t, wgquick.WithStateDir(dir))
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig+`
+[Interface]
+Table = 1234
+`)))
+	_, dst, err := net.ParseCIDR("172.16.0.0/12")
+	require.NoError(t, err)
+	cfg.Routes = []wgquick.Route{{Dst: *dst, Gateway: net.ParseIP("10.192.122.3"), OnLink: true}}
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+
+	got, err := c.GetRuntimeConfig("wg0")
+	require.NoError(t, err)
+	assert.Equal(t, wgquick.DefaultMTU, got.MTU)
+	assert.Equal(t, cfg.Address, got.Address)
+	assert.Equal(t, wgquick.RouteTable(1234), got.Table)
+	assert.Equal(t, *cfg.PrivateKey, *got.PrivateKey)
+	assert.Equal(t, *cfg.ListenPort, *got.ListenPort)
+	require.Len(t, got.Peers, 2)
+	for i := range cfg.Peers {
+		assert.Equal(t, cfg.Peers[i].PublicKey, got.Peers[i].PublicKey)
+		assert.Equal(t, cfg.Peers[i].AllowedIPs, got.Peers[i].AllowedIPs)
+	}
+	require.Len(t, got.Routes, 1)
+	assert.Equal(t, cfg.Routes[0].String(), got.Routes[0].String())
+
+	_, err = c.GetRuntimeConfig("lo")
+	assert.Error(t, err)
+}
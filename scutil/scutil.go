@@ -0,0 +1,72 @@
+// Package scutil applies the tunnel DNS servers on macOS through the SystemConfiguration dynamic store, for the darwin
+// port and the users driving utun themselves:
+//
+//	err := scutil.Set("utun3", servers, []string{"corp.example"})
+//	defer scutil.Remove("utun3")
+//
+// The settings are published as the DNS entity of the tunnel's own service, State:/Network/Service/wg-quick-go-<iface>/DNS,
+// with the empty supplemental match domain, so mDNSResponder uses the tunnel servers for all the queries. Nothing of the
+// user's network services is changed, Remove deleting the entity restores the previous resolver configuration. Unlike
+// wg-quick's networksetup calls they survive the network changes without a monitor process.
+package scutil
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// Command is the scutil binary
+var Command = "scutil"
+
+// key returns the dynamic store key of the interface DNS entity
+func key(iface string) string {
+	return "State:/Network/Service/wg-quick-go-" + iface + "/DNS"
+}
+
+// setScript returns the scutil commands publishing the DNS entity
+func setScript(iface string, servers []net.IP, search []string) string {
+	b := &bytes.Buffer{}
+	fmt.Fprintln(b, "d.init")
+	var addrs []string
+	for _, ip := range servers {
+		addrs = append(addrs, ip.String())
+	}
+	fmt.Fprintf(b, "d.add ServerAddresses * %s\n", strings.Join(addrs, " "))
+	if len(search) > 0 {
+		fmt.Fprintf(b, "d.add SearchDomains * %s\n", strings.Join(search, " "))
+	}
+	// the empty match domain makes the resolver the default one
+	fmt.Fprintln(b, `d.add SupplementalMatchDomains * ""`)
+	fmt.Fprintf(b, "set %s\n", key(iface))
+	return b.String()
+}
+
+// Set publishes the DNS servers and search domains of the interface, replacing the previous ones
+func Set(iface string, servers []net.IP, search []string) error {
+	if len(servers) == 0 {
+		return fmt.Errorf("no DNS servers")
+	}
+	return run(setScript(iface, servers, search))
+}
+
+// Remove deletes the DNS entity of the interface published by Set
+func Remove(iface string) error {
+	return run(fmt.Sprintf("remove %s\n", key(iface)))
+}
+
+func run(script string) error {
+	cmd := exec.Command(Command)
+	cmd.Stdin = strings.NewReader(script)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", Command, err, bytes.TrimSpace(out))
+	}
+	// scutil reports the failed commands on the output, exiting with 0
+	if out := bytes.TrimSpace(out); len(out) > 0 {
+		return fmt.Errorf("%s: %s", Command, out)
+	}
+	return nil
+}
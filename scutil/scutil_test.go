@@ -0,0 +1,41 @@
+package scutil
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetScript(t *testing.T) {
+	assert.Equal(t, `d.init
+d.add ServerAddresses * 10.0.0.1 fd00::1
+d.add SearchDomains * corp.example
+d.add SupplementalMatchDomains * ""
+set State:/Network/Service/wg-quick-go-utun3/DNS
+`, setScript("utun3", []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")}, []string{"corp.example"}))
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scutil")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input")
+	fake := filepath.Join(dir, "scutil")
+	require.NoError(t, ioutil.WriteFile(fake, []byte("#!/bin/sh\ncat > "+input+"\n"), 0755))
+	defer func(cmd string) { Command = cmd }(Command)
+	Command = fake
+
+	require.NoError(t, Remove("utun3"))
+	b, err := ioutil.ReadFile(input)
+	require.NoError(t, err)
+	assert.Equal(t, "remove State:/Network/Service/wg-quick-go-utun3/DNS\n", string(b))
+	assert.Error(t, Set("utun3", nil, nil))
+
+	require.NoError(t, ioutil.WriteFile(fake, []byte("#!/bin/sh\necho 'No such key'\n"), 0755))
+	assert.Error(t, Remove("utun3"), "scutil reports the errors on the output")
+}
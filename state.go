@@ -0,0 +1,377 @@
+package wgquick
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// DefaultStateDir holds the per-interface state files
+const DefaultStateDir = "/run/wg-quick-go"
+
+// State records what Up and Sync applied for the interface, so Down cleans up exactly even if the config changed since.
+// The addresses and routes are in CIDR notation.
+type State struct {
+	Address            []string `json:"address,omitempty"`
+	DNS                []string `json:"dns,omitempty"`
+	DNSBackend         string   `json:"dnsBackend,omitempty"`
+	Table              int      `json:"table"`
+	RouteProtocol      int      `json:"routeProtocol"`
+	RouteMetric        int      `json:"routeMetric,omitempty"`
+	Routes             []string `json:"routes,omitempty"`
+	SourceRules        bool     `json:"sourceRules,omitempty"`
+	SourceRulePriority int      `json:"sourceRulePriority,omitempty"`
+	FirewallMark       *int     `json:"firewallMark,omitempty"`
+	// DisplacedRoutes are the foreign routes replaced by the tunnel default routes, restored by Down
+	DisplacedRoutes []StateRoute `json:"displacedRoutes,omitempty"`
+	// Sysctls are the previous values of the sysctls enabled by Up, e.g. by IPForward, restored by Down
+	Sysctls map[string]string `json:"sysctls,omitempty"`
+	// ProxyDevice and ProxyNeighbors are the proxy neighbor entries, see Config.ProxyDevice
+	ProxyDevice    string   `json:"proxyDevice,omitempty"`
+	ProxyNeighbors []string `json:"proxyNeighbors,omitempty"`
+	// FirewallRules are the iptables rules (without the action) added by UpExitNode and EnableAppRouting, deleted by Down
+	FirewallRules [][]string `json:"firewallRules,omitempty"`
+	// PolicyRules are the policy rules added by EnableAppRouting, deleted by Down
+	PolicyRules []StateRule `json:"policyRules,omitempty"`
+}
+
+// StateRule is the recorded fwmark policy rule
+type StateRule struct {
+	Family   int `json:"family"`
+	Priority int `json:"priority"`
+	Mark     int `json:"mark"`
+	Mask     int `json:"mask"`
+	Table    int `json:"table"`
+}
+
+func newStateRule(rule netlink.Rule) StateRule {
+	return StateRule{Family: rule.Family, Priority: rule.Priority, Mark: rule.Mark, Mask: rule.Mask, Table: rule.Table}
+}
+
+func (st StateRule) netlinkRule() netlink.Rule {
+	rule := netlink.NewRule()
+	rule.Family = st.Family
+	rule.Priority = st.Priority
+	rule.Mark = st.Mark
+	rule.Mask = st.Mask
+	rule.Table = st.Table
+	return *rule
+}
+
+// policyRules returns the recorded policy rules
+func (st *State) policyRules() []netlink.Rule {
+	var rules []netlink.Rule
+	for _, s := range st.PolicyRules {
+		rules = append(rules, s.netlinkRule())
+	}
+	return rules
+}
+
+// StateRoute is the recorded netlink route
+type StateRoute struct {
+	Dst       string `json:"dst"`
+	Gateway   string `json:"gateway,omitempty"`
+	Src       string `json:"src,omitempty"`
+	LinkIndex int    `json:"linkIndex,omitempty"`
+	Table     int    `json:"table"`
+	Protocol  int    `json:"protocol"`
+	Priority  int    `json:"priority,omitempty"`
+	Scope     int    `json:"scope,omitempty"`
+	Type      int    `json:"type"`
+	Flags     int    `json:"flags,omitempty"`
+}
+
+func newStateRoute(rt netlink.Route) StateRoute {
+	st := StateRoute{
+		Dst:       rt.Dst.String(),
+		LinkIndex: rt.LinkIndex,
+		Table:     rt.Table,
+		Protocol:  rt.Protocol,
+		Priority:  rt.Priority,
+		Scope:     int(rt.Scope),
+		Type:      rt.Type,
+		Flags:     rt.Flags,
+	}
+	if rt.Gw != nil {
+		st.Gateway = rt.Gw.String()
+	}
+	if rt.Src != nil {
+		st.Src = rt.Src.String()
+	}
+	return st
+}
+
+func (st StateRoute) netlinkRoute() (netlink.Route, error) {
+	dst, err := parseIPNet(st.Dst)
+	if err != nil {
+		return netlink.Route{}, fmt.Errorf("invalid state route: %w", err)
+	}
+	return netlink.Route{
+		Dst:       &dst,
+		Gw:        net.ParseIP(st.Gateway),
+		Src:       net.ParseIP(st.Src),
+		LinkIndex: st.LinkIndex,
+		Table:     st.Table,
+		Protocol:  st.Protocol,
+		Priority:  st.Priority,
+		Scope:     netlink.Scope(st.Scope),
+		Type:      st.Type,
+		Flags:     st.Flags,
+	}, nil
+}
+
+// displacedRoutes returns the recorded displaced routes
+func (st *State) displacedRoutes() ([]netlink.Route, error) {
+	var routes []netlink.Route
+	for _, s := range st.DisplacedRoutes {
+		rt, err := s.netlinkRoute()
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, rt)
+	}
+	return routes, nil
+}
+
+// WithStateDir sets the directory of the per-interface state files. It's DefaultStateDir for the kernel netlink and
+// none for the others, e.g. fakes. Empty dir disables the state files, Down then cleans up according to its config.
+func WithStateDir(dir string) ClientOption {
+	return func(c *Client) {
+		c.stateDir = &dir
+	}
+}
+
+// runDir returns the directory set by the option, or the default one for the kernel netlink
+func (c *Client) runDir(dir *string, def string) string {
+	if dir != nil {
+		return *dir
+	}
+	if c.kernelNetlink() {
+		return def
+	}
+	return ""
+}
+
+func (c *Client) statePath(iface string) string {
+	dir := c.runDir(c.stateDir, DefaultStateDir)
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, iface+".json")
+}
+
+// newState records the config with the defaults filled in
+func newState(cfg *Config) *State {
+	st := &State{
+		Table:              int(cfg.Table),
+		RouteProtocol:      cfg.RouteProtocol,
+		RouteMetric:        cfg.RouteMetric,
+		SourceRules:        cfg.SourceRules,
+		SourceRulePriority: cfg.SourceRulePriority,
+		FirewallMark:       cfg.FirewallMark,
+		ProxyDevice:        cfg.ProxyDevice,
+	}
+	for _, ip := range cfg.proxyNeighbors() {
+		st.ProxyNeighbors = append(st.ProxyNeighbors, ip.String())
+	}
+	for _, addr := range cfg.Address {
+		st.Address = append(st.Address, addr.String())
+	}
+	for _, rt := range cfg.managedRoutes() {
+		st.Routes = append(st.Routes, rt.String())
+	}
+	for _, rt := range cfg.Routes {
+		st.Routes = append(st.Routes, rt.Dst.String())
+	}
+	return st
+}
+
+// apply returns the copy of the config with the recorded resources instead of the configured ones
+func (st *State) apply(cfg *Config) (*Config, error) {
+	out := cfg.clone()
+	out.Address, out.DNS, out.Routes, out.Peers = nil, nil, nil, nil
+	for _, s := range st.Address {
+		addr, err := parseIPNet(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state address: %w", err)
+		}
+		out.Address = append(out.Address, addr)
+	}
+	for _, s := range st.DNS {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid state DNS %s", s)
+		}
+		out.DNS = append(out.DNS, ip)
+	}
+	for _, s := range st.Routes {
+		dst, err := parseIPNet(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state route: %w", err)
+		}
+		out.Routes = append(out.Routes, Route{Dst: dst})
+	}
+	out.Table = RouteTable(st.Table)
+	out.RouteProtocol = st.RouteProtocol
+	out.RouteMetric = st.RouteMetric
+	out.SourceRules = st.SourceRules
+	out.SourceRulePriority = st.SourceRulePriority
+	out.FirewallMark = st.FirewallMark
+	if len(st.DNS) > 0 {
+		out.DNSBackend = st.DNSBackend
+	}
+	return out, nil
+}
+
+// LoadState returns the recorded state of the interface, nil if there's none
+func (c *Client) LoadState(iface string) (*State, error) {
+	path := c.statePath(iface)
+	if path == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := &State{}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("cannot parse state file %s: %w", path, err)
+	}
+	return st, nil
+}
+
+// saveState atomically replaces the state file of the interface
+func (c *Client) saveState(iface string, st *State) error {
+	path := c.statePath(iface)
+	if path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// recordState records the synced config, keeping the DNS and sysctls recorded by Up and the routes displaced by the previous syncs
+func (c *Client) recordState(iface string, cfg *Config, displaced []netlink.Route, log logrus.FieldLogger) error {
+	prev, err := c.LoadState(iface)
+	if err != nil {
+		return err
+	}
+	st := newState(cfg)
+	if prev != nil {
+		st.DNS, st.DNSBackend = prev.DNS, prev.DNSBackend
+		st.DisplacedRoutes = prev.DisplacedRoutes
+		st.Sysctls = prev.Sysctls
+		st.FirewallRules = prev.FirewallRules
+		st.PolicyRules = prev.PolicyRules
+	}
+	for _, rt := range displaced {
+		st.DisplacedRoutes = append(st.DisplacedRoutes, newStateRoute(rt))
+	}
+	if err := c.saveState(iface, st); err != nil {
+		log.WithError(err).Error("cannot record state")
+		return err
+	}
+	return nil
+}
+
+// recordDNS records the DNS servers and backend set by Up
+func (c *Client) recordDNS(iface string, cfg *Config, log logrus.FieldLogger) error {
+	st, err := c.LoadState(iface)
+	if err != nil || st == nil {
+		return err
+	}
+	st.DNS = nil
+	for _, ip := range cfg.DNS {
+		st.DNS = append(st.DNS, ip.String())
+	}
+	st.DNSBackend = cfg.DNSBackend
+	if err := c.saveState(iface, st); err != nil {
+		log.WithError(err).Error("cannot record state")
+		return err
+	}
+	return nil
+}
+
+// updateState changes the recorded state of the interface, if there's one
+func (c *Client) updateState(iface string, log logrus.FieldLogger, update func(st *State)) error {
+	st, err := c.LoadState(iface)
+	if err != nil || st == nil {
+		return err
+	}
+	update(st)
+	if err := c.saveState(iface, st); err != nil {
+		log.WithError(err).Error("cannot record state")
+		return err
+	}
+	return nil
+}
+
+// recordFirewallRules adds the iptables rules to the recorded ones and removes the deleted ones
+func (c *Client) recordFirewallRules(iface string, added, deleted [][]string, log logrus.FieldLogger) error {
+	return c.updateState(iface, log, func(st *State) {
+		key := func(rule []string) string { return strings.Join(rule, "\x00") }
+		drop := make(map[string]bool)
+		for _, rule := range append(added, deleted...) {
+			drop[key(rule)] = true
+		}
+		var rules [][]string
+		for _, rule := range st.FirewallRules {
+			if !drop[key(rule)] {
+				rules = append(rules, rule)
+			}
+		}
+		st.FirewallRules = append(rules, added...)
+	})
+}
+
+// recordPolicyRules adds the policy rules to the recorded ones and removes the deleted ones
+func (c *Client) recordPolicyRules(iface string, added, deleted []netlink.Rule, log logrus.FieldLogger) error {
+	return c.updateState(iface, log, func(st *State) {
+		drop := make(map[StateRule]bool)
+		for _, rule := range append(added, deleted...) {
+			drop[newStateRule(rule)] = true
+		}
+		var rules []StateRule
+		for _, rule := range st.PolicyRules {
+			if !drop[rule] {
+				rules = append(rules, rule)
+			}
+		}
+		for _, rule := range added {
+			rules = append(rules, newStateRule(rule))
+		}
+		st.PolicyRules = rules
+	})
+}
+
+// removeState deletes the state file of the interface
+func (c *Client) removeState(iface string) error {
+	path := c.statePath(iface)
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package wgquick_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestDownUsesState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c, nl, _ := newFakeClient(t, wgquick.WithStateDir(dir))
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.Table = 1234
+	cfg.SourceRules = true
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	assert.Len(t, nl.Rules(), 2)
+	st, err := c.LoadState("wg0")
+	require.NoError(t, err)
+	require.NotNil(t, st)
+	assert.Equal(t, []string{"10.192.122.1/24", "10.10.0.1/16"}, st.Address)
+
+	changed := &wgquick.Config{}
+	require.NoError(t, changed.UnmarshalText([]byte(testConfig)))
+	require.NoError(t, c.Down(changed, "wg0", testLog))
+	assert.Empty(t, nl.Rules(), "rules recorded by Up are deleted")
+	st, err = c.LoadState("wg0")
+	require.NoError(t, err)
+	assert.Nil(t, st)
+}
+
+func TestRestoreDisplacedRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c, nl, _ := newFakeClient(t, wgquick.WithStateDir(dir))
+	defer c.Close()
+
+	require.NoError(t, nl.LinkAdd(&netlink.GenericLink{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}, LinkType: "device"}))
+	eth0, err := nl.LinkByName("eth0")
+	require.NoError(t, err)
+	_, dst, err := net.ParseCIDR("0.0.0.0/0")
+	require.NoError(t, err)
+	sysDefault := netlink.Route{LinkIndex: eth0.Attrs().Index, Dst: dst, Gw: net.ParseIP("192.168.1.1"), Table: unix.RT_TABLE_MAIN, Protocol: unix.RTPROT_DHCP, Type: unix.RTN_UNICAST}
+	require.NoError(t, nl.RouteReplace(&sysDefault))
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.Peers[1].AllowedIPs = []net.IPNet{*dst}
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+	for _, rt := range nl.Routes() {
+		assert.NotEqual(t, eth0.Attrs().Index, rt.LinkIndex, "tunnel default route replaces the system one")
+	}
+
+	require.NoError(t, c.Down(cfg, "wg0", testLog))
+	routes := nl.Routes()
+	require.Len(t, routes, 1)
+	assert.Equal(t, eth0.Attrs().Index, routes[0].LinkIndex)
+	assert.Equal(t, "192.168.1.1", routes[0].Gw.String())
+	assert.Equal(t, unix.RTPROT_DHCP, routes[0].Protocol)
+}
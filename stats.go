@@ -0,0 +1,109 @@
+package wgquick
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ErrPeerNotFound is returned by PeerStats when the device has no peer with the key
+var ErrPeerNotFound = errors.New("peer not found")
+
+// PeerStatistics are the runtime statistics of a single peer, see Client.PeerStats
+type PeerStatistics struct {
+	PublicKey wgtypes.Key
+	// Endpoint is the last known peer address, nil if the peer never connected and has no configured endpoint
+	Endpoint *net.UDPAddr
+	// LastHandshakeTime is zero if there was no handshake yet
+	LastHandshakeTime time.Time
+	ReceiveBytes      int64
+	TransmitBytes     int64
+	AllowedIPs        []net.IPNet
+}
+
+// PeerGetter is implemented by the Wireguard implementations which can look up a single peer cheaper than the whole device,
+// e.g. UAPISocket only parses the peer lines of the dump. Device is scanned for the peer without it.
+type PeerGetter interface {
+	// Peer returns the device peer with the key, ErrPeerNotFound if there's none
+	Peer(name string, key wgtypes.Key) (*wgtypes.Peer, error)
+}
+
+// PeerStats returns the statistics of the peer, ErrPeerNotFound if the device has no such peer, e.g. for the monitoring
+// agents polling a few peers of large devices. The kernel has no single peer lookup, there it still dumps the whole device,
+// but skips building the statistics of the other peers.
+func (c *Client) PeerStats(iface string, key wgtypes.Key) (PeerStatistics, error) {
+	cl, err := c.wgctrl()
+	if err != nil {
+		return PeerStatistics{}, err
+	}
+	var peer *wgtypes.Peer
+	if pg, ok := cl.(PeerGetter); ok {
+		if peer, err = pg.Peer(iface, key); err != nil {
+			return PeerStatistics{}, err
+		}
+	} else {
+		dev, err := cl.Device(iface)
+		if err != nil {
+			return PeerStatistics{}, err
+		}
+		for i := range dev.Peers {
+			if dev.Peers[i].PublicKey == key {
+				peer = &dev.Peers[i]
+				break
+			}
+		}
+		if peer == nil {
+			return PeerStatistics{}, fmt.Errorf("%s: %w", iface, ErrPeerNotFound)
+		}
+	}
+	return PeerStatistics{
+		PublicKey:         peer.PublicKey,
+		Endpoint:          peer.Endpoint,
+		LastHandshakeTime: peer.LastHandshakeTime,
+		ReceiveBytes:      peer.ReceiveBytes,
+		TransmitBytes:     peer.TransmitBytes,
+		AllowedIPs:        append([]net.IPNet(nil), peer.AllowedIPs...),
+	}, nil
+}
+
+// Peer returns the peer from the UAPI `get=1` dump, parsing only its lines
+func (s *UAPISocket) Peer(name string, key wgtypes.Key) (*wgtypes.Peer, error) {
+	lines, err := s.request("get=1\n\n")
+	if err != nil {
+		return nil, err
+	}
+	want := hex.EncodeToString(key[:])
+	var peer *wgtypes.Peer
+	var handshake [2]int64
+	for no, ln := range lines {
+		parts := strings.SplitN(ln, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("[line %d]: cannot parse line, missing =", no+1)
+		}
+		key, value := parts[0], parts[1]
+		if key == "public_key" {
+			if peer != nil {
+				break
+			}
+			if value != want {
+				continue
+			}
+			peer = &wgtypes.Peer{}
+		}
+		if peer == nil {
+			continue
+		}
+		if err := parseUAPIDumpLine(nil, peer, &handshake, key, value); err != nil {
+			return nil, fmt.Errorf("[line %d]: %w", no+1, err)
+		}
+	}
+	if peer == nil {
+		return nil, fmt.Errorf("%s: %w", name, ErrPeerNotFound)
+	}
+	return peer, nil
+}
@@ -0,0 +1,29 @@
+package wgquick_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestPeerStats(t *testing.T) {
+	c, _, _ := newFakeClient(t)
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+
+	stats, err := c.PeerStats("wg0", cfg.Peers[1].PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Peers[1].PublicKey, stats.PublicKey)
+	assert.Equal(t, cfg.Peers[1].AllowedIPs, stats.AllowedIPs)
+	assert.True(t, stats.LastHandshakeTime.IsZero())
+
+	_, err = c.PeerStats("wg0", wgtypes.Key{1})
+	assert.True(t, errors.Is(err, wgquick.ErrPeerNotFound))
+}
@@ -0,0 +1,185 @@
+// Package stun discovers the public address of the host behind NAT with the STUN binding request (RFC 5389), so the
+// configs generated for the other peers contain the reachable endpoint:
+//
+//	addr, err := stun.Discover(ctx, stun.DefaultServer, 51820)
+//	endpoint := addr.String()
+//
+// The request has to be sent from the wireguard listen port for the NAT mapping to match the tunnel traffic. The port
+// can't be bound while the wireguard interface uses it, so Discover runs before Up, e.g. when generating the configs.
+package stun
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultServer is the public STUN server used when none is configured
+const DefaultServer = "stun.l.google.com:19302"
+
+const (
+	magicCookie = 0x2112A442
+	headerLen   = 20
+
+	bindingRequest  = 0x0001
+	bindingResponse = 0x0101
+
+	attrMappedAddress    = 0x0001
+	attrXorMappedAddress = 0x0020
+
+	familyIPv4 = 0x01
+	familyIPv6 = 0x02
+)
+
+// RetransmitInterval is the initial wait for the response before the request is resent, doubled with every retry
+var RetransmitInterval = 500 * time.Millisecond
+
+// maxRequests is the number of the sent requests before giving up, Rc in RFC 5389
+const maxRequests = 7
+
+// Discover sends the binding request to server from localPort (any port if 0) and returns the public address the server
+// saw the request from. It gives up when ctx is done or the server didn't respond to any of the retransmitted requests.
+func Discover(ctx context.Context, server string, localPort int) (*net.UDPAddr, error) {
+	raddr, err := net.ResolveUDPAddr("udp", server)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: localPort})
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on port %d, is the wireguard interface up? %w", localPort, err)
+	}
+	defer conn.Close()
+
+	var txID [12]byte
+	if _, err := rand.Read(txID[:]); err != nil {
+		return nil, err
+	}
+	req := request(txID)
+	buf := make([]byte, 1500)
+	wait := RetransmitInterval
+	for i := 0; i < maxRequests; i++ {
+		if _, err := conn.WriteToUDP(req, raddr); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(wait)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			if !from.IP.Equal(raddr.IP) || from.Port != raddr.Port {
+				continue
+			}
+			addr, err := parseResponse(buf[:n], txID)
+			if err == errOtherTransaction {
+				continue
+			}
+			return addr, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		wait *= 2
+	}
+	return nil, fmt.Errorf("no response from %s", server)
+}
+
+// request encodes the binding request without attributes
+func request(txID [12]byte) []byte {
+	req := make([]byte, headerLen)
+	binary.BigEndian.PutUint16(req[0:], bindingRequest)
+	binary.BigEndian.PutUint32(req[4:], magicCookie)
+	copy(req[8:], txID[:])
+	return req
+}
+
+var errOtherTransaction = errors.New("response to another transaction")
+
+// parseResponse returns the mapped address of the binding response, preferring XOR-MAPPED-ADDRESS
+func parseResponse(msg []byte, txID [12]byte) (*net.UDPAddr, error) {
+	if len(msg) < headerLen || binary.BigEndian.Uint32(msg[4:]) != magicCookie {
+		return nil, errors.New("not a STUN message")
+	}
+	if !bytes.Equal(msg[8:headerLen], txID[:]) {
+		return nil, errOtherTransaction
+	}
+	if t := binary.BigEndian.Uint16(msg[0:]); t != bindingResponse {
+		return nil, fmt.Errorf("unexpected STUN message type %#04x", t)
+	}
+	length := int(binary.BigEndian.Uint16(msg[2:]))
+	if headerLen+length > len(msg) {
+		return nil, errors.New("truncated STUN message")
+	}
+	var mapped *net.UDPAddr
+	attrs := msg[headerLen : headerLen+length]
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		n := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+n > len(attrs) {
+			return nil, errors.New("truncated STUN attribute")
+		}
+		value := attrs[4 : 4+n]
+		switch typ {
+		case attrXorMappedAddress:
+			return parseAddress(value, msg[4:headerLen])
+		case attrMappedAddress:
+			addr, err := parseAddress(value, nil)
+			if err != nil {
+				return nil, err
+			}
+			mapped = addr
+		}
+		// the attributes are padded to 4 bytes
+		n = (n + 3) &^ 3
+		if 4+n > len(attrs) {
+			break
+		}
+		attrs = attrs[4+n:]
+	}
+	if mapped == nil {
+		return nil, errors.New("no mapped address in STUN response")
+	}
+	return mapped, nil
+}
+
+// parseAddress decodes the (XOR-)MAPPED-ADDRESS value, xor is the magic cookie and transaction ID for the XOR one
+func parseAddress(value []byte, xor []byte) (*net.UDPAddr, error) {
+	if len(value) < 4 {
+		return nil, errors.New("truncated STUN address")
+	}
+	var ipLen int
+	switch value[1] {
+	case familyIPv4:
+		ipLen = net.IPv4len
+	case familyIPv6:
+		ipLen = net.IPv6len
+	default:
+		return nil, fmt.Errorf("unknown STUN address family %d", value[1])
+	}
+	if len(value) < 4+ipLen {
+		return nil, errors.New("truncated STUN address")
+	}
+	port := binary.BigEndian.Uint16(value[2:])
+	ip := append(net.IP(nil), value[4:4+ipLen]...)
+	if xor != nil {
+		port ^= magicCookie >> 16
+		for i := range ip {
+			ip[i] ^= xor[i]
+		}
+	}
+	return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -0,0 +1,105 @@
+package stun
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// response encodes the binding response with the address attribute, xor-ed for XOR-MAPPED-ADDRESS
+func response(req []byte, typ uint16, addr *net.UDPAddr) []byte {
+	ip := addr.IP.To4()
+	family := byte(familyIPv4)
+	if ip == nil {
+		ip, family = addr.IP.To16(), familyIPv6
+	}
+	value := make([]byte, 4+len(ip))
+	value[1] = family
+	port := uint16(addr.Port)
+	copy(value[4:], ip)
+	if typ == attrXorMappedAddress {
+		port ^= magicCookie >> 16
+		for i := range ip {
+			value[4+i] ^= req[4+i]
+		}
+	}
+	binary.BigEndian.PutUint16(value[2:], port)
+
+	msg := make([]byte, headerLen+4+len(value))
+	copy(msg, req[:headerLen])
+	binary.BigEndian.PutUint16(msg[0:], bindingResponse)
+	binary.BigEndian.PutUint16(msg[2:], uint16(4+len(value)))
+	binary.BigEndian.PutUint16(msg[headerLen:], typ)
+	binary.BigEndian.PutUint16(msg[headerLen+2:], uint16(len(value)))
+	copy(msg[headerLen+4:], value)
+	return msg
+}
+
+func TestDiscover(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		dropped := false
+		for {
+			n, from, err := server.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if !dropped {
+				// the first request is lost, the retransmitted one is answered
+				dropped = true
+				continue
+			}
+			server.WriteToUDP(response(buf[:n], attrXorMappedAddress, from), from)
+		}
+	}()
+
+	RetransmitInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addr, err := Discover(ctx, server.LocalAddr().String(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", addr.IP.String())
+	assert.NotZero(t, addr.Port)
+}
+
+func TestDiscoverTimeout(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer server.Close()
+
+	RetransmitInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = Discover(ctx, server.LocalAddr().String(), 0)
+	assert.Error(t, err)
+}
+
+func TestParseResponse(t *testing.T) {
+	var txID [12]byte
+	copy(txID[:], "0123456789ab")
+	req := request(txID)
+	for _, addr := range []*net.UDPAddr{
+		{IP: net.ParseIP("203.0.113.5").To4(), Port: 51820},
+		{IP: net.ParseIP("2001:db8::5"), Port: 4500},
+	} {
+		for _, typ := range []uint16{attrMappedAddress, attrXorMappedAddress} {
+			got, err := parseResponse(response(req, typ, addr), txID)
+			require.NoError(t, err)
+			assert.Equal(t, addr.String(), got.String())
+		}
+	}
+
+	var other [12]byte
+	_, err := parseResponse(response(req, attrXorMappedAddress, &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4)}), other)
+	assert.Equal(t, errOtherTransaction, err)
+	_, err = parseResponse(req[:10], txID)
+	assert.Error(t, err)
+}
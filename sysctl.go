@@ -0,0 +1,99 @@
+package wgquick
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultSysctlDir is where the sysctls are set
+const DefaultSysctlDir = "/proc/sys"
+
+// forwardingSysctls are enabled by Config.IPForward
+var forwardingSysctls = []string{"net/ipv4/ip_forward", "net/ipv6/conf/all/forwarding"}
+
+// WithSysctlDir sets the directory the sysctls are set in. It's DefaultSysctlDir for the kernel netlink and none for
+// the others, e.g. fakes. Empty dir disables setting the sysctls.
+func WithSysctlDir(dir string) ClientOption {
+	return func(c *Client) {
+		c.sysctlDir = &dir
+	}
+}
+
+// wantedSysctls returns the sysctls to enable for the config: forwarding with IPForward and proxy NDP on ProxyDevice
+func (cfg *Config) wantedSysctls() []string {
+	var names []string
+	if cfg.IPForward {
+		names = append(names, forwardingSysctls...)
+	}
+	if cfg.ProxyDevice != "" {
+		names = append(names, "net/ipv6/conf/"+cfg.ProxyDevice+"/proxy_ndp")
+	}
+	return names
+}
+
+// enableSysctls enables the config sysctls, recording the previous values in the state for Down.
+// The missing sysctls, e.g. IPv6 ones with IPv6 disabled, are skipped.
+func (c *Client) enableSysctls(cfg *Config, iface string, log logrus.FieldLogger) error {
+	dir := c.runDir(c.sysctlDir, DefaultSysctlDir)
+	names := cfg.wantedSysctls()
+	if dir == "" || len(names) == 0 {
+		return nil
+	}
+	prev := make(map[string]string)
+	for _, name := range names {
+		log := log.WithField("sysctl", name)
+		path := filepath.Join(dir, name)
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			log.Warn("sysctl not available, not enabling it")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		value := strings.TrimSpace(string(b))
+		if value == "1" {
+			continue
+		}
+		err = ioutil.WriteFile(path, []byte("1\n"), 0644)
+		c.record("set sysctl", name+"=1", err)
+		if err != nil {
+			log.WithError(err).Error("cannot enable sysctl")
+			return err
+		}
+		prev[name] = value
+		log.Info("enabled sysctl")
+	}
+	st, err := c.LoadState(iface)
+	if err != nil || st == nil {
+		return err
+	}
+	st.Sysctls = prev
+	if err := c.saveState(iface, st); err != nil {
+		log.WithError(err).Error("cannot record state")
+		return err
+	}
+	return nil
+}
+
+// restoreSysctls sets back the sysctls changed by enableSysctls
+func (c *Client) restoreSysctls(prev map[string]string, log logrus.FieldLogger) {
+	dir := c.runDir(c.sysctlDir, DefaultSysctlDir)
+	if dir == "" {
+		return
+	}
+	for name, value := range prev {
+		log := log.WithField("sysctl", name)
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0644)
+		c.record("set sysctl", name+"="+value, err)
+		if err != nil {
+			log.WithError(err).Warn("cannot restore sysctl")
+			continue
+		}
+		log.WithField("value", value).Info("restored sysctl")
+	}
+}
@@ -0,0 +1,38 @@
+package wgquick_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPForward(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sysctl := filepath.Join(dir, "sys/net/ipv4/ip_forward")
+	require.NoError(t, os.MkdirAll(filepath.Dir(sysctl), 0755))
+	require.NoError(t, ioutil.WriteFile(sysctl, []byte("0\n"), 0644))
+	c, _, _ := newFakeClient(t,
+		wgquick.WithStateDir(dir), wgquick.WithSysctlDir(filepath.Join(dir, "sys")))
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.IPForward = true
+	require.NoError(t, c.Up(cfg, "wg0", testLog), "missing IPv6 sysctl is skipped")
+	b, err := ioutil.ReadFile(sysctl)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", string(b))
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+
+	require.NoError(t, c.Down(cfg, "wg0", testLog))
+	b, err = ioutil.ReadFile(sysctl)
+	require.NoError(t, err)
+	assert.Equal(t, "0\n", string(b))
+}
@@ -0,0 +1,491 @@
+package wgquick
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The TOML representation mirrors the INI one key by key, with the wg-quick key names. The sections are the
+// [Interface] table and the [[Peer]] array of tables, e.g.
+//
+//	[Interface]
+//	Address = ["10.0.0.1/24", "fd00::1/64"]
+//	DNS = ["10.0.0.53"]
+//	PrivateKey = "..."
+//	ListenPort = 51820
+//	PostUp = "logger %i up"
+//	SaveConfig = false
+//
+//	[[Peer]]
+//	Name = "laptop"
+//	PublicKey = "..."
+//	AllowedIPs = ["10.0.0.2/32"]
+//	Endpoint = "vpn.example.com:51820"
+//	PersistentKeepalive = 25
+//
+// Address, DNS and AllowedIPs are arrays of strings, a single string is accepted as well. ListenPort, FwMark, MTU,
+// PersistentKeepalive and the AmneziaWG Jc, Jmin, Jmax, S1, S2 and H1-H4 are integers, SaveConfig is a boolean; all of
+// them may also be strings with the INI value, e.g. FwMark = "off". The other keys are strings. Name is the peer name,
+// the `# Name = x` comment of the INI. The comments are kept like in the INI. Only this subset of TOML is supported:
+// the basic and literal single-line strings, integers, booleans and arrays of them, no floats, dates or inline tables.
+
+// tomlIntKeys are the keys with the integer values
+var tomlIntKeys = map[string]bool{
+	"ListenPort":          true,
+	"FwMark":              true,
+	"MTU":                 true,
+	"PersistentKeepalive": true,
+	"Jc":                  true,
+	"Jmin":                true,
+	"Jmax":                true,
+	"S1":                  true,
+	"S2":                  true,
+	"H1":                  true,
+	"H2":                  true,
+	"H3":                  true,
+	"H4":                  true,
+}
+
+// MarshalTOML serializes the config as TOML, see the schema above. Like MarshalText it keeps the comments and key
+// ordering of the parsed configs.
+func (cfg *Config) MarshalTOML() ([]byte, error) {
+	text, err := cfg.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(text)
+	return iniToTOML(text)
+}
+
+// UnmarshalTOML parses the TOML config with default options
+func (cfg *Config) UnmarshalTOML(text []byte) error {
+	return cfg.ParseTOML(text)
+}
+
+// ParseTOML parses the TOML config with given options. The options and the errors are the same as for Parse, with
+// the line numbers of the TOML text.
+func (cfg *Config) ParseTOML(text []byte, opts ...ParseOption) error {
+	if len(text) > MaxConfigSize {
+		return fmt.Errorf("config is %d bytes, exceeding the %d bytes limit", len(text), MaxConfigSize)
+	}
+	if !utf8.Valid(text) {
+		return fmt.Errorf("config is not valid UTF-8")
+	}
+	ini, err := tomlToINI(string(text))
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(ini)
+	return cfg.Parse(ini, opts...)
+}
+
+// iniToTOML converts the INI config line by line. The repeated list keys of the section are merged into the first one,
+// TOML doesn't allow the duplicate keys.
+func iniToTOML(text []byte) ([]byte, error) {
+	lines := strings.Split(strings.TrimSuffix(string(text), "\n"), "\n")
+	var out []string
+	inPeer := false
+	// lists are the list key items of the section, by the key
+	var lists map[string]*tomlList
+	for no, line := range lines {
+		ln := strings.TrimSpace(line)
+		switch {
+		case ln == "":
+			out = append(out, "")
+		case ln == "[Interface]", ln == "[Peer]":
+			inPeer = ln == "[Peer]"
+			lists = make(map[string]*tomlList)
+			if inPeer {
+				ln = "[[Peer]]"
+			}
+			out = append(out, ln)
+		case ln[0] == '#':
+			if name, ok := parseNameComment(ln); ok && inPeer {
+				ln = "Name = " + tomlQuote(name)
+			}
+			out = append(out, ln)
+		default:
+			parts := strings.SplitN(ln, "=", 2)
+			if len(parts) < 2 {
+				return nil, fmt.Errorf("[line %d]: cannot convert line, missing =", no+1)
+			}
+			lhs, rhs := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			if !listKeys[lhs] {
+				out = append(out, lhs+" = "+tomlValue(lhs, rhs))
+				continue
+			}
+			list, ok := lists[lhs]
+			if !ok {
+				list = &tomlList{line: len(out)}
+				lists[lhs] = list
+				out = append(out, "")
+			}
+			for _, item := range strings.Split(rhs, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list.items = append(list.items, tomlQuote(item))
+				}
+			}
+			out[list.line] = lhs + " = [" + strings.Join(list.items, ", ") + "]"
+		}
+	}
+	return []byte(strings.Join(out, "\n") + "\n"), nil
+}
+
+// tomlList is the list key being converted
+type tomlList struct {
+	line  int
+	items []string
+}
+
+// tomlValue returns the TOML value of the INI key, other than the list one
+func tomlValue(key, value string) string {
+	switch {
+	case tomlIntKeys[key]:
+		if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return value
+		}
+	case key == "SaveConfig":
+		if value == "true" || value == "false" {
+			return value
+		}
+	}
+	return tomlQuote(value)
+}
+
+// tomlQuote returns the TOML basic string
+func tomlQuote(s string) string {
+	b := &strings.Builder{}
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// tomlParser converts the TOML to the INI with the same line numbers, so the INI parse errors point to the TOML lines
+type tomlParser struct {
+	text string
+	pos  int
+	// line is the 0-based line of pos
+	line int
+	out  []string
+}
+
+func tomlToINI(text string) ([]byte, error) {
+	p := &tomlParser{text: text, out: make([]string, strings.Count(strings.TrimSuffix(text, "\n"), "\n")+1)}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join(p.out, "\n") + "\n"), nil
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("[line %d]: %s", p.line+1, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.text)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.text[p.pos]
+}
+
+func (p *tomlParser) next() byte {
+	c := p.text[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipSpace skips the spaces and tabs, and with newlines also the newlines and comments
+func (p *tomlParser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ', c == '\t', c == '\r':
+			p.next()
+		case newlines && c == '\n':
+			p.next()
+		case newlines && c == '#':
+			p.comment()
+		default:
+			return
+		}
+	}
+}
+
+// comment skips the comment up to the end of the line, returning it
+func (p *tomlParser) comment() string {
+	start := p.pos
+	for !p.eof() && p.peek() != '\n' {
+		p.next()
+	}
+	return strings.TrimRight(p.text[start:p.pos], "\r")
+}
+
+// endLine expects the end of the line, allowing the trailing comment
+func (p *tomlParser) endLine() error {
+	p.skipSpace(false)
+	if p.peek() == '#' {
+		p.comment()
+	}
+	if !p.eof() && p.next() != '\n' {
+		return p.errorf("expected the end of the line")
+	}
+	return nil
+}
+
+func (p *tomlParser) parse() error {
+	section := ""
+	var seen map[string]bool
+	for {
+		p.skipSpace(false)
+		if p.eof() {
+			return nil
+		}
+		line := p.line
+		switch p.peek() {
+		case '\n':
+			p.next()
+			continue
+		case '#':
+			p.out[line] = p.comment()
+		case '[':
+			header := p.comment()
+			if i := strings.Index(header, "#"); i >= 0 {
+				header = header[:i]
+			}
+			switch strings.Join(strings.Fields(header), "") {
+			case "[Interface]":
+				p.out[line] = "[Interface]"
+			case "[[Peer]]":
+				p.out[line] = "[Peer]"
+			default:
+				return p.errorf("unsupported table %s, expected [Interface] or [[Peer]]", strings.TrimSpace(header))
+			}
+			section = p.out[line]
+			seen = make(map[string]bool)
+		default:
+			key := p.key()
+			if key == "" {
+				return p.errorf("expected a key")
+			}
+			p.skipSpace(false)
+			if p.eof() || p.next() != '=' {
+				return p.errorf("expected = after %s", key)
+			}
+			p.skipSpace(false)
+			value, err := p.value(key)
+			if err != nil {
+				return err
+			}
+			if seen[key] {
+				return fmt.Errorf("[line %d]: duplicate key %s", line+1, key)
+			}
+			if seen != nil {
+				seen[key] = true
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("[line %d]: %s: multi-line values are not supported", line+1, key)
+			}
+			if key == "Name" && section == "[Peer]" {
+				p.out[line] = "# Name = " + value
+			} else {
+				p.out[line] = key + " = " + value
+			}
+		}
+		if err := p.endLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// key reads the bare key
+func (p *tomlParser) key() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			break
+		}
+		p.next()
+	}
+	return p.text[start:p.pos]
+}
+
+// value reads the value of the key, returning its INI form
+func (p *tomlParser) value(key string) (string, error) {
+	if p.peek() != '[' {
+		return p.scalar(key)
+	}
+	if !listKeys[key] {
+		return "", p.errorf("%s is not an array", key)
+	}
+	p.next()
+	var items []string
+	for {
+		p.skipSpace(true)
+		if p.peek() == ']' {
+			p.next()
+			return strings.Join(items, ", "), nil
+		}
+		item, err := p.scalar(key)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, item)
+		p.skipSpace(true)
+		switch {
+		case p.peek() == ',':
+			p.next()
+		case p.peek() != ']':
+			return "", p.errorf("expected , or ] in the %s array", key)
+		}
+	}
+}
+
+// scalar reads the string, integer or boolean
+func (p *tomlParser) scalar(key string) (string, error) {
+	switch c := p.peek(); {
+	case c == '"':
+		return p.basicString()
+	case c == '\'':
+		return p.literalString()
+	case c == '+' || c == '-' || c >= '0' && c <= '9':
+		return p.integer(key)
+	}
+	start := p.pos
+	for !p.eof() && p.peek() >= 'a' && p.peek() <= 'z' {
+		p.next()
+	}
+	switch word := p.text[start:p.pos]; word {
+	case "true", "false":
+		return word, nil
+	case "":
+		return "", p.errorf("%s: expected a value", key)
+	default:
+		return "", p.errorf("%s: unsupported value %s", key, word)
+	}
+}
+
+func (p *tomlParser) integer(key string) (string, error) {
+	start := p.pos
+	for !p.eof() && strings.IndexByte("+-_.0123456789abcdefABCDEFxo", p.peek()) >= 0 {
+		p.next()
+	}
+	literal := p.text[start:p.pos]
+	s := strings.Replace(literal, "_", "", -1)
+	base := 10
+	if len(s) > 2 && s[0] == '0' {
+		switch s[1] {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+		if base != 10 {
+			s = s[2:]
+		}
+	}
+	n, err := strconv.ParseInt(s, base, 64)
+	if err != nil {
+		return "", p.errorf("%s: unsupported value %s, only integers are supported of the numbers", key, literal)
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	p.next()
+	start := p.pos
+	for !p.eof() && p.peek() != '\'' {
+		if p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		p.next()
+	}
+	if p.eof() {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.text[start:p.pos]
+	p.next()
+	return s, nil
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	p.next()
+	b := &strings.Builder{}
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.next()
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+		default:
+			b.WriteByte(c)
+			continue
+		}
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		switch e := p.next(); e {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case '"', '\\':
+			b.WriteByte(e)
+		case 'u', 'U':
+			n := 4
+			if e == 'U' {
+				n = 8
+			}
+			if p.pos+n > len(p.text) {
+				return "", p.errorf("invalid escape \\%c", e)
+			}
+			r, err := strconv.ParseUint(p.text[p.pos:p.pos+n], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", p.errorf("invalid escape \\%c%s", e, p.text[p.pos:p.pos+n])
+			}
+			p.pos += n
+			b.WriteRune(rune(r))
+		default:
+			return "", p.errorf("invalid escape \\%c", e)
+		}
+	}
+}
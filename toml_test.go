@@ -0,0 +1,118 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOMLRoundTrip(t *testing.T) {
+	for name, text := range testConfigs {
+		t.Run(name, func(t *testing.T) {
+			cfg := &Config{}
+			require.NoError(t, cfg.UnmarshalText([]byte(text)))
+			tt, err := cfg.MarshalTOML()
+			require.NoError(t, err)
+			t.Logf("TOML:\n%s", tt)
+
+			parsed := &Config{}
+			require.NoError(t, parsed.UnmarshalTOML(tt))
+			assert.Equal(t, len(cfg.Peers), len(parsed.Peers))
+			assert.True(t, Diff(cfg, parsed).Empty())
+
+			again, err := parsed.MarshalTOML()
+			require.NoError(t, err)
+			assert.Equal(t, string(tt), string(again))
+		})
+	}
+}
+
+func TestTOMLMarshal(t *testing.T) {
+	cfg := &Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfigs["sample-2"])))
+	tt, err := cfg.MarshalTOML()
+	require.NoError(t, err)
+	assert.Equal(t, `[Interface]
+Address = ["10.192.122.1/24", "10.10.0.1/16"]
+PrivateKey = "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="
+ListenPort = 51820
+SaveConfig = true
+
+[[Peer]]
+PublicKey = "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="
+AllowedIPs = ["10.192.122.3/32", "10.192.124.1/24"]
+
+[[Peer]]
+PublicKey = "TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0="
+AllowedIPs = ["10.192.122.4/32", "192.168.0.0/16"]
+
+[[Peer]]
+PublicKey = "gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA="
+AllowedIPs = ["10.10.10.230/32"]
+`, string(tt))
+}
+
+func TestTOMLParse(t *testing.T) {
+	cfg := &Config{}
+	require.NoError(t, cfg.UnmarshalTOML([]byte(`# office tunnel
+[Interface]
+Address = [
+  "10.192.122.1/24", # v4
+  'fd00::1/64',
+]
+DNS = "10.192.122.53"
+PrivateKey = "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="
+ListenPort = 51_820
+FwMark = 0xca6c
+PostUp = "logger \"%i up\""
+
+[[Peer]]
+Name = "laptop"
+PublicKey = "xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=" # trailing comment
+AllowedIPs = ["10.192.122.3/32"]
+PersistentKeepalive = 25
+`)))
+	require.Len(t, cfg.Address, 2)
+	assert.Equal(t, "fd00::1/64", cfg.Address[1].String())
+	assert.Equal(t, "10.192.122.53", cfg.DNS[0].String())
+	assert.Equal(t, 51820, *cfg.ListenPort)
+	assert.Equal(t, 0xca6c, *cfg.FirewallMark)
+	assert.Equal(t, `logger "%i up"`, cfg.PostUp)
+	require.Len(t, cfg.Peers, 1)
+	assert.Equal(t, "laptop", cfg.PeerNames[cfg.Peers[0].PublicKey])
+	assert.Equal(t, 25, toSeconds(*cfg.Peers[0].PersistentKeepaliveInterval))
+
+	tt, err := cfg.MarshalTOML()
+	require.NoError(t, err)
+	assert.Contains(t, string(tt), "# office tunnel\n[Interface]\n")
+	assert.Contains(t, string(tt), `Name = "laptop"`)
+	assert.Contains(t, string(tt), `PostUp = "logger \"%i up\""`)
+}
+
+func TestTOMLErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		text, err string
+	}{
+		"unknown table": {"[Interface]\n\n[Peers]\n", "[line 3]: unsupported table"},
+		"duplicate key": {"[Interface]\nMTU = 1420\nMTU = 1380\n", "[line 3]: duplicate key MTU"},
+		"float":         {"[Interface]\nMTU = 1420.5\n", "[line 2]: MTU: unsupported value"},
+		"not array":     {"[Interface]\nMTU = [1420]\n", "[line 2]: MTU is not an array"},
+		"unterminated":  {"[Interface]\nPostUp = \"true\n", "[line 2]: unterminated string"},
+		"multi-line":    {"[Interface]\nPostUp = \"a\\nb\"\n", "[line 2]: PostUp: multi-line values are not supported"},
+		"bad value":     {"[Interface]\n\nAddress = [\n\"10.0.0.1/24\",\n\"nope\"]\n", "[line 3]: Address:"},
+		"unknown key":   {"[Interface]\nFoo = 1\n", "[line 2]: unknown directive Foo"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := (&Config{}).UnmarshalTOML([]byte(tc.text))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestParseConfigTOML(t *testing.T) {
+	cfg, err := ParseConfig("wg0.toml", []byte("[Interface]\nAddress = [\"10.0.0.1/24\"]\n"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1/24", cfg.Address[0].String())
+}
@@ -0,0 +1,148 @@
+package wgquick
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ParseShowConf parses the `wg showconf` / `wg setconf` format. It's a subset of the wg-quick format,
+// so the result only holds the wireguard specific settings.
+func ParseShowConf(text []byte) (*Config, error) {
+	c := &Config{}
+	if err := c.Parse(text); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ParseUAPI parses the cross platform userspace API `get=1` device dump (key=value lines with hex encoded keys),
+// e.g. as returned by the userspace wireguard implementations. Runtime only keys (handshake times, transfer stats, ...) are ignored.
+func ParseUAPI(text []byte) (*Config, error) {
+	c := &Config{}
+	var peerCfg *wgtypes.PeerConfig
+	for no, line := range strings.Split(string(text), "\n") {
+		ln := strings.TrimSpace(line)
+		if len(ln) == 0 {
+			continue
+		}
+		parts := strings.SplitN(ln, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("[line %d]: cannot parse line, missing =", no+1)
+		}
+		key, value := parts[0], parts[1]
+		if key == "public_key" {
+			c.Peers = append(c.Peers, wgtypes.PeerConfig{})
+			peerCfg = &c.Peers[len(c.Peers)-1]
+		}
+		var err error
+		if peerCfg == nil {
+			err = parseUAPIDeviceLine(c, key, value)
+		} else {
+			err = parseUAPIPeerLine(peerCfg, key, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("[line %d]: %w", no+1, err)
+		}
+	}
+	return c, nil
+}
+
+func parseHexKey(s string) (wgtypes.Key, error) {
+	var key wgtypes.Key
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return key, err
+	}
+	if len(b) != wgtypes.KeyLen {
+		return key, fmt.Errorf("wrong key length %d, expected %d", len(b), wgtypes.KeyLen)
+	}
+	copy(key[:], b)
+	return key, nil
+}
+
+func parseUAPIDeviceLine(cfg *Config, key, value string) error {
+	switch key {
+	case "private_key":
+		k, err := parseHexKey(value)
+		if err != nil {
+			return fmt.Errorf("cannot decode key %w", err)
+		}
+		cfg.PrivateKey = &k
+	case "listen_port":
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		cfg.ListenPort = &port
+	case "fwmark":
+		mark, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if mark != 0 {
+			cfg.FirewallMark = &mark
+		}
+	case "errno":
+		if value != "0" {
+			return fmt.Errorf("device dump reports errno %s", value)
+		}
+	case "protocol_version":
+	default:
+		return fmt.Errorf("unknown device key %s", key)
+	}
+	return nil
+}
+
+func parseUAPIPeerLine(peerCfg *wgtypes.PeerConfig, key, value string) error {
+	switch key {
+	case "public_key":
+		k, err := parseHexKey(value)
+		if err != nil {
+			return fmt.Errorf("cannot decode key %w", err)
+		}
+		peerCfg.PublicKey = k
+	case "preshared_key":
+		k, err := parseHexKey(value)
+		if err != nil {
+			return fmt.Errorf("cannot decode key %w", err)
+		}
+		if k != (wgtypes.Key{}) {
+			peerCfg.PresharedKey = &k
+		}
+	case "endpoint":
+		addr, err := net.ResolveUDPAddr("udp", value)
+		if err != nil {
+			return err
+		}
+		peerCfg.Endpoint = addr
+	case "persistent_keepalive_interval":
+		t, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if t != 0 {
+			dur := time.Duration(t) * time.Second
+			peerCfg.PersistentKeepaliveInterval = &dur
+		}
+	case "allowed_ip":
+		ipnet, err := parseIPNet(value)
+		if err != nil {
+			return fmt.Errorf("cannot parse %s: %w", value, err)
+		}
+		peerCfg.AllowedIPs = append(peerCfg.AllowedIPs, ipnet)
+	case "errno":
+		if value != "0" {
+			return fmt.Errorf("device dump reports errno %s", value)
+		}
+	case "last_handshake_time_sec", "last_handshake_time_nsec", "rx_bytes", "tx_bytes", "protocol_version":
+	default:
+		return fmt.Errorf("unknown peer key %s", key)
+	}
+	return nil
+}
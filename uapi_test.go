@@ -0,0 +1,57 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUAPI(t *testing.T) {
+	c, err := ParseUAPI([]byte(`private_key=e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a
+listen_port=12912
+fwmark=0
+public_key=b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33
+preshared_key=188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52
+allowed_ip=192.168.4.4/32
+endpoint=[abcd:23::33%2]:51820
+public_key=58402e695ba1772b1cc9309755f043251ea77fdcf10fbe63989ceb7e19321376
+tx_bytes=38333
+rx_bytes=2224
+allowed_ip=192.168.4.6/32
+persistent_keepalive_interval=111
+endpoint=182.122.22.19:3233
+last_handshake_time_sec=1574853525
+last_handshake_time_nsec=0
+protocol_version=1
+errno=0
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 12912, *c.ListenPort)
+	assert.Nil(t, c.FirewallMark)
+	require.Len(t, c.Peers, 2)
+	assert.NotNil(t, c.Peers[0].PresharedKey)
+	assert.Equal(t, "[abcd:23::33%2]:51820", c.Peers[0].Endpoint.String())
+	assert.Equal(t, "192.168.4.6/32", c.Peers[1].AllowedIPs[0].String())
+	assert.Equal(t, "1m51s", c.Peers[1].PersistentKeepaliveInterval.String())
+
+	_, err = ParseUAPI([]byte("errno=22\n"))
+	assert.Error(t, err)
+}
+
+func TestParseShowConf(t *testing.T) {
+	c, err := ParseShowConf([]byte(`[Interface]
+ListenPort = 51820
+FwMark = 0x1234
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.192.122.3/32, 10.192.124.0/24
+Endpoint = 192.95.5.67:1234
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 0x1234, *c.FirewallMark)
+	assert.Equal(t, 51820, *c.ListenPort)
+	assert.Len(t, c.Peers[0].AllowedIPs, 2)
+}
@@ -0,0 +1,211 @@
+package wgquick
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// UAPISocket implements Wireguard with the UAPI socket of the userspace implementation (wireguard-go, boringtun), so the
+// client can drive the instances it didn't create, e.g. with the socket outside /var/run/wireguard. The socket serves a
+// single device, the name is only reported back by Device. The TUN link must exist, Up doesn't create it.
+type UAPISocket struct {
+	// Path is the unix socket path
+	Path string
+	// Timeout of a request, none if 0
+	Timeout time.Duration
+}
+
+// WithUAPISocket makes the client configure the device with the UAPI socket at the path instead of the kernel
+func WithUAPISocket(path string) ClientOption {
+	return WithWireguard(&UAPISocket{Path: path, Timeout: 10 * time.Second})
+}
+
+// request sends the request and returns the response lines without the errno one, failing with the non-zero errno
+func (s *UAPISocket) request(req string) ([]string, error) {
+	conn, err := net.Dial("unix", s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if s.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(s.Timeout)); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := io.WriteString(conn, req); err != nil {
+		return nil, err
+	}
+	var lines []string
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		ln := sc.Text()
+		if ln == "" {
+			break
+		}
+		if strings.HasPrefix(ln, "errno=") {
+			errno, err := strconv.Atoi(strings.TrimPrefix(ln, "errno="))
+			if err != nil {
+				return nil, fmt.Errorf("invalid errno line %q", ln)
+			}
+			if errno != 0 {
+				return nil, syscall.Errno(errno)
+			}
+			return lines, nil
+		}
+		lines = append(lines, ln)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s: response without errno", s.Path)
+}
+
+// Device returns the device dump of the UAPI `get=1` request
+func (s *UAPISocket) Device(name string) (*wgtypes.Device, error) {
+	lines, err := s.request("get=1\n\n")
+	if err != nil {
+		return nil, err
+	}
+	dev := &wgtypes.Device{Name: name, Type: wgtypes.Userspace}
+	var peer *wgtypes.Peer
+	var handshake [2]int64
+	for no, ln := range lines {
+		parts := strings.SplitN(ln, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("[line %d]: cannot parse line, missing =", no+1)
+		}
+		key, value := parts[0], parts[1]
+		if key == "public_key" {
+			dev.Peers = append(dev.Peers, wgtypes.Peer{})
+			peer = &dev.Peers[len(dev.Peers)-1]
+			handshake = [2]int64{}
+		}
+		if err := parseUAPIDumpLine(dev, peer, &handshake, key, value); err != nil {
+			return nil, fmt.Errorf("[line %d]: %w", no+1, err)
+		}
+	}
+	return dev, nil
+}
+
+func parseUAPIDumpLine(dev *wgtypes.Device, peer *wgtypes.Peer, handshake *[2]int64, key, value string) error {
+	var err error
+	switch {
+	case peer == nil && key == "private_key":
+		if dev.PrivateKey, err = parseHexKey(value); err != nil {
+			return fmt.Errorf("cannot decode key %w", err)
+		}
+		dev.PublicKey = dev.PrivateKey.PublicKey()
+	case peer == nil && key == "listen_port":
+		dev.ListenPort, err = strconv.Atoi(value)
+	case peer == nil && key == "fwmark":
+		dev.FirewallMark, err = strconv.Atoi(value)
+	case peer == nil:
+		// e.g. protocol_version of the newer implementations
+	case key == "public_key":
+		if peer.PublicKey, err = parseHexKey(value); err != nil {
+			return fmt.Errorf("cannot decode key %w", err)
+		}
+	case key == "preshared_key":
+		if peer.PresharedKey, err = parseHexKey(value); err != nil {
+			return fmt.Errorf("cannot decode key %w", err)
+		}
+	case key == "endpoint":
+		peer.Endpoint, err = net.ResolveUDPAddr("udp", value)
+	case key == "persistent_keepalive_interval":
+		var t int
+		t, err = strconv.Atoi(value)
+		peer.PersistentKeepaliveInterval = time.Duration(t) * time.Second
+	case key == "allowed_ip":
+		var ipnet net.IPNet
+		if ipnet, err = parseIPNet(value); err != nil {
+			return fmt.Errorf("cannot parse %s: %w", value, err)
+		}
+		peer.AllowedIPs = append(peer.AllowedIPs, ipnet)
+	case key == "last_handshake_time_sec", key == "last_handshake_time_nsec":
+		i := 0
+		if key == "last_handshake_time_nsec" {
+			i = 1
+		}
+		if handshake[i], err = strconv.ParseInt(value, 10, 64); err != nil {
+			return err
+		}
+		if handshake[0] != 0 || handshake[1] != 0 {
+			peer.LastHandshakeTime = time.Unix(handshake[0], handshake[1])
+		}
+	case key == "rx_bytes":
+		peer.ReceiveBytes, err = strconv.ParseInt(value, 10, 64)
+	case key == "tx_bytes":
+		peer.TransmitBytes, err = strconv.ParseInt(value, 10, 64)
+	case key == "protocol_version":
+		peer.ProtocolVersion, err = strconv.Atoi(value)
+	}
+	return err
+}
+
+// uapiSet returns the UAPI `set=1` request of the config with the AmneziaWG parameters, if set. They're device keys, so
+// they go before the first peer.
+func uapiSet(cfg wgtypes.Config, amnezia AmneziaWG) string {
+	b := &bytes.Buffer{}
+	fmt.Fprintln(b, "set=1")
+	if cfg.PrivateKey != nil {
+		fmt.Fprintf(b, "private_key=%s\n", hex.EncodeToString(cfg.PrivateKey[:]))
+	}
+	if cfg.ListenPort != nil {
+		fmt.Fprintf(b, "listen_port=%d\n", *cfg.ListenPort)
+	}
+	if cfg.FirewallMark != nil {
+		fmt.Fprintf(b, "fwmark=%d\n", *cfg.FirewallMark)
+	}
+	if cfg.ReplacePeers {
+		fmt.Fprintln(b, "replace_peers=true")
+	}
+	b.WriteString(amnezia.uapi())
+	for _, p := range cfg.Peers {
+		fmt.Fprintf(b, "public_key=%s\n", hex.EncodeToString(p.PublicKey[:]))
+		if p.Remove {
+			fmt.Fprintln(b, "remove=true")
+			continue
+		}
+		if p.UpdateOnly {
+			fmt.Fprintln(b, "update_only=true")
+		}
+		if p.PresharedKey != nil {
+			fmt.Fprintf(b, "preshared_key=%s\n", hex.EncodeToString(p.PresharedKey[:]))
+		}
+		if p.Endpoint != nil {
+			fmt.Fprintf(b, "endpoint=%s\n", p.Endpoint.String())
+		}
+		if p.PersistentKeepaliveInterval != nil {
+			fmt.Fprintf(b, "persistent_keepalive_interval=%d\n", int(p.PersistentKeepaliveInterval.Seconds()))
+		}
+		if p.ReplaceAllowedIPs {
+			fmt.Fprintln(b, "replace_allowed_ips=true")
+		}
+		for _, ip := range p.AllowedIPs {
+			fmt.Fprintf(b, "allowed_ip=%s\n", ip.String())
+		}
+	}
+	fmt.Fprintln(b)
+	return b.String()
+}
+
+// ConfigureDevice applies the config with the UAPI `set=1` request
+func (s *UAPISocket) ConfigureDevice(name string, cfg wgtypes.Config) error {
+	_, err := s.request(uapiSet(cfg, AmneziaWG{}))
+	return err
+}
+
+// Close does nothing, every request uses its own connection
+func (s *UAPISocket) Close() error {
+	return nil
+}
@@ -0,0 +1,151 @@
+package wgquick
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// serveUAPI answers the get requests with the dump and records the set requests
+func serveUAPI(t *testing.T, l net.Listener, dump string, sets chan<- string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		r := bufio.NewReader(conn)
+		var req []string
+		for {
+			ln, err := r.ReadString('\n')
+			if err != nil || ln == "\n" {
+				break
+			}
+			req = append(req, ln)
+		}
+		switch {
+		case len(req) > 0 && req[0] == "get=1\n":
+			conn.Write([]byte(dump + "errno=0\n\n"))
+		case len(req) > 0 && req[0] == "set=1\n":
+			sets <- strings.Join(req, "")
+			conn.Write([]byte("errno=0\n\n"))
+		default:
+			conn.Write([]byte("errno=22\n\n"))
+		}
+		conn.Close()
+	}
+}
+
+func TestUAPISocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-uapi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wg0.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer l.Close()
+	sets := make(chan string, 1)
+	go serveUAPI(t, l, `private_key=e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a
+listen_port=12912
+public_key=b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33
+preshared_key=188515093e952f5f22e865cef3012e72f8b5f0b598ac0309d5dacce3b70fcf52
+allowed_ip=192.168.4.4/32
+endpoint=[abcd:23::33%2]:51820
+last_handshake_time_sec=1
+last_handshake_time_nsec=2
+tx_bytes=38333
+rx_bytes=2224
+persistent_keepalive_interval=0
+protocol_version=1
+`, sets)
+
+	s := &UAPISocket{Path: path, Timeout: time.Second}
+	dev, err := s.Device("wg0")
+	require.NoError(t, err)
+	assert.Equal(t, "wg0", dev.Name)
+	assert.Equal(t, wgtypes.Userspace, dev.Type)
+	assert.Equal(t, 12912, dev.ListenPort)
+	assert.Equal(t, dev.PrivateKey.PublicKey(), dev.PublicKey)
+	require.Len(t, dev.Peers, 1)
+	assert.Equal(t, "192.168.4.4/32", dev.Peers[0].AllowedIPs[0].String())
+	assert.Equal(t, 51820, dev.Peers[0].Endpoint.Port)
+	assert.Equal(t, time.Unix(1, 2), dev.Peers[0].LastHandshakeTime)
+	assert.Equal(t, int64(2224), dev.Peers[0].ReceiveBytes)
+	assert.Equal(t, 1, dev.Peers[0].ProtocolVersion)
+
+	port := 51820
+	keepalive := 25 * time.Second
+	require.NoError(t, s.ConfigureDevice("wg0", wgtypes.Config{
+		ListenPort:   &port,
+		ReplacePeers: true,
+		Peers: []wgtypes.PeerConfig{
+			{PublicKey: dev.Peers[0].PublicKey, PersistentKeepaliveInterval: &keepalive, ReplaceAllowedIPs: true, AllowedIPs: dev.Peers[0].AllowedIPs},
+			{PublicKey: dev.PublicKey, Remove: true},
+		},
+	}))
+	assert.Equal(t, `set=1
+listen_port=51820
+replace_peers=true
+public_key=b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33
+persistent_keepalive_interval=25
+replace_allowed_ips=true
+allowed_ip=192.168.4.4/32
+public_key=`+hex.EncodeToString(dev.PublicKey[:])+`
+remove=true
+`, <-sets)
+
+	_, err = s.request("bogus=1\n\n")
+	assert.Equal(t, syscall.EINVAL, err)
+}
+
+func TestUAPISocketPeer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wg-quick-uapi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wg0.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer l.Close()
+	go serveUAPI(t, l, `private_key=e84b5a6d2717c1003a13b431570353dbaca9146cf150c5f8575680feba52027a
+listen_port=12912
+public_key=b85996fecc9c7f1fc6d2572a76eda11d59bcd20be8e543b15ce4bd85a8e75a33
+allowed_ip=192.168.4.4/32
+rx_bytes=1
+public_key=58402e695ba1772b1cc9309755f043251ea77fdcf10fbe63989ceb7e19321376
+allowed_ip=192.168.4.6/32
+endpoint=182.122.22.19:3233
+last_handshake_time_sec=1
+last_handshake_time_nsec=2
+tx_bytes=38333
+rx_bytes=2224
+`, nil)
+
+	s := &UAPISocket{Path: path, Timeout: time.Second}
+	var key wgtypes.Key
+	b, err := hex.DecodeString("58402e695ba1772b1cc9309755f043251ea77fdcf10fbe63989ceb7e19321376")
+	require.NoError(t, err)
+	copy(key[:], b)
+	peer, err := s.Peer("wg0", key)
+	require.NoError(t, err)
+	assert.Equal(t, key, peer.PublicKey)
+	assert.Equal(t, "182.122.22.19:3233", peer.Endpoint.String())
+	assert.Equal(t, time.Unix(1, 2), peer.LastHandshakeTime)
+	assert.Equal(t, int64(2224), peer.ReceiveBytes)
+	assert.Equal(t, int64(38333), peer.TransmitBytes)
+	require.Len(t, peer.AllowedIPs, 1)
+	assert.Equal(t, "192.168.4.6/32", peer.AllowedIPs[0].String())
+
+	_, err = s.Peer("wg0", wgtypes.Key{1})
+	assert.True(t, errors.Is(err, ErrPeerNotFound))
+}
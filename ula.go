@@ -0,0 +1,61 @@
+package wgquick
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ULAPrefix derives the IPv6 unique local /48 prefix (RFC 4193) from the seed, e.g. the mesh name, instead of the random
+// global ID. The same seed always gives the same prefix, so the mesh addressing needs no coordination.
+func ULAPrefix(seed string) net.IPNet {
+	sum := sha256.Sum256([]byte(seed))
+	ip := make(net.IP, net.IPv6len)
+	ip[0] = 0xfd
+	copy(ip[1:6], sum[:5])
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(48, 128)}
+}
+
+// ULAAddress derives the peer /128 address within the IPv6 prefix, e.g. ULAPrefix, by filling the host bits with the hash
+// of its public key. The collisions are as likely as with the random addresses, negligible for the prefixes up to /64.
+func ULAAddress(prefix net.IPNet, key wgtypes.Key) (net.IPNet, error) {
+	ones, bits := prefix.Mask.Size()
+	if bits != 128 || prefix.IP.To4() != nil {
+		return net.IPNet{}, fmt.Errorf("%s is not IPv6 prefix", prefix.String())
+	}
+	if ones > 120 {
+		return net.IPNet{}, fmt.Errorf("%s is too small to derive the addresses", prefix.String())
+	}
+	sum := sha256.Sum256(key[:])
+	base := prefix.IP.Mask(prefix.Mask)
+	ip := make(net.IP, net.IPv6len)
+	for i := range ip {
+		ip[i] = base[i] | sum[i]&^prefix.Mask[i]
+	}
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// ulaPrefixString is the ULAPrefix template function
+func ulaPrefixString(seed string) string {
+	prefix := ULAPrefix(seed)
+	return prefix.String()
+}
+
+// ulaAddressString is the ULAAddress template function, taking the prefix in CIDR notation and the base64 public key
+func ulaAddressString(prefix string, publicKey string) (string, error) {
+	_, n, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", err
+	}
+	key, err := ParseKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	addr, err := ULAAddress(*n, key)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
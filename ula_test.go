@@ -0,0 +1,43 @@
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestULA(t *testing.T) {
+	prefix := ULAPrefix("mesh")
+	same, other := ULAPrefix("mesh"), ULAPrefix("other")
+	assert.Equal(t, prefix.String(), same.String(), "deterministic")
+	assert.NotEqual(t, prefix.String(), other.String())
+	assert.Equal(t, byte(0xfd), prefix.IP[0])
+	ones, _ := prefix.Mask.Size()
+	assert.Equal(t, 48, ones)
+
+	a, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	b, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	addrA, err := ULAAddress(prefix, a.PublicKey())
+	require.NoError(t, err)
+	again, err := ULAAddress(prefix, a.PublicKey())
+	require.NoError(t, err)
+	addrB, err := ULAAddress(prefix, b.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, addrA.String(), again.String())
+	assert.NotEqual(t, addrA.String(), addrB.String())
+	assert.True(t, prefix.Contains(addrA.IP))
+
+	_, small, err := net.ParseCIDR("fd00::/124")
+	require.NoError(t, err)
+	_, err = ULAAddress(*small, a.PublicKey())
+	assert.Error(t, err)
+	_, v4, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	_, err = ULAAddress(*v4, a.PublicKey())
+	assert.Error(t, err)
+}
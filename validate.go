@@ -0,0 +1,292 @@
+package wgquick
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Severity of the config diagnostic
+type Severity int
+
+const (
+	// SeverityError marks config which cannot be applied
+	SeverityError Severity = iota
+	// SeverityWarning marks config which can be applied, but is likely not what's intended
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Diagnostic is a single finding about the config
+type Diagnostic struct {
+	Severity Severity
+	// Code is machine readable identifier of the finding, e.g. "missing-private-key"
+	Code string
+	// Field the finding is about, e.g. "Interface.MTU" or "Peer[1].AllowedIPs"
+	Field   string
+	Message string
+	// Line is the 1-based line of the field in the parsed config text, 0 if unknown
+	Line int
+}
+
+func (d Diagnostic) String() string {
+	if d.Line > 0 {
+		return fmt.Sprintf("%s: %s (line %d) [%s]: %s", d.Severity, d.Field, d.Line, d.Code, d.Message)
+	}
+	return fmt.Sprintf("%s: %s [%s]: %s", d.Severity, d.Field, d.Code, d.Message)
+}
+
+// setLines fills in the diagnostic lines of the parsed config
+func (cfg *Config) setLines(diags []Diagnostic) {
+	if cfg.doc == nil {
+		return
+	}
+	for i := range diags {
+		diags[i].Line = cfg.doc.line(cfg, diags[i].Field)
+	}
+}
+
+// ValidationError is returned by Validate when the config contains errors
+type ValidationError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		msgs = append(msgs, d.String())
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+func peerField(i int, field string) string {
+	return fmt.Sprintf("Peer[%d].%s", i, field)
+}
+
+const (
+	minMTU     = 576
+	minIPv6MTU = 1280
+	maxMTU     = 65535
+)
+
+// Validate checks the config for errors which would make it fail (or misbehave) when applied.
+// It returns *ValidationError listing all found problems, or nil if the config is valid.
+func (cfg *Config) Validate() error {
+	var diags []Diagnostic
+	add := func(code, field, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{
+			Severity: SeverityError,
+			Code:     code,
+			Field:    field,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if cfg.PrivateKey == nil || *cfg.PrivateKey == (wgtypes.Key{}) {
+		add("missing-private-key", "Interface.PrivateKey", "private key is not set")
+	}
+	if cfg.ListenPort != nil && (*cfg.ListenPort < 0 || *cfg.ListenPort > 65535) {
+		add("bad-listen-port", "Interface.ListenPort", "port %d out of range [0, 65535]", *cfg.ListenPort)
+	}
+
+	hasIPv6 := false
+	seenAddr := make(map[string]bool)
+	for _, addr := range cfg.Address {
+		if msg := checkIPNet(addr); msg != "" {
+			add("bad-address", "Interface.Address", "%v: %s", addr.String(), msg)
+			continue
+		}
+		if addr.IP.IsUnspecified() || addr.IP.IsMulticast() {
+			add("bad-address", "Interface.Address", "%v is not an unicast address", addr.String())
+		}
+		if peer := cfg.AddressOptions[addr.String()].Peer; peer != nil && (peer.IP.To4() == nil) != (addr.IP.To4() == nil) {
+			add("bad-address", "Interface.Address", "%v: peer %v address family mismatch", addr.String(), peer.String())
+		}
+		if label := cfg.addressLabel(addr); len(label) >= unix.IFNAMSIZ {
+			add("bad-address-label", "Interface.Address", "%v: label %q longer than %d characters", addr.String(), label, unix.IFNAMSIZ-1)
+		}
+		if seenAddr[addr.String()] {
+			add("duplicate-address", "Interface.Address", "%v specified multiple times", addr.String())
+		}
+		seenAddr[addr.String()] = true
+		if addr.IP.To4() == nil {
+			hasIPv6 = true
+		}
+	}
+
+	seenDNS := make(map[string]bool)
+	for _, dns := range cfg.DNS {
+		if dns == nil || dns.IsUnspecified() || dns.IsMulticast() {
+			add("bad-dns", "Interface.DNS", "%v is not an unicast address", dns)
+			continue
+		}
+		if seenDNS[dns.String()] {
+			add("duplicate-dns", "Interface.DNS", "%v specified multiple times", dns)
+		}
+		seenDNS[dns.String()] = true
+	}
+
+	var routeDsts []string
+	for dst := range cfg.RouteOptions {
+		routeDsts = append(routeDsts, dst)
+	}
+	sort.Strings(routeDsts)
+	for _, dst := range routeDsts {
+		opts := cfg.RouteOptions[dst]
+		ipnet, err := parseIPNet(dst)
+		switch {
+		case err != nil:
+			add("bad-route-options", "Interface.RouteOptions", "%s: %v", dst, err)
+		case opts.MTU < 0 || opts.MTU > maxMTU || (opts.MTU != 0 && opts.MTU < minMTU):
+			add("bad-route-options", "Interface.RouteOptions", "%s: MTU %d out of range [%d, %d]", dst, opts.MTU, minMTU, maxMTU)
+		case opts.MTU != 0 && ipnet.IP.To4() == nil && opts.MTU < minIPv6MTU:
+			add("bad-route-options", "Interface.RouteOptions", "%s: MTU %d is below IPv6 minimum of %d", dst, opts.MTU, minIPv6MTU)
+		case opts.MTULock && opts.MTU == 0:
+			add("bad-route-options", "Interface.RouteOptions", "%s: mtu lock requires the MTU", dst)
+		}
+	}
+
+	for i, rt := range cfg.Routes {
+		field := fmt.Sprintf("Interface.Routes[%d]", i)
+		if msg := checkIPNet(rt.Dst); msg != "" {
+			add("bad-route", field, "%v: %s", rt.Dst.String(), msg)
+			continue
+		}
+		if rt.Gateway != nil && (rt.Gateway.To4() == nil) != (rt.Dst.IP.To4() == nil) {
+			add("bad-route", field, "%v: gateway address family mismatch", rt.String())
+		}
+		if rt.OnLink && rt.Gateway == nil {
+			add("bad-route", field, "%v: onlink requires a gateway", rt.String())
+		}
+	}
+
+	switch {
+	case cfg.MTU == 0:
+	case cfg.MTU < minMTU || cfg.MTU > maxMTU:
+		add("bad-mtu", "Interface.MTU", "MTU %d out of range [%d, %d]", cfg.MTU, minMTU, maxMTU)
+	case hasIPv6 && cfg.MTU < minIPv6MTU:
+		add("bad-mtu", "Interface.MTU", "MTU %d is below IPv6 minimum of %d", cfg.MTU, minIPv6MTU)
+	}
+
+	if cfg.Table < TableOff {
+		add("bad-table", "Interface.Table", "table %d must not be negative", int(cfg.Table))
+	}
+	if cfg.SourceRules && (cfg.Table == TableAuto || cfg.Table == TableOff || cfg.Table == unix.RT_TABLE_MAIN) {
+		add("source-rules-table", "Interface.Table", "source rules require a dedicated routing table, got %v", cfg.Table)
+	}
+	if cfg.SourceRulePriority < 0 {
+		add("bad-source-rule-priority", "Interface.SourceRulePriority", "priority %d must not be negative", cfg.SourceRulePriority)
+	}
+	if cfg.RouteProtocol < 0 || cfg.RouteProtocol > 255 {
+		add("bad-route-protocol", "Interface.RouteProtocol", "protocol %d out of range [0, 255]", cfg.RouteProtocol)
+	}
+	if cfg.RouteMetric < 0 {
+		add("bad-route-metric", "Interface.RouteMetric", "metric %d must not be negative", cfg.RouteMetric)
+	}
+
+	for _, msg := range cfg.AmneziaWG.validate() {
+		add("bad-amneziawg", "Interface.AmneziaWG", "%s", msg)
+	}
+
+	for _, backend := range cfg.dnsBackendChain() {
+		switch backend {
+		case DNSBackendResolvconf, DNSBackendNetworkManager, DNSBackendFile, DNSBackendResolved:
+		default:
+			add("bad-dns-backend", "Interface.DNSBackend", "unknown DNS backend %q", backend)
+		}
+	}
+	switch cfg.DNSSEC {
+	case "", "yes", "no", "allow-downgrade":
+	default:
+		add("bad-dnssec", "Interface.DNSSEC", "%q is not one of yes, no, allow-downgrade", cfg.DNSSEC)
+	}
+	switch cfg.DNSOverTLS {
+	case "", "yes", "no", "opportunistic":
+	default:
+		add("bad-dns-over-tls", "Interface.DNSOverTLS", "%q is not one of yes, no, opportunistic", cfg.DNSOverTLS)
+	}
+	switch cfg.LLMNR {
+	case "", "yes", "no", "resolve":
+	default:
+		add("bad-llmnr", "Interface.LLMNR", "%q is not one of yes, no, resolve", cfg.LLMNR)
+	}
+
+	for _, name := range cfg.HookCapabilities {
+		if _, err := parseCapability(name); err != nil {
+			add("bad-hook-capability", "Interface.HookCapabilities", "%v", err)
+		}
+	}
+	if len(cfg.HookCapabilities) > 0 && cfg.HookUser == "" {
+		add("hook-capabilities-without-user", "Interface.HookCapabilities", "hook capabilities require HookUser, root hooks keep all of them")
+	}
+
+	seenPeers := make(map[wgtypes.Key]int)
+	for i, peer := range cfg.Peers {
+		if peer.PublicKey == (wgtypes.Key{}) {
+			add("missing-public-key", peerField(i, "PublicKey"), "public key is not set")
+		} else if j, ok := seenPeers[peer.PublicKey]; ok {
+			add("duplicate-peer", peerField(i, "PublicKey"), "same public key as Peer[%d]", j)
+		} else {
+			seenPeers[peer.PublicKey] = i
+		}
+		if cfg.PrivateKey != nil && peer.PublicKey == cfg.PrivateKey.PublicKey() {
+			add("self-peer", peerField(i, "PublicKey"), "peer public key belongs to this interface private key")
+		}
+		if cfg.PrivateKey != nil && peer.PublicKey != (wgtypes.Key{}) && peer.PublicKey == *cfg.PrivateKey {
+			pub := cfg.PrivateKey.PublicKey()
+			add("public-key-is-private-key", peerField(i, "PublicKey"), "peer public key is this interface private key: if it is, the interface public key is %s; if it's the peer key, PrivateKey holds a public key", serializeKey(&pub))
+		}
+		if peer.PresharedKey != nil && *peer.PresharedKey != (wgtypes.Key{}) && (*peer.PresharedKey == peer.PublicKey || cfg.PrivateKey != nil && *peer.PresharedKey == *cfg.PrivateKey) {
+			add("reused-preshared-key", peerField(i, "PresharedKey"), "preshared key is the peer public key or this interface private key, generate it with `wg genpsk`")
+		}
+
+		for _, aip := range peer.AllowedIPs {
+			if msg := checkIPNet(aip); msg != "" {
+				add("bad-allowed-ip", peerField(i, "AllowedIPs"), "%v: %s", aip.String(), msg)
+			}
+		}
+
+		if peer.Endpoint != nil && (peer.Endpoint.Port <= 0 || peer.Endpoint.Port > 65535) {
+			add("bad-endpoint", peerField(i, "Endpoint"), "port %d out of range [1, 65535]", peer.Endpoint.Port)
+		}
+		if ka := peer.PersistentKeepaliveInterval; ka != nil && (*ka < 0 || *ka > 65535*time.Second) {
+			add("bad-persistent-keepalive", peerField(i, "PersistentKeepalive"), "interval %v out of range [0, 65535s]", *ka)
+		}
+	}
+
+	if len(diags) == 0 {
+		return nil
+	}
+	cfg.setLines(diags)
+	return &ValidationError{Diagnostics: diags}
+}
+
+// checkIPNet returns a description of problem with the ip network, or empty string if it's fine
+func checkIPNet(n net.IPNet) string {
+	if n.IP == nil {
+		return "missing IP"
+	}
+	ones, bits := n.Mask.Size()
+	if bits == 0 {
+		return "invalid mask"
+	}
+	if n.IP.To4() == nil && bits == 8*net.IPv4len {
+		return fmt.Sprintf("IPv6 address with IPv4 mask /%d", ones)
+	}
+	return ""
+}
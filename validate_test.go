@@ -0,0 +1,130 @@
+package wgquick
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateExampleConfigs(t *testing.T) {
+	for name, cfg := range testConfigs {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{}
+			require.NoError(t, c.UnmarshalText([]byte(cfg)))
+			assert.NoError(t, c.Validate())
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(`[Interface]
+Address = 10.0.0.1/24
+Address = 10.0.0.1/24
+Address = fd00::1/64
+DNS = 0.0.0.0
+MTU = 1000
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.0.0.2/32
+`)))
+	err := c.Validate()
+	require.Error(t, err)
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+
+	var codes []string
+	for _, d := range verr.Diagnostics {
+		assert.Equal(t, SeverityError, d.Severity)
+		codes = append(codes, d.Code)
+	}
+	assert.ElementsMatch(t, []string{
+		"missing-private-key",
+		"duplicate-address",
+		"bad-dns",
+		"bad-mtu",
+		"duplicate-peer",
+	}, codes)
+}
+
+func TestValidateSourceRules(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	c.SourceRules = true
+	err := c.Validate()
+	require.Error(t, err)
+	assert.Equal(t, "source-rules-table", err.(*ValidationError).Diagnostics[0].Code)
+	c.Table = 51820
+	assert.NoError(t, c.Validate())
+}
+
+func TestValidateHookCapabilities(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	c.HookCapabilities = []string{"net_admin", "CAP_BOGUS"}
+	err := c.Validate()
+	require.Error(t, err)
+	var codes []string
+	for _, d := range err.(*ValidationError).Diagnostics {
+		codes = append(codes, d.Code)
+	}
+	assert.ElementsMatch(t, []string{"bad-hook-capability", "hook-capabilities-without-user"}, codes)
+	c.HookUser = "nobody"
+	c.HookCapabilities = c.HookCapabilities[:1]
+	assert.NoError(t, c.Validate())
+}
+
+func TestValidateKeys(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(`[Interface]
+Address = 10.0.0.1/24
+PrivateKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+
+[Peer]
+PublicKey = GtL7fZc/bLnqZldpVofMCD6hDjrK28SsdLxevJ+qtKU=
+AllowedIPs = 10.0.0.2/32
+
+[Peer]
+# the private key pasted by mistake
+AllowedIPs = 10.0.0.3/32
+PublicKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+PresharedKey = oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM=
+`)))
+	err := c.Validate()
+	require.Error(t, err)
+	verr := err.(*ValidationError)
+	require.Len(t, verr.Diagnostics, 2)
+	d := verr.Diagnostics[0]
+	assert.Equal(t, "public-key-is-private-key", d.Code)
+	assert.Equal(t, "Peer[1].PublicKey", d.Field)
+	assert.Equal(t, 12, d.Line)
+	pub := c.PrivateKey.PublicKey()
+	assert.Contains(t, d.Message, serializeKey(&pub))
+	assert.Contains(t, d.String(), "(line 12)")
+	assert.Equal(t, "reused-preshared-key", verr.Diagnostics[1].Code)
+	assert.Equal(t, 13, verr.Diagnostics[1].Line)
+
+	c.Peers = c.Peers[:1]
+	c.Peers[0].Endpoint = &net.UDPAddr{IP: net.ParseIP("192.0.2.1")}
+	verr = c.Validate().(*ValidationError)
+	require.Len(t, verr.Diagnostics, 1)
+	assert.Equal(t, 5, verr.Diagnostics[0].Line, "the header of the section without the key")
+}
+
+func TestKeyErrors(t *testing.T) {
+	for key, hint := range map[string]string{
+		`"oK56DE9Ue9zK76rAc8pBl6opph+1v36lm7cXXsQKrQM="`: "is quoted",
+		"oK56DE9Ue9zK76rAc8pBl6opph":                     "has 26 characters",
+	} {
+		_, err := ParseKey(key)
+		require.Error(t, err, key)
+		assert.Contains(t, err.Error(), hint)
+		assert.NotContains(t, err.Error(), key)
+	}
+}
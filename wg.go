@@ -12,38 +12,61 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
-	"golang.zx2c4.com/wireguard/wgctrl"
 )
 
 // Up sets and configures the wg interface. Mostly equivalent to `wg-quick up iface`
-func Up(cfg *Config, iface string, logger logrus.FieldLogger) error {
+func (c *Client) Up(cfg *Config, iface string, logger logrus.FieldLogger) error {
+	if c.zeroize {
+		defer cfg.Zeroize()
+	}
 	log := logger.WithField("iface", iface)
-	_, err := netlink.LinkByName(iface)
+	cfg, err := c.withDNSBackend(cfg, log)
+	if err != nil {
+		return err
+	}
+	if err := c.preflight(cfg, iface, len(cfg.DNS) > 0 || cfg.resolved()); err != nil {
+		return err
+	}
+	unlock, err := c.lockIface(iface)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	_, err = c.nl.LinkByName(iface)
 	if err == nil {
 		return os.ErrExist
 	}
-	if _, ok := err.(netlink.LinkNotFoundError); !ok {
+	if !isLinkNotFound(err) {
 		return err
 	}
 
-	for _, dns := range cfg.DNS {
-		if err := execSh("resolvconf -a tun.%i -m 0 -x", iface, log, fmt.Sprintf("nameserver %s\n", dns)); err != nil {
-			return err
-		}
+	dns := c.dnsPhase(cfg, iface, log)
+	var extra []syncPhase
+	if c.parallel {
+		// DNS doesn't depend on the link, apply it together with the other phases
+		extra = append(extra, dns)
+	} else if err := c.phase(dns, iface, log).run(); err != nil {
+		return err
 	}
 
 	if cfg.PreUp != "" {
-		if err := execSh(cfg.PreUp, iface, log); err != nil {
+		if err := c.runHook(cfg, cfg.PreUp, iface, log); err != nil {
 			return err
 		}
 		log.Infoln("applied pre-up command")
 	}
-	if err := Sync(cfg, iface, logger); err != nil {
+	if err := c.sync(cfg, iface, logger, extra); err != nil {
+		return err
+	}
+	if err := c.finishDNS(cfg, iface, log); err != nil {
+		return err
+	}
+	if err := c.enableSysctls(cfg, iface, log); err != nil {
 		return err
 	}
 
 	if cfg.PostUp != "" {
-		if err := execSh(cfg.PostUp, iface, log); err != nil {
+		if err := c.runHook(cfg, cfg.PostUp, iface, log); err != nil {
 			return err
 		}
 		log.Infoln("applied post-up command")
@@ -51,33 +74,138 @@ func Up(cfg *Config, iface string, logger logrus.FieldLogger) error {
 	return nil
 }
 
+// dnsPhase returns the phase setting the DNS servers with the backends applied before the link exists: resolvconf and the file
+func (c *Client) dnsPhase(cfg *Config, iface string, log logrus.FieldLogger) syncPhase {
+	return syncPhase{name: "dns", run: func() error {
+		if len(cfg.DNS) == 0 {
+			return nil
+		}
+		switch cfg.dnsBackend() {
+		case DNSBackendFile:
+			return c.writeResolvConf(cfg, iface, log)
+		case DNSBackendResolvconf:
+		default:
+			// set on the link after the sync
+			return nil
+		}
+		for _, dns := range cfg.DNS {
+			if err := c.runSh(cfg.resolvconfCommand(cfg.ResolvconfAdd, DefaultResolvconfAdd), iface, log, fmt.Sprintf("nameserver %s\n", dns)); err != nil {
+				// e.g. resolvconf busy with the other update
+				return temporaryError{err}
+			}
+		}
+		return nil
+	}}
+}
+
+// finishDNS sets the DNS servers with the link backends and systemd-resolved, recording them in the state for Down
+func (c *Client) finishDNS(cfg *Config, iface string, log logrus.FieldLogger) error {
+	if err := c.setLinkDNS(cfg, iface, log); err != nil {
+		return err
+	}
+	if err := c.recordDNS(iface, cfg, log); err != nil {
+		return err
+	}
+	return c.setResolved(cfg, iface, log)
+}
+
 // Down destroys the wg interface. Mostly equivalent to `wg-quick down iface`
-func Down(cfg *Config, iface string, logger logrus.FieldLogger) error {
+// With cfg.KillSwitch set the tunnel routes are replaced with kill switch routes before the link is deleted.
+// The addresses, DNS, routes and rules recorded in the state file by Up and Sync are cleaned up instead of the configured ones.
+func (c *Client) Down(cfg *Config, iface string, logger logrus.FieldLogger) error {
 	log := logger.WithField("iface", iface)
-	link, err := netlink.LinkByName(iface)
+	if err := c.preflight(cfg, iface, false); err != nil {
+		return err
+	}
+	unlock, err := c.lockIface(iface)
 	if err != nil {
 		return err
 	}
-
-	if len(cfg.DNS) > 1 {
-		if err := execSh("resolvconf -d tun.%s", iface, log); err != nil {
+	defer unlock()
+	st, err := c.LoadState(iface)
+	if err != nil {
+		return err
+	}
+	var displaced []netlink.Route
+	proxyDevice, proxies := cfg.ProxyDevice, cfg.proxyNeighbors()
+	if st != nil {
+		proxyDevice, proxies = st.ProxyDevice, nil
+		for _, s := range st.ProxyNeighbors {
+			proxies = append(proxies, net.ParseIP(s))
+		}
+		if cfg, err = st.apply(cfg); err != nil {
+			return err
+		}
+		if displaced, err = st.displacedRoutes(); err != nil {
 			return err
 		}
+	} else if cfg, err = c.withDNSBackend(cfg, log); err != nil {
+		// no state recording the backend Up used, the chain picks the same one
+		return err
+	}
+	if err := c.preflight(cfg, iface, len(cfg.DNS) > 0); err != nil {
+		return err
+	}
+	link, err := c.nl.LinkByName(iface)
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.DNS) > 0 {
+		switch cfg.dnsBackend() {
+		case DNSBackendResolvconf:
+			if err := c.runSh(cfg.resolvconfCommand(cfg.ResolvconfDelete, DefaultResolvconfDelete), iface, log); err != nil {
+				return err
+			}
+		case DNSBackendFile:
+			if err := c.restoreResolvConf(log); err != nil {
+				return err
+			}
+		}
 	}
 
 	if cfg.PreDown != "" {
-		if err := execSh(cfg.PreDown, iface, log); err != nil {
+		if err := c.runHook(cfg, cfg.PreDown, iface, log); err != nil {
 			return err
 		}
 		log.Infoln("applied pre-down command")
 	}
 
-	if err := netlink.LinkDel(link); err != nil {
+	if cfg.SourceRules {
+		if err := c.deleteSourceRules(cfg, log); err != nil {
+			return err
+		}
+	}
+	if st != nil {
+		c.deleteIptablesRules(st.FirewallRules, log)
+		if err := c.deletePolicyRules(st.policyRules(), log); err != nil {
+			return err
+		}
+	}
+	c.deleteProxyNeighbors(proxyDevice, proxies, log)
+	if err := c.deleteLANBypass(cfg, log); err != nil {
+		return err
+	}
+	if err := c.EngageKillSwitch(cfg, log); err != nil {
+		return err
+	}
+	if err := c.nl.LinkDel(link); err != nil {
 		return err
 	}
 	log.Infoln("link deleted")
+	if cfg.KillSwitch == KillSwitchOff {
+		c.restoreRoutes(displaced, log)
+	} else if len(displaced) > 0 {
+		log.Info("kill switch engaged, not restoring displaced routes")
+	}
+	if st != nil {
+		c.restoreSysctls(st.Sysctls, log)
+	}
+	if err := c.removeState(iface); err != nil {
+		log.WithError(err).Warn("cannot remove state file")
+	}
 	if cfg.PostDown != "" {
-		if err := execSh(cfg.PostDown, iface, log); err != nil {
+		if err := c.runHook(cfg, cfg.PostDown, iface, log); err != nil {
 			return err
 		}
 		log.Infoln("applied post-down command")
@@ -85,8 +213,41 @@ func Down(cfg *Config, iface string, logger logrus.FieldLogger) error {
 	return nil
 }
 
+// HookDirect is the Config.HookShell running the hooks directly, split into the arguments on white space, without a shell
+const HookDirect = "none"
+
+// hookCommand returns the arguments running the hook with the config hook shell
+func (cfg *Config) hookCommand(hook string) []string {
+	switch cfg.HookShell {
+	case "":
+		return []string{"sh", "-ce", hook}
+	case HookDirect:
+		return strings.Fields(hook)
+	default:
+		return append(strings.Fields(cfg.HookShell), hook)
+	}
+}
+
+// execHook runs the hook with the config hook shell
+func execHook(cfg *Config, hook string, iface string, log logrus.FieldLogger) error {
+	args := cfg.hookCommand(strings.ReplaceAll(hook, "%i", iface))
+	if len(args) == 0 {
+		return fmt.Errorf("empty hook command")
+	}
+	attr, err := cfg.hookProcAttr()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.SysProcAttr = attr
+	return execCommand(cmd, log)
+}
+
 func execSh(command string, iface string, log logrus.FieldLogger, stdin ...string) error {
-	cmd := exec.Command("sh", "-ce", strings.ReplaceAll(command, "%i", iface))
+	return execCommand(exec.Command("sh", "-ce", strings.ReplaceAll(command, "%i", iface)), log, stdin...)
+}
+
+func execCommand(cmd *exec.Cmd, log logrus.FieldLogger, stdin ...string) error {
 	if len(stdin) > 0 {
 		log = log.WithField("stdin", strings.Join(stdin, ""))
 		b := &bytes.Buffer{}
@@ -106,92 +267,243 @@ func execSh(command string, iface string, log logrus.FieldLogger, stdin ...strin
 	return nil
 }
 
-// Sync the config to the current setup for given interface
-// It perform 4 operations:
+// Sync the config to the current setup for given interface. Defaults are filled in, see FillDefaults.
+// It performs these operations:
 // * SyncLink --> makes sure link is up and type wireguard
 // * SyncWireguardDevice --> configures allowedIP & other wireguard specific settings
 // * SyncAddress --> synces linux addresses bounded to this interface
 // * SyncRoutes --> synces all allowedIP routes to route to this interface
-func Sync(cfg *Config, iface string, logger logrus.FieldLogger) error {
+// * SyncRules --> synces source rules, if enabled
+// * proxy neighbors --> synces proxy ARP/NDP entries, if ProxyDevice is set
+//
+// The last four run concurrently with ParallelSync client option.
+func (c *Client) Sync(cfg *Config, iface string, logger logrus.FieldLogger) error {
+	if c.zeroize {
+		defer cfg.Zeroize()
+	}
+	if err := c.preflight(cfg, iface, false); err != nil {
+		return err
+	}
+	unlock, err := c.lockIface(iface)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return c.sync(cfg, iface, logger, nil)
+}
+
+// sync runs the Sync and the extra phases after the link is configured, recording the outcome for the health checks
+func (c *Client) sync(cfg *Config, iface string, logger logrus.FieldLogger, extra []syncPhase) (err error) {
+	defer func() { c.syncs.record(iface, err) }()
 	log := logger.WithField("iface", iface)
+	cfg = cfg.clone()
+	defer cfg.Zeroize()
+	cfg.FillDefaults()
 
-	link, err := SyncLink(cfg, iface, log)
-	if err != nil {
+	var link netlink.Link
+	linkPhase := syncPhase{name: "link", run: func() (err error) {
+		link, err = c.SyncLink(cfg, iface, log)
+		return err
+	}}
+	if err := c.phase(linkPhase, iface, log).run(); err != nil {
 		log.WithError(err).Errorln("cannot sync wireguard link")
 		return err
 	}
 	log.Info("synced link")
 
-	if err := SyncWireguardDevice(cfg, link, log); err != nil {
+	device := syncPhase{name: "device", run: func() error { return c.SyncWireguardDevice(cfg, link, log) }}
+	if err := c.phase(device, iface, log).run(); err != nil {
 		log.WithError(err).Errorln("cannot sync wireguard link")
 		return err
 	}
 	log.Info("synced link")
 
-	if err := SyncAddress(cfg, link, log); err != nil {
-		log.WithError(err).Errorln("cannot sync addresses")
-		return err
+	var displaced []netlink.Route
+	if cfg.Table != TableOff {
+		if displaced, err = c.displacedRoutes(cfg, link); err != nil {
+			log.WithError(err).Errorln("cannot read displaced routes")
+			return err
+		}
 	}
-	log.Info("synced addresss")
 
-	var managedRoutes []net.IPNet
-	for _, peer := range cfg.Peers {
-		for _, rt := range peer.AllowedIPs {
-			managedRoutes = append(managedRoutes, rt)
+	prev, err := c.LoadState(iface)
+	if err != nil {
+		return err
+	}
+	addresses := syncPhase{name: "addresses", run: func() error {
+		if err := c.SyncAddress(cfg, link, log); err != nil {
+			log.WithError(err).Errorln("cannot sync addresses")
+			return err
+		}
+		log.Info("synced addresss")
+		return nil
+	}}
+	routes := syncPhase{name: "routes", run: func() error {
+		if err := c.SyncRoutes(cfg, link, cfg.managedRoutes(), log); err != nil {
+			log.WithError(err).Errorln("cannot sync routes")
+			return err
+		}
+		if prev != nil && prev.RouteProtocol != 0 && prev.RouteProtocol != cfg.RouteProtocol && cfg.Table != TableOff {
+			if err := c.deleteProtocolRoutes(cfg, link, prev.RouteProtocol, log); err != nil {
+				log.WithError(err).Errorln("cannot delete the previous protocol routes")
+				return err
+			}
+		}
+		if err := c.SyncLANBypass(cfg, link, log); err != nil {
+			log.WithError(err).Errorln("cannot sync LAN bypass routes")
+			return err
+		}
+		log.Info("synced routed")
+		return nil
+	}}
+	rules := syncPhase{name: "rules", run: func() error {
+		if !cfg.SourceRules {
+			return nil
+		}
+		if err := c.SyncRules(cfg, cfg.sourceRules(), log); err != nil {
+			log.WithError(err).Errorln("cannot sync rules")
+			return err
 		}
+		log.Info("synced rules")
+		return nil
+	}}
+	proxy := syncPhase{name: "proxy", run: func() error {
+		if err := c.syncProxyNeighbors(cfg, prev, log); err != nil {
+			log.WithError(err).Errorln("cannot sync proxy neighbors")
+			return err
+		}
+		return nil
+	}}
+	phases := []syncPhase{addresses, routes, rules, proxy}
+	if c.parallel && cfg.routesNeedAddresses() {
+		phases = []syncPhase{addresses.then(routes), rules, proxy}
+	}
+	phases = append(phases, extra...)
+	for i := range phases {
+		phases[i] = c.phase(phases[i], iface, log)
 	}
-	if err := SyncRoutes(cfg, link, managedRoutes, log); err != nil {
-		log.WithError(err).Errorln("cannot sync routes")
+	if err := c.runPhases(phases); err != nil {
+		return err
+	}
+	if err := c.recordState(iface, cfg, displaced, log); err != nil {
 		return err
 	}
-	log.Info("synced routed")
 	log.Info("Successfully synced device")
 	return nil
 
 }
 
+// managedRoutes returns all routes this config routes over the interface
+func (cfg *Config) managedRoutes() []net.IPNet {
+	var managedRoutes []net.IPNet
+	for _, peer := range cfg.Peers {
+		if peer.Remove {
+			continue
+		}
+		for _, rt := range peer.AllowedIPs {
+			managedRoutes = append(managedRoutes, rt)
+		}
+	}
+	return managedRoutes
+}
+
 // SyncWireguardDevice synces wireguard vpn setting on the given link. It does not set routes/addresses beyond wg internal crypto-key routing, only handles wireguard specific settings
-func SyncWireguardDevice(cfg *Config, link netlink.Link, log logrus.FieldLogger) error {
-	cl, err := wgctrl.New()
+func (c *Client) SyncWireguardDevice(cfg *Config, link netlink.Link, log logrus.FieldLogger) error {
+	cl, err := c.wgctrl()
 	if err != nil {
 		log.WithError(err).Errorln("cannot setup wireguard device")
 		return err
 	}
-	if err := cl.ConfigureDevice(link.Attrs().Name, cfg.Config); err != nil {
+	for _, peer := range cfg.Peers {
+		log.WithFields(map[string]interface{}{
+			"peer":       cfg.PeerLabel(peer.PublicKey),
+			"allowedIPs": fmt.Sprint(peer.AllowedIPs),
+		}).Debug("configuring peer")
+	}
+	update := cfg.Config
+	if dev, err := cl.Device(link.Attrs().Name); err == nil {
+		update = deviceUpdate(cfg.Config, dev)
+		log.WithFields(map[string]interface{}{
+			"peers":   len(cfg.Peers),
+			"changed": len(update.Peers),
+		}).Debug("computed peer changes")
+	} else {
+		log.WithError(err).Warn("cannot read device, configuring all peers")
+	}
+	if cfg.AmneziaWG.IsZero() {
+		err = cl.ConfigureDevice(link.Attrs().Name, update)
+	} else if ac, ok := cl.(AmneziaWGConfigurer); ok {
+		err = ac.ConfigureDeviceAmneziaWG(link.Attrs().Name, update, cfg.AmneziaWG)
+	} else {
+		return fmt.Errorf("the wireguard implementation doesn't support the AmneziaWG parameters")
+	}
+	c.recordDevice(link.Attrs().Name, update, err)
+	if err != nil {
 		log.WithError(err).Error("cannot configure device")
 		return err
 	}
+	if cfg.ListenPort == nil || *cfg.ListenPort == 0 {
+		if dev, err := cl.Device(link.Attrs().Name); err == nil {
+			log.WithField("port", dev.ListenPort).Info("kernel picked listen port")
+		}
+	}
 	return nil
 }
 
+// ListenPort returns the actual port the wireguard device is listening on. Use it after Up/Sync when ListenPort is 0 or unset
+// and the kernel picked a free port, e.g. to register it in DNS or firewalls.
+func (c *Client) ListenPort(iface string) (int, error) {
+	cl, err := c.wgctrl()
+	if err != nil {
+		return 0, err
+	}
+	dev, err := cl.Device(iface)
+	if err != nil {
+		return 0, err
+	}
+	return dev.ListenPort, nil
+}
+
 // SyncLink synces link state with the config. It does not sync Wireguard settings, just makes sure the device is up and type wireguard
-func SyncLink(cfg *Config, iface string, log logrus.FieldLogger) (netlink.Link, error) {
-	link, err := netlink.LinkByName(iface)
+func (c *Client) SyncLink(cfg *Config, iface string, log logrus.FieldLogger) (netlink.Link, error) {
+	link, err := c.nl.LinkByName(iface)
 	if err != nil {
-		if _, ok := err.(netlink.LinkNotFoundError); !ok {
+		if !isLinkNotFound(err) {
 			log.WithError(err).Error("cannot read link")
 			return nil, err
 		}
 		log.Info("link not found, creating")
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = iface
+		attrs.MTU = cfg.MTU
+		attrs.NumTxQueues = cfg.NumTxQueues
+		attrs.NumRxQueues = cfg.NumRxQueues
 		wgLink := &netlink.GenericLink{
-			LinkAttrs: netlink.LinkAttrs{
-				Name: iface,
-				MTU:  cfg.MTU,
-			},
-			LinkType: "wireguard",
+			LinkAttrs: attrs,
+			LinkType:  "wireguard",
 		}
-		if err := netlink.LinkAdd(wgLink); err != nil {
+		if err := c.nl.LinkAdd(wgLink); err != nil {
 			log.WithError(err).Error("cannot create link")
 			return nil, err
 		}
 
-		link, err = netlink.LinkByName(iface)
+		link, err = c.nl.LinkByName(iface)
 		if err != nil {
 			log.WithError(err).Error("cannot read link")
 			return nil, err
 		}
 	}
-	if err := netlink.LinkSetUp(link); err != nil {
+	if err := c.syncLinkAttrs(cfg, link, log); err != nil {
+		return nil, err
+	}
+	if cfg.LinkAlias != "" && link.Attrs().Alias != cfg.LinkAlias {
+		if err := c.nl.LinkSetAlias(link, cfg.LinkAlias); err != nil {
+			log.WithError(err).Error("cannot set link alias")
+			return nil, err
+		}
+		log.WithField("alias", cfg.LinkAlias).Info("set link alias")
+	}
+	if err := c.nl.LinkSetUp(link); err != nil {
 		log.WithError(err).Error("cannot set link up")
 		return nil, err
 	}
@@ -200,40 +512,88 @@ func SyncLink(cfg *Config, iface string, log logrus.FieldLogger) (netlink.Link,
 }
 
 // SyncAddress adds/deletes all lind assigned IPV4 addressed as specified in the config
-func SyncAddress(cfg *Config, link netlink.Link, log logrus.FieldLogger) error {
-	addrs, err := netlink.AddrList(link, syscall.AF_INET)
+func (c *Client) SyncAddress(cfg *Config, link netlink.Link, log logrus.FieldLogger) error {
+	addrs, err := c.nl.AddrList(link, netlink.FAMILY_ALL)
 	if err != nil {
 		log.Error(err, "cannot read link address")
 		return err
 	}
 
+	errs := c.newItemErrors()
 	// nil addr means I've used it
 	presentAddresses := make(map[string]netlink.Addr, 0)
 	for _, addr := range addrs {
+		if addr.IP.IsLinkLocalUnicast() && !cfg.hasAddress(*addr.IPNet) {
+			// the kernel manages the IPv6 link-local addresses
+			continue
+		}
 		log.WithFields(map[string]interface{}{
 			"addr":  fmt.Sprint(addr.IPNet),
 			"label": addr.Label,
 		}).Debugf("found existing address: %v", addr)
 		presentAddresses[addr.IPNet.String()] = addr
 	}
+	stale := len(presentAddresses)
+	for _, addr := range cfg.Address {
+		if _, ok := presentAddresses[addr.String()]; ok {
+			stale--
+		}
+	}
+	prog := c.newItemProgress(link.Attrs().Name, "addresses", len(cfg.Address)+stale)
 
 	for _, addr := range cfg.Address {
-		log := log.WithField("addr", addr.String())
-		_, present := presentAddresses[addr.String()]
+		log := log.WithField("addr", cfg.formatAddress(addr))
+		wanted := cfg.netlinkAddr(addr)
+		presentAddr, present := presentAddresses[addr.String()]
 		presentAddresses[addr.String()] = netlink.Addr{} // mark as present
-		if present {
-			log.Info("address present")
+		if opts := cfg.AddressOptions[addr.String()]; opts.refresh() {
+			if present && !addrMatches(&presentAddr, wanted) {
+				if err := c.nl.AddrDel(link, &presentAddr); err != nil {
+					log.WithError(err).Error("cannot delete outdated addr")
+					prog.item("delete address", presentAddr.IPNet.String(), err)
+					if err := errs.add("delete address", presentAddr.IPNet.String(), err); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			err := c.nl.AddrReplaceMetric(link, wanted, opts.Metric)
+			prog.item("replace address", addr.String(), err)
+			if err != nil {
+				log.WithError(err).Error("cannot replace addr")
+				if err := errs.add("replace address", addr.String(), err); err != nil {
+					return err
+				}
+				continue
+			}
+			log.Info("address replaced")
 			continue
 		}
-		if err := netlink.AddrAdd(link, &netlink.Addr{
-			IPNet: &addr,
-			Label: cfg.AddressLabel,
-		}); err != nil {
-			if err != syscall.EEXIST {
-				log.WithError(err).Error("cannot add addr")
+		if present {
+			if addrMatches(&presentAddr, wanted) {
+				log.Info("address present")
+				prog.item("keep address", addr.String(), nil)
+				continue
+			}
+			if err := c.nl.AddrDel(link, &presentAddr); err != nil {
+				log.WithError(err).Error("cannot delete outdated addr")
+				prog.item("delete address", presentAddr.IPNet.String(), err)
+				if err := errs.add("delete address", presentAddr.IPNet.String(), err); err != nil {
+					return err
+				}
+				continue
+			}
+			log.Info("outdated address deleted")
+		}
+		if err := c.nl.AddrAdd(link, wanted); err != nil && err != syscall.EEXIST {
+			log.WithError(err).Error("cannot add addr")
+			prog.item("add address", addr.String(), err)
+			if err := errs.add("add address", addr.String(), err); err != nil {
 				return err
 			}
+			continue
 		}
+		prog.item("add address", addr.String(), nil)
 		log.Info("address added")
 	}
 
@@ -245,13 +605,18 @@ func SyncAddress(cfg *Config, link netlink.Link, log logrus.FieldLogger) error {
 			"addr":  addr.IPNet.String(),
 			"label": addr.Label,
 		})
-		if err := netlink.AddrDel(link, &addr); err != nil {
+		err := c.nl.AddrDel(link, &addr)
+		prog.item("delete address", addr.IPNet.String(), err)
+		if err != nil {
 			log.WithError(err).Error("cannot delete addr")
-			return err
+			if err := errs.add("delete address", addr.IPNet.String(), err); err != nil {
+				return err
+			}
+			continue
 		}
 		log.Info("addr deleted")
 	}
-	return nil
+	return errs.err()
 }
 
 func fillRouteDefaults(rt *netlink.Route) {
@@ -261,7 +626,7 @@ func fillRouteDefaults(rt *netlink.Route) {
 	}
 
 	if rt.Protocol == 0 {
-		rt.Protocol = unix.RTPROT_BOOT
+		rt.Protocol = DefaultRouteProtocol
 	}
 
 	if rt.Type == 0 {
@@ -269,10 +634,23 @@ func fillRouteDefaults(rt *netlink.Route) {
 	}
 }
 
-// SyncRoutes adds/deletes all route assigned IPV4 addressed as specified in the config
-func SyncRoutes(cfg *Config, link netlink.Link, managedRoutes []net.IPNet, log logrus.FieldLogger) error {
+// SyncRoutes adds/deletes all route assigned IPV4 and IPV6 addressed as specified in the config, together with cfg.Routes. With Table off it does nothing.
+func (c *Client) SyncRoutes(cfg *Config, link netlink.Link, managedRoutes []net.IPNet, log logrus.FieldLogger) error {
+	if cfg.Table == TableOff {
+		log.Info("table off, skipping routes")
+		return nil
+	}
 	var wantedRoutes = make(map[string][]netlink.Route, len(managedRoutes))
-	presentRoutes, err := netlink.RouteList(link, syscall.AF_INET)
+	// wantedDsts keeps the config order, so the routes are replaced in it and the sync stops on the same failed route
+	var wantedDsts []string
+	want := func(nrt netlink.Route) {
+		dst := nrt.Dst.String()
+		if _, ok := wantedRoutes[dst]; !ok {
+			wantedDsts = append(wantedDsts, dst)
+		}
+		wantedRoutes[dst] = append(wantedRoutes[dst], nrt)
+	}
+	presentRoutes, err := c.listOwnedRoutes(cfg, link)
 	if err != nil {
 		log.Error(err, "cannot read existing routes")
 		return err
@@ -280,33 +658,26 @@ func SyncRoutes(cfg *Config, link netlink.Link, managedRoutes []net.IPNet, log l
 	for _, rt := range managedRoutes {
 		rt := rt // make copy
 		log.WithField("dst", rt.String()).Debug("managing route")
-
-		nrt := netlink.Route{
-			LinkIndex: link.Attrs().Index,
-			Dst:       &rt,
-			Table:     cfg.Table,
-			Protocol:  cfg.RouteProtocol,
-			Priority:  cfg.RouteMetric}
-		fillRouteDefaults(&nrt)
-		wantedRoutes[rt.String()] = append(wantedRoutes[rt.String()], nrt)
+		want(cfg.netlinkRoute(link, rt, nil, false))
+	}
+	for _, rt := range cfg.Routes {
+		log.WithField("route", rt.String()).Debug("managing route")
+		want(cfg.netlinkRoute(link, rt.Dst, rt.Gateway, rt.OnLink))
 	}
 
-	for _, rtLst := range wantedRoutes {
-		for _, rt := range rtLst {
-			rt := rt // make copy
-			log := log.WithFields(map[string]interface{}{
-				"route":    rt.Dst.String(),
-				"protocol": rt.Protocol,
-				"table":    rt.Table,
-				"type":     rt.Type,
-				"metric":   rt.Priority,
-			})
-			if err := netlink.RouteReplace(&rt); err != nil {
-				log.WithError(err).Errorln("cannot add/replace route")
-				return err
+	errs := c.newItemErrors()
+	// present routes by destination, so the unchanged ones aren't replaced again
+	presentByDst := make(map[string][]netlink.Route, len(presentRoutes))
+	for _, rt := range presentRoutes {
+		presentByDst[rt.Dst.String()] = append(presentByDst[rt.Dst.String()], rt)
+	}
+	isPresent := func(rt netlink.Route) bool {
+		for _, candidateRt := range presentByDst[rt.Dst.String()] {
+			if cfg.routeMatches(candidateRt, rt) {
+				return true
 			}
-			log.Infoln("route added/replaced")
 		}
+		return false
 	}
 
 	checkWanted := func(rt netlink.Route) bool {
@@ -317,36 +688,83 @@ func SyncRoutes(cfg *Config, link netlink.Link, managedRoutes []net.IPNet, log l
 		}
 		return false
 	}
-
+	total := 0
+	for _, rtLst := range wantedRoutes {
+		total += len(rtLst)
+	}
 	for _, rt := range presentRoutes {
-		log := log.WithFields(map[string]interface{}{
+		if !checkWanted(rt) {
+			total++
+		}
+	}
+	prog := c.newItemProgress(link.Attrs().Name, "routes", total)
+
+	routeLog := func(rt netlink.Route) logrus.FieldLogger {
+		return log.WithFields(map[string]interface{}{
 			"route":    rt.Dst.String(),
+			"gateway":  rt.Gw,
 			"protocol": rt.Protocol,
 			"table":    rt.Table,
 			"type":     rt.Type,
 			"metric":   rt.Priority,
 		})
-		if !(rt.Table == cfg.Table || (cfg.Table == 0 && rt.Table == unix.RT_CLASS_MAIN)) {
-			log.Debug("wrong table for route, skipping")
-			continue
+	}
+	var changed []netlink.Route
+	for _, dst := range wantedDsts {
+		for _, rt := range wantedRoutes[dst] {
+			if isPresent(rt) {
+				routeLog(rt).Debug("route present")
+				prog.item("keep route", routeItem(rt), nil)
+				continue
+			}
+			changed = append(changed, rt)
 		}
-
-		if !(rt.Protocol == cfg.RouteProtocol) {
-			log.Infof("skipping route deletion, not owned by this daemon")
-			continue
+	}
+	err = c.replaceRoutes(cfg, changed, func(rt netlink.Route, err error) error {
+		prog.item("replace route", routeItem(rt), err)
+		if err != nil {
+			routeLog(rt).WithError(err).Errorln("cannot add/replace route")
+			return errs.add("replace route", routeItem(rt), err)
 		}
+		routeLog(rt).Infoln("route added/replaced")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
+	for _, rt := range presentRoutes {
+		log := log.WithFields(map[string]interface{}{
+			"route":    rt.Dst.String(),
+			"protocol": rt.Protocol,
+			"table":    rt.Table,
+			"type":     rt.Type,
+			"metric":   rt.Priority,
+		})
 		if checkWanted(rt) {
 			log.Debug("route wanted, skipping deleting")
 			continue
 		}
 
-		if err := netlink.RouteDel(&rt); err != nil {
+		err := c.nl.RouteDel(&rt)
+		prog.item("delete route", routeItem(rt), err)
+		if err != nil {
 			log.WithError(err).Error("cannot delete route")
-			return err
+			if err := errs.add("delete route", routeItem(rt), err); err != nil {
+				return err
+			}
+			continue
 		}
 		log.Info("route deleted")
 	}
 
-	return nil
+	return errs.err()
+}
+
+// routeItem describes the route in ItemsError
+func routeItem(rt netlink.Route) string {
+	if rt.Gw != nil {
+		return rt.Dst.String() + " via " + rt.Gw.String()
+	}
+	return rt.Dst.String()
 }
@@ -0,0 +1,88 @@
+package wgquick_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestSync(t *testing.T) {
+	c, nl, wg := newFakeClient(t)
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.LinkGroup = 7
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+
+	link, err := nl.LinkByName("wg0")
+	require.NoError(t, err)
+	assert.Equal(t, "wireguard", link.Type())
+	assert.Equal(t, uint32(7), nl.LinkGroup("wg0"))
+	addrs, err := nl.AddrList(link, unix.AF_INET)
+	require.NoError(t, err)
+	assert.Len(t, addrs, 2)
+	assert.Len(t, nl.Routes(), 4)
+
+	port, err := c.ListenPort("wg0")
+	require.NoError(t, err)
+	assert.Equal(t, 51820, port)
+
+	cfg.Address = cfg.Address[:1]
+	cfg.Peers = cfg.Peers[:1]
+	cfg.ReplacePeers = true
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+	addrs, err = nl.AddrList(link, unix.AF_INET)
+	require.NoError(t, err)
+	assert.Len(t, addrs, 1)
+	assert.Len(t, nl.Routes(), 2)
+	dev, err := wg.Device("wg0")
+	require.NoError(t, err)
+	require.Len(t, dev.Peers, 1)
+	assert.Equal(t, cfg.Peers[0].PublicKey, dev.Peers[0].PublicKey)
+}
+
+func TestSyncAddressIPv6(t *testing.T) {
+	c, nl, _ := newFakeClient(t)
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	cfg.Address = append(cfg.Address, ipNet(t, "fd00::1/64"), ipNet(t, "fd00::2/64"))
+	require.NoError(t, c.Up(cfg, "wg0", testLog))
+	link, err := nl.LinkByName("wg0")
+	require.NoError(t, err)
+	require.NoError(t, nl.AddrAdd(link, &netlink.Addr{IPNet: ipNetPtr(t, "fe80::1/64")}))
+
+	// fd00::1 gets noprefixroute, fd00::2 is removed
+	cfg.Address = cfg.Address[:3]
+	cfg.AddressOptions = map[string]wgquick.AddressOptions{"fd00::1/64": {NoPrefixRoute: true}}
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+	addrs, err := nl.AddrList(link, netlink.FAMILY_V6)
+	require.NoError(t, err)
+	byAddr := make(map[string]netlink.Addr)
+	for _, addr := range addrs {
+		byAddr[addr.IPNet.String()] = addr
+	}
+	assert.Len(t, byAddr, 2)
+	assert.Equal(t, unix.IFA_F_NOPREFIXROUTE, byAddr["fd00::1/64"].Flags&unix.IFA_F_NOPREFIXROUTE, "the flags of the present address are refreshed")
+	assert.NotContains(t, byAddr, "fd00::2/64")
+	assert.Contains(t, byAddr, "fe80::1/64", "the kernel link-local address is kept")
+}
+
+func ipNetPtr(t *testing.T, s string) *net.IPNet {
+	ip, ipnet, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	ipnet.IP = ip
+	return ipnet
+}
+
+func ipNet(t *testing.T, s string) net.IPNet {
+	return *ipNetPtr(t, s)
+}
@@ -0,0 +1,81 @@
+package wgquick
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestHookCommand(t *testing.T) {
+	cfg := &Config{}
+	assert.Equal(t, []string{"sh", "-ce", "echo a | cat"}, cfg.hookCommand("echo a | cat"))
+	cfg.HookShell = "bash -ceo pipefail"
+	assert.Equal(t, []string{"bash", "-ceo", "pipefail", "echo a | cat"}, cfg.hookCommand("echo a | cat"))
+	cfg.HookShell = HookDirect
+	assert.Equal(t, []string{"echo", "a", "|", "cat"}, cfg.hookCommand("echo a | cat"))
+}
+
+func TestExecHook(t *testing.T) {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	dir, err := ioutil.TempDir("", "wg-quick-hook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{HookShell: HookDirect}
+	require.NoError(t, execHook(cfg, "touch "+filepath.Join(dir, "%i"), "wg0", log))
+	_, err = os.Stat(filepath.Join(dir, "wg0"))
+	assert.NoError(t, err)
+	assert.Error(t, execHook(cfg, "", "wg0", log))
+
+	cfg.HookShell = "sh -c"
+	require.NoError(t, execHook(cfg, "echo up > "+filepath.Join(dir, "%i.log"), "wg1", log))
+	out, err := ioutil.ReadFile(filepath.Join(dir, "wg1.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "up\n", string(out))
+}
+
+func TestHookProcAttr(t *testing.T) {
+	cfg := &Config{}
+	attr, err := cfg.hookProcAttr()
+	require.NoError(t, err)
+	assert.Nil(t, attr)
+
+	cfg.HookUser = "0:0"
+	cfg.HookCapabilities = []string{"CAP_NET_ADMIN"}
+	attr, err = cfg.hookProcAttr()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), attr.Credential.Uid)
+	assert.Equal(t, uint32(0), attr.Credential.Gid)
+	assert.Empty(t, attr.Credential.Groups)
+	assert.Equal(t, []uintptr{unix.CAP_NET_ADMIN}, attr.AmbientCaps)
+
+	cfg.HookCapabilities = []string{"bogus"}
+	_, err = cfg.hookProcAttr()
+	assert.Error(t, err)
+}
+
+func TestExecHookUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	if _, err := lookupUser("nobody"); err != nil {
+		t.Skip("no nobody user")
+	}
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	dir, err := ioutil.TempDir("", "wg-quick-hook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{}
+	require.NoError(t, execHook(cfg, "touch "+filepath.Join(dir, "root"), "wg0", log))
+	cfg.HookUser = "nobody"
+	assert.Error(t, execHook(cfg, "touch "+filepath.Join(dir, "nobody"), "wg0", log), "nobody can't write to the root's temp dir")
+}
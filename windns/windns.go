@@ -0,0 +1,112 @@
+// Package windns applies the tunnel DNS on Windows, for the Windows backend: the per-interface servers and connection
+// suffix, and the NRPT (Name Resolution Policy Table) rules sending only the listed namespaces to the tunnel servers
+// for split DNS:
+//
+//	err := windns.Set("wg0", servers, "corp.example")
+//	err = windns.AddNRPT("wg0", []string{".corp.example"}, servers)
+//	defer windns.Clear("wg0")
+//
+// The servers are set with netsh, the suffix and the NRPT rules with PowerShell. The NRPT rules are tagged with the
+// interface in their comment, so Clear removes exactly the ones added for it.
+package windns
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+var (
+	// Netsh is the netsh binary
+	Netsh = "netsh"
+	// PowerShell is the PowerShell binary
+	PowerShell = "powershell"
+)
+
+// comment tags the NRPT rules of the interface
+func comment(iface string) string {
+	return "wg-quick-go:" + iface
+}
+
+// psQuote quotes the string for PowerShell
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// family returns the netsh family of the address
+func family(ip net.IP) string {
+	if ip.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// setCommands returns the commands setting the servers and the suffix of the interface
+func setCommands(iface string, servers []net.IP, suffix string) [][]string {
+	var cmds [][]string
+	index := map[string]int{}
+	for _, fam := range []string{"ipv4", "ipv6"} {
+		cmds = append(cmds, []string{Netsh, "interface", fam, "delete", "dnsservers", "name=" + iface, "address=all", "validate=no"})
+	}
+	for _, ip := range servers {
+		fam := family(ip)
+		index[fam]++
+		cmds = append(cmds, []string{Netsh, "interface", fam, "add", "dnsservers", "name=" + iface, "address=" + ip.String(),
+			fmt.Sprintf("index=%d", index[fam]), "validate=no"})
+	}
+	cmds = append(cmds, []string{PowerShell, "-NoProfile", "-NonInteractive", "-Command",
+		fmt.Sprintf("Set-DnsClient -InterfaceAlias %s -ConnectionSpecificSuffix %s", psQuote(iface), psQuote(suffix))})
+	return cmds
+}
+
+// Set sets the DNS servers and the connection specific search suffix (none if empty) of the interface, replacing the previous ones
+func Set(iface string, servers []net.IP, suffix string) error {
+	return run(setCommands(iface, servers, suffix))
+}
+
+// nrptCommand returns the command adding the NRPT rule
+func nrptCommand(iface string, namespaces []string, servers []net.IP) []string {
+	var quoted, addrs []string
+	for _, ns := range namespaces {
+		quoted = append(quoted, psQuote(ns))
+	}
+	for _, ip := range servers {
+		addrs = append(addrs, psQuote(ip.String()))
+	}
+	return []string{PowerShell, "-NoProfile", "-NonInteractive", "-Command",
+		fmt.Sprintf("Add-DnsClientNrptRule -Namespace %s -NameServers %s -Comment %s",
+			strings.Join(quoted, ","), strings.Join(addrs, ","), psQuote(comment(iface)))}
+}
+
+// AddNRPT adds the NRPT rule resolving the namespaces (e.g. ".corp.example" for the subdomains, "corp.example" for the name
+// itself, "." for all) with the servers, regardless of the interface order
+func AddNRPT(iface string, namespaces []string, servers []net.IP) error {
+	if len(namespaces) == 0 || len(servers) == 0 {
+		return fmt.Errorf("NRPT rule needs namespaces and servers")
+	}
+	return run([][]string{nrptCommand(iface, namespaces, servers)})
+}
+
+// clearCommands returns the commands removing the servers, the suffix and the NRPT rules of the interface
+func clearCommands(iface string) [][]string {
+	cmds := setCommands(iface, nil, "")
+	return append(cmds, []string{PowerShell, "-NoProfile", "-NonInteractive", "-Command",
+		fmt.Sprintf("Get-DnsClientNrptRule | Where-Object Comment -eq %s | Remove-DnsClientNrptRule -Force", psQuote(comment(iface)))})
+}
+
+// Clear removes the servers, the suffix and the NRPT rules of the interface
+func Clear(iface string) error {
+	return run(clearCommands(iface))
+}
+
+func run(cmds [][]string) error {
+	for _, args := range cmds {
+		out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %w: %s", strings.Join(args, " "), err, bytes.TrimSpace(out))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package windns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetCommands(t *testing.T) {
+	cmds := setCommands("wg0", []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1"), net.ParseIP("10.0.0.2")}, "corp.example")
+	assert.Equal(t, [][]string{
+		{"netsh", "interface", "ipv4", "delete", "dnsservers", "name=wg0", "address=all", "validate=no"},
+		{"netsh", "interface", "ipv6", "delete", "dnsservers", "name=wg0", "address=all", "validate=no"},
+		{"netsh", "interface", "ipv4", "add", "dnsservers", "name=wg0", "address=10.0.0.1", "index=1", "validate=no"},
+		{"netsh", "interface", "ipv6", "add", "dnsservers", "name=wg0", "address=fd00::1", "index=1", "validate=no"},
+		{"netsh", "interface", "ipv4", "add", "dnsservers", "name=wg0", "address=10.0.0.2", "index=2", "validate=no"},
+		{"powershell", "-NoProfile", "-NonInteractive", "-Command", "Set-DnsClient -InterfaceAlias 'wg0' -ConnectionSpecificSuffix 'corp.example'"},
+	}, cmds)
+}
+
+func TestNRPTCommands(t *testing.T) {
+	cmd := nrptCommand("it's", []string{".corp.example", "corp.example"}, []net.IP{net.ParseIP("10.0.0.1")})
+	assert.Equal(t, "Add-DnsClientNrptRule -Namespace '.corp.example','corp.example' -NameServers '10.0.0.1' -Comment 'wg-quick-go:it''s'", cmd[4])
+
+	cmds := clearCommands("wg0")
+	assert.Equal(t, "Get-DnsClientNrptRule | Where-Object Comment -eq 'wg-quick-go:wg0' | Remove-DnsClientNrptRule -Force", cmds[len(cmds)-1][4])
+	assert.Error(t, AddNRPT("wg0", nil, nil))
+}
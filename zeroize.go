@@ -0,0 +1,32 @@
+package wgquick
+
+import (
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Zeroize wipes the private and preshared keys and unsets them, so the config doesn't change the device keys anymore.
+// It also drops the parsed text kept for MarshalText, which holds the keys in base64. Go strings can't be overwritten,
+// dropping them only lets the garbage collector reclaim the memory.
+func (cfg *Config) Zeroize() {
+	if cfg.PrivateKey != nil {
+		zeroKey(cfg.PrivateKey)
+		cfg.PrivateKey = nil
+	}
+	for i := range cfg.Peers {
+		if cfg.Peers[i].PresharedKey != nil {
+			zeroKey(cfg.Peers[i].PresharedKey)
+			cfg.Peers[i].PresharedKey = nil
+		}
+	}
+	cfg.doc = nil
+}
+
+func zeroKey(key *wgtypes.Key) {
+	*key = wgtypes.Key{}
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,24 @@
+package wgquick_test
+
+import (
+	"testing"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZeroizeKeys(t *testing.T) {
+	c, _, wg := newFakeClient(t, wgquick.ZeroizeKeys())
+	defer c.Close()
+
+	cfg := &wgquick.Config{}
+	require.NoError(t, cfg.UnmarshalText([]byte(testConfig)))
+	key := *cfg.PrivateKey
+	require.NoError(t, c.Sync(cfg, "wg0", testLog))
+	assert.Nil(t, cfg.PrivateKey)
+
+	dev, err := wg.Device("wg0")
+	require.NoError(t, err)
+	assert.Equal(t, key, dev.PrivateKey)
+}
@@ -0,0 +1,25 @@
+package wgquick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestZeroize(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, c.UnmarshalText([]byte(testConfigs["simple"])))
+	key, psk := c.PrivateKey, c.Peers[0].PresharedKey
+	require.NotNil(t, psk)
+	clone := c.clone()
+
+	c.Zeroize()
+	assert.Nil(t, c.PrivateKey)
+	assert.Nil(t, c.Peers[0].PresharedKey)
+	assert.Equal(t, wgtypes.Key{}, *key)
+	assert.Equal(t, wgtypes.Key{}, *psk)
+	assert.NotContains(t, c.StringWithSecrets(), "PrivateKey")
+	assert.NotEqual(t, wgtypes.Key{}, *clone.PrivateKey, "clones have their own keys")
+}